@@ -8,25 +8,32 @@ import (
 
 	"aiguardrails/internal/agent"
 	"aiguardrails/internal/alert"
+	"aiguardrails/internal/approval"
 	"aiguardrails/internal/audit"
 	"aiguardrails/internal/auth"
 	"aiguardrails/internal/config"
+	"aiguardrails/internal/injection"
 	"aiguardrails/internal/mcp"
 	"aiguardrails/internal/opa"
 	"aiguardrails/internal/org"
 	"aiguardrails/internal/policy"
 	"aiguardrails/internal/promptfw"
+	"aiguardrails/internal/proxy"
 	"aiguardrails/internal/rag"
 	"aiguardrails/internal/rbac"
 	"aiguardrails/internal/secret"
 	"aiguardrails/internal/server"
+	"aiguardrails/internal/session"
 	"aiguardrails/internal/store"
 	"aiguardrails/internal/tenant"
 	"aiguardrails/internal/tracing"
 	"aiguardrails/internal/usage"
+	"aiguardrails/internal/vault"
 )
 
 func main() {
+	// Process tools re-execute this binary to confine themselves; it never returns then
+	agent.SandboxInit()
 	cfg := config.FromEnv()
 
 	db, err := store.Open(cfg.DatabaseURL)
@@ -51,7 +58,6 @@ func main() {
 	firewall.WithLLM(llmDet, cfg.OutputMode)
 	capStore := mcp.NewStore(db)
 	mcpBroker := mcp.NewBroker(policyEng, capStore)
-	agentGw := agent.NewGateway(policyEng, firewall)
 	ragSec := rag.NewSecurity(policyEng)
 	usageMeter := usage.NewMeter()
 	rateLimiter := usage.NewRateLimiter(redisClient, cfg.RedisNamespace)
@@ -83,22 +89,76 @@ func main() {
 	}
 	ruleStore := policy.NewRuleStore(db)
 	tenantRuleStore := policy.NewTenantRuleStore(db)
+	injectionDet := injection.NewDetector(tenantRuleStore)
+	firewall.WithInjection(injectionDet)
+	ragSec.WithInjection(injectionDet)
+	ragSec.WithDocumentActions(tenantRuleStore)
 	tenantUserStore := auth.NewTenantUserStore(db)
+	agentOpts := []agent.GatewayOption{
+		agent.WithToolRules(tenantRuleStore),
+		agent.WithSandbox(agent.NewSandbox(time.Duration(cfg.AgentSandboxTimeoutSec)*time.Second, int64(cfg.AgentSandboxMemMB)<<20, nil)),
+	}
+	if cfg.AgentToolsFile != "" {
+		registry := agent.NewRegistry()
+		tools, err := agent.LoadTools(cfg.AgentToolsFile)
+		if err == nil {
+			err = tools.Register(registry, agent.ToolEnv{WorkRoot: cfg.AgentSandboxDir, Secrets: secretProv, Egress: tenantRuleStore, Firewall: firewall})
+		}
+		if err != nil {
+			log.Printf("warning: agent tools not loaded: %v", err)
+		} else {
+			agentOpts = append(agentOpts, agent.WithRegistry(registry))
+		}
+	}
+	approvalPolicies := []agent.ApprovalPolicy{agent.NewPermissionApprovals(tenantRuleStore)}
+	if cfg.AgentPlannerURL != "" {
+		agentOpts = append(agentOpts, agent.WithPlanner(agent.NewOpenAIPlanner(cfg.AgentPlannerURL, cfg.AgentPlannerKey, cfg.AgentPlannerModel, time.Duration(cfg.AgentPlannerTimeoutSec)*time.Second)))
+	}
 	var opaEval *opa.Evaluator
 	if cfg.OPAEnabled {
 		opaEval, err = opa.NewFromDir(cfg.OPARegoPath, cfg.OPADecision, time.Duration(cfg.OPATimeoutSec)*time.Second)
 		if err != nil {
 			log.Printf("warning: opa init failed: %v", err)
+		} else {
+			ragSec.WithAccessPolicy(rag.NewOPAPolicy(opaEval, cfg.OPARAGDocDecision))
+			agentOpts = append(agentOpts, agent.WithCallPolicy(agent.NewOPACallPolicy(opaEval, cfg.OPAAgentToolDecision)))
+			approvalPolicies = append(approvalPolicies, agent.NewOPAApprovalPolicy(opaEval, cfg.OPAAgentApprovalDecision))
 		}
 	}
 
 	// Initialize additional stores for alerts, usage stats, tracing, and orgs
 	alertStore := alert.NewRuleStore(db)
+	notifyDispatcher := alert.NewNotifyDispatcher(alertStore)
+	alertEngine := alert.NewEnhancedEngine(alertStore, notifyDispatcher)
+	alertEngine.Start()
+
+	// Sensitive agent tool calls wait for human approval; resolved requests resume or abort their run
+	approvalSvc := approval.NewService(approval.NewPGStore(db), time.Duration(cfg.AgentApprovalTTLMin)*time.Minute)
+	approvalSvc.WithNotifier(notifyDispatcher, alertStore, cfg.AgentApprovalChannels)
+	approvalSvc.WithAudit(func(event string, fields map[string]string) {
+		auditLog.RecordStore(auditStore, event, fields)
+	})
+	agentOpts = append(agentOpts, agent.WithApprovals(approvalSvc, approvalPolicies...))
+	agentGw := agent.NewGateway(policyEng, firewall, agentOpts...)
+	approvalSvc.OnResolved(func(a *approval.Request) {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), approvalSvc.ResumeTimeout())
+			defer cancel()
+			if resp, err := agentGw.ResumeApproval(ctx, a); resp == nil {
+				log.Printf("agent run %s after approval %s: %v", a.RunID, a.ID, err)
+			}
+		}()
+	})
+	// Start also resumes runs an earlier process resolved but never finished
+	approvalSvc.Start(time.Minute)
 	usageStatStore := usage.NewUsageStore(db)
 	tracingStore := tracing.NewStore(db)
 	orgStore := org.NewStore(db)
+	upstreamStore := proxy.NewStore(db)
+	piiVault := vault.New(redisClient, cfg.RedisNamespace, time.Duration(cfg.VaultTTLMin)*time.Minute)
+	sessionStore := session.NewStore(redisClient, cfg.RedisNamespace, time.Duration(cfg.SessionTTLMin)*time.Minute)
 
-	srv := server.New(cfg, tenantSvc, policyEng, firewall, agentGw, ragSec, usageMeter, rateLimiter, auditLog, auditStore, mcpBroker, capStore, rulesRepo, ruleStore, tenantRuleStore, userStore, tenantUserStore, jwtSigner, opaEval, alertStore, usageStatStore, tracingStore, orgStore)
+	srv := server.New(cfg, tenantSvc, policyEng, firewall, agentGw, ragSec, usageMeter, rateLimiter, auditLog, auditStore, mcpBroker, capStore, rulesRepo, ruleStore, tenantRuleStore, userStore, tenantUserStore, jwtSigner, opaEval, alertStore, alertEngine, usageStatStore, tracingStore, orgStore, upstreamStore, piiVault, sessionStore, approvalSvc)
 	log.Printf("starting API on %s", srv.Addr())
 	if err := http.ListenAndServe(srv.Addr(), srv.Handler()); err != nil {
 		log.Fatal(err)
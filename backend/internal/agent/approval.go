@@ -0,0 +1,163 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"aiguardrails/internal/approval"
+	"aiguardrails/internal/opa"
+	"aiguardrails/internal/policy"
+)
+
+// ApprovalRequirement is the human approval a tool call needs before it runs.
+type ApprovalRequirement struct {
+	Approvers int // distinct approvers needed; 0 runs the call at once
+	Reason    string
+	Signals   []string
+}
+
+// ApprovalPolicy decides which tool calls wait for approval. An error means
+// the call could not be checked.
+type ApprovalPolicy interface {
+	RequireApproval(ctx context.Context, call ToolCall) (ApprovalRequirement, error)
+}
+
+// ApprovalQueue holds the tool calls awaiting approval, e.g. approval.Service.
+type ApprovalQueue interface {
+	Submit(ctx context.Context, r *approval.Request) error
+	SetOutcome(id string, outcome json.RawMessage, reason string) error
+}
+
+// Reasons of runs suspended or stopped for approval.
+const (
+	ReasonApprovalPending     = "approval_pending"
+	ReasonApprovalRequired    = "approval_required" // no queue to hold the call
+	ReasonApprovalDenied      = "approval_denied"
+	ReasonApprovalExpired     = "approval_expired"
+	ReasonApprovalUnavailable = "approval_policy_unavailable"
+)
+
+// PendingApproval is the tool call a suspended run waits on.
+type PendingApproval struct {
+	ID        string    `json:"id"`
+	Tool      string    `json:"tool"`
+	Approvers int       `json:"approvers"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// suspendedRun is the state of a run saved with its approval request.
+type suspendedRun struct {
+	Request       PlanRequest   `json:"request"`
+	Steps         []Step        `json:"steps"`
+	Step          Step          `json:"step"` // the step awaiting approval
+	Action        Action        `json:"action"`
+	MaxIterations int           `json:"max_iterations"`
+	Elapsed       time.Duration `json:"elapsed"`
+}
+
+// requester is who asks for a run's approvals: the authenticated app. The
+// user_id an app reports is its own claim, so it decides nothing.
+func requester(req PlanRequest) string {
+	if req.AppID == "" {
+		return ""
+	}
+	return "app:" + req.AppID
+}
+
+// ToolPermissions resolves a tenant's tool permissions by tool name.
+type ToolPermissions interface {
+	ToolPermissions(tenantID string) map[string]policy.ToolPermConfig
+}
+
+// PermissionApprovals requires approval of the tools a tenant's permission
+// rules mark requires_confirmation or requires_mfa. Calls need the
+// configured number of approvers, else one, or two distinct approvers for
+// requires_mfa: the platform has no second factor of its own, so a second
+// person stands in for it.
+type PermissionApprovals struct {
+	perms ToolPermissions
+}
+
+// NewPermissionApprovals constructs PermissionApprovals.
+func NewPermissionApprovals(p ToolPermissions) *PermissionApprovals {
+	return &PermissionApprovals{perms: p}
+}
+
+func (p *PermissionApprovals) RequireApproval(_ context.Context, call ToolCall) (ApprovalRequirement, error) {
+	cfg, ok := p.perms.ToolPermissions(call.TenantID)[call.Tool]
+	if !ok || !(cfg.RequiresConfirmation || cfg.RequiresMFA || cfg.Approvers > 0) {
+		return ApprovalRequirement{}, nil
+	}
+	req := ApprovalRequirement{Approvers: cfg.Approvers, Reason: ReasonApprovalRequired, Signals: []string{call.Tool}}
+	if cfg.RequiresConfirmation {
+		req.Signals = append(req.Signals, "requires_confirmation")
+	}
+	if cfg.RequiresMFA {
+		req.Signals = append(req.Signals, "requires_mfa")
+	}
+	if req.Approvers <= 0 {
+		req.Approvers = 1
+		if cfg.RequiresMFA {
+			req.Approvers = 2
+		}
+	}
+	return req, nil
+}
+
+// OPAApprovalPolicy evaluates tool calls with OPA in mode "agent_tool". The
+// decision is an object {"approvers", "reason", "signals"}, such as the
+// agent_approval rule of the bundled policies, or true for one approver;
+// an undefined decision needs no approval.
+type OPAApprovalPolicy struct {
+	eval     *opa.Evaluator
+	decision string
+}
+
+// NewOPAApprovalPolicy constructs OPAApprovalPolicy; decision is the query, e.g. data.guardrails.agent_approval.
+func NewOPAApprovalPolicy(eval *opa.Evaluator, decision string) *OPAApprovalPolicy {
+	return &OPAApprovalPolicy{eval: eval, decision: decision}
+}
+
+func (p *OPAApprovalPolicy) RequireApproval(ctx context.Context, call ToolCall) (ApprovalRequirement, error) {
+	val, err := p.eval.Query(ctx, p.decision, opa.Input{
+		TenantID:     call.TenantID,
+		Mode:         "agent_tool",
+		Tool:         call.Tool,
+		Args:         asJSON(call.Args),
+		AllowedTools: call.AllowedTools,
+		Step:         call.Step,
+		MaxSteps:     call.MaxSteps,
+	})
+	if errors.Is(err, opa.ErrUndefined) {
+		return ApprovalRequirement{}, nil
+	}
+	if err != nil {
+		return ApprovalRequirement{}, err
+	}
+	switch v := val.(type) {
+	case bool:
+		if v {
+			return ApprovalRequirement{Approvers: 1, Reason: ReasonApprovalRequired, Signals: []string{call.Tool}}, nil
+		}
+		return ApprovalRequirement{}, nil
+	case map[string]interface{}:
+		req := ApprovalRequirement{Approvers: 1, Reason: ReasonApprovalRequired}
+		if n, ok := opa.Int(v["approvers"]); ok {
+			req.Approvers = n
+		}
+		if r, ok := v["reason"].(string); ok && r != "" {
+			req.Reason = r
+		}
+		if sigs, ok := v["signals"].([]interface{}); ok {
+			for _, s := range sigs {
+				req.Signals = append(req.Signals, fmt.Sprint(s))
+			}
+		}
+		return req, nil
+	default:
+		return ApprovalRequirement{}, fmt.Errorf("agent approval decision: unexpected type %T", val)
+	}
+}
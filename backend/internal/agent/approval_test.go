@@ -0,0 +1,46 @@
+package agent
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"aiguardrails/internal/opa"
+)
+
+func TestOPAApprovalPolicy(t *testing.T) {
+	eval, err := opa.NewFromDir(filepath.Join("..", "..", "opa", "policies"), "data.guardrails.allow", 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewOPAApprovalPolicy(eval, "data.guardrails.agent_approval")
+	cases := []struct {
+		tool      string
+		approvers int
+	}{
+		{"read_status", 0},
+		{"lookup_order", 0},
+		{"set_parameter", 1},
+		{"start_stop", 2},
+		{"safety_override", 2},
+	}
+	for _, tc := range cases {
+		req, err := p.RequireApproval(context.Background(), ToolCall{TenantID: "t1", Tool: tc.tool, AllowedTools: []string{tc.tool}, Step: 1, MaxSteps: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req.Approvers != tc.approvers {
+			t.Fatalf("%s: expected %d approvers, got %+v", tc.tool, tc.approvers, req)
+		}
+		if tc.approvers > 0 && (req.Reason != ReasonApprovalRequired || len(req.Signals) == 0 || req.Signals[0] != tc.tool) {
+			t.Fatalf("%s: unexpected requirement %+v", tc.tool, req)
+		}
+	}
+
+	// Calls the bundled deny rules check are not held for approval.
+	if vs, err := NewOPACallPolicy(eval, "data.guardrails.deny_reason").CheckCall(context.Background(),
+		ToolCall{TenantID: "t1", Tool: "set_parameter", AllowedTools: []string{"set_parameter"}, Step: 1, MaxSteps: 10}); err != nil || len(vs) != 0 {
+		t.Fatalf("approval tools must pass the call policy: %v %v", vs, err)
+	}
+}
@@ -0,0 +1,253 @@
+package agent
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"aiguardrails/internal/policy"
+)
+
+// AnyTool is the tool name of argument rules applying to every tool.
+const AnyTool = "*"
+
+// ToolRules resolves a tenant's argument rules by tool name.
+type ToolRules interface {
+	AgentToolRules(tenantID string) map[string]*policy.ToolArgRuleConfig
+}
+
+// Argument rule names reported in violations.
+const (
+	RuleMin           = "min"
+	RuleMax           = "max"
+	RulePattern       = "pattern"
+	RuleDenyPattern   = "deny_pattern"
+	RuleMaxLength     = "max_length"
+	RuleForbiddenPath = "forbidden_path"
+	RuleForbiddenHost = "forbidden_host"
+)
+
+// ValidateToolRules checks the tools of a tenant's agent_tools rule.
+func ValidateToolRules(rules map[string]*policy.ToolArgRuleConfig) error {
+	for tool, cfg := range rules {
+		if cfg == nil {
+			continue
+		}
+		for arg, r := range cfg.Args {
+			if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+				return fmt.Errorf("agent_tools.%s.args.%s: min %v above max %v", tool, arg, *r.Min, *r.Max)
+			}
+			if r.MaxLength < 0 {
+				return fmt.Errorf("agent_tools.%s.args.%s: negative max_length", tool, arg)
+			}
+			for _, p := range []string{r.Pattern, r.DenyPattern} {
+				if _, err := regexp.Compile(p); err != nil {
+					return fmt.Errorf("agent_tools.%s.args.%s: %v", tool, arg, err)
+				}
+			}
+		}
+		for _, p := range cfg.ForbiddenPaths {
+			if strings.TrimSpace(p) == "" {
+				return fmt.Errorf("agent_tools.%s: empty forbidden path", tool)
+			}
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("agent_tools.%s: forbidden path %q: %v", tool, p, err)
+			}
+		}
+		for _, h := range cfg.ForbiddenHosts {
+			if strings.TrimSpace(h) == "" {
+				return fmt.Errorf("agent_tools.%s: empty forbidden host", tool)
+			}
+			if strings.Contains(h, "/") {
+				if _, _, err := net.ParseCIDR(h); err != nil {
+					return fmt.Errorf("agent_tools.%s: forbidden host %q: %v", tool, h, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// CheckArgs applies the rules for tool, and those for AnyTool, to args.
+func CheckArgs(rules map[string]*policy.ToolArgRuleConfig, tool string, args map[string]interface{}) []Violation {
+	var out []Violation
+	for _, name := range []string{AnyTool, tool} {
+		cfg := rules[name]
+		if cfg == nil {
+			continue
+		}
+		walkArgs(asJSON(args), "", "", func(p, key string, v interface{}) {
+			if r, ok := cfg.Args[key]; ok {
+				out = append(out, checkArg(r, p, v)...)
+			}
+			if s, ok := v.(string); ok {
+				out = append(out, checkTargets(cfg, p, s)...)
+			}
+		})
+	}
+	return out
+}
+
+// walkArgs calls fn with each scalar in v, its path ("ids[2]") and its rule
+// key, the path without array indices ("ids").
+func walkArgs(v interface{}, p, key string, fn func(p, key string, v interface{})) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			walkArgs(val[k], joinPath(p, k), joinPath(key, k), fn)
+		}
+	case []interface{}:
+		for i, item := range val {
+			walkArgs(item, fmt.Sprintf("%s[%d]", p, i), key, fn)
+		}
+	default:
+		fn(p, key, v)
+	}
+}
+
+func checkArg(r policy.ArgRuleConfig, p string, v interface{}) []Violation {
+	var out []Violation
+	add := func(rule, format string, a ...interface{}) {
+		out = append(out, Violation{Path: p, Rule: rule, Message: fmt.Sprintf(format, a...)})
+	}
+	if v == nil {
+		return nil
+	}
+	s, isString := v.(string)
+	if !isString {
+		s = fmt.Sprint(v)
+	}
+	if r.Min != nil || r.Max != nil {
+		f, ok := number(v)
+		if !ok && isString {
+			var err error
+			f, err = strconv.ParseFloat(strings.TrimSpace(s), 64)
+			ok = err == nil
+		}
+		switch {
+		case !ok:
+			add(RuleMin, "%s is not a number", preview(v))
+		case r.Min != nil && f < *r.Min:
+			add(RuleMin, "%v below %v", f, *r.Min)
+		case r.Max != nil && f > *r.Max:
+			add(RuleMax, "%v above %v", f, *r.Max)
+		}
+	}
+	if r.Pattern != "" {
+		if re, err := regexp.Compile(r.Pattern); err == nil && !re.MatchString(s) {
+			add(RulePattern, "%s does not match %q", preview(v), r.Pattern)
+		}
+	}
+	if r.DenyPattern != "" {
+		if re, err := regexp.Compile(r.DenyPattern); err == nil && re.MatchString(s) {
+			add(RuleDenyPattern, "%s matches %q", preview(v), r.DenyPattern)
+		}
+	}
+	if r.MaxLength > 0 && utf8.RuneCountInString(s) > r.MaxLength {
+		add(RuleMaxLength, "length %d above %d", utf8.RuneCountInString(s), r.MaxLength)
+	}
+	return out
+}
+
+// checkTargets checks a string argument that names a file or a host
+// against the forbidden paths and hosts.
+func checkTargets(cfg *policy.ToolArgRuleConfig, p, s string) []Violation {
+	if len(cfg.ForbiddenPaths) == 0 && len(cfg.ForbiddenHosts) == 0 {
+		return nil
+	}
+	s = strings.TrimSpace(s)
+	var out []Violation
+	host, filePath := targets(s)
+	if host != "" {
+		for _, h := range cfg.ForbiddenHosts {
+			if hostMatches(host, h) {
+				out = append(out, Violation{Path: p, Rule: RuleForbiddenHost, Message: fmt.Sprintf("host %s is forbidden (%s)", host, h)})
+				break
+			}
+		}
+	}
+	if filePath != "" {
+		for _, fp := range cfg.ForbiddenPaths {
+			if pathMatches(filePath, fp) {
+				out = append(out, Violation{Path: p, Rule: RuleForbiddenPath, Message: fmt.Sprintf("path %s is forbidden (%s)", filePath, fp)})
+				break
+			}
+		}
+	}
+	return out
+}
+
+var hostLike = regexp.MustCompile(`^(?:\[[0-9a-fA-F:.]+\]|[A-Za-z0-9](?:[A-Za-z0-9.-]*[A-Za-z0-9])?)(?::\d+)?$`)
+
+// targets returns the host and the file path s names, if any: the host of
+// a URL or host[:port], the path of a file URL or of a string that looks
+// like a path, cleaned so that "a/../../etc" reads "../etc".
+func targets(s string) (host, filePath string) {
+	if strings.Contains(s, "://") {
+		u, err := url.Parse(s)
+		if err != nil {
+			return "", ""
+		}
+		if strings.EqualFold(u.Scheme, "file") {
+			return u.Hostname(), cleanPath(u.Path)
+		}
+		return u.Hostname(), ""
+	}
+	if strings.ContainsAny(s, "/\\") || strings.HasPrefix(s, "~") || s == ".." {
+		return "", cleanPath(s)
+	}
+	if hostLike.MatchString(s) && (strings.Contains(s, ".") || strings.Contains(s, ":") || strings.EqualFold(s, "localhost")) {
+		if h, _, err := net.SplitHostPort(s); err == nil {
+			return strings.Trim(h, "[]"), ""
+		}
+		return strings.Trim(s, "[]"), ""
+	}
+	return "", ""
+}
+
+func cleanPath(p string) string {
+	return path.Clean(strings.ReplaceAll(p, "\\", "/"))
+}
+
+// pathMatches reports whether p is the forbidden path or lies under it; a
+// pattern with wildcards matches the whole path or its base name.
+func pathMatches(p, forbidden string) bool {
+	if strings.ContainsAny(forbidden, "*?[") {
+		if ok, _ := path.Match(forbidden, p); ok {
+			return true
+		}
+		ok, _ := path.Match(forbidden, path.Base(p))
+		return ok
+	}
+	f := cleanPath(forbidden)
+	return p == f || strings.HasPrefix(p, strings.TrimSuffix(f, "/")+"/")
+}
+
+// hostMatches reports whether host is the forbidden host, a subdomain of
+// it, or an IP inside a forbidden CIDR.
+func hostMatches(host, forbidden string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	forbidden = strings.ToLower(strings.TrimSpace(forbidden))
+	if strings.Contains(forbidden, "/") {
+		_, cidr, err := net.ParseCIDR(forbidden)
+		ip := net.ParseIP(host)
+		return err == nil && ip != nil && cidr.Contains(ip)
+	}
+	if fip := net.ParseIP(forbidden); fip != nil {
+		ip := net.ParseIP(host)
+		return ip != nil && ip.Equal(fip)
+	}
+	forbidden = strings.TrimPrefix(forbidden, "*.")
+	return host == forbidden || strings.HasSuffix(host, "."+forbidden)
+}
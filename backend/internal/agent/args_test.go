@@ -0,0 +1,147 @@
+package agent
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"aiguardrails/internal/opa"
+	"aiguardrails/internal/policy"
+)
+
+func float(v float64) *float64 { return &v }
+
+func TestCheckArgs(t *testing.T) {
+	rules := map[string]*policy.ToolArgRuleConfig{
+		AnyTool: {ForbiddenHosts: []string{"169.254.169.254", "10.0.0.0/8", "internal.example.com"}},
+		"read_file": {
+			Args:           map[string]policy.ArgRuleConfig{"encoding": {Pattern: "^(utf-8|ascii)$"}},
+			ForbiddenPaths: []string{"/etc", "~/.ssh", "..", "*.pem"},
+		},
+		"search": {Args: map[string]policy.ArgRuleConfig{
+			"limit":        {Min: float(1), Max: float(100)},
+			"query":        {MaxLength: 10, DenyPattern: "(?i)drop\\s+table"},
+			"filter.owner": {Pattern: "^[a-z]+$"},
+		}},
+	}
+	cases := []struct {
+		tool string
+		args map[string]interface{}
+		path string
+		rule string
+	}{
+		{"search", map[string]interface{}{"limit": 500}, "limit", RuleMax},
+		{"search", map[string]interface{}{"limit": "0"}, "limit", RuleMin},
+		{"search", map[string]interface{}{"limit": "lots"}, "limit", RuleMin},
+		{"search", map[string]interface{}{"query": "DROP table"}, "query", RuleDenyPattern},
+		{"search", map[string]interface{}{"query": "a long query"}, "query", RuleMaxLength},
+		{"search", map[string]interface{}{"filter": map[string]interface{}{"owner": "Robert'); --"}}, "filter.owner", RulePattern},
+		{"fetch", map[string]interface{}{"url": "http://169.254.169.254/latest"}, "url", RuleForbiddenHost},
+		{"fetch", map[string]interface{}{"urls": []string{"https://ok.example.com", "http://10.1.2.3:8080/admin"}}, "urls[1]", RuleForbiddenHost},
+		{"fetch", map[string]interface{}{"host": "db.internal.example.com:5432"}, "host", RuleForbiddenHost},
+		{"read_file", map[string]interface{}{"path": "/etc/passwd"}, "path", RuleForbiddenPath},
+		{"read_file", map[string]interface{}{"path": "/srv/app/../../etc/shadow"}, "path", RuleForbiddenPath},
+		{"read_file", map[string]interface{}{"path": "reports/../../secret.txt"}, "path", RuleForbiddenPath},
+		{"read_file", map[string]interface{}{"path": "~/.ssh/id_rsa"}, "path", RuleForbiddenPath},
+		{"read_file", map[string]interface{}{"path": "C:\\certs\\server.pem"}, "path", RuleForbiddenPath},
+		{"read_file", map[string]interface{}{"path": "file:///etc/hosts"}, "path", RuleForbiddenPath},
+		{"read_file", map[string]interface{}{"path": "/srv/app/a.txt", "encoding": "utf-16"}, "encoding", RulePattern},
+	}
+	for _, tc := range cases {
+		vs := CheckArgs(rules, tc.tool, tc.args)
+		if len(vs) != 1 || vs[0].Path != tc.path || vs[0].Rule != tc.rule {
+			t.Fatalf("%s %v: expected %s %s, got %v", tc.tool, tc.args, tc.path, tc.rule, vs)
+		}
+	}
+
+	allowed := []struct {
+		tool string
+		args map[string]interface{}
+	}{
+		{"search", map[string]interface{}{"limit": 20, "query": "orders", "filter": map[string]interface{}{"owner": "alice"}}},
+		{"read_file", map[string]interface{}{"path": "/srv/app/etc/config.yaml", "encoding": "utf-8"}},
+		{"fetch", map[string]interface{}{"url": "https://example.com/internal.example.com", "note": "see /etc for details? no"}},
+		{"fetch", map[string]interface{}{"host": "notinternal.example.com"}},
+	}
+	for _, tc := range allowed {
+		if vs := CheckArgs(rules, tc.tool, tc.args); len(vs) != 0 {
+			t.Fatalf("%s %v: unexpected violations %v", tc.tool, tc.args, vs)
+		}
+	}
+}
+
+func TestValidateToolRules(t *testing.T) {
+	valid := map[string]*policy.ToolArgRuleConfig{"search": {
+		Args:           map[string]policy.ArgRuleConfig{"limit": {Min: float(1), Max: float(10)}},
+		ForbiddenPaths: []string{"/etc", "*.pem"},
+		ForbiddenHosts: []string{"10.0.0.0/8", "example.com"},
+	}}
+	if err := ValidateToolRules(valid); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, bad := range []*policy.ToolArgRuleConfig{
+		{Args: map[string]policy.ArgRuleConfig{"limit": {Min: float(10), Max: float(1)}}},
+		{Args: map[string]policy.ArgRuleConfig{"q": {DenyPattern: "[a-"}}},
+		{ForbiddenPaths: []string{"[unclosed"}},
+		{ForbiddenHosts: []string{"10.0.0.0/33"}},
+	} {
+		if err := ValidateToolRules(map[string]*policy.ToolArgRuleConfig{"t": bad}); err == nil {
+			t.Fatalf("expected error for %+v", bad)
+		}
+	}
+}
+
+func TestValidateEgress(t *testing.T) {
+	for _, bad := range [][]string{
+		{"10.0.0.0/33"},
+		{"internal:10.0.0.0/8"},
+	} {
+		if err := ValidateEgress(bad); err == nil {
+			t.Fatalf("expected error for %v", bad)
+		}
+	}
+	if err := ValidateEgress([]string{"internal:orders.internal", "10.20.0.0/16"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestOPACallPolicy(t *testing.T) {
+	eval, err := opa.NewFromDir(filepath.Join("..", "..", "opa", "policies"), "data.guardrails.allow", 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewOPACallPolicy(eval, "data.guardrails.deny_reason")
+	check := func(call ToolCall) []Violation {
+		t.Helper()
+		vs, err := p.CheckCall(context.Background(), call)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return vs
+	}
+	call := ToolCall{TenantID: "t1", Tool: "fetch", AllowedTools: []string{"fetch"}, Step: 1, MaxSteps: 10}
+
+	call.Args = map[string]interface{}{"url": "https://example.com/orders/42"}
+	if vs := check(call); len(vs) != 0 {
+		t.Fatalf("unexpected violations: %v", vs)
+	}
+	call.Args = map[string]interface{}{"url": "http://169.254.169.254/latest/meta-data"}
+	if vs := check(call); len(vs) != 1 || vs[0].Rule != "opa_agent_tool_private_url" || vs[0].Message != "url" {
+		t.Fatalf("expected private url violation: %v", vs)
+	}
+	call.Args = map[string]interface{}{"files": []string{"a.txt", "../../etc/passwd"}}
+	if vs := check(call); len(vs) != 1 || vs[0].Rule != "opa_agent_tool_path_traversal" || vs[0].Message != "files.1" {
+		t.Fatalf("expected path traversal violation: %v", vs)
+	}
+	call.Args, call.AllowedTools = nil, []string{"search"}
+	if vs := check(call); len(vs) != 1 || vs[0].Rule != "opa_agent_tool_not_allowed" {
+		t.Fatalf("expected tool allowlist violation: %v", vs)
+	}
+
+	// Modules without the decision allow every call.
+	undefined := NewOPACallPolicy(eval, "data.guardrails.no_such_rule")
+	if vs, err := undefined.CheckCall(context.Background(), call); err != nil || len(vs) != 0 {
+		t.Fatalf("expected undefined decision to allow: %v %v", vs, err)
+	}
+}
@@ -0,0 +1,88 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"aiguardrails/internal/opa"
+)
+
+// ToolCall is one tool call the planner asked for.
+type ToolCall struct {
+	TenantID     string
+	Tool         string
+	Args         map[string]interface{}
+	AllowedTools []string // tools offered in this run
+	Step         int
+	MaxSteps     int
+}
+
+// CallPolicy is an external check of tool calls, such as OPA. It returns the
+// violations of a call; an error means the call could not be checked.
+type CallPolicy interface {
+	CheckCall(ctx context.Context, call ToolCall) ([]Violation, error)
+}
+
+// OPACallPolicy evaluates tool calls with OPA in mode "agent_tool". The
+// decision is a set of {"reason", "signals"} messages, such as the
+// deny_reason rules of the bundled policies; modules that do not define it
+// allow every call.
+type OPACallPolicy struct {
+	eval     *opa.Evaluator
+	decision string
+}
+
+// NewOPACallPolicy constructs OPACallPolicy; decision is the query, e.g. data.guardrails.deny_reason.
+func NewOPACallPolicy(eval *opa.Evaluator, decision string) *OPACallPolicy {
+	return &OPACallPolicy{eval: eval, decision: decision}
+}
+
+func (p *OPACallPolicy) CheckCall(ctx context.Context, call ToolCall) ([]Violation, error) {
+	val, err := p.eval.Query(ctx, p.decision, opa.Input{
+		TenantID:     call.TenantID,
+		Mode:         "agent_tool",
+		Tool:         call.Tool,
+		Args:         asJSON(call.Args),
+		AllowedTools: call.AllowedTools,
+		Step:         call.Step,
+		MaxSteps:     call.MaxSteps,
+	})
+	if errors.Is(err, opa.ErrUndefined) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var items []interface{}
+	switch v := val.(type) {
+	case []interface{}:
+		items = v
+	case bool:
+		// An allow-style decision carries no reasons.
+		if !v {
+			return []Violation{{Rule: "opa_agent_tool_denied", Message: "denied by policy"}}, nil
+		}
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("agent_tool decision: unexpected type %T", val)
+	}
+	var out []Violation
+	for _, item := range items {
+		m, _ := item.(map[string]interface{})
+		v := Violation{Rule: "opa_agent_tool_denied", Message: "denied by policy"}
+		if r, ok := m["reason"].(string); ok && r != "" {
+			v.Rule = r
+		}
+		if sigs, ok := m["signals"].([]interface{}); ok && len(sigs) > 0 {
+			parts := make([]string, 0, len(sigs))
+			for _, s := range sigs {
+				parts = append(parts, fmt.Sprint(s))
+			}
+			v.Message = strings.Join(parts, ", ")
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
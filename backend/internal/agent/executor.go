@@ -8,6 +8,20 @@ import (
 
 var ErrExecutorNotFound = errors.New("executor not found")
 
+type tenantKey struct{}
+
+// WithTenant returns a context naming the tenant a tool runs for; the
+// gateway passes it to executors.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant a tool runs for.
+func TenantFromContext(ctx context.Context) string {
+	v, _ := ctx.Value(tenantKey{}).(string)
+	return v
+}
+
 // Executor defines interface for tool execution.
 type Executor interface {
 	// Execute runs the tool with given arguments.
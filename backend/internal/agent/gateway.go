@@ -2,11 +2,18 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
+
+	"aiguardrails/internal/approval"
 	"aiguardrails/internal/policy"
 	"aiguardrails/internal/promptfw"
 	"aiguardrails/internal/types"
@@ -22,39 +29,82 @@ type Step struct {
 	Duration    time.Duration `json:"duration_ms"`
 	Blocked     bool          `json:"blocked,omitempty"`
 	BlockReason string        `json:"block_reason,omitempty"`
+	// BlockedAt is the part of the step the guardrail stopped: thought, action, observation or final.
+	BlockedAt string `json:"blocked_at,omitempty"`
+	// Violations are the reasons a tool call's arguments were rejected.
+	Violations []Violation `json:"violations,omitempty"`
+	// Approval is the approval request the step's tool call waited for.
+	Approval string `json:"approval,omitempty"`
 }
 
+// Parts of a step the firewall screens.
+const (
+	PhaseThought     = "thought"
+	PhaseAction      = "action"
+	PhaseObservation = "observation"
+	PhaseFinal       = "final"
+)
+
+// maxObservationBytes bounds a tool result fed back to the planner.
+const maxObservationBytes = 8 * 1024
+
 // PlanRequest is input to PlanAndAct.
 type PlanRequest struct {
-	TenantID      string            `json:"tenant_id"`
-	Prompt        string            `json:"prompt"`
+	TenantID string `json:"tenant_id"`
+	Prompt   string `json:"prompt"`
+	// Tools limits the run to these registered tools; empty offers every tool the
+	// tenant may use. Without a configured planner they are called once, in order.
 	Tools         []string          `json:"tools"`
 	MaxIterations int               `json:"max_iterations,omitempty"`
 	Timeout       time.Duration     `json:"timeout,omitempty"`
 	Context       map[string]string `json:"context,omitempty"`
+	// AppID is the authenticated calling app, the requester of the run's
+	// approvals; UserID the user the agent acts for, as the app reports it.
+	AppID  string `json:"app_id,omitempty"`
+	UserID string `json:"user_id,omitempty"`
 }
 
 // PlanResponse is the result of PlanAndAct.
 type PlanResponse struct {
+	RunID       string        `json:"run_id,omitempty"`
 	Allowed     bool          `json:"allowed"`
 	Reason      string        `json:"reason,omitempty"`
 	Steps       []Step        `json:"steps"`
 	FinalResult interface{}   `json:"final_result,omitempty"`
 	TotalTime   time.Duration `json:"total_time_ms"`
 	Signals     []string      `json:"signals,omitempty"`
+	// Approval is the tool call a suspended run waits on.
+	Approval *PendingApproval `json:"approval,omitempty"`
 }
 
-// Metrics tracks agent execution stats.
+// Errors ending a run early; the response carries the reason.
+var (
+	ErrPromptRejected = errors.New("prompt rejected")
+	ErrToolBlocked    = errors.New("tool blocked by policy")
+	ErrStepBlocked    = errors.New("agent step blocked by guardrail")
+	ErrMaxIterations  = errors.New("agent did not finish within max iterations")
+	ErrNoPlanner      = errors.New("no planner configured")
+	// ErrApprovalPending means the run is suspended until a tool call is approved.
+	ErrApprovalPending = errors.New("tool call awaiting approval")
+)
+
+// Metrics is a snapshot of agent execution stats.
 type Metrics struct {
-	mu              sync.Mutex
-	TotalExecutions int64
-	TotalBlocked    int64
-	AvgIterations   float64
+	TotalExecutions int64   `json:"total_executions"`
+	TotalBlocked    int64   `json:"total_blocked"`
+	AvgIterations   float64 `json:"avg_iterations"`
+}
+
+// metricsRecorder accumulates Metrics.
+type metricsRecorder struct {
+	mu sync.Mutex
+	m  Metrics
 }
 
-func (m *Metrics) record(blocked bool, iterations int) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+func (r *metricsRecorder) record(blocked bool, iterations int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := &r.m
 	m.TotalExecutions++
 	if blocked {
 		m.TotalBlocked++
@@ -68,9 +118,15 @@ type Gateway struct {
 	firewall       *promptfw.Firewall
 	sandbox        *Sandbox
 	registry       *Registry
-	metrics        *Metrics
+	planner        LLMPlanner
+	toolRules      ToolRules
+	callPolicy     CallPolicy
+	metrics        *metricsRecorder
 	defaultMaxIter int
 	defaultTimeout time.Duration
+	// Tool calls held for human approval
+	approvals        ApprovalQueue
+	approvalPolicies []ApprovalPolicy
 }
 
 // GatewayOption configures Gateway.
@@ -86,6 +142,30 @@ func WithRegistry(r *Registry) GatewayOption {
 	return func(g *Gateway) { g.registry = r }
 }
 
+// WithPlanner sets the planner choosing each action.
+func WithPlanner(p LLMPlanner) GatewayOption {
+	return func(g *Gateway) { g.planner = p }
+}
+
+// WithToolRules sets each tenant's tool argument rules.
+func WithToolRules(r ToolRules) GatewayOption {
+	return func(g *Gateway) { g.toolRules = r }
+}
+
+// WithCallPolicy adds an external check of every tool call, e.g. OPA.
+func WithCallPolicy(p CallPolicy) GatewayOption {
+	return func(g *Gateway) { g.callPolicy = p }
+}
+
+// WithApprovals holds the tool calls the policies require approval of in
+// the queue, suspending the run until they are resolved.
+func WithApprovals(q ApprovalQueue, policies ...ApprovalPolicy) GatewayOption {
+	return func(g *Gateway) {
+		g.approvals = q
+		g.approvalPolicies = append(g.approvalPolicies, policies...)
+	}
+}
+
 // WithDefaults sets default max iterations and timeout.
 func WithDefaults(maxIter int, timeout time.Duration) GatewayOption {
 	return func(g *Gateway) {
@@ -101,7 +181,7 @@ func NewGateway(p policy.Engine, fw *promptfw.Firewall, opts ...GatewayOption) *
 		firewall:       fw,
 		sandbox:        NewSandbox(30*time.Second, 128*1024*1024, nil),
 		registry:       NewRegistry(),
-		metrics:        &Metrics{},
+		metrics:        &metricsRecorder{},
 		defaultMaxIter: 10,
 		defaultTimeout: 60 * time.Second,
 	}
@@ -111,138 +191,447 @@ func NewGateway(p policy.Engine, fw *promptfw.Firewall, opts ...GatewayOption) *
 	return g
 }
 
+// Registry returns the gateway's tool registry.
+func (g *Gateway) Registry() *Registry {
+	return g.registry
+}
+
 // GetMetrics returns current metrics.
 func (g *Gateway) GetMetrics() Metrics {
 	g.metrics.mu.Lock()
 	defer g.metrics.mu.Unlock()
-	return *g.metrics
+	return g.metrics.m
 }
 
-// PlanAndAct implements ReAct loop with guardrail enforcement.
-func (g *Gateway) PlanAndAct(ctx context.Context, req PlanRequest) (*PlanResponse, error) {
-	start := time.Now()
-	resp := &PlanResponse{Steps: []Step{}}
+// tools returns the registered tools the tenant may call in this run, by name.
+func (g *Gateway) tools(tenantID string, only []string) []ToolDescription {
+	var out []ToolDescription
+	for _, d := range g.registry.Describe() {
+		if len(only) > 0 && !containsName(only, d.Name) {
+			continue
+		}
+		if g.policy.AllowTool(tenantID, d.Name) && g.sandbox.ValidateTool(d.Name) == nil {
+			out = append(out, d)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
 
-	// Set defaults
-	maxIter := req.MaxIterations
-	if maxIter <= 0 {
-		maxIter = g.defaultMaxIter
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
 	}
-	timeout := req.Timeout
-	if timeout <= 0 {
-		timeout = g.defaultTimeout
+	return false
+}
+
+func containsTool(tools []ToolDescription, name string) bool {
+	for _, t := range tools {
+		if t.Name == name {
+			return true
+		}
 	}
+	return false
+}
 
-	// Create timeout context
-	ctx, cancel := context.WithTimeout(ctx, timeout)
+// PlanAndAct runs the ReAct loop behind the guardrail. The planner chooses
+// each action from the tools the tenant may use; the gateway runs the tool
+// from the registry in the sandbox. The prompt, every thought, the tool and
+// arguments of every action, every observation and the final answer pass the
+// firewall, and the first one it rejects ends the run. Tool calls must also
+// match the tool's schema, the tenant's argument rules and the call policy.
+// A call the approval policies hold suspends the run: the response carries
+// the pending approval and ErrApprovalPending, and ResumeApproval goes on
+// once the approval is resolved.
+func (g *Gateway) PlanAndAct(ctx context.Context, req PlanRequest) (*PlanResponse, error) {
+	r := g.newRun(req, uuid.NewString())
+	ctx, cancel := context.WithTimeout(ctx, g.timeout(req))
 	defer cancel()
 
-	// Phase 1: Check prompt
-	check := g.firewall.CheckPrompt(req.TenantID, req.Prompt, []string{})
-	if !check.Allowed {
-		resp.Allowed = false
-		resp.Reason = check.Reason
-		resp.Signals = check.Signals
-		resp.TotalTime = time.Since(start)
-		g.metrics.record(true, 0)
-		return resp, errors.New("prompt rejected")
+	if check := g.firewall.CheckPrompt(req.TenantID, req.Prompt, nil); !check.Allowed {
+		return r.finish(check.Reason, check.Signals, ErrPromptRejected)
 	}
 
-	// Phase 2: Validate all proposed tools
+	// Tools named by the caller must all be usable.
 	for _, tool := range req.Tools {
 		if !g.policy.AllowTool(req.TenantID, tool) {
-			resp.Allowed = false
-			resp.Reason = "tool_not_allowed"
-			resp.Signals = []string{tool}
-			resp.TotalTime = time.Since(start)
-			g.metrics.record(true, 0)
-			return resp, errors.New("tool blocked by policy")
+			return r.finish("tool_not_allowed", []string{tool}, ErrToolBlocked)
 		}
 		if err := g.sandbox.ValidateTool(tool); err != nil {
-			resp.Allowed = false
-			resp.Reason = "tool_sandbox_rejected"
-			resp.Signals = []string{tool, err.Error()}
-			resp.TotalTime = time.Since(start)
-			g.metrics.record(true, 0)
-			return resp, err
+			return r.finish("tool_sandbox_rejected", []string{tool, err.Error()}, err)
+		}
+		if _, err := g.registry.Get(tool); err != nil {
+			return r.finish("tool_not_registered", []string{tool}, err)
 		}
 	}
 
-	// Phase 3: ReAct loop
-	for i := 0; i < maxIter; i++ {
-		select {
-		case <-ctx.Done():
-			resp.Allowed = false
-			resp.Reason = "timeout"
-			resp.TotalTime = time.Since(start)
-			g.metrics.record(true, i)
-			return resp, ctx.Err()
-		default:
+	if !r.prepare() {
+		return r.finish("no_planner", nil, ErrNoPlanner)
+	}
+	return r.loop(ctx, 0, nil)
+}
+
+// ResumeApproval continues the run suspended on the resolved request a. An
+// approved call is checked again, without asking for approval, and runs;
+// a denied or expired one ends the run. The outcome is saved on the request.
+func (g *Gateway) ResumeApproval(ctx context.Context, a *approval.Request) (*PlanResponse, error) {
+	var s suspendedRun
+	if err := json.Unmarshal(a.Run, &s); err != nil {
+		return nil, fmt.Errorf("approval %s: suspended run: %w", a.ID, err)
+	}
+	if a.Status == approval.StatusPending {
+		return nil, fmt.Errorf("approval %s is still pending", a.ID)
+	}
+	r := g.newRun(s.Request, a.RunID)
+	r.start = time.Now().Add(-s.Elapsed)
+	r.maxIter = s.MaxIterations
+	r.resp.Steps = append(r.resp.Steps, s.Steps...)
+	ctx, cancel := context.WithTimeout(ctx, g.timeout(s.Request))
+	defer cancel()
+
+	s.Step.Approval = a.ID
+	var resp *PlanResponse
+	var err error
+	switch {
+	case a.Status != approval.StatusApproved:
+		reason := ReasonApprovalDenied
+		if a.Status == approval.StatusExpired {
+			reason = ReasonApprovalExpired
+		}
+		res := types.GuardrailResult{Reason: reason, Signals: decisionSignals(a)}
+		resp, err = r.blockStep(s.Step, PhaseAction, res, time.Now())
+	case !r.prepare():
+		resp, err = r.finish("no_planner", nil, ErrNoPlanner)
+	default:
+		resp, err = r.loop(ctx, s.Step.Iteration-1, &s)
+	}
+	if g.approvals != nil {
+		outcome, _ := json.Marshal(resp)
+		if serr := g.approvals.SetOutcome(a.ID, outcome, resp.Reason); serr != nil {
+			log.Printf("approval %s: saving outcome: %v", a.ID, serr)
 		}
+	}
+	return resp, err
+}
 
-		iterStart := time.Now()
-		step := Step{Iteration: i + 1}
+// decisionSignals renders the decisions on a request, e.g. "alice:denied:unsafe".
+func decisionSignals(a *approval.Request) []string {
+	out := []string{a.Status}
+	for _, d := range a.Decisions {
+		verdict := "denied"
+		if d.Approved {
+			verdict = "approved"
+		}
+		sig := d.Approver + ":" + verdict
+		if d.Comment != "" {
+			sig += ":" + d.Comment
+		}
+		out = append(out, sig)
+	}
+	return out
+}
+
+// run is one agent run: its request, planner and steps so far.
+type run struct {
+	g       *Gateway
+	req     PlanRequest
+	resp    *PlanResponse
+	start   time.Time
+	maxIter int
+	planner LLMPlanner
+	in      PlannerInput
+}
+
+func (g *Gateway) newRun(req PlanRequest, runID string) *run {
+	maxIter := req.MaxIterations
+	if maxIter <= 0 {
+		maxIter = g.defaultMaxIter
+	}
+	return &run{g: g, req: req, resp: &PlanResponse{RunID: runID, Steps: []Step{}}, start: time.Now(), maxIter: maxIter}
+}
+
+func (g *Gateway) timeout(req PlanRequest) time.Duration {
+	if req.Timeout > 0 {
+		return req.Timeout
+	}
+	return g.defaultTimeout
+}
+
+// prepare picks the planner and the tools it is offered; false when there is no planner.
+func (r *run) prepare() bool {
+	r.planner = r.g.planner
+	if r.planner == nil {
+		if len(r.req.Tools) == 0 {
+			return false
+		}
+		r.planner = toolScript(r.req.Prompt, r.req.Tools)
+	}
+	r.in = PlannerInput{TenantID: r.req.TenantID, Prompt: r.req.Prompt, Tools: r.g.tools(r.req.TenantID, r.req.Tools), Context: r.req.Context}
+	return true
+}
 
-		// Simulate thought generation (in real implementation, call LLM)
-		step.Thought = fmt.Sprintf("Analyzing step %d for prompt: %s", i+1, truncate(req.Prompt, 50))
+func (r *run) finish(reason string, signals []string, err error) (*PlanResponse, error) {
+	r.resp.Allowed = err == nil
+	r.resp.Reason = reason
+	r.resp.Signals = signals
+	r.resp.TotalTime = time.Since(r.start)
+	// A suspended run is recorded once it is resumed.
+	if !errors.Is(err, ErrApprovalPending) {
+		r.g.metrics.record(err != nil, len(r.resp.Steps))
+	}
+	return r.resp, err
+}
 
-		// Determine action (stub: use first available tool or finish)
-		if i < len(req.Tools) {
-			step.Action = req.Tools[i]
-			step.ActionInput = map[string]interface{}{"iteration": i}
+// loop runs the iterations from the given one on. approved, when set, is
+// the suspended run whose action, the one of iteration from, was approved.
+func (r *run) loop(ctx context.Context, from int, approved *suspendedRun) (*PlanResponse, error) {
+	g, tenantID := r.g, r.req.TenantID
+	for i := from; i < r.maxIter; i++ {
+		if err := ctx.Err(); err != nil {
+			return r.finish("timeout", nil, err)
+		}
+		iterStart := time.Now()
+		r.in.Steps = r.resp.Steps
+		var act Action
+		var step Step
+		if approved != nil && i == from {
+			act, step = approved.Action, approved.Step
+		} else {
+			var err error
+			act, err = r.planner.Next(ctx, r.in)
+			if err != nil {
+				if ctx.Err() != nil {
+					return r.finish("timeout", nil, ctx.Err())
+				}
+				return r.finish("planner_error", []string{err.Error()}, err)
+			}
+			step = Step{Iteration: i + 1, Thought: act.Thought, Action: act.Tool}
+		}
 
-			// Execute in sandbox
-			result, err := g.sandbox.Execute(ctx, step.Action, map[string]interface{}{
-				"prompt":    req.Prompt,
-				"iteration": i,
-			})
+		if act.Finished() {
+			step.Action = ActionFinish
+			step.Observation = act.Final
+			if res, blocked := g.screen(tenantID, step.Thought, false); blocked {
+				return r.blockStep(step, PhaseThought, res, iterStart)
+			}
+			if res, blocked := g.screen(tenantID, act.Final, false); blocked {
+				return r.blockStep(step, PhaseFinal, res, iterStart)
+			}
+			step.Duration = time.Since(iterStart)
+			r.resp.Steps = append(r.resp.Steps, step)
+			r.resp.FinalResult = act.Final
+			return r.finish("", nil, nil)
+		}
+
+		if act.Args == nil {
+			act.Args = map[string]interface{}{}
+		}
+		step.ActionInput = act.Args
+		if res, blocked := g.screen(tenantID, step.Thought, false); blocked {
+			return r.blockStep(step, PhaseThought, res, iterStart)
+		}
+		if !containsTool(r.in.Tools, act.Tool) {
+			res := types.GuardrailResult{Reason: "tool_not_allowed", Signals: []string{act.Tool}}
+			return r.blockStep(step, PhaseAction, res, iterStart)
+		}
+		call := toolCall(tenantID, act, r.in.Tools, step.Iteration, r.maxIter)
+		if reason, vs := g.checkCall(ctx, call, r.in.Tools); len(vs) > 0 {
+			step.Violations = vs
+			res := types.GuardrailResult{Reason: reason, Signals: violationStrings(vs)}
+			return r.blockStep(step, PhaseAction, res, iterStart)
+		}
+		argsJSON, _ := json.Marshal(act.Args)
+		if res, blocked := g.screen(tenantID, act.Tool+" "+string(argsJSON), true); blocked {
+			return r.blockStep(step, PhaseAction, res, iterStart)
+		}
+		// A call approved already runs without asking again.
+		if step.Approval == "" {
+			need, err := g.requireApproval(ctx, call)
 			if err != nil {
-				step.Observation = fmt.Sprintf("Error: %v", err)
-				step.Blocked = true
-				step.BlockReason = err.Error()
-			} else {
-				step.Observation = fmt.Sprintf("Result: %v", result)
+				res := types.GuardrailResult{Reason: ReasonApprovalUnavailable, Signals: []string{err.Error()}}
+				return r.blockStep(step, PhaseAction, res, iterStart)
+			}
+			if need.Approvers > 0 {
+				return r.suspend(ctx, step, act, need, iterStart)
 			}
-		} else {
-			// No more tools, finish
-			step.Action = "finish"
-			step.Observation = "Task completed"
 		}
 
+		step.Observation = g.execute(WithTenant(ctx, tenantID), act)
+		if res, blocked := g.screen(tenantID, step.Observation, true); blocked {
+			return r.blockStep(step, PhaseObservation, res, iterStart)
+		}
+		if res, blocked := g.screen(tenantID, step.Observation, false); blocked {
+			return r.blockStep(step, PhaseObservation, res, iterStart)
+		}
 		step.Duration = time.Since(iterStart)
-		resp.Steps = append(resp.Steps, step)
-
-		// Check if blocked
-		if step.Blocked {
-			resp.Allowed = false
-			resp.Reason = step.BlockReason
-			resp.TotalTime = time.Since(start)
-			g.metrics.record(true, i+1)
-			return resp, errors.New(step.BlockReason)
+		r.resp.Steps = append(r.resp.Steps, step)
+	}
+	return r.finish("max_iterations", nil, ErrMaxIterations)
+}
+
+// suspend saves the run with an approval request for the step's tool call
+// and ends it as pending. Without an approval queue the call is blocked.
+func (r *run) suspend(ctx context.Context, step Step, act Action, need ApprovalRequirement, iterStart time.Time) (*PlanResponse, error) {
+	q := r.g.approvals
+	if q == nil {
+		return r.blockStep(step, PhaseAction, types.GuardrailResult{Reason: ReasonApprovalRequired, Signals: need.Signals}, iterStart)
+	}
+	state, err := json.Marshal(suspendedRun{
+		Request:       r.req,
+		Steps:         r.resp.Steps,
+		Step:          step,
+		Action:        act,
+		MaxIterations: r.maxIter,
+		Elapsed:       time.Since(r.start),
+	})
+	if err != nil {
+		return r.blockStep(step, PhaseAction, types.GuardrailResult{Reason: ReasonApprovalUnavailable, Signals: []string{err.Error()}}, iterStart)
+	}
+	a := &approval.Request{
+		RunID:     r.resp.RunID,
+		TenantID:  r.req.TenantID,
+		AppID:     r.req.AppID,
+		Requester: requester(r.req),
+		Tool:      act.Tool,
+		Args:      act.Args,
+		Reason:    need.Reason,
+		Signals:   need.Signals,
+		Approvers: need.Approvers,
+		Run:       state,
+	}
+	if err := q.Submit(ctx, a); err != nil {
+		return r.blockStep(step, PhaseAction, types.GuardrailResult{Reason: ReasonApprovalUnavailable, Signals: []string{err.Error()}}, iterStart)
+	}
+	step.Approval = a.ID
+	step.Duration = time.Since(iterStart)
+	r.resp.Steps = append(r.resp.Steps, step)
+	r.resp.Approval = &PendingApproval{ID: a.ID, Tool: a.Tool, Approvers: a.Approvers, ExpiresAt: a.ExpiresAt}
+	return r.finish(ReasonApprovalPending, need.Signals, ErrApprovalPending)
+}
+
+// requireApproval asks every approval policy about the call; the call
+// needs the most approvers any of them asks for.
+func (g *Gateway) requireApproval(ctx context.Context, call ToolCall) (ApprovalRequirement, error) {
+	var need ApprovalRequirement
+	for _, p := range g.approvalPolicies {
+		req, err := p.RequireApproval(ctx, call)
+		if err != nil {
+			return ApprovalRequirement{}, err
 		}
+		if req.Approvers > need.Approvers {
+			need.Approvers, need.Reason = req.Approvers, req.Reason
+		}
+		if req.Approvers > 0 {
+			need.Signals = append(need.Signals, req.Signals...)
+		}
+	}
+	return need, nil
+}
+
+// Reasons of tool calls rejected for their arguments; OPA violations carry
+// the policy's own reason.
+const (
+	ReasonArgsInvalid       = "tool_args_invalid"
+	ReasonArgsDenied        = "tool_args_denied"
+	ReasonPolicyUnavailable = "tool_policy_unavailable"
+)
+
+// toolCall describes the action for the call and approval policies.
+func toolCall(tenantID string, act Action, offered []ToolDescription, step, maxSteps int) ToolCall {
+	names := make([]string, 0, len(offered))
+	for _, t := range offered {
+		names = append(names, t.Name)
+	}
+	return ToolCall{TenantID: tenantID, Tool: act.Tool, Args: act.Args, AllowedTools: names, Step: step, MaxSteps: maxSteps}
+}
 
-		// Check if finished
-		if step.Action == "finish" {
-			break
+// checkCall checks the call's arguments against the tool's schema, the
+// tenant's argument rules and the call policy, in that order, and returns
+// the reason and violations of the first check they fail.
+func (g *Gateway) checkCall(ctx context.Context, call ToolCall, offered []ToolDescription) (string, []Violation) {
+	for _, t := range offered {
+		if t.Name == call.Tool {
+			if vs := ValidateArgs(t.Schema, call.Args); len(vs) > 0 {
+				return ReasonArgsInvalid, vs
+			}
+		}
+	}
+	if g.toolRules != nil {
+		if vs := CheckArgs(g.toolRules.AgentToolRules(call.TenantID), call.Tool, call.Args); len(vs) > 0 {
+			return ReasonArgsDenied, vs
 		}
+	}
+	if g.callPolicy == nil {
+		return "", nil
+	}
+	vs, err := g.callPolicy.CheckCall(ctx, call)
+	if err != nil {
+		return ReasonPolicyUnavailable, []Violation{{Rule: ReasonPolicyUnavailable, Message: err.Error()}}
+	}
+	if len(vs) > 0 {
+		return vs[0].Rule, vs
+	}
+	return "", nil
+}
 
-		// FilterOutput through output filter
-		filterResult := g.firewall.FilterOutput(req.TenantID, step.Observation, nil)
-		if !filterResult.Allowed {
-			resp.Allowed = false
-			resp.Reason = filterResult.Reason
-			resp.Signals = filterResult.Signals
-			resp.TotalTime = time.Since(start)
-			g.metrics.record(true, i+1)
-			return resp, errors.New("output filtered")
+// execute runs the action's tool in the sandbox and renders the result, or
+// the error, as the observation the planner sees next.
+func (g *Gateway) execute(ctx context.Context, act Action) string {
+	exec, err := g.registry.Get(act.Tool)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err)
+	}
+	result, err := g.sandbox.Execute(ctx, exec, act.Args)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err)
+	}
+	var obs string
+	switch v := result.(type) {
+	case string:
+		obs = v
+	case []byte:
+		obs = string(v)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("Error: unrenderable result: %v", err)
 		}
+		obs = string(b)
+	}
+	if len(obs) > maxObservationBytes {
+		obs = obs[:maxObservationBytes] + "...[truncated]"
+	}
+	return obs
+}
+
+// screen runs text through the firewall as a prompt (input the model or a
+// tool will act on) or as output (text the model produced or will relay).
+func (g *Gateway) screen(tenantID, text string, asPrompt bool) (types.GuardrailResult, bool) {
+	if strings.TrimSpace(text) == "" {
+		return types.GuardrailResult{Allowed: true}, false
 	}
+	var res types.GuardrailResult
+	if asPrompt {
+		res = g.firewall.CheckPrompt(tenantID, text, nil)
+	} else {
+		res = g.firewall.FilterOutput(tenantID, text, nil)
+	}
+	return res, !res.Allowed
+}
 
-	resp.Allowed = true
-	resp.FinalResult = "Agent execution completed successfully"
-	resp.TotalTime = time.Since(start)
-	g.metrics.record(false, len(resp.Steps))
-	return resp, nil
+// blockStep records the blocked step and ends the run with the guardrail's reason.
+func (r *run) blockStep(step Step, phase string, res types.GuardrailResult, iterStart time.Time) (*PlanResponse, error) {
+	step.Blocked = true
+	step.BlockReason = res.Reason
+	step.BlockedAt = phase
+	if phase == PhaseObservation || phase == PhaseFinal {
+		step.Observation = "[blocked by guardrail]"
+	}
+	step.Duration = time.Since(iterStart)
+	r.resp.Steps = append(r.resp.Steps, step)
+	return r.finish(res.Reason, res.Signals, ErrStepBlocked)
 }
 
 // LegacyPlanAndAct provides backward compatibility with old signature.
@@ -262,10 +651,3 @@ func (g *Gateway) LegacyPlanAndAct(tenantID, prompt string, proposedTools []stri
 	}
 	return types.GuardrailResult{Allowed: resp.Allowed}, nil
 }
-
-func truncate(s string, n int) string {
-	if len(s) <= n {
-		return s
-	}
-	return s[:n] + "..."
-}
@@ -0,0 +1,444 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"aiguardrails/internal/promptfw"
+	"aiguardrails/internal/secret"
+)
+
+var ErrEgressDenied = errors.New("egress denied")
+
+// HTTPTool declares a tool calling an HTTP endpoint. "{{name}}" in the URL
+// is replaced by the tool argument name, escaped for the path or the query
+// it is in. The other arguments are sent as query parameters for GET and
+// DELETE, else as a JSON body. Header values may name secrets as
+// "{{secret:KEY}}", resolved with the secret provider for each call.
+type HTTPTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Schema      map[string]interface{} `json:"schema,omitempty"`
+	Method      string                 `json:"method,omitempty"` // GET by default
+	URL         string                 `json:"url"`
+	Headers     map[string]string      `json:"headers,omitempty"`
+	// AllowedHosts is the egress allowlist of tenants without their own agent_egress.
+	AllowedHosts     []string `json:"allowed_hosts,omitempty"`
+	MaxResponseBytes int      `json:"max_response_bytes,omitempty"`
+	// TimeoutSec bounds the whole call, redirects and body included.
+	TimeoutSec int `json:"timeout_sec,omitempty"`
+}
+
+// defaultMaxResponseBytes caps the response body an HTTP tool reads.
+const defaultMaxResponseBytes = 64 << 10
+
+// defaultHTTPTimeout bounds a call of an HTTP tool without its own timeout.
+const defaultHTTPTimeout = 30 * time.Second
+
+// HTTPResult is the response of an HTTP tool as the planner sees it.
+type HTTPResult struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        string `json:"body,omitempty"`
+	Truncated   bool   `json:"truncated,omitempty"`
+	// Withheld is why the body was dropped, e.g. prompt_injection_detected.
+	Withheld string `json:"withheld,omitempty"`
+	// Redacted is set when DLP masked parts of the body.
+	Redacted   bool     `json:"redacted,omitempty"`
+	Signals    []string `json:"signals,omitempty"`
+	DurationMS int64    `json:"duration_ms"`
+}
+
+// EgressAllowlist resolves the hosts a tenant's HTTP tools may reach.
+type EgressAllowlist interface {
+	AgentEgress(tenantID string) []string
+}
+
+// HTTPExecutor calls an HTTPTool's endpoint for the tenant in the context.
+// Egress goes only to hosts on the tenant's allowlist, else the tool's;
+// loopback, private, link-local and other internal addresses only when an
+// IP/CIDR entry lists them or the host's entry opts in with "internal:". The response body is capped
+// and screened: an injection attempt withholds it, DLP hits are masked.
+type HTTPExecutor struct {
+	tool     HTTPTool
+	secrets  secret.Provider
+	egress   EgressAllowlist
+	firewall *promptfw.Firewall
+}
+
+// NewHTTPExecutor constructs HTTPExecutor; secrets, egress and fw may be nil.
+func NewHTTPExecutor(tool HTTPTool, secrets secret.Provider, egress EgressAllowlist, fw *promptfw.Firewall) *HTTPExecutor {
+	return &HTTPExecutor{tool: tool, secrets: secrets, egress: egress, firewall: fw}
+}
+
+func (e *HTTPExecutor) Name() string        { return e.tool.Name }
+func (e *HTTPExecutor) Description() string { return e.tool.Description }
+func (e *HTTPExecutor) Schema() map[string]interface{} {
+	if e.tool.Schema == nil {
+		return map[string]interface{}{"type": "object"}
+	}
+	return e.tool.Schema
+}
+
+func (e *HTTPExecutor) Execute(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	tenantID := TenantFromContext(ctx)
+	req, err := e.request(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	guard := &egressGuard{allow: e.allowlist(tenantID)}
+	if len(guard.allow) == 0 {
+		return nil, fmt.Errorf("%w: no egress allowlist for tool %s", ErrEgressDenied, e.tool.Name)
+	}
+	timeout := defaultHTTPTimeout
+	if e.tool.TimeoutSec > 0 {
+		timeout = time.Duration(e.tool.TimeoutSec) * time.Second
+	}
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// No proxy: the guard must see the address actually dialed.
+			Proxy:             nil,
+			DialContext:       guard.dialContext,
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Host != via[0].URL.Host {
+				// Secrets are meant for the configured host only.
+				for _, k := range e.secretHeaders() {
+					req.Header.Del(k)
+				}
+			}
+			return checkScheme(req.URL)
+		},
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	limit := e.tool.MaxResponseBytes
+	if limit <= 0 {
+		limit = defaultMaxResponseBytes
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	res := &HTTPResult{Status: resp.StatusCode, ContentType: resp.Header.Get("Content-Type")}
+	if len(body) > limit {
+		body, res.Truncated = body[:limit], true
+	}
+	res.Body = strings.ToValidUTF8(string(body), "�")
+	e.screen(tenantID, res)
+	res.DurationMS = time.Since(start).Milliseconds()
+	return res, nil
+}
+
+// allowlist is the tenant's egress allowlist, or the tool's.
+func (e *HTTPExecutor) allowlist(tenantID string) []string {
+	if e.egress != nil {
+		if hosts := e.egress.AgentEgress(tenantID); len(hosts) > 0 {
+			return hosts
+		}
+	}
+	return e.tool.AllowedHosts
+}
+
+// screen withholds a body that attempts prompt injection and masks DLP hits
+// in the rest, before the body becomes an observation.
+func (e *HTTPExecutor) screen(tenantID string, res *HTTPResult) {
+	if e.firewall == nil || res.Body == "" {
+		return
+	}
+	if inj, hit := e.firewall.DetectInjection(tenantID, res.Body); hit {
+		res.Body, res.Withheld, res.Signals = "", inj.Reason, inj.Signals
+		return
+	}
+	sf := e.firewall.NewStreamFilter(tenantID, nil, promptfw.StreamRedact)
+	head, _ := sf.Write(res.Body)
+	tail, dlp := sf.Close()
+	if len(dlp.Signals) > 0 {
+		res.Body, res.Redacted, res.Signals = head+tail, true, dlp.Signals
+	}
+}
+
+var methodsWithBody = map[string]bool{http.MethodPost: true, http.MethodPut: true, http.MethodPatch: true}
+
+// request builds the call: the URL with its placeholders expanded, the
+// remaining arguments as query or body, and the headers with their secrets.
+func (e *HTTPExecutor) request(ctx context.Context, args map[string]interface{}) (*http.Request, error) {
+	method := strings.ToUpper(e.tool.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	rawURL, rest := expandURL(e.tool.URL, args)
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("http tool %s: %w", e.tool.Name, err)
+	}
+	if err := checkScheme(u); err != nil {
+		return nil, err
+	}
+
+	var body io.Reader
+	if methodsWithBody[method] {
+		b, err := json.Marshal(rest)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	} else if len(rest) > 0 {
+		q := u.Query()
+		for k, v := range rest {
+			q.Set(k, argText(v))
+		}
+		u.RawQuery = q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range e.tool.Headers {
+		value, err := e.expandSecrets(ctx, v)
+		if err != nil {
+			return nil, fmt.Errorf("http tool %s: header %s: %w", e.tool.Name, k, err)
+		}
+		req.Header.Set(k, value)
+	}
+	return req, nil
+}
+
+// secretHeaders names the tool's headers that carry a secret.
+func (e *HTTPExecutor) secretHeaders() []string {
+	var out []string
+	for k, v := range e.tool.Headers {
+		if secretRef.MatchString(v) {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+var secretRef = regexp.MustCompile(`\{\{\s*secret:([^}\s]+)\s*\}\}`)
+
+func (e *HTTPExecutor) expandSecrets(ctx context.Context, v string) (string, error) {
+	var firstErr error
+	out := secretRef.ReplaceAllStringFunc(v, func(m string) string {
+		key := secretRef.FindStringSubmatch(m)[1]
+		if e.secrets == nil {
+			firstErr = fmt.Errorf("no secret provider for %s", key)
+			return ""
+		}
+		s, err := e.secrets.GetSecret(ctx, key)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("secret %s: %w", key, err)
+		}
+		return s
+	})
+	return out, firstErr
+}
+
+// expandURL replaces the URL's placeholders, path-escaped before the query
+// and query-escaped in it, and returns the arguments it did not use.
+func expandURL(tmpl string, args map[string]interface{}) (string, map[string]interface{}) {
+	rest := make(map[string]interface{}, len(args))
+	for k, v := range args {
+		rest[k] = v
+	}
+	query := strings.Index(tmpl, "?")
+	var b strings.Builder
+	last := 0
+	for _, m := range placeholder.FindAllStringSubmatchIndex(tmpl, -1) {
+		name := tmpl[m[2]:m[3]]
+		b.WriteString(tmpl[last:m[0]])
+		text := argText(args[name])
+		if query >= 0 && m[0] > query {
+			b.WriteString(url.QueryEscape(text))
+		} else {
+			b.WriteString(url.PathEscape(text))
+		}
+		delete(rest, name)
+		last = m[1]
+	}
+	b.WriteString(tmpl[last:])
+	return b.String(), rest
+}
+
+// argText renders an argument as text: strings as they are, other values
+// as JSON, a missing one as nothing.
+func argText(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	default:
+		b, _ := json.Marshal(val)
+		return string(b)
+	}
+}
+
+func checkScheme(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme %q", ErrEgressDenied, u.Scheme)
+	}
+	return nil
+}
+
+// internalNets are the loopback, private, link-local, shared, multicast
+// and reserved ranges an HTTP tool must not reach unless allowlisted.
+var internalNets = func() []*net.IPNet {
+	var out []*net.IPNet
+	for _, c := range []string{
+		"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12",
+		"192.0.0.0/24", "192.168.0.0/16", "198.18.0.0/15", "224.0.0.0/4", "240.0.0.0/4",
+		"::/128", "::1/128", "64:ff9b::/96", "fc00::/7", "fe80::/10", "ff00::/8",
+	} {
+		_, n, _ := net.ParseCIDR(c)
+		out = append(out, n)
+	}
+	return out
+}()
+
+// internalNet returns the internal range ip lies in, if any.
+func internalNet(ip net.IP) *net.IPNet {
+	for _, n := range internalNets {
+		if n.Contains(ip) {
+			return n
+		}
+	}
+	return nil
+}
+
+// namesInternal reports whether an allowlist entry names internal addresses
+// on purpose: an internal IP, or a CIDR inside one internal range. A broad
+// range such as 0.0.0.0/0 does not.
+func namesInternal(entry string) bool {
+	if ip := net.ParseIP(entry); ip != nil {
+		return internalNet(ip) != nil
+	}
+	_, cidr, err := net.ParseCIDR(entry)
+	if err != nil {
+		return false
+	}
+	in := internalNet(cidr.IP)
+	if in == nil {
+		return false
+	}
+	inOnes, _ := in.Mask.Size()
+	ones, _ := cidr.Mask.Size()
+	return ones >= inOnes
+}
+
+// internalOptIn prefixes an allowlisted host name that may resolve to
+// internal addresses, e.g. "internal:orders.corp.example". Without it a
+// name only reaches public addresses.
+const internalOptIn = "internal:"
+
+// egressGuard checks every connection an HTTP tool dials: the host must be
+// allowlisted by name, or each address it resolves to by IP or CIDR. An
+// internal address needs an IP or CIDR entry naming internal addresses, or
+// a name entry opting in. Checking the dialed address, not the URL or the
+// name, also covers redirects and names resolving to internal addresses,
+// DNS rebinding included.
+type egressGuard struct {
+	allow []string
+}
+
+func (g *egressGuard) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	var byName, nameInternal bool
+	if net.ParseIP(host) == nil {
+		byName, nameInternal = g.allowsName(host)
+	}
+	d := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			ipText, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(ipText)
+			if ip == nil {
+				return fmt.Errorf("%w: %s", ErrEgressDenied, address)
+			}
+			internal := internalNet(ip) != nil
+			if (byName && (!internal || nameInternal)) || g.allowsIP(ip, internal) {
+				return nil
+			}
+			if internal {
+				return fmt.Errorf("%w: %s resolves to internal address %s", ErrEgressDenied, host, ip)
+			}
+			return fmt.Errorf("%w: %s is not allowlisted", ErrEgressDenied, host)
+		},
+	}
+	return d.DialContext(ctx, network, addr)
+}
+
+// allowsIP reports whether an IP or CIDR entry lists ip; an internal ip
+// needs an entry naming internal addresses.
+func (g *egressGuard) allowsIP(ip net.IP, internal bool) bool {
+	for _, a := range g.allow {
+		if hostMatches(ip.String(), a) && (!internal || namesInternal(a)) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsName reports whether a name entry lists host, and whether one that
+// does opts in to internal addresses.
+func (g *egressGuard) allowsName(host string) (allowed, internal bool) {
+	for _, a := range g.allow {
+		name, optIn := strings.CutPrefix(a, internalOptIn)
+		if hostMatches(host, name) {
+			allowed = true
+			internal = internal || optIn
+		}
+	}
+	return allowed, internal
+}
+
+// ValidateEgress checks the hosts of a tenant's agent_egress rule.
+func ValidateEgress(hosts []string) error {
+	for _, h := range hosts {
+		if strings.TrimSpace(h) == "" {
+			return fmt.Errorf("agent_egress: empty host")
+		}
+		if name, ok := strings.CutPrefix(h, internalOptIn); ok {
+			if name == "" || net.ParseIP(name) != nil || strings.Contains(name, "/") {
+				return fmt.Errorf("agent_egress: %q: %s only applies to host names", h, internalOptIn)
+			}
+			continue
+		}
+		if strings.Contains(h, "/") {
+			if _, _, err := net.ParseCIDR(h); err != nil {
+				return fmt.Errorf("agent_egress: %q: %v", h, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOpenAIPlanner(t *testing.T) {
+	var got chatRequest
+	reply := `{"choices":[{"message":{"role":"assistant","content":"Checking the order.","tool_calls":[{"id":"c1","type":"function","function":{"name":"lookup_order","arguments":"{\"id\":\"42\"}"}}]}}]}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer key" {
+			t.Errorf("unexpected request %s %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_, _ = w.Write([]byte(reply))
+	}))
+	defer srv.Close()
+
+	p := NewOpenAIPlanner(srv.URL+"/v1/", "key", "planner-model", time.Second)
+	in := PlannerInput{
+		Prompt: "Where is order 42?",
+		Tools:  []ToolDescription{{Name: "lookup_order", Description: "Look up an order", Schema: map[string]interface{}{"type": "object"}}},
+		Steps:  []Step{{Iteration: 1, Thought: "look it up", Action: "lookup_order", ActionInput: map[string]interface{}{"id": "41"}, Observation: "not found"}},
+	}
+	act, err := p.Next(context.Background(), in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if act.Tool != "lookup_order" || act.Args["id"] != "42" || act.Thought != "Checking the order." || act.Finished() {
+		t.Fatalf("unexpected action: %+v", act)
+	}
+	if got.Model != "planner-model" || len(got.Tools) != 1 || got.Tools[0].Function.Name != "lookup_order" {
+		t.Fatalf("unexpected request: %+v", got)
+	}
+	// system, user, then the earlier step as a tool call and its result
+	if len(got.Messages) != 4 || got.Messages[2].ToolCalls[0].Function.Arguments != `{"id":"41"}` ||
+		got.Messages[3].Role != "tool" || *got.Messages[3].Content != "not found" {
+		t.Fatalf("unexpected messages: %+v", got.Messages)
+	}
+
+	reply = `{"choices":[{"message":{"role":"assistant","content":"Order 42 has shipped."}}]}`
+	if act, err = p.Next(context.Background(), in); err != nil || !act.Finished() || act.Final != "Order 42 has shipped." {
+		t.Fatalf("expected a final answer: %v %+v", err, act)
+	}
+
+	reply = `{"choices":[{"message":{"role":"assistant","tool_calls":[{"id":"c2","type":"function","function":{"name":"lookup_order","arguments":"{not json"}}]}}]}`
+	if _, err = p.Next(context.Background(), in); !errors.Is(err, ErrPlannerResponse) {
+		t.Fatalf("expected ErrPlannerResponse, got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ActionFinish is the action of a step that answers instead of calling a tool.
+const ActionFinish = "finish"
+
+// Action is the planner's next move: call Tool with Args, or answer with Final.
+type Action struct {
+	Thought string                 `json:"thought,omitempty"`
+	Tool    string                 `json:"tool,omitempty"`
+	Args    map[string]interface{} `json:"args,omitempty"`
+	Final   string                 `json:"final,omitempty"`
+}
+
+// Finished reports whether the action ends the run.
+func (a Action) Finished() bool { return a.Tool == "" || a.Tool == ActionFinish }
+
+// PlannerInput is what the planner sees before each step: the task, the tools
+// it may call and the steps taken so far.
+type PlannerInput struct {
+	TenantID string            `json:"tenant_id"`
+	Prompt   string            `json:"prompt"`
+	Tools    []ToolDescription `json:"tools"`
+	Steps    []Step            `json:"steps"`
+	Context  map[string]string `json:"context,omitempty"`
+}
+
+// LLMPlanner chooses the next action of an agent run.
+type LLMPlanner interface {
+	Next(ctx context.Context, in PlannerInput) (Action, error)
+}
+
+// ScriptedPlanner replays fixed actions, one per step, then finishes. It is
+// deterministic, for tests and for callers that name their tools up front.
+type ScriptedPlanner struct {
+	actions []Action
+	final   string
+}
+
+// NewScriptedPlanner constructs a ScriptedPlanner.
+func NewScriptedPlanner(actions ...Action) *ScriptedPlanner {
+	return &ScriptedPlanner{actions: actions}
+}
+
+// WithFinal sets the answer given after the script; by default the last observation.
+func (p *ScriptedPlanner) WithFinal(final string) *ScriptedPlanner {
+	p.final = final
+	return p
+}
+
+func (p *ScriptedPlanner) Next(_ context.Context, in PlannerInput) (Action, error) {
+	if i := len(in.Steps); i < len(p.actions) {
+		return p.actions[i], nil
+	}
+	final := p.final
+	if final == "" && len(in.Steps) > 0 {
+		final = in.Steps[len(in.Steps)-1].Observation
+	}
+	return Action{Tool: ActionFinish, Final: final}, nil
+}
+
+// toolScript is the planner of requests naming tools without a configured
+// planner: each tool is called once, in order, with the prompt.
+func toolScript(prompt string, tools []string) *ScriptedPlanner {
+	actions := make([]Action, 0, len(tools))
+	for _, t := range tools {
+		actions = append(actions, Action{Thought: fmt.Sprintf("call %s", t), Tool: t, Args: map[string]interface{}{"prompt": prompt}})
+	}
+	return NewScriptedPlanner(actions...).WithFinal(fmt.Sprintf("completed: %s", strings.Join(tools, ", ")))
+}
@@ -0,0 +1,340 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Isolation modes of process tools.
+const (
+	IsolationNone     = "none"     // rlimits only
+	IsolationAuto     = "auto"     // namespaces and seccomp where the host allows them
+	IsolationRequired = "required" // fail rather than run without namespaces and seccomp
+)
+
+var ErrIsolationUnavailable = errors.New("process isolation unavailable")
+
+// ProcessTool declares a script tool run as a subprocess. Command is the
+// program and its arguments; "{{name}}" in an argument is replaced by the
+// tool argument name, as text and never through a shell. The tool's
+// arguments are also written to its stdin as a JSON object.
+type ProcessTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Schema      map[string]interface{} `json:"schema,omitempty"`
+	Command     []string               `json:"command"`
+	Env         map[string]string      `json:"env,omitempty"`
+	// WorkRoot holds the per-run working directories; the system temp dir by default.
+	WorkRoot  string        `json:"work_root,omitempty"`
+	Isolation string        `json:"isolation,omitempty"` // IsolationAuto by default
+	Limits    ProcessLimits `json:"limits"`
+}
+
+// ProcessLimits are the resource limits of a process tool; zero values take
+// the defaults.
+type ProcessLimits struct {
+	CPUSeconds    int   `json:"cpu_seconds,omitempty"`     // RLIMIT_CPU
+	MemoryBytes   int64 `json:"memory_bytes,omitempty"`    // RLIMIT_AS; the sandbox memory limit by default
+	FileSizeBytes int64 `json:"file_size_bytes,omitempty"` // RLIMIT_FSIZE
+	OpenFiles     int   `json:"open_files,omitempty"`      // RLIMIT_NOFILE
+	Processes     int   `json:"processes,omitempty"`       // RLIMIT_NPROC of the tool's user; unlimited by default
+	OutputBytes   int   `json:"output_bytes,omitempty"`    // stdout and stderr kept, each
+}
+
+// Default process tool limits.
+const (
+	defaultCPUSeconds    = 10
+	defaultMemoryBytes   = 256 << 20 // when run without a sandbox
+	defaultFileSizeBytes = 16 << 20
+	defaultOpenFiles     = 256
+	defaultOutputBytes   = 64 << 10
+)
+
+// ProcessResult is the structured exit status of a process tool.
+type ProcessResult struct {
+	ExitCode int    `json:"exit_code"`        // -1 when killed by a signal
+	Signal   string `json:"signal,omitempty"` // e.g. "killed"
+	// Limit names the rlimit that stopped the tool: cpu or file_size.
+	Limit           string `json:"limit,omitempty"`
+	TimedOut        bool   `json:"timed_out,omitempty"`
+	Stdout          string `json:"stdout"`
+	Stderr          string `json:"stderr,omitempty"`
+	StdoutTruncated bool   `json:"stdout_truncated,omitempty"`
+	StderrTruncated bool   `json:"stderr_truncated,omitempty"`
+	DurationMS      int64  `json:"duration_ms"`
+	// Isolation lists what confined the tool, e.g. rlimits, user_namespace, read_only_fs, seccomp.
+	Isolation []string `json:"isolation,omitempty"`
+}
+
+// ProcessExecutor runs a ProcessTool in a fresh working directory under
+// resource limits and, on Linux, in user, mount and network namespaces
+// with a seccomp filter. Binaries running process tools must call
+// SandboxInit first thing in main.
+type ProcessExecutor struct {
+	tool ProcessTool
+}
+
+// NewProcessExecutor constructs ProcessExecutor.
+func NewProcessExecutor(tool ProcessTool) *ProcessExecutor {
+	return &ProcessExecutor{tool: tool}
+}
+
+func (e *ProcessExecutor) Name() string        { return e.tool.Name }
+func (e *ProcessExecutor) Description() string { return e.tool.Description }
+func (e *ProcessExecutor) Schema() map[string]interface{} {
+	if e.tool.Schema == nil {
+		return map[string]interface{}{"type": "object"}
+	}
+	return e.tool.Schema
+}
+
+// Execute runs the tool under its own limits.
+func (e *ProcessExecutor) Execute(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	return e.result(e.run(ctx, nil, args))
+}
+
+// ExecuteIn runs the tool under the sandbox: its program must pass the deny
+// list and its memory limit defaults to the sandbox's.
+func (e *ProcessExecutor) ExecuteIn(ctx context.Context, s *Sandbox, args map[string]interface{}) (interface{}, error) {
+	return e.result(e.run(ctx, s, args))
+}
+
+func (e *ProcessExecutor) result(res *ProcessResult, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// processSpec is one run of a process tool.
+type processSpec struct {
+	Program   string // absolute path of the program
+	Argv      []string
+	Dir       string
+	Env       []string
+	Stdin     []byte
+	Limits    ProcessLimits
+	Isolation string
+}
+
+func (e *ProcessExecutor) run(ctx context.Context, s *Sandbox, args map[string]interface{}) (*ProcessResult, error) {
+	if len(e.tool.Command) == 0 {
+		return nil, fmt.Errorf("process tool %s: no command", e.tool.Name)
+	}
+	if s != nil {
+		if err := s.ValidateCommand(e.tool.Command[0]); err != nil {
+			return nil, err
+		}
+	}
+	if vs := confineArgs(args); len(vs) > 0 {
+		return nil, &ArgsError{Tool: e.tool.Name, Violations: vs}
+	}
+	program, err := exec.LookPath(e.tool.Command[0])
+	if err != nil {
+		return nil, fmt.Errorf("process tool %s: %w", e.tool.Name, err)
+	}
+	if program, err = filepath.Abs(program); err != nil {
+		return nil, err
+	}
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	stdin, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+
+	root := e.tool.WorkRoot
+	if root == "" {
+		root = os.TempDir()
+	}
+	dir, err := os.MkdirTemp(root, "tool-run-")
+	if err != nil {
+		return nil, fmt.Errorf("process tool %s: work dir: %w", e.tool.Name, err)
+	}
+	defer os.RemoveAll(dir)
+
+	isolation := e.tool.Isolation
+	if isolation == "" {
+		isolation = IsolationAuto
+	}
+	return runProcess(ctx, &processSpec{
+		Program:   program,
+		Argv:      append([]string{e.tool.Command[0]}, expandArgs(e.tool.Command[1:], args)...),
+		Dir:       dir,
+		Env:       e.env(dir),
+		Stdin:     stdin,
+		Limits:    e.limits(s),
+		Isolation: isolation,
+	})
+}
+
+// limits fills in the defaults of the tool's limits.
+func (e *ProcessExecutor) limits(s *Sandbox) ProcessLimits {
+	l := e.tool.Limits
+	if l.CPUSeconds <= 0 {
+		l.CPUSeconds = defaultCPUSeconds
+	}
+	if l.MemoryBytes <= 0 {
+		l.MemoryBytes = defaultMemoryBytes
+		if s != nil && s.MemLimit() > 0 {
+			l.MemoryBytes = s.MemLimit()
+		}
+	}
+	if l.FileSizeBytes <= 0 {
+		l.FileSizeBytes = defaultFileSizeBytes
+	}
+	if l.OpenFiles <= 0 {
+		l.OpenFiles = defaultOpenFiles
+	}
+	if l.OutputBytes <= 0 {
+		l.OutputBytes = defaultOutputBytes
+	}
+	return l
+}
+
+// env is the tool's environment: a fixed PATH, the working directory as
+// HOME and TMPDIR, and the tool's own variables. Nothing of the server's
+// environment is passed on.
+func (e *ProcessExecutor) env(dir string) []string {
+	env := []string{"PATH=/usr/local/bin:/usr/bin:/bin", "HOME=" + dir, "TMPDIR=" + dir, "LANG=C.UTF-8"}
+	keys := make([]string, 0, len(e.tool.Env))
+	for k := range e.tool.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		env = append(env, k+"="+e.tool.Env[k])
+	}
+	return env
+}
+
+var placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}`)
+
+// expandArgs replaces the placeholders in command arguments with the tool
+// arguments they name, see argText.
+func expandArgs(argv []string, args map[string]interface{}) []string {
+	out := make([]string, len(argv))
+	for i, a := range argv {
+		out[i] = placeholder.ReplaceAllStringFunc(a, func(m string) string {
+			return argText(args[placeholder.FindStringSubmatch(m)[1]])
+		})
+	}
+	return out
+}
+
+// confineArgs reports the arguments naming a path outside the working
+// directory: absolute paths, paths climbing out of it and home paths,
+// whether the whole argument or a part of it such as "--file=/etc/passwd",
+// "out=/etc/shadow" or "-o/root/x" names them.
+func confineArgs(args map[string]interface{}) []Violation {
+	var out []Violation
+	walkArgs(args, "", "", func(p, _ string, v interface{}) {
+		s, ok := v.(string)
+		if !ok {
+			return
+		}
+		for _, part := range argPaths(s) {
+			if _, fp := targets(part); fp != "" && escapesWorkDir(fp) {
+				out = append(out, Violation{Path: p, Rule: "workdir", Message: fmt.Sprintf("path %q is outside the working directory", s)})
+				return
+			}
+		}
+	})
+	return out
+}
+
+// argPaths returns the parts of an argument that may be a path: the whole
+// of it, the text after each "=", ",", ";", "@" or ":" (not that of a URL
+// scheme), and the value of a short option such as "-o/root/x".
+func argPaths(s string) []string {
+	out := []string{s}
+	if len(s) > 2 && s[0] == '-' && s[1] != '-' {
+		out = append(out, s[2:])
+	}
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case ':':
+			if strings.HasPrefix(s[i+1:], "//") {
+				continue
+			}
+		case '=', ',', ';', '@':
+		default:
+			continue
+		}
+		if i+1 < len(s) {
+			out = append(out, s[i+1:])
+		}
+	}
+	return out
+}
+
+func escapesWorkDir(fp string) bool {
+	return path.IsAbs(fp) || fp == ".." || strings.HasPrefix(fp, "../") || strings.HasPrefix(fp, "~") || filepath.VolumeName(fp) != ""
+}
+
+// cappedBuffer keeps the first max bytes written to it and drops the rest,
+// so a chatty tool never blocks on its output.
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// runCommand runs cmd with the spec's stdin and output caps; started is
+// called once it runs. A tool that ran reports its exit status however it
+// ended; the error is for one that could not run.
+func runCommand(ctx context.Context, cmd *exec.Cmd, p *processSpec, started func()) (*ProcessResult, error) {
+	stdout := &cappedBuffer{max: p.Limits.OutputBytes}
+	stderr := &cappedBuffer{max: p.Limits.OutputBytes}
+	cmd.Stdin = bytes.NewReader(p.Stdin)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.Dir = p.Dir
+	cmd.Env = p.Env
+	cmd.WaitDelay = time.Second
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	if started != nil {
+		started()
+	}
+	err := cmd.Wait()
+	if cmd.ProcessState == nil {
+		return nil, err
+	}
+	res := &ProcessResult{
+		Stdout:          stdout.buf.String(),
+		Stderr:          stderr.buf.String(),
+		StdoutTruncated: stdout.truncated,
+		StderrTruncated: stderr.truncated,
+		DurationMS:      time.Since(start).Milliseconds(),
+		TimedOut:        ctx.Err() != nil,
+	}
+	exitStatus(cmd.ProcessState, res)
+	return res, nil
+}
@@ -0,0 +1,408 @@
+//go:build linux
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// sandboxInitArg marks a re-executed binary as the init of a process tool:
+// it confines itself, then executes the tool in its place. Go cannot set
+// the rlimits or install the seccomp filter of a child between fork and
+// exec, so the binary does it for its own child process.
+const sandboxInitArg = "aiguardrails-sandbox-init"
+
+// initSpec is what the init applies before it executes the tool.
+type initSpec struct {
+	Program    string        `json:"program"`
+	Argv       []string      `json:"argv"`
+	Dir        string        `json:"dir"` // the working directory, the only one left writable
+	Limits     ProcessLimits `json:"limits"`
+	Namespaces bool          `json:"namespaces"`
+	Seccomp    bool          `json:"seccomp"`
+	Required   bool          `json:"required"` // fail if seccomp cannot be installed
+}
+
+// initStatus is what the init reports on fd 3 before it executes the tool,
+// or the error that stopped it.
+type initStatus struct {
+	Isolation   []string `json:"isolation,omitempty"`
+	Error       string   `json:"error,omitempty"`
+	Unavailable bool     `json:"unavailable,omitempty"`
+}
+
+// SandboxInit runs the init of a process tool when the binary was started
+// as one, and never returns then; otherwise it returns at once. main, and
+// TestMain of tests running process tools, must call it first.
+func SandboxInit() {
+	if len(os.Args) < 3 || os.Args[1] != sandboxInitArg {
+		return
+	}
+	status := os.NewFile(3, "sandbox-status")
+	err := sandboxInit(os.Args[2], status)
+	json.NewEncoder(status).Encode(initStatus{Error: err.Error(), Unavailable: errors.Is(err, ErrIsolationUnavailable)})
+	os.Exit(126)
+}
+
+func sandboxInit(specJSON string, status *os.File) error {
+	var spec initSpec
+	if err := json.Unmarshal([]byte(specJSON), &spec); err != nil {
+		return err
+	}
+	// prctl applies to the calling thread, which must be the one to exec.
+	runtime.LockOSThread()
+
+	isolation := []string{"rlimits"}
+	if spec.Namespaces {
+		// Keep mounts made in the namespace from propagating to the host.
+		if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+			return fmt.Errorf("mount namespace: %w", err)
+		}
+		isolation = append(isolation, "user_namespace", "mount_namespace", "network_namespace")
+		switch err := readOnlyRoot(spec.Dir); {
+		case err == nil:
+			isolation = append(isolation, "read_only_fs")
+		case spec.Required:
+			return fmt.Errorf("%w: read-only filesystem: %v", ErrIsolationUnavailable, err)
+		}
+	}
+	if spec.Seccomp {
+		switch err := installSeccomp(); {
+		case err == nil:
+			isolation = append(isolation, "seccomp")
+		case spec.Required:
+			return fmt.Errorf("%w: seccomp: %v", ErrIsolationUnavailable, err)
+		}
+	}
+	ok, err := json.Marshal(initStatus{Isolation: isolation})
+	if err != nil {
+		return err
+	}
+	// The address space limit may be below what this process maps already,
+	// so nothing past this point should allocate much.
+	if err := setRlimits(spec.Limits); err != nil {
+		return err
+	}
+	if _, err := status.Write(append(ok, '\n')); err != nil {
+		return err
+	}
+	syscall.CloseOnExec(3)
+	return syscall.Exec(spec.Program, spec.Argv, os.Environ())
+}
+
+// mountFlags are the mount options a remount must keep: the namespace may
+// not drop those the host set.
+var mountFlags = map[string]uintptr{
+	"nosuid": syscall.MS_NOSUID, "nodev": syscall.MS_NODEV, "noexec": syscall.MS_NOEXEC,
+	"noatime": syscall.MS_NOATIME, "nodiratime": syscall.MS_NODIRATIME, "relatime": syscall.MS_RELATIME,
+	"strictatime": syscall.MS_STRICTATIME,
+}
+
+// readOnlyRoot leaves the tool only dir to write to: it bind-mounts dir on
+// itself, then remounts every other mount of the namespace read-only.
+func readOnlyRoot(dir string) error {
+	if dir == "" {
+		return errors.New("no working directory")
+	}
+	if err := syscall.Mount(dir, dir, "", syscall.MS_BIND, ""); err != nil {
+		return fmt.Errorf("bind %s: %w", dir, err)
+	}
+	// The working directory still refers to the directory under the mount.
+	if err := os.Chdir(dir); err != nil {
+		return err
+	}
+	info, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return err
+	}
+	// The work dir's own mount stays writable; the one it was bound from,
+	// like every other, does not.
+	for _, line := range strings.Split(strings.TrimSpace(string(info)), "\n") {
+		// id parent major:minor root mount-point options ...
+		fields := strings.Fields(line)
+		if len(fields) < 6 {
+			continue
+		}
+		target := unescapeMountPoint(fields[4])
+		if target == dir {
+			continue
+		}
+		flags := uintptr(syscall.MS_REMOUNT | syscall.MS_BIND | syscall.MS_RDONLY)
+		for _, opt := range strings.Split(fields[5], ",") {
+			flags |= mountFlags[opt]
+		}
+		if flags&(syscall.MS_NOATIME|syscall.MS_RELATIME) == 0 {
+			// mountinfo names no option for strictatime.
+			flags |= syscall.MS_STRICTATIME
+		}
+		if err := syscall.Mount("", target, "", flags, ""); err != nil {
+			return fmt.Errorf("remount %s read-only: %w", target, err)
+		}
+	}
+	return nil
+}
+
+// unescapeMountPoint decodes the octal escapes, such as \040 for a space,
+// of a mount point in /proc/self/mountinfo.
+func unescapeMountPoint(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// rlimitNproc is RLIMIT_NPROC, which package syscall lacks.
+const rlimitNproc = 6
+
+// setRlimits lowers this process's limits to l. A limit above the current
+// hard limit, which only a privileged process could raise, is clamped.
+func setRlimits(l ProcessLimits) error {
+	type rlimit struct {
+		name     string
+		resource int
+		cur, max uint64
+	}
+	limits := []rlimit{
+		// The tool gets SIGXCPU at the soft limit and SIGKILL a second later.
+		{"cpu", syscall.RLIMIT_CPU, uint64(l.CPUSeconds), uint64(l.CPUSeconds) + 1},
+		{"memory", syscall.RLIMIT_AS, uint64(l.MemoryBytes), uint64(l.MemoryBytes)},
+		{"file_size", syscall.RLIMIT_FSIZE, uint64(l.FileSizeBytes), uint64(l.FileSizeBytes)},
+		{"open_files", syscall.RLIMIT_NOFILE, uint64(l.OpenFiles), uint64(l.OpenFiles)},
+		{"core", syscall.RLIMIT_CORE, 0, 0},
+	}
+	if l.Processes > 0 {
+		limits = append(limits, rlimit{"processes", rlimitNproc, uint64(l.Processes), uint64(l.Processes)})
+	}
+	for _, lim := range limits {
+		var cur syscall.Rlimit
+		if err := syscall.Getrlimit(lim.resource, &cur); err != nil {
+			return fmt.Errorf("rlimit %s: %w", lim.name, err)
+		}
+		lim.max = min(lim.max, cur.Max)
+		lim.cur = min(lim.cur, lim.max)
+		if err := syscall.Setrlimit(lim.resource, &syscall.Rlimit{Cur: lim.cur, Max: lim.max}); err != nil {
+			return fmt.Errorf("rlimit %s: %w", lim.name, err)
+		}
+	}
+	return nil
+}
+
+// Seccomp constants package syscall lacks.
+const (
+	prSetNoNewPrivs   = 38
+	seccompModeFilter = 2
+	seccompRetAllow   = 0x7fff0000
+	seccompRetErrno   = 0x00050000
+	x32SyscallBit     = 0x40000000
+	sysClone3         = 435 // the same on amd64 and arm64
+)
+
+// cloneNamespaces are the clone flags creating namespaces.
+const cloneNamespaces = syscall.CLONE_NEWNS | syscall.CLONE_NEWUTS | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUSER |
+	syscall.CLONE_NEWPID | syscall.CLONE_NEWNET | syscall.CLONE_NEWCGROUP
+
+// seccompArch is the audit arch the filter accepts and the syscalls it
+// denies beyond seccompDenied that package syscall has no names for.
+var seccompArch = map[string]struct {
+	audit uint32
+	extra []uint32
+}{
+	// process_vm_readv, process_vm_writev, open_by_handle_at, setns,
+	// finit_module, bpf, userfaultfd
+	"amd64": {0xc000003e, []uint32{310, 311, 304, 308, 313, 321, 323}},
+	"arm64": {0xc00000b7, []uint32{270, 271, 265, 268, 273, 280, 282}},
+}
+
+// seccompDenied are the syscalls a tool has no business making: they
+// administer the host, escape or re-enter namespaces, or inspect other
+// processes. They fail with EPERM.
+var seccompDenied = []uint32{
+	syscall.SYS_PTRACE, syscall.SYS_MOUNT, syscall.SYS_UMOUNT2, syscall.SYS_PIVOT_ROOT,
+	syscall.SYS_CHROOT, syscall.SYS_UNSHARE, syscall.SYS_REBOOT, syscall.SYS_KEXEC_LOAD,
+	syscall.SYS_INIT_MODULE, syscall.SYS_DELETE_MODULE, syscall.SYS_SWAPON, syscall.SYS_SWAPOFF,
+	syscall.SYS_ACCT, syscall.SYS_SETTIMEOFDAY, syscall.SYS_CLOCK_SETTIME, syscall.SYS_SYSLOG,
+	syscall.SYS_KEYCTL, syscall.SYS_ADD_KEY, syscall.SYS_REQUEST_KEY, syscall.SYS_PERF_EVENT_OPEN,
+}
+
+// installSeccomp installs a filter denying seccompDenied, every syscall of
+// another ABI and clone with namespace flags, to this thread and what it
+// executes. clone3, whose flags the filter cannot read, fails with ENOSYS
+// so that the C library falls back to clone.
+func installSeccomp() error {
+	arch, ok := seccompArch[runtime.GOARCH]
+	if !ok {
+		return fmt.Errorf("no filter for %s", runtime.GOARCH)
+	}
+	denied := append(append([]uint32{}, seccompDenied...), arch.extra...)
+	stmt := func(code uint16, k uint32) syscall.SockFilter { return syscall.SockFilter{Code: code, K: k} }
+	jump := func(code uint16, k uint32, jt, jf uint8) syscall.SockFilter {
+		return syscall.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+	}
+
+	// seccomp_data: nr at offset 0, arch at 4, the low half of the first
+	// argument at 16 on these little-endian arches.
+	prog := []syscall.SockFilter{
+		stmt(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, 4),
+		jump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, arch.audit, 1, 0),
+		stmt(syscall.BPF_RET|syscall.BPF_K, seccompRetErrno|uint32(syscall.EPERM)),
+		stmt(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, 0),
+	}
+	// Jumps only go forward: each check jumps over the checks after it to
+	// the returns at the end, allow, deny and ENOSYS.
+	const tail = 4 // clone3, clone, the argument load and the flag test
+	checks := len(denied) + tail
+	if runtime.GOARCH == "amd64" {
+		prog = append(prog, jump(syscall.BPF_JMP|syscall.BPF_JGE|syscall.BPF_K, x32SyscallBit, uint8(checks+1), 0))
+	}
+	for _, nr := range denied {
+		prog = append(prog, jump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, nr, uint8(checks), 0))
+		checks--
+	}
+	prog = append(prog,
+		jump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, sysClone3, 5, 0),
+		jump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, syscall.SYS_CLONE, 0, 2),
+		stmt(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, 16),
+		jump(syscall.BPF_JMP|syscall.BPF_JSET|syscall.BPF_K, cloneNamespaces, 1, 0),
+		stmt(syscall.BPF_RET|syscall.BPF_K, seccompRetAllow),
+		stmt(syscall.BPF_RET|syscall.BPF_K, seccompRetErrno|uint32(syscall.EPERM)),
+		stmt(syscall.BPF_RET|syscall.BPF_K, seccompRetErrno|uint32(syscall.ENOSYS)),
+	)
+
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return fmt.Errorf("no_new_privs: %w", errno)
+	}
+	fprog := syscall.SockFprog{Len: uint16(len(prog)), Filter: &prog[0]}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_SET_SECCOMP, seccompModeFilter, uintptr(unsafe.Pointer(&fprog))); errno != 0 {
+		return fmt.Errorf("seccomp filter: %w", errno)
+	}
+	return nil
+}
+
+// runProcess runs the tool through the sandbox init, in namespaces unless
+// the isolation is none. In auto mode a host that refuses the namespaces,
+// such as a container without user namespaces, runs the tool without them.
+func runProcess(ctx context.Context, p *processSpec) (*ProcessResult, error) {
+	namespaces := p.Isolation != IsolationNone
+	res, err := runInit(ctx, p, namespaces)
+	if err != nil && namespaces && namespacesRefused(err) {
+		if p.Isolation == IsolationRequired {
+			return nil, fmt.Errorf("%w: namespaces: %v", ErrIsolationUnavailable, err)
+		}
+		res, err = runInit(ctx, p, false)
+	}
+	return res, err
+}
+
+func namespacesRefused(err error) bool {
+	return errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EINVAL) ||
+		errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EUSERS)
+}
+
+func runInit(ctx context.Context, p *processSpec, namespaces bool) (*ProcessResult, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	spec, err := json.Marshal(initSpec{
+		Program:    p.Program,
+		Argv:       p.Argv,
+		Dir:        p.Dir,
+		Limits:     p.Limits,
+		Namespaces: namespaces,
+		Seccomp:    p.Isolation != IsolationNone,
+		Required:   p.Isolation == IsolationRequired,
+	})
+	if err != nil {
+		return nil, err
+	}
+	statusR, statusW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer statusR.Close()
+	defer statusW.Close()
+
+	cmd := exec.CommandContext(ctx, self, sandboxInitArg, string(spec))
+	cmd.ExtraFiles = []*os.File{statusW}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if namespaces {
+		// The server's user is root in the namespace, with no say over
+		// anything outside it; the network namespace has no interfaces up.
+		cmd.SysProcAttr.Cloneflags = syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWNET
+		cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}}
+		cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}}
+	}
+	// Kill the whole process group, not only the tool's first process.
+	cmd.Cancel = func() error { return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL) }
+
+	statusCh := make(chan initStatus, 1)
+	res, err := runCommand(ctx, cmd, p, func() {
+		statusW.Close()
+		go func() {
+			// The init reports its isolation, then an error if exec failed.
+			var st initStatus
+			dec := json.NewDecoder(statusR)
+			for {
+				var v initStatus
+				if dec.Decode(&v) != nil {
+					break
+				}
+				if v.Error != "" {
+					st.Error, st.Unavailable = v.Error, v.Unavailable
+				} else {
+					st.Isolation = v.Isolation
+				}
+			}
+			statusCh <- st
+		}()
+	})
+	if err != nil {
+		return nil, err
+	}
+	st := <-statusCh
+	if st.Error != "" {
+		if st.Unavailable {
+			return nil, fmt.Errorf("%w: %s", ErrIsolationUnavailable, st.Error)
+		}
+		return nil, fmt.Errorf("sandbox init: %s", st.Error)
+	}
+	res.Isolation = st.Isolation
+	return res, nil
+}
+
+// exitStatus fills in how the tool exited, and the rlimit that killed it.
+func exitStatus(state *os.ProcessState, res *ProcessResult) {
+	res.ExitCode = state.ExitCode()
+	ws, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() {
+		return
+	}
+	res.Signal = ws.Signal().String()
+	switch ws.Signal() {
+	case syscall.SIGXCPU:
+		res.Limit = "cpu"
+	case syscall.SIGXFSZ:
+		res.Limit = "file_size"
+	}
+}
@@ -0,0 +1,167 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	SandboxInit()
+	if os.Getenv("AGENT_TEST_CLONE") != "" {
+		tryClone()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// tryClone reports whether clone3 and clone with a namespace flag fail, as
+// a process tool run by TestSeccompClone.
+func tryClone() {
+	_, _, errno := syscall.RawSyscall(sysClone3, 0, 0, 0)
+	fmt.Println("clone3:", errno == syscall.ENOSYS)
+	pid, _, errno := syscall.RawSyscall6(syscall.SYS_CLONE, syscall.CLONE_NEWUSER|uintptr(syscall.SIGCHLD), 0, 0, 0, 0, 0)
+	if errno == 0 && pid == 0 {
+		syscall.RawSyscall(syscall.SYS_EXIT, 0, 0, 0)
+	}
+	fmt.Println("clone_newuser:", errno == syscall.EPERM)
+}
+
+func shellTool(t *testing.T, script string, limits ProcessLimits) *ProcessExecutor {
+	return NewProcessExecutor(ProcessTool{
+		Name:     "script",
+		Command:  []string{"sh", "-c", script, "sh", "{{msg}}"},
+		WorkRoot: t.TempDir(),
+		Limits:   limits,
+	})
+}
+
+func runTool(t *testing.T, e *ProcessExecutor, args map[string]interface{}) *ProcessResult {
+	t.Helper()
+	res, err := e.Execute(context.Background(), args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.(*ProcessResult)
+}
+
+func TestProcessExecutorRunsCommand(t *testing.T) {
+	e := shellTool(t, `echo "$1"; cat; echo; pwd; echo oops >&2; exit 3`, ProcessLimits{})
+	res := runTool(t, e, map[string]interface{}{"msg": "hello; rm -rf /"})
+	lines := strings.Split(res.Stdout, "\n")
+	if len(lines) < 3 || lines[0] != "hello; rm -rf /" || lines[1] != `{"msg":"hello; rm -rf /"}` {
+		t.Fatalf("expected the argument verbatim and the args on stdin: %q", res.Stdout)
+	}
+	if !strings.HasPrefix(lines[2], filepath.Join(e.tool.WorkRoot, "tool-run-")) {
+		t.Fatalf("expected a run dir under the work root: %q", lines[2])
+	}
+	if res.ExitCode != 3 || res.Signal != "" || res.Stderr != "oops\n" {
+		t.Fatalf("unexpected exit status: %+v", res)
+	}
+	if len(res.Isolation) == 0 || res.Isolation[0] != "rlimits" {
+		t.Fatalf("expected rlimits: %v", res.Isolation)
+	}
+	if entries, _ := os.ReadDir(e.tool.WorkRoot); len(entries) != 0 {
+		t.Fatalf("expected the run dir removed: %v", entries)
+	}
+}
+
+func TestProcessExecutorLimits(t *testing.T) {
+	sb := NewSandbox(10*time.Second, 64<<20, nil)
+	e := shellTool(t, `ulimit -v; ulimit -n; exec head -c 100000 /dev/zero > big`, ProcessLimits{FileSizeBytes: 4096, OpenFiles: 32})
+	out, err := sb.Execute(context.Background(), e, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := out.(*ProcessResult)
+	if res.Stdout != "65536\n32\n" {
+		t.Fatalf("expected the sandbox memory limit and the open files limit: %q", res.Stdout)
+	}
+	if res.Limit != "file_size" || res.Signal == "" {
+		t.Fatalf("expected the file size limit to stop the write: %+v", res)
+	}
+
+	res = runTool(t, shellTool(t, `while :; do :; done`, ProcessLimits{CPUSeconds: 1}), nil)
+	if res.Limit != "cpu" || res.ExitCode != -1 {
+		t.Fatalf("expected the cpu limit to kill the loop: %+v", res)
+	}
+
+	res = runTool(t, shellTool(t, `head -c 100000 /dev/zero | tr '\0' x; echo done >&2`, ProcessLimits{OutputBytes: 10}), nil)
+	if res.Stdout != "xxxxxxxxxx" || !res.StdoutTruncated || res.Stderr != "done\n" || res.ExitCode != 0 {
+		t.Fatalf("expected stdout capped: %+v", res)
+	}
+}
+
+func TestProcessExecutorIsolation(t *testing.T) {
+	res := runTool(t, shellTool(t, `grep -E '^(Seccomp|NoNewPrivs):' /proc/self/status; ls /sys/class/net`, ProcessLimits{}), nil)
+	has := map[string]bool{}
+	for _, i := range res.Isolation {
+		has[i] = true
+	}
+	if has["seccomp"] && !strings.Contains(res.Stdout, "Seccomp:\t2") {
+		t.Fatalf("expected a seccomp filter: %q", res.Stdout)
+	}
+	if has["network_namespace"] && !strings.HasSuffix(res.Stdout, "\nlo\n") {
+		t.Fatalf("expected only loopback in the network namespace: %q", res.Stdout)
+	}
+
+	outside := t.TempDir()
+	res = runTool(t, shellTool(t, `echo x > own && cat own && echo x > `+outside+`/escaped`, ProcessLimits{}), nil)
+	_, err := os.Stat(filepath.Join(outside, "escaped"))
+	if res.Stdout != "x\n" || (has["read_only_fs"] && (res.ExitCode == 0 || err == nil)) {
+		t.Fatalf("expected only the work dir writable: %+v %v", res, err)
+	}
+	t.Logf("isolation: %v", res.Isolation)
+
+	e := shellTool(t, `true`, ProcessLimits{})
+	e.tool.Isolation = IsolationNone
+	if res := runTool(t, e, nil); len(res.Isolation) != 1 {
+		t.Fatalf("expected rlimits only: %v", res.Isolation)
+	}
+}
+
+func TestSeccompClone(t *testing.T) {
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewProcessExecutor(ProcessTool{Name: "clone", Command: []string{self}, Env: map[string]string{"AGENT_TEST_CLONE": "1"}, WorkRoot: t.TempDir(),
+		// The Go runtime reserves more address space than the default allows.
+		Limits: ProcessLimits{MemoryBytes: 16 << 30}})
+	res := runTool(t, e, nil)
+	if !slices.Contains(res.Isolation, "seccomp") {
+		t.Skipf("no seccomp here: %v", res.Isolation)
+	}
+	if res.Stdout != "clone3: true\nclone_newuser: true\n" {
+		t.Fatalf("expected clone3 and namespace clones refused: %+v", res)
+	}
+}
+
+func TestSandboxProcessSemantics(t *testing.T) {
+	sb := NewSandbox(200*time.Millisecond, 0, nil)
+	start := time.Now()
+	if _, err := sb.Execute(context.Background(), shellTool(t, `sleep 5`, ProcessLimits{}), nil); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected a timeout: %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatalf("timeout took %v", time.Since(start))
+	}
+
+	rm := NewProcessExecutor(ProcessTool{Name: "cleanup", Command: []string{"/bin/rm", "-rf", "{{msg}}"}, WorkRoot: t.TempDir()})
+	if _, err := sb.Execute(context.Background(), rm, nil); !errors.Is(err, ErrToolNotAllowed) {
+		t.Fatalf("expected the deny list to apply to the program: %v", err)
+	}
+
+	var argsErr *ArgsError
+	_, err := sb.Execute(context.Background(), shellTool(t, `cat "$1"`, ProcessLimits{}), map[string]interface{}{"msg": "../../etc/passwd"})
+	if !errors.As(err, &argsErr) || argsErr.Violations[0].Rule != "workdir" {
+		t.Fatalf("expected the path confined to the work dir: %v", err)
+	}
+}
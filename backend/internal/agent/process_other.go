@@ -0,0 +1,27 @@
+//go:build !linux
+
+package agent
+
+import (
+	"context"
+	"os"
+	"os/exec"
+)
+
+// SandboxInit is a no-op: process tools run without an init off Linux.
+func SandboxInit() {}
+
+// runProcess runs the tool directly: rlimits, namespaces and seccomp are
+// Linux only, so required isolation cannot be had.
+func runProcess(ctx context.Context, p *processSpec) (*ProcessResult, error) {
+	if p.Isolation == IsolationRequired {
+		return nil, ErrIsolationUnavailable
+	}
+	cmd := exec.CommandContext(ctx, p.Program, p.Argv[1:]...)
+	return runCommand(ctx, cmd, p, nil)
+}
+
+// exitStatus fills in how the tool exited.
+func exitStatus(state *os.ProcessState, res *ProcessResult) {
+	res.ExitCode = state.ExitCode()
+}
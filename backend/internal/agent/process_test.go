@@ -0,0 +1,23 @@
+package agent
+
+import "testing"
+
+func TestConfineArgs(t *testing.T) {
+	for _, s := range []string{
+		"/etc/passwd", "../../etc/passwd", "~/.ssh/id_rsa", "file:///etc/passwd",
+		"--file=/etc/passwd", "out=/etc/shadow", "-o/root/x", "-o../x", "--in=a,/etc/hosts",
+		"user@/srv/data", "dst:/var/lib", "--out=data/../../etc",
+	} {
+		if vs := confineArgs(map[string]interface{}{"a": s}); len(vs) != 1 || vs[0].Rule != "workdir" {
+			t.Fatalf("%q: expected a workdir violation: %+v", s, vs)
+		}
+	}
+	for _, s := range []string{
+		"report.txt", "out/data.csv", "--file=out/data.csv", "-oout.txt", "https://example.com/a/b",
+		"--url=https://example.com/x", "a=b", "ratio 1:2",
+	} {
+		if vs := confineArgs(map[string]interface{}{"a": s}); len(vs) != 0 {
+			t.Fatalf("%q: expected no violation: %+v", s, vs)
+		}
+	}
+}
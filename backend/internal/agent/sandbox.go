@@ -3,6 +3,7 @@ package agent
 import (
 	"context"
 	"errors"
+	"path/filepath"
 	"strings"
 	"time"
 )
@@ -75,25 +76,52 @@ func (s *Sandbox) ValidateTool(tool string) error {
 	return nil
 }
 
-// Execute runs a tool in sandbox with constraints.
-func (s *Sandbox) Execute(ctx context.Context, tool string, args map[string]interface{}) (interface{}, error) {
-	// Validate tool first
-	if err := s.ValidateTool(tool); err != nil {
+// ValidateCommand checks if a program a tool runs is allowed: its base name
+// must pass the deny list. The allowlist names tools, not programs.
+func (s *Sandbox) ValidateCommand(program string) error {
+	base := strings.ToLower(filepath.Base(program))
+	for _, denied := range s.denyList {
+		if strings.Contains(base, denied) {
+			return ErrToolNotAllowed
+		}
+	}
+	return nil
+}
+
+// SandboxedExecutor is an executor that enforces the sandbox's limits on the
+// work it starts itself, such as ProcessExecutor.
+type SandboxedExecutor interface {
+	Executor
+	ExecuteIn(ctx context.Context, s *Sandbox, args map[string]interface{}) (interface{}, error)
+}
+
+// Execute runs a tool's executor under the sandbox constraints: the tool
+// must pass ValidateTool, its arguments must match its schema (*ArgsError
+// otherwise) and it must finish within the timeout. A SandboxedExecutor
+// is handed the sandbox to apply its other limits.
+func (s *Sandbox) Execute(ctx context.Context, exec Executor, args map[string]interface{}) (interface{}, error) {
+	if err := s.ValidateTool(exec.Name()); err != nil {
 		return nil, err
 	}
+	if vs := ValidateArgs(exec.Schema(), args); len(vs) > 0 {
+		return nil, &ArgsError{Tool: exec.Name(), Violations: vs}
+	}
 
-	// Create timeout context
 	execCtx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
-	// Execute in goroutine with result channel
 	resultCh := make(chan sandboxResult, 1)
 	go func() {
-		result, err := s.executeInternal(tool, args)
+		var result interface{}
+		var err error
+		if se, ok := exec.(SandboxedExecutor); ok {
+			result, err = se.ExecuteIn(execCtx, s, args)
+		} else {
+			result, err = exec.Execute(execCtx, args)
+		}
 		resultCh <- sandboxResult{result: result, err: err}
 	}()
 
-	// Wait for result or timeout
 	select {
 	case <-execCtx.Done():
 		return nil, ErrTimeout
@@ -107,24 +135,9 @@ type sandboxResult struct {
 	err    error
 }
 
-// executeInternal performs the actual execution.
-// In production, this would use process isolation or containers.
-func (s *Sandbox) executeInternal(tool string, args map[string]interface{}) (interface{}, error) {
-	// Stub implementation - in production:
-	// 1. Fork a subprocess with resource limits (cgroups, rlimit)
-	// 2. Set up seccomp filters
-	// 3. Use namespaces for isolation
-	// 4. Monitor memory usage
-
-	// For now, simulate execution
-	time.Sleep(10 * time.Millisecond)
-
-	return map[string]interface{}{
-		"tool":   tool,
-		"args":   args,
-		"status": "executed",
-		"output": "Sandbox execution stub",
-	}, nil
+// MemLimit returns the memory limit executors should enforce, in bytes.
+func (s *Sandbox) MemLimit() int64 {
+	return s.memLimit
 }
 
 // SetTimeout updates the timeout.
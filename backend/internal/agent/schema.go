@@ -0,0 +1,322 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInvalidArgs means a tool call's arguments do not match the tool's schema.
+var ErrInvalidArgs = errors.New("tool arguments invalid")
+
+// Violation is one reason a tool call was rejected.
+type Violation struct {
+	Path    string `json:"path,omitempty"` // argument path, e.g. "limit", "filter.owner", "ids[2]"; empty for the whole call
+	Rule    string `json:"rule"`           // schema keyword, argument rule or policy reason
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	if v.Path == "" {
+		return fmt.Sprintf("%s: %s", v.Rule, v.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", v.Path, v.Rule, v.Message)
+}
+
+func violationStrings(vs []Violation) []string {
+	out := make([]string, 0, len(vs))
+	for _, v := range vs {
+		out = append(out, v.String())
+	}
+	return out
+}
+
+// ArgsError reports the schema violations of a tool call.
+type ArgsError struct {
+	Tool       string
+	Violations []Violation
+}
+
+func (e *ArgsError) Error() string {
+	return fmt.Sprintf("%v for %s: %s", ErrInvalidArgs, e.Tool, strings.Join(violationStrings(e.Violations), "; "))
+}
+
+func (e *ArgsError) Unwrap() error { return ErrInvalidArgs }
+
+// maxSchemaViolations bounds the violations reported for one call.
+const maxSchemaViolations = 10
+
+// ValidateArgs checks args against a JSON schema. It supports the keywords
+// tools describe their arguments with: type, enum, const, properties,
+// required, additionalProperties, items, minItems, maxItems, minLength,
+// maxLength, pattern, minimum, maximum, exclusiveMinimum, exclusiveMaximum,
+// multipleOf, allOf, anyOf, oneOf and not. A nil schema accepts anything.
+func ValidateArgs(schema map[string]interface{}, args map[string]interface{}) []Violation {
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	var out []Violation
+	validateValue(subSchema(asJSON(schema)), asJSON(args), "", &out)
+	if len(out) > maxSchemaViolations {
+		out = out[:maxSchemaViolations]
+	}
+	return out
+}
+
+func validateValue(schema map[string]interface{}, v interface{}, path string, out *[]Violation) {
+	if schema == nil {
+		return
+	}
+	add := func(rule, format string, a ...interface{}) {
+		*out = append(*out, Violation{Path: path, Rule: rule, Message: fmt.Sprintf(format, a...)})
+	}
+
+	if t, ok := schema["type"]; ok {
+		types := schemaTypes(t)
+		if len(types) > 0 && !matchesAnyType(v, types) {
+			add("type", "expected %s, got %s", strings.Join(types, " or "), jsonType(v))
+			return
+		}
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if reflect.DeepEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			add("enum", "%s is not one of the allowed values", preview(v))
+		}
+	}
+	if c, ok := schema["const"]; ok && !reflect.DeepEqual(c, v) {
+		add("const", "must be %s", preview(c))
+	}
+
+	switch val := v.(type) {
+	case map[string]interface{}:
+		validateObject(schema, val, path, out)
+	case []interface{}:
+		validateArray(schema, val, path, out)
+	case string:
+		n := utf8.RuneCountInString(val)
+		if min, ok := number(schema["minLength"]); ok && float64(n) < min {
+			add("minLength", "length %d below %v", n, min)
+		}
+		if max, ok := number(schema["maxLength"]); ok && float64(n) > max {
+			add("maxLength", "length %d above %v", n, max)
+		}
+		if p, ok := schema["pattern"].(string); ok {
+			re, err := regexp.Compile(p)
+			switch {
+			case err != nil:
+				add("pattern", "schema pattern %q does not compile", p)
+			case !re.MatchString(val):
+				add("pattern", "%s does not match %q", preview(val), p)
+			}
+		}
+	default:
+		if f, ok := number(v); ok {
+			validateNumber(schema, f, add)
+		}
+	}
+
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			validateValue(subSchema(sub), v, path, out)
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		if countMatches(anyOf, v) == 0 {
+			add("anyOf", "matches none of the allowed schemas")
+		}
+	}
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		if n := countMatches(oneOf, v); n != 1 {
+			add("oneOf", "matches %d of the schemas, expected exactly 1", n)
+		}
+	}
+	if not, ok := schema["not"]; ok {
+		var sub []Violation
+		validateValue(subSchema(not), v, path, &sub)
+		if len(sub) == 0 {
+			add("not", "matches a disallowed schema")
+		}
+	}
+}
+
+func validateObject(schema map[string]interface{}, obj map[string]interface{}, path string, out *[]Violation) {
+	props, _ := schema["properties"].(map[string]interface{})
+	if req, ok := schema["required"].([]interface{}); ok {
+		for _, r := range req {
+			name, _ := r.(string)
+			if _, present := obj[name]; name != "" && !present {
+				*out = append(*out, Violation{Path: joinPath(path, name), Rule: "required", Message: "missing required argument"})
+			}
+		}
+	}
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if sub, ok := props[k]; ok {
+			validateValue(subSchema(sub), obj[k], joinPath(path, k), out)
+			continue
+		}
+		switch extra := schema["additionalProperties"].(type) {
+		case bool:
+			if !extra {
+				*out = append(*out, Violation{Path: joinPath(path, k), Rule: "additionalProperties", Message: "unexpected argument"})
+			}
+		case map[string]interface{}:
+			validateValue(extra, obj[k], joinPath(path, k), out)
+		}
+	}
+}
+
+func validateArray(schema map[string]interface{}, arr []interface{}, path string, out *[]Violation) {
+	if min, ok := number(schema["minItems"]); ok && float64(len(arr)) < min {
+		*out = append(*out, Violation{Path: path, Rule: "minItems", Message: fmt.Sprintf("%d items, at least %v required", len(arr), min)})
+	}
+	if max, ok := number(schema["maxItems"]); ok && float64(len(arr)) > max {
+		*out = append(*out, Violation{Path: path, Rule: "maxItems", Message: fmt.Sprintf("%d items, at most %v allowed", len(arr), max)})
+	}
+	if items := subSchema(schema["items"]); items != nil {
+		for i, item := range arr {
+			validateValue(items, item, fmt.Sprintf("%s[%d]", path, i), out)
+		}
+	}
+}
+
+func validateNumber(schema map[string]interface{}, f float64, add func(rule, format string, a ...interface{})) {
+	if min, ok := number(schema["minimum"]); ok && f < min {
+		add("minimum", "%v below minimum %v", f, min)
+	}
+	if max, ok := number(schema["maximum"]); ok && f > max {
+		add("maximum", "%v above maximum %v", f, max)
+	}
+	if min, ok := number(schema["exclusiveMinimum"]); ok && f <= min {
+		add("exclusiveMinimum", "%v must be above %v", f, min)
+	}
+	if max, ok := number(schema["exclusiveMaximum"]); ok && f >= max {
+		add("exclusiveMaximum", "%v must be below %v", f, max)
+	}
+	if m, ok := number(schema["multipleOf"]); ok && m > 0 {
+		if q := f / m; math.Abs(q-math.Round(q)) > 1e-9 {
+			add("multipleOf", "%v is not a multiple of %v", f, m)
+		}
+	}
+}
+
+func countMatches(schemas []interface{}, v interface{}) int {
+	n := 0
+	for _, s := range schemas {
+		var sub []Violation
+		validateValue(subSchema(s), v, "", &sub)
+		if len(sub) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func subSchema(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
+
+func schemaTypes(t interface{}) []string {
+	switch v := t.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var out []string
+		for _, s := range v {
+			if str, ok := s.(string); ok {
+				out = append(out, str)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func matchesAnyType(v interface{}, types []string) bool {
+	actual := jsonType(v)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonType names the JSON type of a decoded value; whole numbers are "integer".
+func jsonType(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	default:
+		if f, ok := number(val); ok {
+			if f == math.Trunc(f) && !math.IsInf(f, 0) {
+				return "integer"
+			}
+			return "number"
+		}
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// number returns a decoded JSON number.
+func number(v interface{}) (float64, bool) {
+	f, ok := v.(float64)
+	return f, ok
+}
+
+// asJSON renders v as decoded JSON, so that schemas and arguments written as
+// Go values ([]string, int) check the same as the planner's JSON.
+func asJSON(v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out interface{}
+	if err := json.Unmarshal(b, &out); err != nil {
+		return v
+	}
+	return out
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// preview renders a value for a violation message.
+func preview(v interface{}) string {
+	b, _ := json.Marshal(v)
+	s := string(b)
+	if len(s) > 64 {
+		s = s[:64] + "..."
+	}
+	return s
+}
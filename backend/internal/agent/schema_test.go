@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateArgs(t *testing.T) {
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"query": map[string]interface{}{"type": "string", "minLength": 1, "maxLength": 20},
+			"limit": map[string]interface{}{"type": "integer", "minimum": 1, "maximum": 50},
+			"sort":  map[string]interface{}{"enum": []string{"asc", "desc"}},
+			"ids":   map[string]interface{}{"type": "array", "maxItems": 3, "items": map[string]interface{}{"type": "string", "pattern": "^[a-z]+-[0-9]+$"}},
+			"filter": map[string]interface{}{
+				"type":                 "object",
+				"properties":           map[string]interface{}{"owner": map[string]interface{}{"type": "string"}},
+				"additionalProperties": false,
+			},
+		},
+		"required":             []string{"query"},
+		"additionalProperties": false,
+	}
+	if vs := ValidateArgs(schema, map[string]interface{}{"query": "orders", "limit": 10, "sort": "asc", "ids": []string{"ord-1"}, "filter": map[string]interface{}{"owner": "alice"}}); len(vs) != 0 {
+		t.Fatalf("unexpected violations: %v", vs)
+	}
+
+	cases := []struct {
+		args map[string]interface{}
+		path string
+		rule string
+	}{
+		{map[string]interface{}{}, "query", "required"},
+		{map[string]interface{}{"query": 42}, "query", "type"},
+		{map[string]interface{}{"query": strings.Repeat("x", 21)}, "query", "maxLength"},
+		{map[string]interface{}{"query": "q", "limit": 500}, "limit", "maximum"},
+		{map[string]interface{}{"query": "q", "limit": 2.5}, "limit", "type"},
+		{map[string]interface{}{"query": "q", "sort": "random"}, "sort", "enum"},
+		{map[string]interface{}{"query": "q", "ids": []string{"ord-1", "../etc"}}, "ids[1]", "pattern"},
+		{map[string]interface{}{"query": "q", "ids": []string{"a-1", "b-2", "c-3", "d-4"}}, "ids", "maxItems"},
+		{map[string]interface{}{"query": "q", "filter": map[string]interface{}{"tenant": "other"}}, "filter.tenant", "additionalProperties"},
+		{map[string]interface{}{"query": "q", "shell": "rm -rf /"}, "shell", "additionalProperties"},
+	}
+	for _, tc := range cases {
+		vs := ValidateArgs(schema, tc.args)
+		if len(vs) != 1 || vs[0].Path != tc.path || vs[0].Rule != tc.rule {
+			t.Fatalf("%v: expected %s %s, got %v", tc.args, tc.path, tc.rule, vs)
+		}
+	}
+
+	anyOf := map[string]interface{}{"anyOf": []interface{}{
+		map[string]interface{}{"required": []string{"id"}},
+		map[string]interface{}{"required": []string{"email"}},
+	}}
+	if vs := ValidateArgs(anyOf, map[string]interface{}{"name": "x"}); len(vs) != 1 || vs[0].Rule != "anyOf" {
+		t.Fatalf("expected anyOf violation, got %v", vs)
+	}
+	if vs := ValidateArgs(nil, map[string]interface{}{"anything": 1}); len(vs) != 0 {
+		t.Fatalf("nil schema accepts anything: %v", vs)
+	}
+}
+
+func TestSandboxRejectsInvalidArgs(t *testing.T) {
+	tool := orderTool("shipped")
+	_, err := NewSandbox(time.Second, 0, nil).Execute(context.Background(), tool, map[string]interface{}{"id": 42})
+	var argsErr *ArgsError
+	if !errors.Is(err, ErrInvalidArgs) || !errors.As(err, &argsErr) || argsErr.Violations[0].Path != "id" {
+		t.Fatalf("expected ArgsError, got %v", err)
+	}
+	if tool.calls != 0 {
+		t.Fatalf("tool must not run with invalid arguments")
+	}
+}
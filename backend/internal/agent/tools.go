@@ -0,0 +1,118 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"aiguardrails/internal/promptfw"
+	"aiguardrails/internal/secret"
+)
+
+// ToolsConfig is a file of declarative tool definitions, e.g.
+//
+//	{"process": [{"name": "word_count", "command": ["wc", "-w"], "limits": {"cpu_seconds": 2}}],
+//	 "http": [{"name": "lookup_order", "url": "https://orders.internal/v1/orders/{{id}}"}]}
+type ToolsConfig struct {
+	Process []ProcessTool `json:"process,omitempty"`
+	HTTP    []HTTPTool    `json:"http,omitempty"`
+}
+
+// ToolEnv is what declarative tools are built with.
+type ToolEnv struct {
+	WorkRoot string // work root of process tools that name none
+	Secrets  secret.Provider
+	Egress   EgressAllowlist
+	Firewall *promptfw.Firewall
+}
+
+// LoadTools reads a tools file.
+func LoadTools(path string) (*ToolsConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c ToolsConfig
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("tools file %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Register validates the tools and registers their executors.
+func (c *ToolsConfig) Register(r *Registry, env ToolEnv) error {
+	seen := map[string]bool{}
+	for _, t := range c.Process {
+		if err := validateProcessTool(t, seen); err != nil {
+			return err
+		}
+		if t.WorkRoot == "" {
+			t.WorkRoot = env.WorkRoot
+		}
+		if err := r.Register(NewProcessExecutor(t)); err != nil {
+			return err
+		}
+	}
+	for _, t := range c.HTTP {
+		if err := validateHTTPTool(t, seen); err != nil {
+			return err
+		}
+		if err := r.Register(NewHTTPExecutor(t, env.Secrets, env.Egress, env.Firewall)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateProcessTool(t ProcessTool, seen map[string]bool) error {
+	switch {
+	case t.Name == "":
+		return fmt.Errorf("process tool without a name")
+	case seen[t.Name]:
+		return fmt.Errorf("tool %s defined twice", t.Name)
+	case len(t.Command) == 0 || t.Command[0] == "":
+		return fmt.Errorf("process tool %s: no command", t.Name)
+	case placeholder.MatchString(t.Command[0]):
+		return fmt.Errorf("process tool %s: the program cannot be an argument", t.Name)
+	}
+	switch t.Isolation {
+	case "", IsolationNone, IsolationAuto, IsolationRequired:
+	default:
+		return fmt.Errorf("process tool %s: unknown isolation %q", t.Name, t.Isolation)
+	}
+	seen[t.Name] = true
+	return nil
+}
+
+func validateHTTPTool(t HTTPTool, seen map[string]bool) error {
+	switch {
+	case t.Name == "":
+		return fmt.Errorf("http tool without a name")
+	case seen[t.Name]:
+		return fmt.Errorf("tool %s defined twice", t.Name)
+	}
+	u, err := url.Parse(placeholder.ReplaceAllString(t.URL, "x"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("http tool %s: url %q is not an http(s) URL", t.Name, t.URL)
+	}
+	authority := t.URL[strings.Index(t.URL, "://")+3:]
+	authority = authority[:strings.IndexAny(authority+"/", "/?#")]
+	if placeholder.MatchString(authority) {
+		return fmt.Errorf("http tool %s: the host cannot be an argument", t.Name)
+	}
+	for k, v := range t.Headers {
+		if placeholder.MatchString(secretRef.ReplaceAllString(v, "")) {
+			return fmt.Errorf("http tool %s: header %s can only name secrets", t.Name, k)
+		}
+	}
+	if err := ValidateEgress(t.AllowedHosts); err != nil {
+		return fmt.Errorf("http tool %s: %v", t.Name, err)
+	}
+	if t.TimeoutSec < 0 {
+		return fmt.Errorf("http tool %s: negative timeout_sec", t.Name)
+	}
+	seen[t.Name] = true
+	return nil
+}
@@ -0,0 +1,60 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadTools(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tools.json")
+	os.WriteFile(path, []byte(`{"process":[{"name":"word_count","description":"count words","command":["wc","-w"],"limits":{"cpu_seconds":2}}],
+		"http":[{"name":"lookup_order","url":"https://orders.internal/v1/orders/{{id}}","headers":{"Authorization":"Bearer {{secret:ORDERS_TOKEN}}"}}]}`), 0o600)
+	tools, err := LoadTools(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRegistry()
+	if err := tools.Register(r, ToolEnv{WorkRoot: "/srv/sandbox"}); err != nil {
+		t.Fatal(err)
+	}
+	exec, err := r.Get("word_count")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := exec.(*ProcessExecutor); p.tool.WorkRoot != "/srv/sandbox" || p.tool.Limits.CPUSeconds != 2 {
+		t.Fatalf("unexpected tool: %+v", p.tool)
+	}
+
+	if _, err := r.Get("lookup_order"); err != nil {
+		t.Fatal(err)
+	}
+
+	bad := []ProcessTool{
+		{Command: []string{"wc"}},
+		{Name: "t"},
+		{Name: "t", Command: []string{"{{program}}"}},
+		{Name: "t", Command: []string{"wc"}, Isolation: "chroot"},
+	}
+	for _, b := range bad {
+		if err := (&ToolsConfig{Process: []ProcessTool{b}}).Register(NewRegistry(), ToolEnv{}); err == nil {
+			t.Fatalf("expected %+v to be rejected", b)
+		}
+	}
+	badHTTP := []HTTPTool{
+		{Name: "t", URL: "ftp://files.internal/{{path}}"},
+		{Name: "t", URL: "https://{{host}}.internal/v1"},
+		{Name: "t", URL: "https://orders.internal/v1", Headers: map[string]string{"X-User": "{{user}}"}},
+		{Name: "t", URL: "https://orders.internal/v1", AllowedHosts: []string{"10.0.0.0/33"}},
+		{Name: "t", URL: "https://orders.internal/v1", AllowedHosts: []string{"internal:10.0.0.0/8"}},
+	}
+	for _, b := range badHTTP {
+		if err := (&ToolsConfig{HTTP: []HTTPTool{b}}).Register(NewRegistry(), ToolEnv{}); err == nil {
+			t.Fatalf("expected %+v to be rejected", b)
+		}
+	}
+	dup := &ToolsConfig{Process: []ProcessTool{{Name: "t", Command: []string{"wc"}}, {Name: "t", Command: []string{"wc"}}}}
+	if err := dup.Register(NewRegistry(), ToolEnv{}); err == nil {
+		t.Fatal("expected duplicate tools to be rejected")
+	}
+}
@@ -0,0 +1,169 @@
+// Package ahocorasick finds many literal patterns in one pass over the text.
+// Matching is case-insensitive; folding never changes byte lengths, so match
+// offsets index the original text.
+package ahocorasick
+
+import (
+	"sort"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Match is one occurrence of Patterns[Pattern] at text[Start:End].
+type Match struct {
+	Pattern int
+	Start   int
+	End     int
+}
+
+type node struct {
+	keys []byte  // sorted transition bytes
+	next []int32 // child for each key
+	fail int32
+	out  []int32 // patterns ending here, including those reached through fail links
+}
+
+// child returns the transition on b, or -1.
+func (n *node) child(b byte) int32 {
+	for i, k := range n.keys {
+		if k == b {
+			return n.next[i]
+		}
+		if k > b {
+			break
+		}
+	}
+	return -1
+}
+
+// Automaton is a compiled pattern set. It is immutable and safe for concurrent use.
+type Automaton struct {
+	nodes    []node
+	root     [256]int32 // dense root transitions; 0 stays at the root
+	lens     []int      // byte length of each pattern; 0 for empty patterns
+	patterns int
+}
+
+// New compiles patterns. Empty patterns never match; duplicates each report
+// their own index.
+func New(patterns []string) *Automaton {
+	a := &Automaton{nodes: []node{{}}, lens: make([]int, len(patterns)), patterns: len(patterns)}
+	for i, p := range patterns {
+		if p == "" {
+			continue
+		}
+		p = Fold(p)
+		a.lens[i] = len(p)
+		cur := int32(0)
+		for j := 0; j < len(p); j++ {
+			nxt := a.nodes[cur].child(p[j])
+			if nxt < 0 {
+				a.nodes = append(a.nodes, node{})
+				nxt = int32(len(a.nodes) - 1)
+				a.insert(cur, p[j], nxt)
+			}
+			cur = nxt
+		}
+		a.nodes[cur].out = append(a.nodes[cur].out, int32(i))
+	}
+	for i, k := range a.nodes[0].keys {
+		a.root[k] = a.nodes[0].next[i]
+	}
+	a.link()
+	return a
+}
+
+func (a *Automaton) insert(parent int32, b byte, child int32) {
+	n := &a.nodes[parent]
+	i := sort.Search(len(n.keys), func(i int) bool { return n.keys[i] >= b })
+	n.keys = append(n.keys, 0)
+	n.next = append(n.next, 0)
+	copy(n.keys[i+1:], n.keys[i:])
+	copy(n.next[i+1:], n.next[i:])
+	n.keys[i], n.next[i] = b, child
+}
+
+// step follows the transition on b from cur, falling back along fail links.
+func (a *Automaton) step(cur int32, b byte) int32 {
+	for cur != 0 {
+		if nxt := a.nodes[cur].child(b); nxt >= 0 {
+			return nxt
+		}
+		cur = a.nodes[cur].fail
+	}
+	return a.root[b]
+}
+
+// link sets failure links breadth-first and merges outputs along them.
+func (a *Automaton) link() {
+	queue := append([]int32(nil), a.nodes[0].next...)
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		n := a.nodes[cur]
+		for i, b := range n.keys {
+			child := n.next[i]
+			if cur != 0 {
+				a.nodes[child].fail = a.step(a.nodes[cur].fail, b)
+			}
+			a.nodes[child].out = append(a.nodes[child].out, a.nodes[a.nodes[child].fail].out...)
+			queue = append(queue, child)
+		}
+	}
+}
+
+// Len reports the number of patterns the automaton was built from.
+func (a *Automaton) Len() int { return a.patterns }
+
+// FindAll returns every occurrence of every pattern, ordered by end offset.
+// Occurrences of the same pattern do not overlap, matching a left-to-right
+// scan that resumes after each hit.
+func (a *Automaton) FindAll(text string) []Match {
+	if a == nil || len(a.nodes) == 1 {
+		return nil
+	}
+	var out []Match
+	var resume map[int32]int // per pattern: first start offset allowed again
+	text = Fold(text)
+	cur := int32(0)
+	for i := 0; i < len(text); i++ {
+		cur = a.step(cur, text[i])
+		for _, p := range a.nodes[cur].out {
+			start := i + 1 - a.lens[p]
+			if start < resume[p] {
+				continue
+			}
+			if resume == nil {
+				resume = map[int32]int{}
+			}
+			resume[p] = i + 1
+			out = append(out, Match{Pattern: int(p), Start: start, End: i + 1})
+		}
+	}
+	return out
+}
+
+// Fold lower-cases s rune by rune, keeping runes whose lower case has a
+// different encoded length, so byte offsets are preserved.
+func Fold(s string) string {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c >= utf8.RuneSelf || ('A' <= c && c <= 'Z') {
+			return fold(s)
+		}
+	}
+	return s
+}
+
+func fold(s string) string {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); {
+		r, n := utf8.DecodeRuneInString(s[i:])
+		if l := unicode.ToLower(r); l != r && utf8.RuneLen(l) == n {
+			b = utf8.AppendRune(b, l)
+		} else {
+			b = append(b, s[i:i+n]...)
+		}
+		i += n
+	}
+	return string(b)
+}
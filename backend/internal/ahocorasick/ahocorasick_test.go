@@ -0,0 +1,84 @@
+package ahocorasick
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// naive finds each pattern separately, resuming after every hit.
+func naive(text string, patterns []string) []Match {
+	var out []Match
+	for p, pat := range patterns {
+		n := len(pat)
+		if n == 0 {
+			continue
+		}
+		for i := 0; i+n <= len(text); i++ {
+			if Fold(text[i:i+n]) == Fold(pat) {
+				out = append(out, Match{Pattern: p, Start: i, End: i + n})
+				i += n - 1
+			}
+		}
+	}
+	return out
+}
+
+func sorted(ms []Match) []Match {
+	sort.Slice(ms, func(i, j int) bool {
+		if ms[i].Pattern != ms[j].Pattern {
+			return ms[i].Pattern < ms[j].Pattern
+		}
+		return ms[i].Start < ms[j].Start
+	})
+	return ms
+}
+
+func TestFindAll(t *testing.T) {
+	patterns := []string{"he", "she", "his", "hers", "", "HE", "发票", "aaa"}
+	text := "Ushers SHE his 开发票 aaaaa"
+	got := sorted(New(patterns).FindAll(text))
+	want := sorted(naive(text, patterns))
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v\nwant %+v", got, want)
+	}
+	for _, m := range got {
+		if !strings.EqualFold(text[m.Start:m.End], patterns[m.Pattern]) {
+			t.Fatalf("offsets %+v point at %q", m, text[m.Start:m.End])
+		}
+	}
+}
+
+func TestFindAllMatchesNaive(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	alphabet := []string{"a", "b", "A", "c", "é", "É", "\xff", "票"}
+	word := func(n int) string {
+		var b strings.Builder
+		for i := 0; i < n; i++ {
+			b.WriteString(alphabet[rng.Intn(len(alphabet))])
+		}
+		return b.String()
+	}
+	for round := 0; round < 200; round++ {
+		patterns := make([]string, 1+rng.Intn(8))
+		for i := range patterns {
+			patterns[i] = word(1 + rng.Intn(3))
+		}
+		text := word(rng.Intn(40))
+		got := sorted(New(patterns).FindAll(text))
+		want := sorted(naive(text, patterns))
+		if len(got) != len(want) || (len(got) > 0 && !reflect.DeepEqual(got, want)) {
+			t.Fatalf("%q in %q:\ngot %+v\nwant %+v", patterns, text, got, want)
+		}
+	}
+}
+
+func TestFoldKeepsOffsets(t *testing.T) {
+	for _, s := range []string{"HELLO", "ÉCOLE", "İstanbul", "ẞ", "bad\xffbyte"} {
+		if f := Fold(s); len(f) != len(s) {
+			t.Fatalf("%q folded to %q changes length", s, f)
+		}
+	}
+}
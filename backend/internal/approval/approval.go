@@ -0,0 +1,196 @@
+// Package approval holds tool calls that wait for a human decision: an
+// agent run suspends on a request, approvers approve or deny it, and the
+// run resumes or aborts once it is resolved or has expired.
+package approval
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Request states.
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusDenied   = "denied"
+	StatusExpired  = "expired"
+)
+
+var (
+	ErrNotFound          = errors.New("approval not found")
+	ErrNotPending        = errors.New("approval already resolved")
+	ErrExpired           = errors.New("approval expired")
+	ErrNoApprover        = errors.New("approver required")
+	ErrDuplicateApprover = errors.New("approver already decided")
+	ErrSelfApproval      = errors.New("requester cannot approve own request")
+	// ErrConflict means the request changed since it was read.
+	ErrConflict = errors.New("approval modified concurrently")
+)
+
+// Decision is one approver's verdict.
+type Decision struct {
+	Approver string    `json:"approver"`
+	Approved bool      `json:"approved"`
+	Comment  string    `json:"comment,omitempty"`
+	At       time.Time `json:"at"`
+}
+
+// Request is a tool call awaiting approval.
+type Request struct {
+	ID        string                 `json:"id"`
+	RunID     string                 `json:"run_id"`
+	TenantID  string                 `json:"tenant_id"`
+	AppID     string                 `json:"app_id,omitempty"`
+	Requester string                 `json:"requester,omitempty"` // app that ran the agent; may not approve
+	Tool      string                 `json:"tool"`
+	Args      map[string]interface{} `json:"args,omitempty"`
+	Reason    string                 `json:"reason,omitempty"`
+	Signals   []string               `json:"signals,omitempty"`
+	Approvers int                    `json:"approvers"` // distinct approvals needed
+	Status    string                 `json:"status"`
+	Decisions []Decision             `json:"decisions"`
+	// Run is the suspended run, opaque to this package.
+	Run json.RawMessage `json:"-"`
+	// Outcome is the result of the resumed or aborted run.
+	Outcome    json.RawMessage `json:"outcome,omitempty"`
+	Version    int             `json:"-"`
+	CreatedAt  time.Time       `json:"created_at"`
+	ExpiresAt  time.Time       `json:"expires_at"`
+	ResolvedAt *time.Time      `json:"resolved_at,omitempty"`
+	// ResumedAt is when the resolved hooks last took the request up to
+	// resume or abort its run.
+	ResumedAt *time.Time `json:"resumed_at,omitempty"`
+}
+
+// Approvals counts the approving decisions.
+func (r *Request) Approvals() int {
+	n := 0
+	for _, d := range r.Decisions {
+		if d.Approved {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *Request) clone() *Request {
+	c := *r
+	c.Decisions = append([]Decision(nil), r.Decisions...)
+	c.Signals = append([]string(nil), r.Signals...)
+	return &c
+}
+
+// Store persists requests. Update saves r only if its version is still
+// r.Version, and then increments it; otherwise it returns ErrConflict.
+type Store interface {
+	Create(r *Request) error
+	Get(id string) (*Request, error)
+	Update(r *Request) error
+	// List returns a tenant's requests, newest first; empty tenantID and
+	// status match all.
+	List(tenantID, status string, limit int) ([]Request, error)
+	// LatestForRun returns the newest request of an agent run.
+	LatestForRun(runID string) (*Request, error)
+	// Due returns pending requests expired at now.
+	Due(now time.Time, limit int) ([]Request, error)
+	// Unresumed returns resolved requests without an outcome whose run was
+	// taken up to resume before, or never.
+	Unresumed(before time.Time, limit int) ([]Request, error)
+}
+
+// MemoryStore implements Store in memory.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	reqs  map[string]*Request
+	order map[string]int // creation order, breaking ties in CreatedAt
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{reqs: make(map[string]*Request), order: make(map[string]int)}
+}
+
+func (s *MemoryStore) Create(r *Request) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.reqs[r.ID]; exists {
+		return errors.New("approval already exists")
+	}
+	s.reqs[r.ID] = r.clone()
+	s.order[r.ID] = len(s.order)
+	return nil
+}
+
+func (s *MemoryStore) Get(id string) (*Request, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.reqs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return r.clone(), nil
+}
+
+func (s *MemoryStore) Update(r *Request) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cur, ok := s.reqs[r.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if cur.Version != r.Version {
+		return ErrConflict
+	}
+	r.Version++
+	s.reqs[r.ID] = r.clone()
+	return nil
+}
+
+func (s *MemoryStore) List(tenantID, status string, limit int) ([]Request, error) {
+	return s.filter(limit, func(r *Request) bool {
+		return (tenantID == "" || r.TenantID == tenantID) && (status == "" || r.Status == status)
+	}), nil
+}
+
+func (s *MemoryStore) LatestForRun(runID string) (*Request, error) {
+	list := s.filter(1, func(r *Request) bool { return r.RunID == runID })
+	if len(list) == 0 {
+		return nil, ErrNotFound
+	}
+	return &list[0], nil
+}
+
+func (s *MemoryStore) Due(now time.Time, limit int) ([]Request, error) {
+	return s.filter(limit, func(r *Request) bool {
+		return r.Status == StatusPending && !now.Before(r.ExpiresAt)
+	}), nil
+}
+
+func (s *MemoryStore) Unresumed(before time.Time, limit int) ([]Request, error) {
+	return s.filter(limit, func(r *Request) bool {
+		return r.Status != StatusPending && len(r.Outcome) == 0 && (r.ResumedAt == nil || r.ResumedAt.Before(before))
+	}), nil
+}
+
+func (s *MemoryStore) filter(limit int, match func(*Request) bool) []Request {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []Request
+	for _, r := range s.reqs {
+		if match(r) {
+			out = append(out, *r.clone())
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.After(out[j].CreatedAt)
+		}
+		return s.order[out[i].ID] > s.order[out[j].ID]
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
@@ -0,0 +1,386 @@
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"aiguardrails/internal/alert"
+)
+
+// Dispatcher sends an alert to notification channels, e.g. alert.NotifyDispatcher.
+type Dispatcher interface {
+	Dispatch(ctx context.Context, a *alert.AlertHistory, channels []string) map[string]string
+}
+
+// HistoryStore keeps dispatched alerts, e.g. alert.RuleStore.
+type HistoryStore interface {
+	SaveHistory(h *alert.AlertHistory) error
+}
+
+// AuditFunc records an audit event.
+type AuditFunc func(event string, fields map[string]string)
+
+// maxUpdateAttempts bounds retries of a decision racing another one.
+const maxUpdateAttempts = 3
+
+// DefaultResumeTimeout bounds a resume of a run after its request resolved.
+const DefaultResumeTimeout = 5 * time.Minute
+
+// Service runs the approval workflow: it persists requests, notifies
+// approvers, records decisions, expires requests nobody decided in time and
+// calls the resolved hooks once a request is approved, denied or expired.
+// A resolved request whose run got no outcome within the resume timeout,
+// e.g. because the process stopped, is handed to the hooks again. Every step
+// is audited.
+type Service struct {
+	store         Store
+	ttl           time.Duration
+	resumeTimeout time.Duration
+	notifier      Dispatcher
+	history       HistoryStore
+	channels      []string
+	audit         AuditFunc
+	now           func() time.Time
+
+	mu    sync.RWMutex
+	hooks []func(*Request)
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewService constructs Service; requests expire ttl after they are submitted.
+func NewService(store Store, ttl time.Duration) *Service {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Service{
+		store:         store,
+		ttl:           ttl,
+		resumeTimeout: DefaultResumeTimeout,
+		now:           func() time.Time { return time.Now().UTC() },
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+}
+
+// WithNotifier sends an alert for each new request to channels, and keeps
+// it in history when set.
+func (s *Service) WithNotifier(d Dispatcher, history HistoryStore, channels []string) {
+	s.notifier = d
+	s.history = history
+	s.channels = channels
+}
+
+// WithAudit sets the audit sink.
+func (s *Service) WithAudit(fn AuditFunc) {
+	s.audit = fn
+}
+
+// OnResolved adds a hook called with each request once it is resolved.
+func (s *Service) OnResolved(fn func(*Request)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, fn)
+}
+
+// WithResumeTimeout sets how long the hooks have to resume a run before
+// it is resumed again.
+func (s *Service) WithResumeTimeout(d time.Duration) {
+	s.resumeTimeout = d
+}
+
+// ResumeTimeout returns how long a resume of a run may take.
+func (s *Service) ResumeTimeout() time.Duration {
+	return s.resumeTimeout
+}
+
+// TTL returns how long a request waits for its decisions.
+func (s *Service) TTL() time.Duration {
+	return s.ttl
+}
+
+// Submit persists a new pending request and notifies the approvers.
+func (s *Service) Submit(ctx context.Context, r *Request) error {
+	now := s.now()
+	if r.ID == "" {
+		r.ID = uuid.NewString()
+	}
+	if r.Approvers < 1 {
+		r.Approvers = 1
+	}
+	r.Status = StatusPending
+	r.Decisions = []Decision{}
+	r.Version = 0
+	r.CreatedAt = now
+	r.ExpiresAt = now.Add(s.ttl)
+	r.ResolvedAt = nil
+	if err := s.store.Create(r); err != nil {
+		return err
+	}
+	s.record("agent_approval_requested", r, map[string]string{
+		"requester":  r.Requester,
+		"reason":     r.Reason,
+		"signals":    strings.Join(r.Signals, ","),
+		"approvers":  strconv.Itoa(r.Approvers),
+		"expires_at": r.ExpiresAt.Format(time.RFC3339),
+	})
+	s.notify(ctx, r)
+	return nil
+}
+
+// Decide records an approver's decision. A denial resolves the request at
+// once; approvals resolve it when r.Approvers distinct approvers agreed.
+// The requester may not decide on their own request.
+func (s *Service) Decide(ctx context.Context, id string, d Decision) (*Request, error) {
+	d.Approver = strings.TrimSpace(d.Approver)
+	if d.Approver == "" {
+		return nil, ErrNoApprover
+	}
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		r, err := s.store.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		if r.Status != StatusPending {
+			return r, ErrNotPending
+		}
+		now := s.now()
+		if !now.Before(r.ExpiresAt) {
+			s.expire(r)
+			return r, ErrExpired
+		}
+		if r.Requester != "" && r.Requester == d.Approver {
+			return r, ErrSelfApproval
+		}
+		for _, prev := range r.Decisions {
+			if prev.Approver == d.Approver {
+				return r, ErrDuplicateApprover
+			}
+		}
+		d.At = now
+		r.Decisions = append(r.Decisions, d)
+		switch {
+		case !d.Approved:
+			r.Status = StatusDenied
+		case r.Approvals() >= r.Approvers:
+			r.Status = StatusApproved
+		}
+		if r.Status != StatusPending {
+			r.ResolvedAt = &now
+			r.ResumedAt = &now
+		}
+		if err := s.store.Update(r); err != nil {
+			if errors.Is(err, ErrConflict) {
+				continue
+			}
+			return nil, err
+		}
+		s.record("agent_approval_decided", r, map[string]string{
+			"approver":  d.Approver,
+			"approved":  strconv.FormatBool(d.Approved),
+			"comment":   d.Comment,
+			"approvals": fmt.Sprintf("%d/%d", r.Approvals(), r.Approvers),
+		})
+		if r.Status != StatusPending {
+			s.resolved(r)
+		}
+		return r, nil
+	}
+	return nil, ErrConflict
+}
+
+// ExpireDue expires the pending requests past their deadline and returns
+// how many it expired.
+func (s *Service) ExpireDue() int {
+	due, err := s.store.Due(s.now(), 100)
+	if err != nil {
+		log.Printf("approval expiry failed: %v", err)
+		return 0
+	}
+	n := 0
+	for i := range due {
+		if s.expire(&due[i]) {
+			n++
+		}
+	}
+	return n
+}
+
+// expire resolves r as expired unless a decision got there first.
+func (s *Service) expire(r *Request) bool {
+	now := s.now()
+	r.Status = StatusExpired
+	r.ResolvedAt = &now
+	r.ResumedAt = &now
+	if err := s.store.Update(r); err != nil {
+		if !errors.Is(err, ErrConflict) {
+			log.Printf("approval %s expiry failed: %v", r.ID, err)
+		}
+		return false
+	}
+	s.resolved(r)
+	return true
+}
+
+// ResumeStale hands the resolved requests whose run was not resumed within
+// the resume timeout to the hooks again and returns how many it handed on.
+// A request is taken up by one caller only, however many run it.
+func (s *Service) ResumeStale() int {
+	now := s.now()
+	stale, err := s.store.Unresumed(now.Add(-s.resumeTimeout), 100)
+	if err != nil {
+		log.Printf("approval resume recovery failed: %v", err)
+		return 0
+	}
+	n := 0
+	for i := range stale {
+		r := &stale[i]
+		r.ResumedAt = &now
+		if err := s.store.Update(r); err != nil {
+			if !errors.Is(err, ErrConflict) {
+				log.Printf("approval %s resume recovery failed: %v", r.ID, err)
+			}
+			continue
+		}
+		s.record("agent_approval_resume_retried", r, map[string]string{})
+		s.callHooks(r)
+		n++
+	}
+	return n
+}
+
+// Start resumes stale runs at once, then expires due requests and resumes
+// stale runs every interval until Stop.
+func (s *Service) Start(interval time.Duration) {
+	go func() {
+		s.ResumeStale()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C:
+				s.ExpireDue()
+				s.ResumeStale()
+			}
+		}
+	}()
+}
+
+// Stop stops the expiry loop.
+func (s *Service) Stop() {
+	s.cancel()
+}
+
+// Get returns a request.
+func (s *Service) Get(id string) (*Request, error) {
+	return s.store.Get(id)
+}
+
+// List returns a tenant's requests in a status, newest first.
+func (s *Service) List(tenantID, status string, limit int) ([]Request, error) {
+	return s.store.List(tenantID, status, limit)
+}
+
+// LatestForRun returns the newest request of an agent run.
+func (s *Service) LatestForRun(runID string) (*Request, error) {
+	return s.store.LatestForRun(runID)
+}
+
+// SetOutcome saves the result of the run resumed or aborted after the
+// request was resolved; reason is empty when the run completed.
+func (s *Service) SetOutcome(id string, outcome json.RawMessage, reason string) error {
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		r, err := s.store.Get(id)
+		if err != nil {
+			return err
+		}
+		r.Outcome = outcome
+		if err := s.store.Update(r); err != nil {
+			if errors.Is(err, ErrConflict) {
+				continue
+			}
+			return err
+		}
+		result := "completed"
+		if reason != "" {
+			result = reason
+		}
+		s.record("agent_approval_outcome", r, map[string]string{"result": result})
+		return nil
+	}
+	return ErrConflict
+}
+
+// resolved audits the resolution and calls the hooks.
+func (s *Service) resolved(r *Request) {
+	fields := map[string]string{"approvals": fmt.Sprintf("%d/%d", r.Approvals(), r.Approvers)}
+	approvers := make([]string, 0, len(r.Decisions))
+	for _, d := range r.Decisions {
+		approvers = append(approvers, d.Approver)
+	}
+	fields["approvers"] = strings.Join(approvers, ",")
+	s.record("agent_approval_"+r.Status, r, fields)
+	s.callHooks(r)
+}
+
+func (s *Service) callHooks(r *Request) {
+	s.mu.RLock()
+	hooks := append([]func(*Request){}, s.hooks...)
+	s.mu.RUnlock()
+	for _, fn := range hooks {
+		fn(r.clone())
+	}
+}
+
+func (s *Service) record(event string, r *Request, fields map[string]string) {
+	if s.audit == nil {
+		return
+	}
+	fields["approval_id"] = r.ID
+	fields["run_id"] = r.RunID
+	fields["tenant_id"] = r.TenantID
+	fields["app_id"] = r.AppID
+	fields["tool"] = r.Tool
+	fields["status"] = r.Status
+	s.audit(event, fields)
+}
+
+// notify alerts the approvers of a new request.
+func (s *Service) notify(ctx context.Context, r *Request) {
+	if s.notifier == nil || len(s.channels) == 0 {
+		return
+	}
+	severity := "high"
+	if r.Approvers > 1 {
+		severity = "critical"
+	}
+	args, _ := json.Marshal(r.Args)
+	data, _ := json.Marshal(r)
+	tenantID := r.TenantID
+	h := &alert.AlertHistory{
+		RuleName: "agent_approval",
+		TenantID: &tenantID,
+		Severity: severity,
+		Title:    fmt.Sprintf("智能体工具调用待审批: %s", r.Tool),
+		Message: fmt.Sprintf("审批单 %s：租户 %s 的智能体请求调用 %s，参数 %s；需 %d 人批准，%s 前未处理将自动拒绝。原因：%s",
+			r.ID, r.TenantID, r.Tool, args, r.Approvers, r.ExpiresAt.Format(time.RFC3339), r.Reason),
+		EventData: data,
+	}
+	status := s.notifier.Dispatch(ctx, h, s.channels)
+	h.NotifyStatus, _ = json.Marshal(status)
+	if s.history != nil {
+		if err := s.history.SaveHistory(h); err != nil {
+			log.Printf("approval %s alert history: %v", r.ID, err)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package approval
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"aiguardrails/internal/alert"
+)
+
+type recordingDispatcher struct {
+	alerts   []*alert.AlertHistory
+	channels []string
+}
+
+func (d *recordingDispatcher) Dispatch(_ context.Context, a *alert.AlertHistory, channels []string) map[string]string {
+	d.alerts = append(d.alerts, a)
+	d.channels = channels
+	return map[string]string{"wecom": "sent"}
+}
+
+type recordingHistory struct{ saved []*alert.AlertHistory }
+
+func (h *recordingHistory) SaveHistory(a *alert.AlertHistory) error {
+	h.saved = append(h.saved, a)
+	return nil
+}
+
+type auditEvent struct {
+	event  string
+	fields map[string]string
+}
+
+// newTestService returns a service on a memory store with a settable clock,
+// the audit events it records and the requests it resolved.
+func newTestService() (*Service, *time.Time, *[]auditEvent, *[]*Request) {
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	svc := NewService(NewMemoryStore(), 30*time.Minute)
+	svc.now = func() time.Time { return now }
+	var events []auditEvent
+	svc.WithAudit(func(event string, fields map[string]string) {
+		events = append(events, auditEvent{event, fields})
+	})
+	var resolved []*Request
+	svc.OnResolved(func(r *Request) { resolved = append(resolved, r) })
+	return svc, &now, &events, &resolved
+}
+
+func submit(t *testing.T, svc *Service, approvers int) *Request {
+	t.Helper()
+	r := &Request{RunID: "run-1", TenantID: "t1", Requester: "carol", Tool: "start_stop",
+		Args: map[string]interface{}{"line": "3"}, Reason: "approval_required", Approvers: approvers}
+	if err := svc.Submit(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestSubmitNotifiesApprovers(t *testing.T) {
+	svc, _, events, _ := newTestService()
+	d, h := &recordingDispatcher{}, &recordingHistory{}
+	svc.WithNotifier(d, h, []string{"wecom"})
+
+	r := submit(t, svc, 2)
+	if r.ID == "" || r.Status != StatusPending || r.ExpiresAt.Sub(r.CreatedAt) != 30*time.Minute {
+		t.Fatalf("unexpected request: %+v", r)
+	}
+	if len(d.alerts) != 1 || d.channels[0] != "wecom" || d.alerts[0].Severity != "critical" || *d.alerts[0].TenantID != "t1" {
+		t.Fatalf("expected a critical alert to wecom: %+v", d)
+	}
+	if len(h.saved) != 1 || string(h.saved[0].NotifyStatus) != `{"wecom":"sent"}` {
+		t.Fatalf("expected the alert in history: %+v", h.saved)
+	}
+	if len(*events) != 1 || (*events)[0].event != "agent_approval_requested" || (*events)[0].fields["approval_id"] != r.ID {
+		t.Fatalf("expected the request to be audited: %+v", *events)
+	}
+	if got, err := svc.LatestForRun("run-1"); err != nil || got.ID != r.ID {
+		t.Fatalf("expected the run's request: %+v %v", got, err)
+	}
+}
+
+func TestDecideNeedsDistinctApprovers(t *testing.T) {
+	svc, _, events, resolved := newTestService()
+	r := submit(t, svc, 2)
+	ctx := context.Background()
+
+	if _, err := svc.Decide(ctx, r.ID, Decision{Approver: "carol", Approved: true}); !errors.Is(err, ErrSelfApproval) {
+		t.Fatalf("requester must not approve: %v", err)
+	}
+	if _, err := svc.Decide(ctx, r.ID, Decision{Approved: true}); !errors.Is(err, ErrNoApprover) {
+		t.Fatalf("expected missing approver: %v", err)
+	}
+	got, err := svc.Decide(ctx, r.ID, Decision{Approver: "alice", Approved: true})
+	if err != nil || got.Status != StatusPending || got.Approvals() != 1 {
+		t.Fatalf("one approval must keep the request pending: %+v %v", got, err)
+	}
+	if _, err := svc.Decide(ctx, r.ID, Decision{Approver: "alice", Approved: true}); !errors.Is(err, ErrDuplicateApprover) {
+		t.Fatalf("expected duplicate approver: %v", err)
+	}
+	got, err = svc.Decide(ctx, r.ID, Decision{Approver: "bob", Approved: true, Comment: "line is clear"})
+	if err != nil || got.Status != StatusApproved || got.ResolvedAt == nil {
+		t.Fatalf("second approval must approve: %+v %v", got, err)
+	}
+	if len(*resolved) != 1 || (*resolved)[0].Status != StatusApproved {
+		t.Fatalf("expected one resolution: %+v", *resolved)
+	}
+	if _, err := svc.Decide(ctx, r.ID, Decision{Approver: "dave", Approved: false}); !errors.Is(err, ErrNotPending) {
+		t.Fatalf("expected resolved request: %v", err)
+	}
+
+	var names []string
+	for _, e := range *events {
+		names = append(names, e.event)
+	}
+	want := []string{"agent_approval_requested", "agent_approval_decided", "agent_approval_decided", "agent_approval_approved"}
+	if len(names) != len(want) {
+		t.Fatalf("unexpected audit trail: %v", names)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("unexpected audit trail: %v", names)
+		}
+	}
+	if f := (*events)[3].fields; f["approvers"] != "alice,bob" || f["approvals"] != "2/2" {
+		t.Fatalf("unexpected resolution audit: %+v", f)
+	}
+
+	if err := svc.SetOutcome(r.ID, []byte(`{"allowed":true}`), ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := svc.Get(r.ID); string(got.Outcome) != `{"allowed":true}` {
+		t.Fatalf("expected the outcome: %s", got.Outcome)
+	}
+}
+
+func TestDecideDenialResolvesAtOnce(t *testing.T) {
+	svc, _, _, resolved := newTestService()
+	r := submit(t, svc, 2)
+	got, err := svc.Decide(context.Background(), r.ID, Decision{Approver: "alice", Approved: false, Comment: "not during shift change"})
+	if err != nil || got.Status != StatusDenied {
+		t.Fatalf("a denial must resolve the request: %+v %v", got, err)
+	}
+	if len(*resolved) != 1 || (*resolved)[0].Decisions[0].Comment != "not during shift change" {
+		t.Fatalf("expected the denial to resolve: %+v", *resolved)
+	}
+}
+
+func TestExpireDue(t *testing.T) {
+	svc, now, events, resolved := newTestService()
+	r := submit(t, svc, 1)
+	late := submit(t, svc, 1)
+
+	if n := svc.ExpireDue(); n != 0 {
+		t.Fatalf("nothing is due yet: %d", n)
+	}
+	*now = now.Add(31 * time.Minute)
+	if _, err := svc.Decide(context.Background(), late.ID, Decision{Approver: "alice", Approved: true}); !errors.Is(err, ErrExpired) {
+		t.Fatalf("a late decision must fail: %v", err)
+	}
+	if n := svc.ExpireDue(); n != 1 {
+		t.Fatalf("expected one more expiry: %d", n)
+	}
+	if got, _ := svc.Get(r.ID); got.Status != StatusExpired {
+		t.Fatalf("expected expired: %+v", got)
+	}
+	if len(*resolved) != 2 || (*events)[len(*events)-1].event != "agent_approval_expired" {
+		t.Fatalf("expected both expiries resolved and audited: %+v %+v", *resolved, *events)
+	}
+}
+
+func TestResumeStale(t *testing.T) {
+	svc, now, events, resolved := newTestService()
+	ctx := context.Background()
+	lost := submit(t, svc, 1)
+	done := submit(t, svc, 1)
+	for _, r := range []*Request{lost, done} {
+		if _, err := svc.Decide(ctx, r.ID, Decision{Approver: "alice", Approved: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := svc.SetOutcome(done.ID, []byte(`{"allowed":true}`), ""); err != nil {
+		t.Fatal(err)
+	}
+	if n := svc.ResumeStale(); n != 0 || len(*resolved) != 2 {
+		t.Fatalf("runs still within the resume timeout must be left alone: %d", n)
+	}
+
+	// The process resuming lost stopped before saving an outcome.
+	*now = now.Add(DefaultResumeTimeout + time.Second)
+	if n := svc.ResumeStale(); n != 1 || len(*resolved) != 3 || (*resolved)[2].ID != lost.ID {
+		t.Fatalf("expected the lost run handed on again: %d %+v", n, *resolved)
+	}
+	if (*events)[len(*events)-1].event != "agent_approval_resume_retried" {
+		t.Fatalf("expected the retry audited: %+v", *events)
+	}
+	if n := svc.ResumeStale(); n != 0 {
+		t.Fatalf("a run taken up again must not be resumed twice: %d", n)
+	}
+}
+
+func TestMemoryStoreRejectsStaleUpdates(t *testing.T) {
+	s := NewMemoryStore()
+	if err := s.Create(&Request{ID: "a1", Status: StatusPending}); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := s.Get("a1")
+	second, _ := s.Get("a1")
+	first.Status = StatusApproved
+	if err := s.Update(first); err != nil || first.Version != 1 {
+		t.Fatalf("unexpected update: %v %+v", err, first)
+	}
+	second.Status = StatusDenied
+	if err := s.Update(second); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected a conflict: %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package approval
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PGStore implements Store on the agent_approvals table.
+type PGStore struct {
+	db *sql.DB
+}
+
+// NewPGStore constructs PGStore.
+func NewPGStore(db *sql.DB) *PGStore { return &PGStore{db: db} }
+
+const approvalColumns = `id, run_id, tenant_id, app_id, requester, tool, args, reason, signals, approvers,
+	status, decisions, run, outcome, version, created_at, expires_at, resolved_at, resumed_at`
+
+// selectColumns reads approvalColumns; requests not run by an app have a NULL app_id.
+const selectColumns = `id, run_id, tenant_id, COALESCE(app_id::text, ''), requester, tool, args, reason, signals, approvers,
+	status, decisions, run, outcome, version, created_at, expires_at, resolved_at, resumed_at`
+
+func (s *PGStore) Create(r *Request) error {
+	args, signals, decisions, err := encodeRequest(r)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO agent_approvals (`+approvalColumns+`)
+		VALUES ($1,$2,$3,NULLIF($4, '')::uuid,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19)`,
+		r.ID, r.RunID, r.TenantID, r.AppID, r.Requester, r.Tool, args, r.Reason, signals, r.Approvers,
+		r.Status, decisions, nullJSON(r.Run), nullJSON(r.Outcome), r.Version, r.CreatedAt, r.ExpiresAt, r.ResolvedAt, r.ResumedAt)
+	return err
+}
+
+func (s *PGStore) Get(id string) (*Request, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	r, err := scanRequest(s.db.QueryRow(`SELECT `+selectColumns+` FROM agent_approvals WHERE id=$1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return r, err
+}
+
+func (s *PGStore) Update(r *Request) error {
+	_, _, decisions, err := encodeRequest(r)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.Exec(`UPDATE agent_approvals
+		SET status=$3, decisions=$4, outcome=$5, resolved_at=$6, resumed_at=$7, version=version+1
+		WHERE id=$1 AND version=$2`,
+		r.ID, r.Version, r.Status, decisions, nullJSON(r.Outcome), r.ResolvedAt, r.ResumedAt)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		if _, err := s.Get(r.ID); err != nil {
+			return err
+		}
+		return ErrConflict
+	}
+	r.Version++
+	return nil
+}
+
+func (s *PGStore) List(tenantID, status string, limit int) ([]Request, error) {
+	query := `SELECT ` + selectColumns + ` FROM agent_approvals`
+	args := []interface{}{}
+	clauses := []string{}
+	if tenantID != "" {
+		if _, err := uuid.Parse(tenantID); err != nil {
+			return nil, nil
+		}
+		args = append(args, tenantID)
+		clauses = append(clauses, `tenant_id = $`+strconv.Itoa(len(args)))
+	}
+	if status != "" {
+		args = append(args, status)
+		clauses = append(clauses, `status = $`+strconv.Itoa(len(args)))
+	}
+	if len(clauses) > 0 {
+		query += " WHERE " + strings.Join(clauses, " AND ")
+	}
+	args = append(args, limit)
+	query += " ORDER BY created_at DESC LIMIT $" + strconv.Itoa(len(args))
+	return s.query(query, args...)
+}
+
+func (s *PGStore) LatestForRun(runID string) (*Request, error) {
+	if _, err := uuid.Parse(runID); err != nil {
+		return nil, ErrNotFound
+	}
+	r, err := scanRequest(s.db.QueryRow(`SELECT `+selectColumns+` FROM agent_approvals
+		WHERE run_id=$1 ORDER BY created_at DESC LIMIT 1`, runID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return r, err
+}
+
+func (s *PGStore) Due(now time.Time, limit int) ([]Request, error) {
+	return s.query(`SELECT `+selectColumns+` FROM agent_approvals
+		WHERE status=$1 AND expires_at <= $2 ORDER BY expires_at LIMIT $3`, StatusPending, now, limit)
+}
+
+func (s *PGStore) Unresumed(before time.Time, limit int) ([]Request, error) {
+	return s.query(`SELECT `+selectColumns+` FROM agent_approvals
+		WHERE status<>$1 AND outcome IS NULL AND (resumed_at IS NULL OR resumed_at < $2)
+		ORDER BY resolved_at LIMIT $3`, StatusPending, before, limit)
+}
+
+func (s *PGStore) query(query string, args ...interface{}) ([]Request, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Request
+	for rows.Next() {
+		r, err := scanRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *r)
+	}
+	return out, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRequest(row scanner) (*Request, error) {
+	var r Request
+	var args, signals, decisions, run, outcome []byte
+	err := row.Scan(&r.ID, &r.RunID, &r.TenantID, &r.AppID, &r.Requester, &r.Tool, &args, &r.Reason, &signals, &r.Approvers,
+		&r.Status, &decisions, &run, &outcome, &r.Version, &r.CreatedAt, &r.ExpiresAt, &r.ResolvedAt, &r.ResumedAt)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range []struct {
+		data []byte
+		dst  interface{}
+	}{{args, &r.Args}, {signals, &r.Signals}, {decisions, &r.Decisions}} {
+		if len(f.data) > 0 {
+			if err := json.Unmarshal(f.data, f.dst); err != nil {
+				return nil, err
+			}
+		}
+	}
+	r.Run = run
+	r.Outcome = outcome
+	return &r, nil
+}
+
+func encodeRequest(r *Request) (args, signals, decisions []byte, err error) {
+	if args, err = json.Marshal(r.Args); err != nil {
+		return
+	}
+	if signals, err = json.Marshal(r.Signals); err != nil {
+		return
+	}
+	decisions, err = json.Marshal(r.Decisions)
+	return
+}
+
+// nullJSON stores an empty document as NULL.
+func nullJSON(b json.RawMessage) interface{} {
+	if len(b) == 0 {
+		return nil
+	}
+	return []byte(b)
+}
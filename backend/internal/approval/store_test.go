@@ -0,0 +1,31 @@
+package approval
+
+import (
+	"errors"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPGStoreRejectsMalformedIDs(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s := NewPGStore(db)
+
+	// IDs are UUIDs: anything else matches nothing and never reaches the database.
+	if _, err := s.Get("not-a-uuid"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found: %v", err)
+	}
+	if _, err := s.LatestForRun("run-1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found: %v", err)
+	}
+	if list, err := s.List("t1", StatusPending, 10); err != nil || len(list) != 0 {
+		t.Fatalf("expected no requests: %v %v", list, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// ErrConfirmMismatch means a confirm token was issued for another tenant or text.
+var ErrConfirmMismatch = errors.New("confirm token does not match request")
+
+// ConfirmClaims bind a guardrail confirmation to one tenant and one exact text.
+type ConfirmClaims struct {
+	TenantID string `json:"tenant_id"`
+	Digest   string `json:"digest"` // sha256 of the confirmed text
+	Reason   string `json:"reason,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// confirmKey derives a separate key so confirm tokens never pass as session tokens.
+func (j *JWTSigner) confirmKey() []byte {
+	return append([]byte("guardrail-confirm:"), j.Secret...)
+}
+
+func textDigest(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// SignConfirm issues a token the client echoes back to proceed past a confirm decision.
+func (j *JWTSigner) SignConfirm(tenantID, text, reason string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := ConfirmClaims{
+		TenantID: tenantID,
+		Digest:   textDigest(text),
+		Reason:   reason,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(j.confirmKey())
+}
+
+// VerifyConfirm checks that token is valid, unexpired and issued for tenantID and text.
+func (j *JWTSigner) VerifyConfirm(token, tenantID, text string) error {
+	claims := &ConfirmClaims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return j.confirmKey(), nil
+	})
+	if err != nil {
+		return err
+	}
+	if !parsed.Valid {
+		return jwt.ErrSignatureInvalid
+	}
+	if claims.TenantID != tenantID || claims.Digest != textDigest(text) {
+		return ErrConfirmMismatch
+	}
+	return nil
+}
@@ -23,6 +23,13 @@ func APIKeyMiddleware(svc tenant.Service) func(http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			appID := r.Header.Get("X-App-Id")
 			secret := r.Header.Get("X-App-Secret")
+			if appID == "" && secret == "" {
+				appID, secret = bearerAppCredentials(r.Header.Get("Authorization"))
+			}
+			if appID == "" && secret == "" {
+				// Anthropic-style clients send the key in x-api-key.
+				appID, secret = splitAppCredentials(r.Header.Get("X-Api-Key"))
+			}
 			if appID == "" || secret == "" {
 				http.Error(w, "missing credentials", http.StatusUnauthorized)
 				return
@@ -50,6 +57,24 @@ func APIKeyMiddleware(svc tenant.Service) func(http.Handler) http.Handler {
 	}
 }
 
+// bearerAppCredentials parses "Authorization: Bearer <appID>:<secret>", which lets
+// OpenAI-style clients authenticate with only an API key setting.
+func bearerAppCredentials(header string) (string, string) {
+	if !strings.HasPrefix(header, "Bearer ") {
+		return "", ""
+	}
+	return splitAppCredentials(strings.TrimPrefix(header, "Bearer "))
+}
+
+// splitAppCredentials parses "<appID>:<secret>".
+func splitAppCredentials(v string) (string, string) {
+	appID, secret, ok := strings.Cut(v, ":")
+	if !ok {
+		return "", ""
+	}
+	return strings.TrimSpace(appID), strings.TrimSpace(secret)
+}
+
 // AppIDFromContext extracts authenticated app ID.
 func AppIDFromContext(ctx context.Context) string {
 	if v, ok := ctx.Value(appIDKey).(string); ok {
@@ -41,6 +41,49 @@ type Config struct {
 	OPARegoPath    string
 	OPADecision    string
 	OPATimeoutSec  int
+	// OPARAGDocDecision is the query deciding document access for rag-check (mode rag_doc).
+	OPARAGDocDecision string
+	// OPAAgentToolDecision is the query checking agent tool calls (mode agent_tool).
+	OPAAgentToolDecision string
+	// OPAAgentApprovalDecision is the query deciding which agent tool calls need approval (mode agent_tool).
+	OPAAgentApprovalDecision string
+
+	// DetectorFailurePolicy is applied when a detection stage errors and the
+	// tenant has no policy of its own: fail_open|fail_closed|mark.
+	DetectorFailurePolicy string
+	// RuleCacheTTLSec bounds how long a tenant's compiled keyword/term automaton,
+	// recognizer selection and pipeline rule are reused; local policy, rule and
+	// tenant rule edits invalidate them immediately.
+	RuleCacheTTLSec int
+	// Guarded LLM proxy (fallback upstream when no tenant/app upstream is configured)
+	ProxyUpstreamURL   string
+	ProxyUpstreamKey   string
+	ProxyUpstreamModel string
+	ProxyTimeoutSec    int
+	StreamFilterMode   string // block|redact for streamed output
+	ProxyAnthropicURL  string // default upstream for /v1/messages
+	ProxyAnthropicKey  string
+	ProxyOllamaURL     string // default upstream for /api/chat
+	ProxyAnonymize     bool   // pseudonymize prompt PII before forwarding upstream
+	ProxyAllowPrivate  bool   // let tenant upstreams target loopback and private addresses
+	VaultTTLMin        int    // lifetime of a pseudonymization session after last use
+	SessionTTLMin      int    // lifetime of a guarded conversation session after its last turn
+	// ProxyHeaderTimeoutSec bounds the wait for upstream response headers; a
+	// non-streamed reply only sends them once generated.
+	ProxyHeaderTimeoutSec int
+	// Agent planner: OpenAI-compatible chat completions API choosing agent actions
+	AgentPlannerURL        string
+	AgentPlannerKey        string
+	AgentPlannerModel      string
+	AgentPlannerTimeoutSec int
+	// Agent tool calls awaiting human approval
+	AgentApprovalTTLMin   int      // a request nobody decided in time expires and the run aborts
+	AgentApprovalChannels []string // notification channels alerting approvers, e.g. wecom,dingtalk
+	// Agent tools and the sandbox running them
+	AgentToolsFile         string // JSON tool definitions, see agent.ToolsConfig
+	AgentSandboxDir        string // root of the per-run working directories of process tools; the temp dir if empty
+	AgentSandboxTimeoutSec int
+	AgentSandboxMemMB      int // address space limit of process tools
 	// Social auth
 	SocialAuthCallbackURL string
 	WeChatAppID           string
@@ -91,6 +134,33 @@ func Default() Config {
 		OPARegoPath:    "opa/policies",
 		OPADecision:    "data.guardrails.allow",
 		OPATimeoutSec:  1,
+		// RAG document access (mode rag_doc)
+		OPARAGDocDecision: "data.guardrails.rag_doc_deny",
+		// Agent tool calls (mode agent_tool)
+		OPAAgentToolDecision:     "data.guardrails.deny_reason",
+		OPAAgentApprovalDecision: "data.guardrails.agent_approval",
+		// Detection
+		DetectorFailurePolicy: "fail_open",
+		RuleCacheTTLSec:       30,
+		// Proxy
+		ProxyUpstreamURL:   "",
+		ProxyUpstreamKey:   "",
+		ProxyUpstreamModel: "",
+		ProxyTimeoutSec:    120,
+		StreamFilterMode:   "block",
+		ProxyAnthropicURL:  "",
+		ProxyAnthropicKey:  "",
+		ProxyOllamaURL:     "",
+		ProxyAnonymize:     false,
+		VaultTTLMin:        60,
+		SessionTTLMin:      60,
+		// Upstream response headers
+		ProxyHeaderTimeoutSec: 120,
+		// Agent
+		AgentPlannerTimeoutSec: 30,
+		AgentApprovalTTLMin:    30,
+		AgentSandboxTimeoutSec: 30,
+		AgentSandboxMemMB:      128,
 	}
 }
 
@@ -190,9 +260,93 @@ func FromEnv() Config {
 	if v := os.Getenv("OPA_DECISION"); v != "" {
 		cfg.OPADecision = v
 	}
+	if v := os.Getenv("OPA_RAG_DOC_DECISION"); v != "" {
+		cfg.OPARAGDocDecision = v
+	}
+	if v := os.Getenv("OPA_AGENT_TOOL_DECISION"); v != "" {
+		cfg.OPAAgentToolDecision = v
+	}
+	if v := os.Getenv("OPA_AGENT_APPROVAL_DECISION"); v != "" {
+		cfg.OPAAgentApprovalDecision = v
+	}
 	if v := os.Getenv("OPA_TIMEOUT_SEC"); v != "" {
 		cfg.OPATimeoutSec = atoiDefault(v, cfg.OPATimeoutSec)
 	}
+	if v := os.Getenv("PROXY_UPSTREAM_URL"); v != "" {
+		cfg.ProxyUpstreamURL = v
+	}
+	if v := os.Getenv("PROXY_UPSTREAM_KEY"); v != "" {
+		cfg.ProxyUpstreamKey = v
+	}
+	if v := os.Getenv("PROXY_UPSTREAM_MODEL"); v != "" {
+		cfg.ProxyUpstreamModel = v
+	}
+	if v := os.Getenv("PROXY_TIMEOUT_SEC"); v != "" {
+		cfg.ProxyTimeoutSec = atoiDefault(v, cfg.ProxyTimeoutSec)
+	}
+	if v := os.Getenv("PROXY_HEADER_TIMEOUT_SEC"); v != "" {
+		cfg.ProxyHeaderTimeoutSec = atoiDefault(v, cfg.ProxyHeaderTimeoutSec)
+	}
+	if v := os.Getenv("DETECTOR_FAILURE_POLICY"); v != "" {
+		cfg.DetectorFailurePolicy = v
+	}
+	if v := os.Getenv("RULE_CACHE_TTL_SEC"); v != "" {
+		cfg.RuleCacheTTLSec = atoiDefault(v, cfg.RuleCacheTTLSec)
+	}
+	if v := os.Getenv("STREAM_FILTER_MODE"); v != "" {
+		cfg.StreamFilterMode = v
+	}
+	if v := os.Getenv("PROXY_ANTHROPIC_URL"); v != "" {
+		cfg.ProxyAnthropicURL = v
+	}
+	if v := os.Getenv("PROXY_ANTHROPIC_KEY"); v != "" {
+		cfg.ProxyAnthropicKey = v
+	}
+	if v := os.Getenv("PROXY_OLLAMA_URL"); v != "" {
+		cfg.ProxyOllamaURL = v
+	}
+	if v := os.Getenv("PROXY_ANONYMIZE"); v != "" {
+		cfg.ProxyAnonymize = v == "true" || v == "1"
+	}
+	if v := os.Getenv("PROXY_ALLOW_PRIVATE"); v != "" {
+		cfg.ProxyAllowPrivate = v == "true" || v == "1"
+	}
+	if v := os.Getenv("VAULT_TTL_MIN"); v != "" {
+		cfg.VaultTTLMin = atoiDefault(v, cfg.VaultTTLMin)
+	}
+	if v := os.Getenv("SESSION_TTL_MIN"); v != "" {
+		cfg.SessionTTLMin = atoiDefault(v, cfg.SessionTTLMin)
+	}
+	if v := os.Getenv("AGENT_PLANNER_URL"); v != "" {
+		cfg.AgentPlannerURL = v
+	}
+	if v := os.Getenv("AGENT_PLANNER_KEY"); v != "" {
+		cfg.AgentPlannerKey = v
+	}
+	if v := os.Getenv("AGENT_PLANNER_MODEL"); v != "" {
+		cfg.AgentPlannerModel = v
+	}
+	if v := os.Getenv("AGENT_PLANNER_TIMEOUT_SEC"); v != "" {
+		cfg.AgentPlannerTimeoutSec = atoiDefault(v, cfg.AgentPlannerTimeoutSec)
+	}
+	if v := os.Getenv("AGENT_APPROVAL_TTL_MIN"); v != "" {
+		cfg.AgentApprovalTTLMin = atoiDefault(v, cfg.AgentApprovalTTLMin)
+	}
+	if v := os.Getenv("AGENT_APPROVAL_CHANNELS"); v != "" {
+		cfg.AgentApprovalChannels = parseCSV(v)
+	}
+	if v := os.Getenv("AGENT_TOOLS_FILE"); v != "" {
+		cfg.AgentToolsFile = v
+	}
+	if v := os.Getenv("AGENT_SANDBOX_DIR"); v != "" {
+		cfg.AgentSandboxDir = v
+	}
+	if v := os.Getenv("AGENT_SANDBOX_TIMEOUT_SEC"); v != "" {
+		cfg.AgentSandboxTimeoutSec = atoiDefault(v, cfg.AgentSandboxTimeoutSec)
+	}
+	if v := os.Getenv("AGENT_SANDBOX_MEM_MB"); v != "" {
+		cfg.AgentSandboxMemMB = atoiDefault(v, cfg.AgentSandboxMemMB)
+	}
 	return cfg
 }
 
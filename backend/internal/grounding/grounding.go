@@ -0,0 +1,345 @@
+// Package grounding checks that a model's answer is supported by the context
+// documents it was generated from. Each sentence making a claim is scored
+// against the context lexically (shared content words) and semantically
+// (character n-gram similarity, which tolerates rewording and inflection);
+// figures missing from the context, negations the context does not share and
+// citations to documents that were never supplied count against it. An
+// optional judge, usually an LLM, reviews the claims the heuristics reject.
+package grounding
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"aiguardrails/internal/policy"
+	"aiguardrails/internal/types"
+)
+
+// Defaults for GroundingRuleConfig fields left zero.
+const (
+	DefaultMinSupport = 0.5
+)
+
+// Reasons and signals of a grounding verdict.
+const (
+	ReasonUngrounded         = "ungrounded_answer"
+	ReasonFabricatedCitation = "fabricated_citation"
+	SignalUnsupportedClaims  = "unsupported_claims"
+	SignalUnsupportedNumber  = "unsupported_number"
+	SignalNegationMismatch   = "negation_mismatch"
+	SignalCitationMismatch   = "citation_mismatch"
+	SignalFabricatedCitation = "fabricated_citation"
+	SignalJudgeUnavailable   = "judge_unavailable"
+)
+
+// Judge verdicts recorded on a sentence.
+const (
+	judgeSupported   = "supported"
+	judgeUnsupported = "unsupported"
+)
+
+const (
+	lexicalWeight      = 0.6  // support = lexicalWeight*lexical + (1-lexicalWeight)*semantic
+	numberCap          = 0.25 // most support a claim with a figure missing from the context keeps
+	negationPenalty    = 0.5
+	minClaimTokens     = 3 // shorter sentences make no checkable claim
+	maxJudgeCalls      = 8
+	judgeEvidence      = 3 // best passages shown to the judge
+	maxSentenceSignals = 6
+	maxFabricatedList  = 10
+)
+
+// Rules are a tenant's grounding rules with defaults applied.
+type Rules struct {
+	MinSupport     float64
+	MaxUnsupported float64 // tolerated share of unsupported claims
+	Decision       string  // mark or block
+	LLMJudge       bool
+}
+
+// RulesFrom applies defaults to cfg, which may be nil.
+func RulesFrom(cfg *policy.GroundingRuleConfig) Rules {
+	r := Rules{MinSupport: DefaultMinSupport, Decision: types.DecisionMark}
+	if cfg == nil {
+		return r
+	}
+	if cfg.MinSupport > 0 {
+		r.MinSupport = cfg.MinSupport
+	}
+	r.MaxUnsupported = cfg.MaxUnsupported
+	if cfg.Decision == types.DecisionBlock {
+		r.Decision = types.DecisionBlock
+	}
+	r.LLMJudge = cfg.LLMJudge
+	return r
+}
+
+// Validate checks a tenant's grounding config.
+func Validate(cfg *policy.GroundingRuleConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	switch {
+	case cfg.MinSupport < 0 || cfg.MinSupport > 1:
+		return fmt.Errorf("grounding.min_support %v out of range [0,1]", cfg.MinSupport)
+	case cfg.MaxUnsupported < 0 || cfg.MaxUnsupported > 1:
+		return fmt.Errorf("grounding.max_unsupported %v out of range [0,1]", cfg.MaxUnsupported)
+	}
+	switch cfg.Decision {
+	case "", types.DecisionMark, types.DecisionBlock:
+	default:
+		return fmt.Errorf("unknown grounding decision %q", cfg.Decision)
+	}
+	return nil
+}
+
+// Source is one context document an output must be supported by.
+type Source struct {
+	ID      string
+	Content string
+	URL     string // where the document lives, if citations may link to it
+}
+
+// Input is the context of one grounding check.
+type Input struct {
+	Sources []Source
+	Rules   Rules
+}
+
+// Judge decides whether evidence supports a claim.
+type Judge interface {
+	Supported(ctx context.Context, claim string, evidence []string) (bool, string, error)
+}
+
+// passage is a sentence, or two adjacent sentences, of a source.
+type passage struct {
+	source   int
+	text     string
+	tokens   map[string]bool
+	grams    map[string]float64
+	negation bool
+}
+
+// index is the preprocessed context.
+type index struct {
+	sources  []Source
+	passages []passage
+	numbers  map[string]bool
+}
+
+func newIndex(sources []Source) *index {
+	ix := &index{sources: sources, numbers: map[string]bool{}}
+	for i, src := range sources {
+		sents := splitSentences(src.Content)
+		for j, s := range sents {
+			ix.add(i, s.text)
+			if j+1 < len(sents) {
+				ix.add(i, s.text+" "+sents[j+1].text)
+			}
+		}
+		for _, n := range numbers(src.Content) {
+			ix.numbers[n] = true
+		}
+	}
+	return ix
+}
+
+func (ix *index) add(source int, text string) {
+	ix.passages = append(ix.passages, passage{source: source, text: text, tokens: tokens(text), grams: ngrams(text), negation: hasNegation(text)})
+}
+
+// resolve maps a citation to a source index, or -1 when no supplied document matches.
+func (ix *index) resolve(c citation) int {
+	for i, src := range ix.sources {
+		switch {
+		case c.index > 0:
+			if c.index == i+1 {
+				return i
+			}
+		case c.id != "":
+			if strings.EqualFold(c.id, src.ID) {
+				return i
+			}
+		case c.url != "":
+			if (src.URL != "" && strings.EqualFold(trimURL(src.URL), c.url)) || strings.Contains(src.Content, c.url) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// scored is one passage's support of a claim.
+type scored struct {
+	passage           *passage
+	lexical, semantic float64
+	support           float64
+}
+
+// Evaluate scores each sentence of output against the context. judge may be
+// nil; it is only consulted when the rules ask for it.
+func Evaluate(ctx context.Context, output string, in Input, judge Judge) *types.GroundingReport {
+	ix := newIndex(in.Sources)
+	report := &types.GroundingReport{Support: 1, Sentences: []types.SentenceSupport{}}
+	fabricated := map[string]bool{}
+	judgeCalls := 0
+	var total float64
+
+	for _, sent := range mergeCitations(splitSentences(output)) {
+		cites, text := extractCitations(sent.text)
+		ss := types.SentenceSupport{Start: sent.start, End: sent.end}
+		cited := map[int]bool{}
+		for _, c := range cites {
+			ss.Citations = append(ss.Citations, c.raw)
+			if i := ix.resolve(c); i >= 0 {
+				cited[i] = true
+			} else {
+				ss.Signals = append(ss.Signals, SignalFabricatedCitation+":"+c.raw)
+				if !fabricated[c.raw] && len(fabricated) < maxFabricatedList {
+					fabricated[c.raw] = true
+					report.FabricatedCitations = append(report.FabricatedCitations, c.raw)
+				}
+			}
+		}
+		claim := tokens(text)
+		trimmed := strings.TrimSpace(text)
+		if len(claim) < minClaimTokens || strings.HasSuffix(trimmed, "?") || strings.HasSuffix(trimmed, "？") {
+			ss.Supported = true
+			report.Sentences = append(report.Sentences, ss)
+			continue
+		}
+		ss.Claim = true
+		report.Claims++
+
+		ranked := ix.rank(text, claim, cited)
+		if len(ranked) > 0 {
+			best := ranked[0]
+			ss.Lexical, ss.Semantic, ss.Support = round(best.lexical), round(best.semantic), best.support
+			ss.Source = ix.sources[best.passage.source].ID
+			if best.passage.negation != hasNegation(text) {
+				ss.Support *= negationPenalty
+				ss.Signals = append(ss.Signals, SignalNegationMismatch)
+			}
+		}
+		for _, n := range numbers(text) {
+			if !ix.numbers[n] {
+				ss.Support = math.Min(ss.Support, numberCap)
+				ss.Signals = append(ss.Signals, SignalUnsupportedNumber+":"+n)
+			}
+		}
+		ss.Support = round(ss.Support)
+		ss.Supported = ss.Support >= in.Rules.MinSupport
+		if !ss.Supported && len(cited) > 0 {
+			// The claim may still be in the context, just not where it says.
+			if all := ix.rank(text, claim, nil); len(all) > 0 && all[0].support >= in.Rules.MinSupport && !cited[all[0].passage.source] {
+				ss.Signals = append(ss.Signals, SignalCitationMismatch+":"+ix.sources[all[0].passage.source].ID)
+			}
+		}
+
+		if !ss.Supported && in.Rules.LLMJudge && !report.JudgeDegraded {
+			switch {
+			case judge == nil:
+				report.JudgeDegraded = true
+			case judgeCalls < maxJudgeCalls:
+				judgeCalls++
+				var evidence []string
+				for i := 0; i < len(ranked) && i < judgeEvidence; i++ {
+					evidence = append(evidence, ranked[i].passage.text)
+				}
+				ok, reason, err := judge.Supported(ctx, trimmed, evidence)
+				switch {
+				case err != nil:
+					report.JudgeDegraded = true
+				case ok:
+					ss.Judge, ss.Supported = judgeSupported, true
+				default:
+					ss.Judge = judgeUnsupported
+					if reason != "" {
+						ss.Signals = append(ss.Signals, "judge:"+reason)
+					}
+				}
+			}
+		}
+		if len(ss.Signals) > maxSentenceSignals {
+			ss.Signals = ss.Signals[:maxSentenceSignals]
+		}
+		if !ss.Supported {
+			report.Unsupported++
+		}
+		total += ss.Support
+		report.Sentences = append(report.Sentences, ss)
+	}
+	if report.Claims > 0 {
+		report.Support = round(total / float64(report.Claims))
+	}
+	return report
+}
+
+// rank scores the claim against every passage, limited to the cited sources
+// when there are any, best first.
+func (ix *index) rank(text string, claim map[string]bool, cited map[int]bool) []scored {
+	grams := ngrams(text)
+	var out []scored
+	for i := range ix.passages {
+		p := &ix.passages[i]
+		if len(cited) > 0 && !cited[p.source] {
+			continue
+		}
+		lex, sem := overlap(claim, p.tokens), cosine(grams, p.grams)
+		out = append(out, scored{passage: p, lexical: lex, semantic: sem, support: lexicalWeight*lex + (1-lexicalWeight)*sem})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].support > out[j].support })
+	return out
+}
+
+// mergeCitations folds sentences that are only citations, such as a trailing
+// "[2]" after the period, into the sentence before them.
+func mergeCitations(sents []span) []span {
+	var out []span
+	for _, s := range sents {
+		_, rest := extractCitations(s.text)
+		if len(out) > 0 && strings.TrimFunc(rest, func(r rune) bool { return !isWordRune(r) }) == "" {
+			last := &out[len(out)-1]
+			last.text += " " + s.text
+			last.end = s.end
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// Verdict turns a report into a pipeline result: the rules' decision when a
+// citation is fabricated or too many claims are unsupported.
+func (r Rules) Verdict(report *types.GroundingReport) types.GuardrailResult {
+	res := types.GuardrailResult{Allowed: true, Grounding: report}
+	ratio := 0.0
+	if report.Claims > 0 {
+		ratio = float64(report.Unsupported) / float64(report.Claims)
+	}
+	ungrounded := report.Unsupported > 0 && ratio > r.MaxUnsupported
+	if !ungrounded && len(report.FabricatedCitations) == 0 {
+		return res
+	}
+	res.Allowed = r.Decision == types.DecisionMark
+	res.Decision = r.Decision
+	res.Reason = ReasonUngrounded
+	if len(report.FabricatedCitations) > 0 {
+		res.Reason = ReasonFabricatedCitation
+		for _, c := range report.FabricatedCitations {
+			res.Signals = append(res.Signals, SignalFabricatedCitation+":"+c)
+		}
+	}
+	if report.Unsupported > 0 {
+		res.Signals = append(res.Signals, fmt.Sprintf("%s:%d/%d", SignalUnsupportedClaims, report.Unsupported, report.Claims))
+	}
+	if report.JudgeDegraded {
+		res.Signals = append(res.Signals, SignalJudgeUnavailable)
+	}
+	return res
+}
+
+func round(v float64) float64 { return math.Round(v*100) / 100 }
@@ -0,0 +1,133 @@
+package grounding
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"aiguardrails/internal/policy"
+	"aiguardrails/internal/types"
+)
+
+var supportDocs = []Source{
+	{ID: "returns", Content: "Returns are accepted within 30 days of purchase. Items must be unused and in their original packaging. Refunds are issued to the original payment method within 5 business days."},
+	{ID: "shipping", Content: "Standard shipping takes 3-7 business days. Express shipping is available for $15.", URL: "https://help.example.com/shipping"},
+	{ID: "zh-returns", Content: "会员可以在购买后30天内申请退货。退款将在5个工作日内退回原支付账户。"},
+}
+
+func sentence(t *testing.T, output string, r *types.GroundingReport, prefix string) types.SentenceSupport {
+	t.Helper()
+	for _, s := range r.Sentences {
+		if len(output[s.Start:s.End]) >= len(prefix) && output[s.Start:s.Start+len(prefix)] == prefix {
+			return s
+		}
+	}
+	t.Fatalf("no sentence starting %q in %+v", prefix, r.Sentences)
+	return types.SentenceSupport{}
+}
+
+func TestEvaluateScoresSentences(t *testing.T) {
+	out := "You can return items within 30 days of buying them [1]. Refunds go back to your original payment method in 5 business days. " +
+		"Shipping is free on all orders over $50. Returns are not accepted within 30 days. Do you need anything else? " +
+		"会员购买后30天内可以退货。我们提供终身免费维修服务。"
+	r := Evaluate(context.Background(), out, Input{Sources: supportDocs, Rules: RulesFrom(nil)}, nil)
+
+	for _, prefix := range []string{"You can return", "Refunds go back", "会员购买后"} {
+		if s := sentence(t, out, r, prefix); !s.Claim || !s.Supported || s.Support < DefaultMinSupport {
+			t.Fatalf("%q should be supported: %+v", prefix, s)
+		}
+	}
+	if s := sentence(t, out, r, "You can return"); s.Source != "returns" || len(s.Citations) != 1 {
+		t.Fatalf("unexpected source or citations: %+v", s)
+	}
+	if s := sentence(t, out, r, "Shipping is free"); s.Supported || s.Signals[len(s.Signals)-1] != SignalUnsupportedNumber+":50" {
+		t.Fatalf("invented figure should be unsupported: %+v", s)
+	}
+	if s := sentence(t, out, r, "Returns are not"); s.Supported || s.Signals[0] != SignalNegationMismatch {
+		t.Fatalf("contradiction should be unsupported: %+v", s)
+	}
+	if s := sentence(t, out, r, "我们提供"); s.Supported {
+		t.Fatalf("unrelated claim should be unsupported: %+v", s)
+	}
+	if s := sentence(t, out, r, "Do you need"); s.Claim || !s.Supported {
+		t.Fatalf("question is not a claim: %+v", s)
+	}
+	if r.Claims != 6 || r.Unsupported != 3 {
+		t.Fatalf("claims %d unsupported %d", r.Claims, r.Unsupported)
+	}
+}
+
+func TestEvaluateCitations(t *testing.T) {
+	out := "Express shipping costs $15 [source: shipping]. Standard shipping takes 3-7 business days (https://help.example.com/shipping). " +
+		"Our CEO founded the company in 1998 [4]. Items must be unused and in original packaging [2]."
+	r := Evaluate(context.Background(), out, Input{Sources: supportDocs, Rules: RulesFrom(nil)}, nil)
+	if len(r.FabricatedCitations) != 1 || r.FabricatedCitations[0] != "[4]" {
+		t.Fatalf("unexpected fabricated citations: %v", r.FabricatedCitations)
+	}
+	for _, prefix := range []string{"Express shipping", "Standard shipping"} {
+		if s := sentence(t, out, r, prefix); !s.Supported || s.Source != "shipping" {
+			t.Fatalf("%q should be supported by its citation: %+v", prefix, s)
+		}
+	}
+	// Supported by the context, but not by the document it cites.
+	if s := sentence(t, out, r, "Items must"); s.Supported || s.Signals[0] != SignalCitationMismatch+":returns" {
+		t.Fatalf("misattributed claim: %+v", s)
+	}
+
+	res := RulesFrom(&policy.GroundingRuleConfig{Decision: types.DecisionBlock}).Verdict(r)
+	if res.Allowed || res.Decision != types.DecisionBlock || res.Reason != ReasonFabricatedCitation || res.Grounding != r {
+		t.Fatalf("unexpected verdict: %+v", res)
+	}
+}
+
+type stubJudge struct {
+	calls int
+	ok    bool
+	err   error
+}
+
+func (j *stubJudge) Supported(_ context.Context, _ string, evidence []string) (bool, string, error) {
+	j.calls++
+	return j.ok, "not in context", j.err
+}
+
+func TestEvaluateJudgeAndVerdict(t *testing.T) {
+	out := "Refunds are issued within 5 business days. Shipping is free on all orders over $50."
+	rules := RulesFrom(&policy.GroundingRuleConfig{LLMJudge: true})
+
+	judge := &stubJudge{ok: true}
+	r := Evaluate(context.Background(), out, Input{Sources: supportDocs, Rules: rules}, judge)
+	if judge.calls != 1 || r.Unsupported != 0 || sentence(t, out, r, "Shipping").Judge != "supported" {
+		t.Fatalf("judge should review only the unsupported claim and overrule it: %d %+v", judge.calls, r)
+	}
+	if res := rules.Verdict(r); !res.Allowed || res.Decision != "" {
+		t.Fatalf("grounded answer should pass: %+v", res)
+	}
+
+	judge = &stubJudge{}
+	r = Evaluate(context.Background(), out, Input{Sources: supportDocs, Rules: rules}, judge)
+	res := rules.Verdict(r)
+	if !res.Allowed || res.Decision != types.DecisionMark || res.Reason != ReasonUngrounded || res.Signals[0] != "unsupported_claims:1/2" {
+		t.Fatalf("expected a marked answer: %+v", res)
+	}
+	if RulesFrom(&policy.GroundingRuleConfig{MaxUnsupported: 0.5}).Verdict(r).Decision != "" {
+		t.Fatal("half the claims unsupported is within max_unsupported 0.5")
+	}
+
+	judge = &stubJudge{err: errors.New("timeout")}
+	r = Evaluate(context.Background(), out, Input{Sources: supportDocs, Rules: rules}, judge)
+	if !r.JudgeDegraded || r.Unsupported != 1 {
+		t.Fatalf("judge failure should keep the heuristic verdict: %+v", r)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, cfg := range []*policy.GroundingRuleConfig{{MinSupport: 1.5}, {MaxUnsupported: -0.1}, {Decision: "redact"}} {
+		if Validate(cfg) == nil {
+			t.Fatalf("expected %+v to be rejected", cfg)
+		}
+	}
+	if err := Validate(&policy.GroundingRuleConfig{MinSupport: 0.6, Decision: "block", LLMJudge: true}); err != nil {
+		t.Fatal(err)
+	}
+}
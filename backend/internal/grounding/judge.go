@@ -0,0 +1,42 @@
+package grounding
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"aiguardrails/internal/llm_guard"
+)
+
+// maxEvidenceRunes bounds each passage shown to the LLM judge.
+const maxEvidenceRunes = 800
+
+// LLMJudge asks the LLM guard whether the evidence supports a claim.
+type LLMJudge struct {
+	guard *llm_guard.Client
+}
+
+// NewLLMJudge constructs LLMJudge.
+func NewLLMJudge(guard *llm_guard.Client) *LLMJudge {
+	return &LLMJudge{guard: guard}
+}
+
+func (j *LLMJudge) Supported(ctx context.Context, claim string, evidence []string) (bool, string, error) {
+	if err := ctx.Err(); err != nil {
+		return false, "", err
+	}
+	var b strings.Builder
+	b.WriteString("Decide whether the content is fully supported by the reference passages below. ")
+	b.WriteString("Content that states facts, figures or sources the passages do not contain, or that contradicts them, is unsafe. ")
+	b.WriteString("Rewording of what the passages say is safe.\nReference passages:\n")
+	if len(evidence) == 0 {
+		b.WriteString("(none)\n")
+	}
+	for i, e := range evidence {
+		if r := []rune(e); len(r) > maxEvidenceRunes {
+			e = string(r[:maxEvidenceRunes])
+		}
+		fmt.Fprintf(&b, "[%d] %s\n", i+1, e)
+	}
+	return j.guard.Check(claim, b.String())
+}
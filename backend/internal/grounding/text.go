@@ -0,0 +1,291 @@
+package grounding
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"aiguardrails/internal/normalize"
+)
+
+// span is a sentence of a text with its byte offsets.
+type span struct {
+	start, end int
+	text       string
+}
+
+// splitSentences splits text at sentence punctuation and line breaks. A
+// period only ends a sentence before whitespace, so decimals and URLs stay
+// whole. Offsets exclude surrounding whitespace.
+func splitSentences(text string) []span {
+	var out []span
+	start := 0
+	emit := func(end int) {
+		seg := text[start:end]
+		trimmed := strings.TrimLeftFunc(seg, unicode.IsSpace)
+		s := start + len(seg) - len(trimmed)
+		trimmed = strings.TrimRightFunc(trimmed, unicode.IsSpace)
+		if trimmed != "" {
+			out = append(out, span{start: s, end: s + len(trimmed), text: trimmed})
+		}
+		start = end
+	}
+	for i := 0; i < len(text); {
+		r, n := utf8.DecodeRuneInString(text[i:])
+		i += n
+		switch r {
+		case '。', '！', '？', '；', '!', '?', '\n':
+			emit(i)
+		case '.':
+			if next, _ := utf8.DecodeRuneInString(text[i:]); i == len(text) || unicode.IsSpace(next) {
+				emit(i)
+			}
+		}
+	}
+	emit(len(text))
+	return out
+}
+
+// citation is a reference an output makes to its context: a 1-based index
+// ("[2]", "【2】"), a document ID ("[source: faq-7]") or a URL.
+type citation struct {
+	raw   string
+	index int
+	id    string
+	url   string
+}
+
+var (
+	numericCitation = regexp.MustCompile(`\^?\[(\d+(?:\s*[,，、-]\s*\d+)*)\]|【(\d+(?:\s*[,，、-]\s*\d+)*)】`)
+	idCitation      = regexp.MustCompile(`(?i)[\[(（【]\s*(?:doc|document|source|ref|来源|出处|参考)\s*[:：#]\s*([^\])）】]+?)\s*[\])）】]`)
+	citedURL        = regexp.MustCompile(`(?i)https?://[^\s)"'<>\]）】]+`)
+	indexList       = regexp.MustCompile(`\d+|-`)
+)
+
+// extractCitations returns the citations in s and s with them removed.
+func extractCitations(s string) ([]citation, string) {
+	var cites []citation
+	s = idCitation.ReplaceAllStringFunc(s, func(m string) string {
+		cites = append(cites, citation{raw: m, id: strings.TrimSpace(idCitation.FindStringSubmatch(m)[1])})
+		return " "
+	})
+	s = numericCitation.ReplaceAllStringFunc(s, func(m string) string {
+		sub := numericCitation.FindStringSubmatch(m)
+		list := sub[1]
+		if list == "" {
+			list = sub[2]
+		}
+		prev := 0
+		ranging := false
+		for _, tok := range indexList.FindAllString(list, -1) {
+			if tok == "-" {
+				ranging = true
+				continue
+			}
+			n, _ := strconv.Atoi(tok)
+			if ranging && n > prev && n-prev <= 20 {
+				for i := prev + 1; i <= n; i++ {
+					cites = append(cites, citation{raw: m, index: i})
+				}
+			} else {
+				cites = append(cites, citation{raw: m, index: n})
+			}
+			prev, ranging = n, false
+		}
+		return " "
+	})
+	s = citedURL.ReplaceAllStringFunc(s, func(m string) string {
+		cites = append(cites, citation{raw: m, url: trimURL(m)})
+		return " "
+	})
+	return cites, s
+}
+
+func trimURL(u string) string {
+	return strings.TrimRight(strings.TrimRight(u, ".,;:!?。，；"), "/")
+}
+
+// stopwords carry no claim content.
+var stopwords = func() map[string]bool {
+	m := map[string]bool{}
+	for _, w := range strings.Fields(`a an the and or but if then than so of to in on at by for from with within without
+		as is are was were be been being am do does did done have has had having can could may might must shall should
+		will would it its this that these those there here they them their we our us you your yours he she his her i me my
+		not no yes also just only very more most such into onto over under about after before during per via each any all
+		some what which who whom whose when where why how please note`) {
+		m[w] = true
+	}
+	for _, w := range []string{"的", "了", "是", "在", "和", "与", "及", "或", "也", "都", "就", "而", "被", "把", "您", "你", "我", "我们", "他们", "请", "吗", "呢", "吧"} {
+		m[w] = true
+	}
+	return m
+}()
+
+// negations flip the meaning of a claim.
+var negations = map[string]bool{
+	"not": true, "no": true, "never": true, "cannot": true, "can't": true, "won't": true, "don't": true,
+	"doesn't": true, "isn't": true, "aren't": true, "wasn't": true, "weren't": true, "none": true, "without": true,
+}
+
+var cjkNegations = []string{"不", "没", "无", "未", "非", "禁止"}
+
+// hasNegation reports whether s contains a negation.
+func hasNegation(s string) bool {
+	for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	}) {
+		if negations[w] || strings.HasSuffix(w, "n't") {
+			return true
+		}
+	}
+	for _, n := range cjkNegations {
+		if strings.Contains(s, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// tokens returns the content words of s: lowercased, lightly stemmed Latin
+// words and numbers, and character bigrams of Han runs.
+func tokens(s string) map[string]bool {
+	out := map[string]bool{}
+	s = normalize.ToSimplified(strings.ToLower(s))
+	var word []rune
+	var han []rune
+	flushWord := func() {
+		if len(word) > 0 {
+			w := stem(strings.Trim(string(word), "'."))
+			if w != "" && !stopwords[w] && !negations[w] {
+				out[w] = true
+			}
+			word = word[:0]
+		}
+	}
+	flushHan := func() {
+		switch {
+		case len(han) == 1:
+			if w := string(han); !stopwords[w] {
+				out[w] = true
+			}
+		case len(han) > 1:
+			for i := 0; i+1 < len(han); i++ {
+				out[string(han[i:i+2])] = true
+			}
+		}
+		han = han[:0]
+	}
+	for _, r := range s {
+		switch {
+		case normalize.IsCJK(r):
+			flushWord()
+			if !stopwords[string(r)] {
+				han = append(han, r)
+			} else {
+				flushHan()
+			}
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || (r == '\'' && len(word) > 0) || (r == '.' && len(word) > 0 && isDigits(word)):
+			flushHan()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushHan()
+		}
+	}
+	flushWord()
+	flushHan()
+	return out
+}
+
+func isWordRune(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+
+func isDigits(rs []rune) bool {
+	for _, r := range rs {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// stem strips common English inflections so "returns" matches "returned".
+func stem(w string) string {
+	w = strings.TrimSuffix(w, "'s")
+	n := len(w)
+	switch {
+	case n > 4 && strings.HasSuffix(w, "ies"):
+		return w[:n-3] + "y"
+	case n > 5 && strings.HasSuffix(w, "ing"):
+		return w[:n-3]
+	case n > 4 && strings.HasSuffix(w, "ed"):
+		return w[:n-2]
+	case n > 3 && strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss"):
+		return w[:n-1]
+	}
+	return w
+}
+
+var number = regexp.MustCompile(`\d+(?:[.,]\d+)*`)
+
+// numbers returns the figures in s with thousands separators removed.
+func numbers(s string) []string {
+	var out []string
+	for _, m := range number.FindAllString(s, -1) {
+		out = append(out, strings.TrimRight(strings.ReplaceAll(m, ",", ""), "."))
+	}
+	return out
+}
+
+// ngrams returns the character trigram counts of s after lowercasing and
+// collapsing everything but letters and digits to single spaces.
+func ngrams(s string) map[string]float64 {
+	var b []rune
+	space := true
+	for _, r := range normalize.ToSimplified(strings.ToLower(s)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b = append(b, r)
+			space = false
+		} else if !space {
+			b = append(b, ' ')
+			space = true
+		}
+	}
+	out := map[string]float64{}
+	for i := 0; i+3 <= len(b); i++ {
+		out[string(b[i:i+3])]++
+	}
+	return out
+}
+
+// cosine is the cosine similarity of two n-gram vectors.
+func cosine(a, b map[string]float64) float64 {
+	var dot, na, nb float64
+	for k, v := range a {
+		na += v * v
+		dot += v * b[k]
+	}
+	for _, v := range b {
+		nb += v * v
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+// overlap is the share of the claim's tokens found in the passage.
+func overlap(claim, passage map[string]bool) float64 {
+	if len(claim) == 0 {
+		return 0
+	}
+	n := 0
+	for t := range claim {
+		if passage[t] {
+			n++
+		}
+	}
+	return float64(n) / float64(len(claim))
+}
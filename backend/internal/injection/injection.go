@@ -0,0 +1,231 @@
+// Package injection scores text for prompt-injection attempts. It is shared by
+// the prompt firewall and the RAG security layer.
+package injection
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"aiguardrails/internal/normalize"
+)
+
+// DefaultThreshold is the score at or above which text is treated as an injection.
+const DefaultThreshold = 0.5
+
+// Signal names.
+const (
+	SignalRoleOverride      = "role_override"      // "ignore previous instructions", 忽略之前的指令
+	SignalPromptLeak        = "prompt_leak"        // "reveal your system prompt"
+	SignalTemplateToken     = "template_token"     // fake <|im_start|>, [INST], <<SYS>>
+	SignalDelimiterAbuse    = "delimiter_abuse"    // "### system", "</context>", "END OF INPUT"
+	SignalJailbreak         = "jailbreak"          // DAN persona, developer mode, 越狱
+	SignalNoRestrictions    = "no_restrictions"    // "without any restrictions", 不受任何限制
+	SignalImperativeDensity = "imperative_density" // most sentences are commands to the model
+)
+
+// Signal is one heuristic that contributed to a score. Start and End are byte
+// offsets of the first matching span.
+type Signal struct {
+	Name   string  `json:"name"`
+	Weight float64 `json:"weight"`
+	Start  int     `json:"start"`
+	End    int     `json:"end"`
+}
+
+// Result is the injection score of a text (0..1) and its contributing signals,
+// strongest first. Transform names the normalization that revealed them.
+type Result struct {
+	Score     float64  `json:"score"`
+	Signals   []Signal `json:"signals,omitempty"`
+	Transform string   `json:"transform,omitempty"`
+}
+
+// Names returns the contributing signal names.
+func (r Result) Names() []string {
+	out := make([]string, 0, len(r.Signals))
+	for _, s := range r.Signals {
+		out = append(out, s.Name)
+	}
+	return out
+}
+
+// ScoreSignal renders the score as a legacy signal string, e.g. "injection_score:0.84".
+func (r Result) ScoreSignal() string {
+	return fmt.Sprintf("injection_score:%.2f", r.Score)
+}
+
+type pattern struct {
+	signal string
+	weight float64
+	re     *regexp.Regexp
+}
+
+func p(signal string, weight float64, expr string) pattern {
+	return pattern{signal: signal, weight: weight, re: regexp.MustCompile(expr)}
+}
+
+// patterns are matched against the raw text; weights reflect how rarely the
+// phrase appears in benign prompts.
+var patterns = []pattern{
+	// Role override, English.
+	p(SignalRoleOverride, 0.7, `(?i)\b(?:ignore|disregard|forget|skip|override|bypass)\s+(?:all\s+|any\s+|the\s+|your\s+|of\s+)*(?:previous|prior|above|earlier|preceding|original|system|initial)\s+(?:instructions?|prompts?|rules|directions|guidelines|context|messages?)`),
+	p(SignalRoleOverride, 0.6, `(?i)\b(?:ignore|disregard|forget)\s+(?:everything|all)\s+(?:above|before|you\s+(?:were|have\s+been)\s+told)`),
+	p(SignalRoleOverride, 0.35, `(?i)\b(?:you\s+are\s+now|from\s+now\s+on,?\s+you\s+(?:are|will|must)|pretend\s+(?:to\s+be|you\s+are)|act\s+as\s+(?:if\s+you\s+are\s+)?(?:an?\s+)?(?:unrestricted|unfiltered|uncensored|evil))`),
+	p(SignalRoleOverride, 0.4, `(?i)\bnew\s+(?:system\s+)?instructions?\s*:|\byour\s+new\s+(?:role|task|instructions?)\s+(?:is|are)\b`),
+	// Role override, Chinese.
+	p(SignalRoleOverride, 0.7, `(?:忽略|无视|忘记|忘掉|不要理会|跳过)(?:掉)?(?:你)?(?:之前|以上|上面|上述|前面|先前|此前|原来|原有|所有|全部|一切)+(?:的)?(?:所有|全部)?(?:指令|指示|规则|提示词?|要求|设定|约束|限制)`),
+	p(SignalRoleOverride, 0.35, `(?:你现在是|从现在(?:开始|起)[，,]?你|假装你是|扮演一个?(?:不受|没有))`),
+	// Prompt leaking.
+	p(SignalPromptLeak, 0.5, `(?i)\b(?:reveal|show|print|repeat|output|display|leak|tell\s+me)\s+(?:me\s+)?(?:your|the)\s+(?:full\s+|original\s+|hidden\s+|initial\s+)*(?:system\s+prompt|instructions|prompt|rules)\b`),
+	p(SignalPromptLeak, 0.5, `(?:输出|显示|打印|重复|告诉我|泄露)(?:一下)?(?:你的)?(?:系统提示词?|初始指令|原始指令|隐藏指令|系统指令)`),
+	// Fake chat-template tokens.
+	p(SignalTemplateToken, 0.7, `(?i)<\|(?:im_start|im_end|system|user|assistant|endoftext|begin_of_text|end_of_text|start_header_id|end_header_id|eot_id)\|>|\[/?INST\]|<</?SYS>>|<(?:start|end)_of_turn>`),
+	p(SignalTemplateToken, 0.3, `(?im)^\s*(?:system|assistant)\s*:\s*\S`),
+	// Instruction delimiter abuse.
+	p(SignalDelimiterAbuse, 0.5, `(?im)^\s*(?:#{2,}|={3,}|-{3,}|\*{3,})\s*(?:new\s+)?(?:system|instructions?|admin|developer)\b`),
+	p(SignalDelimiterAbuse, 0.45, `(?i)</(?:system|instructions?|context|document|user_input|data)>`),
+	p(SignalDelimiterAbuse, 0.45, `(?i)\b(?:end\s+of\s+(?:user\s+)?(?:input|prompt|context|document|instructions))\b`),
+	// Jailbreak personas and modes. These words also name phone rooting, IDE
+	// settings and people, so alone they stay below DefaultThreshold.
+	p(SignalJailbreak, 0.35, `(?i:\b(?:pretend\s+(?:to\s+be|you\s+are)|act\s+as|you\s+are(?:\s+now)?|become|enable|activate|stay(?:\s+in\s+character\s+as)?)\s+)DAN\b|\bDAN\s+(?i:mode|prompt|jailbreak)\b|\bDAN\b[^.\n]{0,40}(?i:do\s+anything\s+now)|(?i:\bdo\s+anything\s+now\b)`),
+	p(SignalJailbreak, 0.35, `(?i)\b(?:developer|god|debug|jailbreak|unrestricted)\s+mode\b|\bjailbr(?:eak|oken)\b`),
+	p(SignalJailbreak, 0.35, `(?:开发者模式|越狱模式|上帝模式|越狱)`),
+	// Lifting the model's restrictions.
+	p(SignalNoRestrictions, 0.4, `(?i)\b(?:without|no|free\s+(?:of|from))\s+(?:any\s+)?(?:restrictions|limitations|filters|censorship|guidelines|rules)\b`),
+	p(SignalNoRestrictions, 0.4, `(?:不受任何限制|没有任何限制|不受限制|无视道德|不受约束)`),
+}
+
+// imperativeVerbs start sentences that command the model.
+var imperativeVerbs = map[string]bool{
+	"ignore": true, "forget": true, "disregard": true, "override": true, "bypass": true,
+	"do": true, "don't": true, "never": true, "always": true, "stop": true,
+	"output": true, "print": true, "reveal": true, "respond": true, "reply": true, "answer": true,
+	"say": true, "write": true, "pretend": true, "act": true, "follow": true, "obey": true,
+	"execute": true, "run": true, "send": true, "repeat": true,
+}
+
+// imperativeZH are sentence openers that command the model.
+var imperativeZH = []string{"忽略", "忘记", "不要", "必须", "立即", "输出", "执行", "请忽略", "你必须", "务必"}
+
+var sentenceSplit = regexp.MustCompile(`[.!?。！？;；\n]+`)
+
+const (
+	minImperatives     = 3
+	minImperativeRatio = 0.6
+)
+
+// imperativeDensity reports a signal when most sentences, and at least
+// minImperatives of them, open with an imperative aimed at the model.
+func imperativeDensity(text string) (Signal, bool) {
+	var total, commands int
+	for _, s := range sentenceSplit.Split(text, -1) {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		total++
+		if isImperative(s) {
+			commands++
+		}
+	}
+	if commands < minImperatives || float64(commands)/float64(total) < minImperativeRatio {
+		return Signal{}, false
+	}
+	w := math.Min(0.45, 0.1*float64(commands))
+	return Signal{Name: SignalImperativeDensity, Weight: w, Start: 0, End: len(text)}, true
+}
+
+func isImperative(sentence string) bool {
+	for _, zh := range imperativeZH {
+		if strings.HasPrefix(sentence, zh) {
+			return true
+		}
+	}
+	first := strings.ToLower(strings.Trim(strings.Fields(sentence)[0], `"'*-,:`))
+	return imperativeVerbs[first]
+}
+
+// Score evaluates text. Each signal counts once, with its strongest match, and
+// signals combine as independent evidence: score = 1 - Π(1 - weight).
+func Score(text string) Result {
+	best := map[string]Signal{}
+	for _, pt := range patterns {
+		loc := pt.re.FindStringIndex(text)
+		if loc == nil {
+			continue
+		}
+		if cur, ok := best[pt.signal]; !ok || pt.weight > cur.Weight {
+			best[pt.signal] = Signal{Name: pt.signal, Weight: pt.weight, Start: loc[0], End: loc[1]}
+		}
+	}
+	if sig, ok := imperativeDensity(text); ok {
+		best[sig.Name] = sig
+	}
+	var res Result
+	miss := 1.0
+	for _, sig := range best {
+		res.Signals = append(res.Signals, sig)
+		miss *= 1 - sig.Weight
+	}
+	sort.Slice(res.Signals, func(i, j int) bool {
+		if res.Signals[i].Weight != res.Signals[j].Weight {
+			return res.Signals[i].Weight > res.Signals[j].Weight
+		}
+		return res.Signals[i].Name < res.Signals[j].Name
+	})
+	res.Score = math.Round((1-miss)*100) / 100
+	return res
+}
+
+// ScoreVariants scores text and its normalized variants and returns the
+// highest score; signal offsets refer to text.
+func ScoreVariants(text string) Result {
+	var best Result
+	for _, v := range normalize.Variants(text) {
+		res := Score(v.Text)
+		if res.Score <= best.Score {
+			continue
+		}
+		for i, sig := range res.Signals {
+			res.Signals[i].Start, res.Signals[i].End = v.Span(sig.Start, sig.End)
+		}
+		res.Transform = v.Transform
+		best = res
+	}
+	return best
+}
+
+// Thresholds resolves a tenant's injection threshold; 0 means DefaultThreshold.
+type Thresholds interface {
+	InjectionThreshold(tenantID string) float64
+}
+
+// Detector applies per-tenant thresholds to Score.
+type Detector struct {
+	thresholds Thresholds
+}
+
+// NewDetector constructs a Detector; thresholds may be nil.
+func NewDetector(thresholds Thresholds) *Detector {
+	return &Detector{thresholds: thresholds}
+}
+
+// Threshold returns the tenant's threshold.
+func (d *Detector) Threshold(tenantID string) float64 {
+	if d != nil && d.thresholds != nil {
+		if t := d.thresholds.InjectionThreshold(tenantID); t > 0 && t <= 1 {
+			return t
+		}
+	}
+	return DefaultThreshold
+}
+
+// Detect scores text and its normalized variants and reports whether the
+// highest score reaches the tenant's threshold.
+func (d *Detector) Detect(tenantID, text string) (Result, bool) {
+	res := ScoreVariants(text)
+	return res, len(res.Signals) > 0 && res.Score >= d.Threshold(tenantID)
+}
@@ -0,0 +1,293 @@
+// Package keyword matches keyword rules against text. Besides plain
+// case-insensitive matching, a rule can opt into Chinese-aware matching:
+// traditional characters and separators inserted between characters are
+// folded away, and pinyin spellings or their initials can count as hits.
+package keyword
+
+import (
+	"strings"
+
+	"aiguardrails/internal/ahocorasick"
+	"aiguardrails/internal/normalize"
+	"aiguardrails/internal/policy"
+)
+
+// Via values name how a keyword matched; plain matches leave Via empty.
+const (
+	ViaChinese  = "chinese"
+	ViaPinyin   = "pinyin"
+	ViaInitials = "initials"
+)
+
+// Options toggles Chinese-aware matching for a keyword rule. The folding and
+// pinyin tables are built in and cover common characters only (about 700
+// traditional forms, 850 readings), not full OpenCC or Unihan data: a
+// traditional character outside the table is not folded, and a keyword with a
+// character outside the pinyin table gets no pinyin or initials form. Such
+// keywords still match literally; list the other spellings as keywords too.
+type Options struct {
+	Chinese  bool `json:"chinese,omitempty"`  // fold traditional→simplified and separators between CJK characters
+	Pinyin   bool `json:"pinyin,omitempty"`   // match full pinyin spellings, e.g. "fapiao", "fa-piao"
+	Initials bool `json:"initials,omitempty"` // match pinyin initials, e.g. "fp"; noisy for short keywords
+}
+
+// Term is a keyword with its matching options.
+type Term struct {
+	Text    string  `json:"text"`
+	Options Options `json:"options,omitempty"`
+}
+
+// Plain returns terms matched literally.
+func Plain(words ...string) []Term {
+	out := make([]Term, 0, len(words))
+	for _, w := range words {
+		out = append(out, Term{Text: w})
+	}
+	return out
+}
+
+// Texts returns the keyword strings of terms.
+func Texts(terms []Term) []string {
+	out := make([]string, 0, len(terms))
+	for _, t := range terms {
+		out = append(out, t.Text)
+	}
+	return out
+}
+
+// Match is the first keyword found in a text with all its spans. Span offsets
+// refer to the searched text.
+type Match struct {
+	Term  string
+	Via   string
+	Spans []policy.DLPSpan
+}
+
+type compiled struct {
+	term     Term
+	pinyin   int // index into Matcher.roman; -1 when disabled or not transliterable
+	initials int
+}
+
+// romanForm is a pinyin spelling or initials of a term. Separators may only
+// appear between its syllables, at the joins offsets.
+type romanForm struct {
+	joins []int
+}
+
+// Matcher matches a fixed set of terms in one pass per text form. Compile it
+// once per rule set; it is safe for concurrent use.
+type Matcher struct {
+	terms  []compiled
+	plain  *ahocorasick.Automaton // term texts, indexed like terms
+	folded *ahocorasick.Automaton // folded texts of Chinese-aware terms; nil when there are none
+	roman  *ahocorasick.Automaton // pinyin and initials forms, indexed like forms; nil when there are none
+	forms  []romanForm
+}
+
+// Compile prepares terms for matching; empty terms are skipped.
+func Compile(terms []Term) *Matcher {
+	m := &Matcher{}
+	var plain, folded, roman []string
+	chinese := false
+	for _, t := range terms {
+		t.Text = strings.TrimSpace(t.Text)
+		if t.Text == "" {
+			continue
+		}
+		c := compiled{term: t, pinyin: -1, initials: -1}
+		f := ""
+		if t.Options.Chinese {
+			chinese = true
+			f = t.Text
+			if v, ok := normalize.FoldChinese(t.Text); ok {
+				f = v.Text
+			}
+		}
+		if py, ok := syllables(normalize.ToSimplified(t.Text)); ok {
+			if t.Options.Pinyin {
+				var joins []int
+				n := 0
+				for _, s := range py[:len(py)-1] {
+					n += len(s)
+					joins = append(joins, n)
+				}
+				c.pinyin = len(roman)
+				roman = append(roman, strings.Join(py, ""))
+				m.forms = append(m.forms, romanForm{joins: joins})
+			}
+			if t.Options.Initials && len(py) > 1 {
+				var b strings.Builder
+				for _, s := range py {
+					b.WriteByte(s[0])
+				}
+				c.initials = len(roman)
+				roman = append(roman, b.String())
+				m.forms = append(m.forms, romanForm{})
+			}
+		}
+		m.terms = append(m.terms, c)
+		plain = append(plain, t.Text)
+		folded = append(folded, f)
+	}
+	m.plain = ahocorasick.New(plain)
+	if chinese {
+		m.folded = ahocorasick.New(folded)
+	}
+	if len(roman) > 0 {
+		m.roman = ahocorasick.New(roman)
+	}
+	return m
+}
+
+// Len reports the number of compiled terms.
+func (m *Matcher) Len() int {
+	if m == nil {
+		return 0
+	}
+	return len(m.terms)
+}
+
+// Terms returns the compiled terms in rule order.
+func (m *Matcher) Terms() []Term {
+	if m == nil {
+		return nil
+	}
+	out := make([]Term, 0, len(m.terms))
+	for _, c := range m.terms {
+		out = append(out, c.term)
+	}
+	return out
+}
+
+// Find returns the first term, in rule order, found in text. For each term a
+// literal hit is preferred over a folded, pinyin or initials hit.
+func (m *Matcher) Find(text string) (Match, bool) {
+	if m.Len() == 0 {
+		return Match{}, false
+	}
+	plain := groupSpans(text, m.plain.FindAll(text), nil)
+	var folded map[int][]policy.DLPSpan
+	if m.folded != nil {
+		if v, ok := normalize.FoldChinese(text); ok {
+			folded = groupSpans(text, m.folded.FindAll(v.Text), &v)
+		}
+	}
+	var roman map[int][]policy.DLPSpan
+	if m.roman != nil {
+		roman = m.findRoman(text)
+	}
+	for i, c := range m.terms {
+		if spans := plain[i]; len(spans) > 0 {
+			return Match{Term: c.term.Text, Spans: spans}, true
+		}
+		if spans := folded[i]; len(spans) > 0 {
+			return Match{Term: c.term.Text, Via: ViaChinese, Spans: spans}, true
+		}
+		if spans := roman[c.pinyin]; len(spans) > 0 {
+			return Match{Term: c.term.Text, Via: ViaPinyin, Spans: spans}, true
+		}
+		if spans := roman[c.initials]; len(spans) > 0 {
+			return Match{Term: c.term.Text, Via: ViaInitials, Spans: spans}, true
+		}
+	}
+	return Match{}, false
+}
+
+// groupSpans groups automaton hits by term, mapping offsets of a folded
+// variant back to text.
+func groupSpans(text string, hits []ahocorasick.Match, v *normalize.Variant) map[int][]policy.DLPSpan {
+	if len(hits) == 0 {
+		return nil
+	}
+	out := map[int][]policy.DLPSpan{}
+	for _, h := range hits {
+		start, end := h.Start, h.End
+		if v != nil {
+			start, end = v.Span(start, end)
+		}
+		out[h.Pattern] = append(out[h.Pattern], policy.DLPSpan{Start: start, End: end, Text: text[start:end]})
+	}
+	return out
+}
+
+// findRoman finds the pinyin and initials forms as whole words, grouped by
+// form. The automaton runs over text with separator runs between two letters
+// removed; a hit counts only if it was split at its syllable joins.
+func (m *Matcher) findRoman(text string) map[int][]policy.DLPSpan {
+	joined, orig := joinLetters(text)
+	var out map[int][]policy.DLPSpan
+	for _, h := range m.roman.FindAll(joined) {
+		start, end := orig[h.Start], orig[h.End-1]+1
+		if (start > 0 && isWordByte(text[start-1])) || (end < len(text) && isWordByte(text[end])) {
+			continue
+		}
+		if !m.forms[h.Pattern].splitAt(h.Start, h.End, orig) {
+			continue
+		}
+		if out == nil {
+			out = map[int][]policy.DLPSpan{}
+		}
+		out[h.Pattern] = append(out[h.Pattern], policy.DLPSpan{Start: start, End: end, Text: text[start:end]})
+	}
+	return out
+}
+
+// splitAt reports whether every separator removed inside joined[start:end]
+// fell on one of the form's syllable joins.
+func (f romanForm) splitAt(start, end int, orig []int) bool {
+	j := 0
+	for i := start + 1; i < end; i++ {
+		if orig[i] == orig[i-1]+1 {
+			continue
+		}
+		for j < len(f.joins) && f.joins[j] < i-start {
+			j++
+		}
+		if j == len(f.joins) || f.joins[j] != i-start {
+			return false
+		}
+	}
+	return true
+}
+
+// joinLetters removes runs of pinyin separators (whitespace, ' . _ -) between
+// two ASCII letters, returning the joined text and the offset in text of each
+// of its bytes.
+func joinLetters(text string) (string, []int) {
+	var b strings.Builder
+	b.Grow(len(text))
+	orig := make([]int, 0, len(text))
+	for i := 0; i < len(text); i++ {
+		if isSeparator(text[i]) && i > 0 && isLetter(text[i-1]) {
+			j := i
+			for j < len(text) && isSeparator(text[j]) {
+				j++
+			}
+			if j < len(text) && isLetter(text[j]) {
+				i = j - 1
+				continue
+			}
+		}
+		b.WriteByte(text[i])
+		orig = append(orig, i)
+	}
+	return b.String(), orig
+}
+
+func isSeparator(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\f', '\r', '\'', '.', '_', '-':
+		return true
+	}
+	return false
+}
+
+func isLetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// isWordByte matches the ASCII word characters of a regexp \b.
+func isWordByte(c byte) bool {
+	return isLetter(c) || ('0' <= c && c <= '9') || c == '_'
+}
@@ -0,0 +1,105 @@
+package keyword
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestMatcherChineseAware(t *testing.T) {
+	cn := Options{Chinese: true, Pinyin: true}
+	cases := []struct {
+		text  string
+		terms []Term
+		hit   bool
+		via   string
+		span  string
+	}{
+		{"我需要开发票", []Term{{Text: "发票"}}, true, "", "发票"},
+		{"可以開發票嗎", []Term{{Text: "发票"}}, false, "", ""},
+		{"可以開發票嗎", []Term{{Text: "发票", Options: cn}}, true, ViaChinese, "發票"},
+		{"有没有 赌 . 博 网站", []Term{{Text: "赌博", Options: cn}}, true, ViaChinese, "赌 . 博"},
+		{"帮我开个fapiao", []Term{{Text: "发票", Options: cn}}, true, ViaPinyin, "fapiao"},
+		{"find a du-bo site", []Term{{Text: "赌博", Options: cn}}, true, ViaPinyin, "du-bo"},
+		{"开个fp吧", []Term{{Text: "发票", Options: cn}}, false, "", ""},
+		{"开个fp吧", []Term{{Text: "发票", Options: Options{Initials: true}}}, true, ViaInitials, "fp"},
+		{"the fapiaos are late", []Term{{Text: "发票", Options: cn}}, false, "", ""},
+		{"need a FA. piao now", []Term{{Text: "发票", Options: cn}}, true, ViaPinyin, "FA. piao"},
+		{"need a f-apiao now", []Term{{Text: "发票", Options: cn}}, false, "", ""},
+		{"see x_fapiao", []Term{{Text: "发票", Options: cn}}, false, "", ""},
+		{"开个f p吧", []Term{{Text: "发票", Options: Options{Initials: true}}}, false, "", ""},
+		{"赌 场", []Term{{Text: "赌博", Options: cn}}, false, "", ""},
+		// Characters outside the built-in tables match literally only.
+		{"鑫源公司", []Term{{Text: "鑫源", Options: cn}}, true, "", "鑫源"},
+		{"call xinyuan now", []Term{{Text: "鑫源", Options: cn}}, false, "", ""},
+		{"龐氏騙局", []Term{{Text: "庞氏骗局", Options: cn}}, false, "", ""},
+		{"龐氏騙局", []Term{{Text: "龐氏骗局", Options: cn}}, true, ViaChinese, "龐氏騙局"},
+	}
+	for _, tc := range cases {
+		m, ok := Compile(tc.terms).Find(tc.text)
+		if ok != tc.hit {
+			t.Errorf("%q: hit=%v want %v", tc.text, ok, tc.hit)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if m.Via != tc.via || tc.text[m.Spans[0].Start:m.Spans[0].End] != tc.span {
+			t.Errorf("%q: via %q span %q, want %q %q", tc.text, m.Via, tc.text[m.Spans[0].Start:m.Spans[0].End], tc.via, tc.span)
+		}
+	}
+}
+
+func TestMatcherRuleOrderAndEmpty(t *testing.T) {
+	m := Compile(append(Plain("", "  "), Plain("b", "a")...))
+	if m.Len() != 2 {
+		t.Fatalf("expected empty terms skipped, got %d", m.Len())
+	}
+	if got, _ := m.Find("a b"); got.Term != "b" {
+		t.Fatalf("expected first rule to win, got %q", got.Term)
+	}
+	if _, ok := Compile(nil).Find("anything"); ok {
+		t.Fatal("empty matcher matched")
+	}
+}
+
+// BenchmarkKeywordRules compares the matching before compiled rules (one
+// strings.Contains per term, plain matching only) with compiling the rules on
+// every request and with reusing a compiled matcher.
+func BenchmarkKeywordRules(b *testing.B) {
+	chars := []rune("敏感词汇发票赌博违规内容")
+	for _, n := range []int{100, 2000} {
+		terms := make([]Term, n)
+		for i := range terms {
+			terms[i] = Term{Text: string([]rune{chars[i%len(chars)], chars[i/len(chars)%len(chars)], chars[i/len(chars)/len(chars)%len(chars)]}) + "词",
+				Options: Options{Chinese: true, Pinyin: true, Initials: true}}
+		}
+		last := terms[n-1].Text
+		text := strings.Repeat("请帮我总结这份季度报告的主要内容。please summarize the report. ", 100) + strings.Join(strings.Split(last, ""), " ")
+		b.Run(fmt.Sprintf("contains_baseline/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				lower := strings.ToLower(text)
+				for _, t := range terms {
+					if strings.Contains(lower, strings.ToLower(t.Text)) {
+						break
+					}
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("compile_per_request/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, ok := Compile(terms).Find(text); !ok {
+					b.Fatal("expected a match")
+				}
+			}
+		})
+		m := Compile(terms)
+		b.Run(fmt.Sprintf("cached/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, ok := m.Find(text); !ok {
+					b.Fatal("expected a match")
+				}
+			}
+		})
+	}
+}
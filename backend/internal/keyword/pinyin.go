@@ -0,0 +1,362 @@
+package keyword
+
+import "strings"
+
+// pinyinTable lists common simplified characters by their most frequent
+// toneless reading. A character listed twice keeps its first reading. It is
+// not complete Unihan data: rarer characters are missing and polyphonic ones
+// get a single reading.
+const pinyinTable = `
+a 阿啊
+ai 爱哀艾碍
+an 安按案暗岸
+ang 昂
+ao 奥傲澳
+ba 八把爸吧巴拔
+bai 白百败拜
+ban 办半班般板版
+bang 帮棒绑
+bao 报包保宝暴抱薄
+bei 被北备背贝杯悲
+ben 本奔
+bi 比必笔毕币闭彼逼
+bian 边变便编遍
+biao 表标
+bie 别
+bin 宾滨
+bing 并病兵冰
+bo 博波播伯拨
+bu 不部步布补捕
+cai 才财采材菜彩
+can 参残惨餐
+cang 藏仓
+cao 草操
+ce 策测册
+ceng 曾层
+cha 查察差茶插
+chai 拆
+chan 产缠
+chang 长场常厂唱娼
+chao 超朝抄
+che 车彻
+chen 陈沉晨
+cheng 成城程称承诚乘惩
+chi 吃持迟尺池
+chong 冲充虫
+chou 抽丑
+chu 出处初除楚
+chuan 传船穿
+chuang 创床
+chun 春纯
+ci 此次词辞
+cong 从聪
+cu 促
+cui 催
+cun 存村
+cuo 错
+da 大打达答
+dai 代带待贷袋
+dan 但单担胆弹蛋
+dang 当党档
+dao 到道导刀倒盗
+de 的得德
+deng 等灯登
+di 地第低底帝敌弟
+dian 点电店典
+diao 调掉
+die 跌
+ding 定顶订
+dong 动东懂冬洞
+dou 都斗
+du 度读毒独赌
+duan 段短断
+dui 对队
+dun 顿
+duo 多夺
+e 恶饿
+er 而二儿
+fa 发法罚
+fan 反饭犯范返
+fang 方放房防访
+fei 非费飞肥
+fen 分份粉愤
+feng 风封丰
+fo 佛
+fou 否
+fu 服府富复副付负父福腐
+gai 该改盖
+gan 干感敢
+gang 港刚钢
+gao 高告搞
+ge 个各哥歌革格
+gei 给
+gen 跟根
+geng 更
+gong 工公共功攻
+gou 购够构沟
+gu 故古股顾骨
+gua 挂
+guai 怪
+guan 关管官观馆
+guang 光广
+gui 规贵鬼归
+gun 滚
+guo 国过果
+ha 哈
+hai 还海害孩
+han 汉含韩
+hang 航
+hao 好号
+he 和合何河核
+hei 黑
+hen 很恨
+hong 红宏
+hou 后候
+hu 户护互呼湖虎
+hua 话化花画华
+huai 坏
+huan 换环欢
+huang 黄皇
+hui 会回汇毁贿灰
+hun 婚混
+huo 或活火获货
+ji 机级及记计技即极急基集际积
+jia 家加价假甲
+jian 件间见建简监检减
+jiang 将讲降奖江
+jiao 交教叫较
+jie 结接解界节借
+jin 进金今近禁仅
+jing 经警境精竟
+jiu 就九旧酒
+ju 局据举具
+jue 决绝觉
+jun 军
+ka 卡
+kai 开
+kan 看
+kao 考靠
+ke 可科客课
+kong 空控恐
+kou 口扣
+ku 库苦
+kuai 快块
+kuan 款宽
+kuang 况矿
+kun 困
+la 拉
+lai 来
+lan 蓝烂
+lang 浪
+lao 老劳
+le 了乐
+lei 类累
+leng 冷
+li 里理力利立李离
+lian 连联脸练
+liang 两量亮
+liao 料疗
+lie 列烈
+lin 林临
+ling 领另零
+liu 流六留
+long 龙
+lou 楼漏
+lu 路录陆赂露
+lun 论
+luo 落
+lv 律绿旅
+ma 吗妈马码麻
+mai 买卖
+man 满慢
+mang 忙
+mao 毛贸
+mei 没美每
+men 们门
+mi 密米秘
+mian 面免
+min 民敏
+ming 名明命
+mo 么模末
+mou 某
+mu 目母
+na 那拿
+nan 难南男
+nao 脑闹
+ne 呢
+nei 内
+neng 能
+ni 你
+nian 年念
+niang 娘
+nong 农
+nu 女努
+nuan 暖
+pa 怕
+pai 派排
+pan 判盘
+pang 旁
+pao 跑炮
+pei 配赔
+peng 朋
+pi 批皮
+pian 片骗偏
+piao 票漂嫖
+pin 品
+ping 平评
+po 破
+pu 普
+qi 起其期气器奇企
+qian 前钱签千
+qiang 强枪
+qiao 桥
+qie 且切
+qin 亲侵
+qing 情清请轻
+qiu 求球
+qu 去取区
+quan 全权劝
+que 却确
+qun 群
+ran 然
+rang 让
+re 热
+ren 人认任
+ri 日
+rong 容
+rou 肉
+ru 如入
+ruan 软
+ruo 弱
+sa 洒
+san 三
+se 色
+sha 杀
+shan 山删
+shang 上商伤
+shao 少烧
+she 社设射
+shen 身深神审
+sheng 生声省
+shi 是时事市使式实十识世
+shou 手受收售首
+shu 数书术属输
+shuang 双
+shui 水税谁
+shuo 说
+si 四死私司思
+song 送
+su 诉速
+suan 算
+sui 虽随
+suo 所锁
+ta 他她它
+tai 太台
+tan 谈贪
+tang 堂
+tao 逃套
+te 特
+ti 提体题
+tian 天
+tiao 条
+tie 铁
+ting 听停
+tong 同通统
+tou 头投偷
+tu 图突
+tui 推退
+tuo 脱
+wai 外
+wan 完万玩
+wang 网往王
+wei 为位未维违伪
+wen 文问
+wo 我
+wu 无务物五
+xi 系西息洗
+xia 下
+xian 现先线
+xiang 想相向
+xiao 小笑效销
+xie 写谢
+xin 新心信
+xing 性行型
+xiu 修
+xu 需许
+xuan 选
+xue 学血
+xun 寻
+ya 压
+yan 言研
+yang 样
+yao 要药
+ye 也业
+yi 一以已意医
+yin 因银淫
+ying 应营
+yong 用
+you 有由又
+yu 与于语预
+yuan 员原
+yue 月越
+yun 运
+za 杂
+zai 在再
+zan 赞
+zang 赃
+zao 早
+ze 则责
+zen 怎
+zeng 增
+zha 诈炸
+zhai 债
+zhan 站战
+zhang 张账
+zhao 找照
+zhe 这者
+zhen 真
+zheng 正政证
+zhi 之只知制
+zhong 中种重
+zhou 周
+zhu 主住
+zhuan 转专
+zhuang 装
+zhun 准
+zi 子自资
+zong 总
+zou 走
+zu 组
+zui 最罪
+zuo 做作
+`
+
+var pinyin = func() map[rune]string {
+	m := map[rune]string{}
+	for _, line := range strings.Split(pinyinTable, "\n") {
+		syllable, chars, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok {
+			continue
+		}
+		for _, r := range chars {
+			if _, dup := m[r]; !dup {
+				m[r] = syllable
+			}
+		}
+	}
+	return m
+}()
+
+// syllables returns the pinyin of each rune of s, or false when any rune is
+// not in the table.
+func syllables(s string) ([]string, bool) {
+	var out []string
+	for _, r := range s {
+		py, ok := pinyin[r]
+		if !ok {
+			return nil, false
+		}
+		out = append(out, py)
+	}
+	return out, len(out) > 0
+}
@@ -3,6 +3,7 @@ package llm_guard
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -39,9 +40,13 @@ func (c *Client) SetAPIKey(key string) {
 	c.cfg.APIKey = key
 }
 
+// ErrNoAPIKey means the guard is not configured; callers apply their failure policy.
+var ErrNoAPIKey = errors.New("llm guard: api key not configured")
+
+// Check asks the LLM whether prompt violates instruction.
 func (c *Client) Check(prompt string, instruction string) (bool, string, error) {
 	if c.cfg.APIKey == "" {
-		return true, "", nil
+		return false, "", ErrNoAPIKey
 	}
 
 	systemPrompt := fmt.Sprintf("You are a content safety guardrail. %s\nIf the content is unsafe, respond with 'UNSAFE: <reason>'. If safe, respond with 'SAFE'.", instruction)
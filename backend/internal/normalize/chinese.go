@@ -0,0 +1,122 @@
+package normalize
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Chinese names the traditional-to-simplified variant.
+const Chinese = "chinese"
+
+// Common traditional characters and their simplified forms, aligned rune by rune.
+// This is a subset, not the OpenCC tables: other traditional characters are left as they are.
+const (
+	traditionalChars = "發髮報銷賄賂賭這個們來時會說對國學還過後實現點無開關問題長東車門見進動種體產當經" +
+		"義於與頭員間電話機樣讓從應愛錢買賣價貨資質費貸賬帳單據證處務業權聯絡網線紅黃綠藍" +
+		"顏號碼驗隊陽陰際隨險難歡觀親傳僅億優倆儲兒內兩冊劃劇勞勢勵區協卻廠歷壓參雙變叢吳" +
+		"圖圍園圓場塊壞壯聲備夠奪獎婦媽孫寧寶將專尋導層屬歲島峽幣幫廣庫廢張強彈歸錄徑復徵" +
+		"憶懷態戀戰戲擊擁擇擔擴攝敗敵數斷晝暫術殺條極構槍標樂歐殘毀氣滅漢濟灣為爲烏熱燈爭" +
+		"爺牆獨獲環瑪畫療盜盡監盤眾衆礦確禮禍稱穩窮競筆節範糧紀約級紙細終組結統絕給續維綜" +
+		"編緊總繼罰罵聖聞職腦膽臉臨興舉舊艦藝蘇蘭衛衝補裝製複規視覺討記訪設許訴詞試詩該認" +
+		"語誤請諸論謝講識護讀貝負財責貧購貿賀賊賽贏趕趙跡軍軟載輕輪輸轉辦農運達違遠適遲遷" +
+		"選遺邊鄉鄧醫釋針鈔銀鋼錯鍵鎮鐘鐵閃閉閱闖陣陳陸隱雜雞離雲靈韓頁項順須預領頻類顧風" +
+		"飛飯飲館馬駕騙驚鬥魚鳥鳳麗麥黨齊齒龍龜傷賠騷獄詐穢髒臟賤娛謀販藥鬧潑黴檯臺颱週裡" +
+		"裏麼麵鬆鬱薦蔔隻彙匯係繫乾幹遊鍊煉團糰纔蟲測湧滬滿漲潔澤濱瀏灑燒爐犧狀猶獅璽畢異" +
+		"疊癢皺盞磚礙禦禪稅穀積窩竊筍簡簽籃籌糾紛純納紐練緒締縣縮織繳罷羅翹聽聰肅脅脈腎膚" +
+		"莊華萬葉著蓋蓮蔣薩蘋蘿虛蝦蠶蠻襲訂計訊託訝詢詳誠誕誌誘誰課調談諾謊謎譯議譽讚贊豐" +
+		"豬貓貞貢貫貪貴貼賓賞賢賴贈趨蹤躍軌較輔輝輩轄辭邏郵鄰釣鈴鉛銅銘鋒鋪錦錶鍋鎖鏡鑰閣" +
+		"閒闆闊隸雖霧靜韻響頂頒頓頗頸顆顯飄飽餅養餘饑騎騰驅鬍魯鮮鴨鵝鷹鹽齡嗎啟喚嘆噴嚴囑" +
+		"壇墳墜奮嬰屆屍帥廳彌慣慮慘憤懇懼擠擬擾攤敘斬暈曆曉棄榮槓樓樹橋檢櫃歎殲氫沒溝準漁" +
+		"潛澀濃濕瀉災煙煩爛牽犢獵琿瓊癡盧瞭矯碩禱秈稈窯竄筧築籤糞緝縫纏罈翬聳腫膠臥艱蕭虜" +
+		"蟬衊袞覓訐評詛誇諷謠譏讒豈貶賦賜贓贖蹟軀轟辯邁醜釀鑑鑒閥闡陝陘隴雋雛靂頹顫飆餓騾" +
+		"骯鬢鴿鹼黷鼴"
+	simplifiedChars = "发发报销贿赂赌这个们来时会说对国学还过后实现点无开关问题长东车门见进动种体产当经" +
+		"义于与头员间电话机样让从应爱钱买卖价货资质费贷账账单据证处务业权联络网线红黄绿蓝" +
+		"颜号码验队阳阴际随险难欢观亲传仅亿优俩储儿内两册划剧劳势励区协却厂历压参双变丛吴" +
+		"图围园圆场块坏壮声备够夺奖妇妈孙宁宝将专寻导层属岁岛峡币帮广库废张强弹归录径复征" +
+		"忆怀态恋战戏击拥择担扩摄败敌数断昼暂术杀条极构枪标乐欧残毁气灭汉济湾为为乌热灯争" +
+		"爷墙独获环玛画疗盗尽监盘众众矿确礼祸称稳穷竞笔节范粮纪约级纸细终组结统绝给续维综" +
+		"编紧总继罚骂圣闻职脑胆脸临兴举旧舰艺苏兰卫冲补装制复规视觉讨记访设许诉词试诗该认" +
+		"语误请诸论谢讲识护读贝负财责贫购贸贺贼赛赢赶赵迹军软载轻轮输转办农运达违远适迟迁" +
+		"选遗边乡邓医释针钞银钢错键镇钟铁闪闭阅闯阵陈陆隐杂鸡离云灵韩页项顺须预领频类顾风" +
+		"飞饭饮馆马驾骗惊斗鱼鸟凤丽麦党齐齿龙龟伤赔骚狱诈秽脏脏贱娱谋贩药闹泼霉台台台周里" +
+		"里么面松郁荐卜只汇汇系系干干游炼炼团团才虫测涌沪满涨洁泽滨浏洒烧炉牺状犹狮玺毕异" +
+		"叠痒皱盏砖碍御禅税谷积窝窃笋简签篮筹纠纷纯纳纽练绪缔县缩织缴罢罗翘听聪肃胁脉肾肤" +
+		"庄华万叶着盖莲蒋萨苹萝虚虾蚕蛮袭订计讯托讶询详诚诞志诱谁课调谈诺谎谜译议誉赞赞丰" +
+		"猪猫贞贡贯贪贵贴宾赏贤赖赠趋踪跃轨较辅辉辈辖辞逻邮邻钓铃铅铜铭锋铺锦表锅锁镜钥阁" +
+		"闲板阔隶虽雾静韵响顶颁顿颇颈颗显飘饱饼养余饥骑腾驱胡鲁鲜鸭鹅鹰盐龄吗启唤叹喷严嘱" +
+		"坛坟坠奋婴届尸帅厅弥惯虑惨愤恳惧挤拟扰摊叙斩晕历晓弃荣杠楼树桥检柜叹歼氢没沟准渔" +
+		"潜涩浓湿泻灾烟烦烂牵犊猎珲琼痴卢了矫硕祷籼秆窑窜笕筑签粪缉缝缠坛翚耸肿胶卧艰萧虏" +
+		"蝉蔑衮觅讦评诅夸讽谣讥谗岂贬赋赐赃赎迹躯轰辩迈丑酿鉴鉴阀阐陕陉陇隽雏雳颓颤飙饿骡" +
+		"肮鬓鸽碱黩鼹"
+)
+
+var toSimplified = func() map[rune]rune {
+	t, s := []rune(traditionalChars), []rune(simplifiedChars)
+	if len(t) != len(s) {
+		panic("normalize: traditional/simplified tables differ in length")
+	}
+	m := make(map[rune]rune, len(t))
+	for i, r := range t {
+		m[r] = s[i]
+	}
+	return m
+}()
+
+// ToSimplified folds traditional characters in s to simplified ones.
+func ToSimplified(s string) string {
+	return strings.Map(func(r rune) rune {
+		if sr, ok := toSimplified[r]; ok {
+			return sr
+		}
+		return r
+	}, s)
+}
+
+// IsCJK reports whether r is a Han character.
+func IsCJK(r rune) bool { return unicode.Is(unicode.Han, r) }
+
+// FoldChinese folds traditional characters to simplified ones and drops
+// whitespace and punctuation between two Han characters ("赌 博", "赌.博"),
+// so CJK keywords match through inserted separators. The result is false when
+// nothing changed.
+func FoldChinese(text string) (Variant, bool) {
+	in := Variant{Text: text}
+	bd := newBuilder(in)
+	changed := false
+	prevCJK := false
+	for i := 0; i < len(text); {
+		r, n := utf8.DecodeRuneInString(text[i:])
+		if prevCJK && isSeparator(r) {
+			// Skip the separator run only when another Han character follows it.
+			j := i
+			for j < len(text) {
+				rj, nj := utf8.DecodeRuneInString(text[j:])
+				if !isSeparator(rj) {
+					break
+				}
+				j += nj
+			}
+			if next, _ := utf8.DecodeRuneInString(text[j:]); j < len(text) && IsCJK(next) {
+				changed = true
+				i = j
+				continue
+			}
+		}
+		if sr, ok := toSimplified[r]; ok {
+			r, changed = sr, true
+		}
+		bd.add(string(r), i, i+n)
+		prevCJK = IsCJK(r)
+		i += n
+	}
+	if !changed {
+		return Variant{}, false
+	}
+	return bd.variant(Chinese), true
+}
+
+func isSeparator(r rune) bool {
+	return unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r) || zeroWidth[r]
+}
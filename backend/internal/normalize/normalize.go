@@ -0,0 +1,360 @@
+// Package normalize produces canonical variants of text so detectors see
+// through obfuscation: full-width forms, zero-width characters, homoglyphs,
+// leetspeak, spaced-out letters and embedded base64/hex/URL/ROT13 payloads.
+package normalize
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Transform names, reported as "normalized:<transform>" signals.
+const (
+	ZeroWidth = "zero_width"
+	FullWidth = "fullwidth"
+	Homoglyph = "homoglyph"
+	Leetspeak = "leetspeak"
+	Spacing   = "spacing"
+	URL       = "url"
+	Base64    = "base64"
+	Hex       = "hex"
+	ROT13     = "rot13"
+)
+
+// MaxLen bounds the text that is expanded; longer text yields only its
+// canonical form.
+const MaxLen = 256 << 10
+
+// Variant is one rendering of the input. Offsets into Text map back to the
+// input with Span.
+type Variant struct {
+	// Transform names the transformations applied, joined by "+"; empty for the input itself.
+	Transform string
+	Text      string
+	from, to  []int // input byte range each Text byte came from; nil for the input itself
+}
+
+// Span maps a byte range of v.Text to the input range it came from.
+func (v Variant) Span(start, end int) (int, int) {
+	if v.from == nil {
+		return start, end
+	}
+	if start >= len(v.from) {
+		start = len(v.from) - 1
+	}
+	if end <= start {
+		end = start + 1
+	}
+	if end > len(v.to) {
+		end = len(v.to)
+	}
+	if start < 0 {
+		return 0, 0
+	}
+	return v.from[start], v.to[end-1]
+}
+
+// Signal returns the "normalized:<transform>" signal of a non-input variant.
+func (v Variant) Signal() string {
+	if v.Transform == "" {
+		return ""
+	}
+	return Signal(v.Transform)
+}
+
+// Signal renders a transform as a result signal.
+func Signal(transform string) string {
+	return "normalized:" + transform
+}
+
+// Variants returns text itself followed by each distinct variant that differs
+// from it. Encoded payloads are decoded from the canonical form.
+func Variants(text string) []Variant {
+	in := Variant{Text: text}
+	out := []Variant{in}
+	seen := map[string]bool{text: true}
+	add := func(v Variant, ok bool) {
+		if ok && !seen[v.Text] {
+			seen[v.Text] = true
+			out = append(out, v)
+		}
+	}
+	canon, ok := canonical(in)
+	add(canon, ok)
+	if len(text) > MaxLen {
+		return out
+	}
+	base := in
+	if ok {
+		base = canon
+	}
+	add(leetspeak(base))
+	add(despace(base))
+	add(decode(base, URL, urlRe, decodeURL))
+	add(decode(base, Base64, base64Re, decodeBase64))
+	add(decode(base, Hex, hexRe, decodeHex))
+	if rot13Marker.MatchString(base.Text) {
+		add(rot13(base))
+	}
+	return out
+}
+
+// builder assembles a variant, mapping output bytes through the parent's mapping.
+type builder struct {
+	parent   Variant
+	b        strings.Builder
+	from, to []int
+}
+
+func newBuilder(parent Variant) *builder {
+	return &builder{parent: parent}
+}
+
+// add writes s as the rendering of parent.Text[start:end].
+func (bd *builder) add(s string, start, end int) {
+	from, to := bd.parent.Span(start, end)
+	for i := 0; i < len(s); i++ {
+		bd.from = append(bd.from, from)
+		bd.to = append(bd.to, to)
+	}
+	bd.b.WriteString(s)
+}
+
+func (bd *builder) variant(transform string) Variant {
+	if bd.parent.Transform != "" {
+		transform = bd.parent.Transform + "+" + transform
+	}
+	return Variant{Transform: transform, Text: bd.b.String(), from: bd.from, to: bd.to}
+}
+
+// zeroWidth characters are dropped.
+var zeroWidth = map[rune]bool{
+	'\u200b': true, '\u200c': true, '\u200d': true, '\u200e': true, '\u200f': true,
+	'\u2060': true, '\u2061': true, '\u2062': true, '\u2063': true, '\u2064': true,
+	'\ufeff': true, '\u00ad': true, '\u180e': true, '\u034f': true,
+}
+
+// homoglyphs maps Cyrillic, Greek and other look-alikes to Latin letters.
+var homoglyphs = map[rune]rune{
+	'а': 'a', 'е': 'e', 'о': 'o', 'р': 'p', 'с': 'c', 'у': 'y', 'х': 'x', 'і': 'i', 'ј': 'j', 'ѕ': 's',
+	'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w', 'һ': 'h', 'ӏ': 'l', 'ɡ': 'g',
+	'А': 'A', 'В': 'B', 'Е': 'E', 'К': 'K', 'М': 'M', 'Н': 'H', 'О': 'O', 'Р': 'P', 'С': 'C', 'Т': 'T',
+	'Х': 'X', 'У': 'Y', 'І': 'I', 'Ј': 'J', 'Ѕ': 'S',
+	'α': 'a', 'ο': 'o', 'ν': 'v', 'ι': 'i', 'κ': 'k', 'ρ': 'p', 'τ': 't', 'υ': 'u', 'ε': 'e',
+	'Α': 'A', 'Β': 'B', 'Ε': 'E', 'Ζ': 'Z', 'Η': 'H', 'Ι': 'I', 'Κ': 'K', 'Μ': 'M', 'Ν': 'N', 'Ο': 'O',
+	'Ρ': 'P', 'Τ': 'T', 'Υ': 'Y', 'Χ': 'X',
+	'ı': 'i', 'ℓ': 'l',
+}
+
+// canonical drops zero-width characters and folds full-width forms and homoglyphs.
+func canonical(in Variant) (Variant, bool) {
+	bd := newBuilder(in)
+	applied := map[string]bool{}
+	for i, r := range in.Text {
+		_, n := utf8.DecodeRuneInString(in.Text[i:])
+		switch {
+		case zeroWidth[r]:
+			applied[ZeroWidth] = true
+			continue
+		case r >= '\uff01' && r <= '\uff5e':
+			applied[FullWidth] = true
+			r -= 0xfee0
+		case r == '\u3000':
+			applied[FullWidth] = true
+			r = ' '
+		default:
+			if h, ok := homoglyphs[r]; ok {
+				applied[Homoglyph] = true
+				r = h
+			}
+		}
+		bd.add(string(r), i, i+n)
+	}
+	if len(applied) == 0 {
+		return Variant{}, false
+	}
+	var names []string
+	for _, name := range []string{ZeroWidth, FullWidth, Homoglyph} {
+		if applied[name] {
+			names = append(names, name)
+		}
+	}
+	return bd.variant(strings.Join(names, "+")), true
+}
+
+var leetToken = regexp.MustCompile(`[A-Za-z0-9@$]+`)
+
+var leetMap = map[byte]byte{'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '@': 'a', '$': 's'}
+
+// leetspeak rewrites digits and symbols inside words that also contain
+// letters ("p4ssw0rd"); plain numbers are left alone.
+func leetspeak(in Variant) (Variant, bool) {
+	bd := newBuilder(in)
+	changed := false
+	pos := 0
+	for _, loc := range leetToken.FindAllStringIndex(in.Text, -1) {
+		tok := in.Text[loc[0]:loc[1]]
+		if !strings.ContainsFunc(tok, isASCIILetter) || !strings.ContainsAny(tok, "0134579@$") {
+			continue
+		}
+		bd.add(in.Text[pos:loc[0]], pos, loc[0])
+		for i := 0; i < len(tok); i++ {
+			c := tok[i]
+			if m, ok := leetMap[c]; ok {
+				c, changed = m, true
+			}
+			bd.add(string(c), loc[0]+i, loc[0]+i+1)
+		}
+		pos = loc[1]
+	}
+	if !changed {
+		return Variant{}, false
+	}
+	bd.add(in.Text[pos:], pos, len(in.Text))
+	return bd.variant(Leetspeak), true
+}
+
+func isASCIILetter(r rune) bool { return r < utf8.RuneSelf && unicode.IsLetter(r) }
+
+// minSpacedRun is the number of single characters that make a spaced-out word.
+const minSpacedRun = 3
+
+// despace joins runs of single letters separated by spaces or punctuation
+// ("p a s s", "p.a.s.s", "密 码 是").
+func despace(in Variant) (Variant, bool) {
+	type tok struct {
+		start, end int
+		word       bool
+		runes      int
+	}
+	var toks []tok
+	for i, r := range in.Text {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r)
+		_, n := utf8.DecodeRuneInString(in.Text[i:])
+		if len(toks) > 0 && toks[len(toks)-1].word == word && toks[len(toks)-1].end == i {
+			toks[len(toks)-1].end += n
+			toks[len(toks)-1].runes++
+			continue
+		}
+		toks = append(toks, tok{start: i, end: i + n, word: word, runes: 1})
+	}
+	isSep := func(t tok) bool {
+		return !t.word && t.end-t.start <= 2 && strings.Trim(in.Text[t.start:t.end], " ._-*/·") == ""
+	}
+	bd := newBuilder(in)
+	changed := false
+	pos := 0
+	for i := 0; i < len(toks); i++ {
+		if !toks[i].word || toks[i].runes != 1 {
+			continue
+		}
+		j := i
+		for j+2 < len(toks) && isSep(toks[j+1]) && toks[j+2].word && toks[j+2].runes == 1 {
+			j += 2
+		}
+		if (j-i)/2+1 < minSpacedRun {
+			continue
+		}
+		bd.add(in.Text[pos:toks[i].start], pos, toks[i].start)
+		for k := i; k <= j; k += 2 {
+			bd.add(in.Text[toks[k].start:toks[k].end], toks[k].start, toks[k].end)
+		}
+		pos = toks[j].end
+		changed = true
+		i = j
+	}
+	if !changed {
+		return Variant{}, false
+	}
+	bd.add(in.Text[pos:], pos, len(in.Text))
+	return bd.variant(Spacing), true
+}
+
+var (
+	urlRe    = regexp.MustCompile(`(?:%[0-9A-Fa-f]{2})+`)
+	base64Re = regexp.MustCompile(`[A-Za-z0-9+/_-]{16,}={0,2}`)
+	hexRe    = regexp.MustCompile(`(?:\\x[0-9A-Fa-f]{2}){4,}|\b(?:0x)?(?:[0-9A-Fa-f]{2}){8,}\b`)
+)
+
+// decode replaces every match of re that fn decodes to readable text.
+func decode(in Variant, transform string, re *regexp.Regexp, fn func(string) (string, bool)) (Variant, bool) {
+	bd := newBuilder(in)
+	changed := false
+	pos := 0
+	for _, loc := range re.FindAllStringIndex(in.Text, -1) {
+		dec, ok := fn(in.Text[loc[0]:loc[1]])
+		if !ok {
+			continue
+		}
+		bd.add(in.Text[pos:loc[0]], pos, loc[0])
+		bd.add(dec, loc[0], loc[1])
+		pos = loc[1]
+		changed = true
+	}
+	if !changed {
+		return Variant{}, false
+	}
+	bd.add(in.Text[pos:], pos, len(in.Text))
+	return bd.variant(transform), true
+}
+
+func decodeURL(s string) (string, bool) {
+	dec, err := url.PathUnescape(s)
+	return dec, err == nil && readable(dec)
+}
+
+func decodeBase64(s string) (string, bool) {
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if b, err := enc.DecodeString(s); err == nil && readable(string(b)) {
+			return string(b), true
+		}
+	}
+	return "", false
+}
+
+func decodeHex(s string) (string, bool) {
+	s = strings.TrimPrefix(strings.ReplaceAll(s, `\x`, ""), "0x")
+	b, err := hex.DecodeString(s)
+	return string(b), err == nil && readable(string(b))
+}
+
+// minReadable is the share of printable characters decoded text needs; random
+// keys and digests decode to binary and are left alone.
+const minReadable = 0.9
+
+func readable(s string) bool {
+	if len(s) < 4 || !utf8.ValidString(s) {
+		return false
+	}
+	var printable, total int
+	for _, r := range s {
+		total++
+		if unicode.IsPrint(r) || unicode.IsSpace(r) {
+			printable++
+		}
+	}
+	return float64(printable)/float64(total) >= minReadable
+}
+
+// rot13Marker gates ROT13: rotating every prompt would mostly produce noise.
+var rot13Marker = regexp.MustCompile(`(?i)\brot[-_ ]?13\b|\bcaesar\b|凯撒`)
+
+func rot13(in Variant) (Variant, bool) {
+	bd := newBuilder(in)
+	for i := 0; i < len(in.Text); i++ {
+		c := in.Text[i]
+		switch {
+		case c >= 'a' && c <= 'z':
+			c = 'a' + (c-'a'+13)%26
+		case c >= 'A' && c <= 'Z':
+			c = 'A' + (c-'A'+13)%26
+		}
+		bd.add(string([]byte{c}), i, i+1)
+	}
+	return bd.variant(ROT13), true
+}
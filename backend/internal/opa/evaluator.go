@@ -2,6 +2,8 @@ package opa
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -15,7 +17,7 @@ import (
 type Input struct {
 	TenantID   string      `json:"tenantId"`
 	AppID      string      `json:"appId"`
-	Mode       string      `json:"mode"` // prompt_check | output_filter | tool
+	Mode       string      `json:"mode"` // prompt_check | output_filter | rag_check | rag_doc | agent_tool
 	Prompt     string      `json:"prompt,omitempty"`
 	Output     string      `json:"output,omitempty"`
 	Tool       string      `json:"tool,omitempty"`
@@ -23,8 +25,27 @@ type Input struct {
 	Namespaces []string    `json:"namespaces,omitempty"`
 	Rules      []string    `json:"rules,omitempty"`
 	Signals    interface{} `json:"signals,omitempty"`
+	// Variants are normalized renderings of the prompt or output (decoded, de-obfuscated).
+	Variants []Variant `json:"variants,omitempty"`
+	// Subject and Documents are the caller and candidate documents of a rag_doc evaluation.
+	Subject   interface{} `json:"subject,omitempty"`
+	Documents interface{} `json:"documents,omitempty"`
+	// Args, AllowedTools, Step and MaxSteps describe the tool call of an agent_tool evaluation.
+	Args         interface{} `json:"args,omitempty"`
+	AllowedTools []string    `json:"allowed_tools,omitempty"`
+	Step         int         `json:"step,omitempty"`
+	MaxSteps     int         `json:"max_steps,omitempty"`
 }
 
+// Variant is one normalized rendering of the evaluated text.
+type Variant struct {
+	Transform string `json:"transform"`
+	Text      string `json:"text"`
+}
+
+// ErrUndefined is returned when the loaded modules do not define the queried decision.
+var ErrUndefined = errors.New("empty decision")
+
 // Evaluator wraps OPA rego evaluation with hot-reload support.
 type Evaluator struct {
 	mu       sync.RWMutex
@@ -142,8 +163,32 @@ func (e *Evaluator) Modules() []string {
 // Decide returns (allow, data, error).
 func (e *Evaluator) Decide(ctx context.Context, in Input) (bool, interface{}, error) {
 	e.mu.RLock()
-	modules := e.modules
 	query := e.query
+	e.mu.RUnlock()
+	val, err := e.Query(ctx, query, in)
+	if err != nil {
+		return false, nil, err
+	}
+	// Expecting allow boolean or object with allow/bool and reason/signals
+	switch v := val.(type) {
+	case bool:
+		return v, nil, nil
+	case map[string]interface{}:
+		allow, ok := v["allow"].(bool)
+		if !ok {
+			return false, nil, fmt.Errorf("decision missing allow")
+		}
+		return allow, v, nil
+	default:
+		return false, nil, fmt.Errorf("unexpected decision type %T", v)
+	}
+}
+
+// Query evaluates query, e.g. data.guardrails.rag_doc_deny, against the
+// loaded modules and returns its value.
+func (e *Evaluator) Query(ctx context.Context, query string, in Input) (interface{}, error) {
+	e.mu.RLock()
+	modules := e.modules
 	timeout := e.timeout
 	e.mu.RUnlock()
 
@@ -160,23 +205,24 @@ func (e *Evaluator) Decide(ctx context.Context, in Input) (bool, interface{}, er
 	r := rego.New(opts...)
 	rs, err := r.Eval(ctx)
 	if err != nil {
-		return false, nil, err
+		return nil, err
 	}
 	if len(rs) == 0 || len(rs[0].Expressions) == 0 {
-		return false, nil, fmt.Errorf("empty decision")
+		return nil, ErrUndefined
 	}
-	val := rs[0].Expressions[0].Value
-	// Expecting allow boolean or object with allow/bool and reason/signals
-	switch v := val.(type) {
-	case bool:
-		return v, nil, nil
-	case map[string]interface{}:
-		allow, ok := v["allow"].(bool)
-		if !ok {
-			return false, nil, fmt.Errorf("decision missing allow")
-		}
-		return allow, v, nil
-	default:
-		return false, nil, fmt.Errorf("unexpected decision type %T", v)
+	return rs[0].Expressions[0].Value, nil
+}
+
+// Int converts a number from a decision value.
+func Int(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		i, err := n.Int64()
+		return int(i), err == nil
+	case float64:
+		return int(n), n == float64(int(n))
+	case int:
+		return n, true
 	}
+	return 0, false
 }
@@ -188,6 +188,30 @@ func (s *Store) ListMembers(orgID string) ([]Member, error) {
 	return members, nil
 }
 
+// MemberTeams 获取用户在租户所属组织中加入的团队
+func (s *Store) MemberTeams(tenantID, userID string) ([]Team, error) {
+	rows, err := s.db.Query(`SELECT t.id, t.org_id, t.name, t.description, t.default_role, t.permissions, t.created_at
+		FROM tenants tn
+		JOIN org_members m ON m.org_id = tn.org_id AND m.user_id = $2 AND m.status = 'active'
+		JOIN teams t ON t.id = ANY(m.team_ids)
+		WHERE tn.id = $1 ORDER BY t.name`, tenantID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var teams []Team
+	for rows.Next() {
+		var t Team
+		err := rows.Scan(&t.ID, &t.OrgID, &t.Name, &t.Description, &t.DefaultRole, pq.Array(&t.Permissions), &t.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		teams = append(teams, t)
+	}
+	return teams, rows.Err()
+}
+
 // RemoveMember 移除成员
 func (s *Store) RemoveMember(orgID, userID string) error {
 	_, err := s.db.Exec(`DELETE FROM org_members WHERE org_id = $1 AND user_id = $2`, orgID, userID)
@@ -0,0 +1,346 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"aiguardrails/internal/grounding"
+	"aiguardrails/internal/keyword"
+	"aiguardrails/internal/policy"
+	"aiguardrails/internal/rag"
+	"aiguardrails/internal/session"
+	"aiguardrails/internal/types"
+)
+
+// Kind is the evaluation a pipeline run belongs to.
+type Kind string
+
+const (
+	KindPrompt Kind = "prompt"
+	KindOutput Kind = "output"
+	KindRAG    Kind = "rag"
+)
+
+// Mode controls whether a run stops at the first block.
+type Mode string
+
+const (
+	ShortCircuit Mode = "short_circuit" // stop at the first blocking stage
+	CollectAll   Mode = "collect_all"   // run every stage and merge all signals
+)
+
+// FailurePolicy decides what a stage error means for the request.
+type FailurePolicy string
+
+const (
+	FailOpen   FailurePolicy = "fail_open"   // treat the stage as passed
+	FailClosed FailurePolicy = "fail_closed" // block the request
+	FailMark   FailurePolicy = "mark"        // allow, but flag the result as degraded
+)
+
+// Built-in stage names.
+const (
+	StageKeyword       = "keyword"
+	StageDLP           = "dlp"
+	StageOPA           = "opa"
+	StageLLMRule       = "llm_rule"
+	StageLLMModeration = "llm_moderation"
+	StageTenantRules   = "tenant_rules"
+	StagePolicyRules   = "policy_rules"
+	StageSession       = "session"
+	StageGrounding     = "grounding"
+)
+
+// DefaultOrder is used for every kind a tenant does not configure.
+var DefaultOrder = map[Kind][]string{
+	KindPrompt: {StageSession, StageOPA, StagePolicyRules, StageTenantRules, StageLLMRule, StageKeyword},
+	KindOutput: {StageSession, StageOPA, StagePolicyRules, StageTenantRules, StageGrounding, StageDLP, StageLLMModeration},
+	KindRAG:    {StageOPA, StagePolicyRules, StageTenantRules, StageKeyword},
+}
+
+// degradedNotifyInterval throttles OnDegraded per tenant and stage.
+const degradedNotifyInterval = time.Minute
+
+// Request is the input every stage sees.
+type Request struct {
+	Kind     Kind
+	TenantID string
+	AppID    string
+	Text     string
+	RuleIDs  []string         // OPA/LLM/policy rule IDs effective for the tenant
+	Keywords *keyword.Matcher // compiled keyword rules effective for the tenant; may be nil
+	// Terms are the tenant's DLP terms plus keyword rules, compiled; nil compiles them per request.
+	Terms *policy.TermSet
+	// Attrs are optional caller attributes policy rules can match on: role, tool, vendor.
+	Attrs map[string]string
+	// Confirmed is set when the caller echoed a valid confirm token for this text;
+	// confirm decisions then pass.
+	Confirmed bool
+	// Session is the multi-turn session this evaluation belongs to; nil when stateless.
+	Session *session.Turn
+	// Grounding is the context an output must be supported by; nil skips the grounding stage.
+	Grounding *grounding.Input
+}
+
+// Stage is one named detector. An error means the stage could not decide;
+// the tenant's FailurePolicy for the stage then applies.
+type Stage interface {
+	Name() string
+	Evaluate(ctx context.Context, req Request) (types.GuardrailResult, error)
+}
+
+// ConfigSource provides per-tenant pipeline configuration; nil config means defaults.
+type ConfigSource interface {
+	PipelineConfig(tenantID string) (*policy.PipelineRuleConfig, error)
+}
+
+// DegradedFunc is notified when a stage fails for a tenant.
+type DegradedFunc func(tenantID, stage string, policy FailurePolicy, err error)
+
+// Pipeline runs registered stages in per-tenant order.
+type Pipeline struct {
+	mu         sync.RWMutex
+	stages     map[string]Stage
+	configs    ConfigSource
+	onFailure  FailurePolicy
+	onDegraded DegradedFunc
+	notified   map[string]time.Time // tenant/stage -> last OnDegraded call
+}
+
+// New constructs an empty Pipeline; configs may be nil.
+func New(configs ConfigSource) *Pipeline {
+	return &Pipeline{stages: map[string]Stage{}, configs: configs, onFailure: FailOpen, notified: map[string]time.Time{}}
+}
+
+// SetFailurePolicy sets the policy for tenants and stages without their own.
+func (p *Pipeline) SetFailurePolicy(fp FailurePolicy) {
+	if validFailurePolicy(fp) {
+		p.onFailure = fp
+	}
+}
+
+// OnDegraded registers a callback for failing stages, throttled per tenant and stage.
+func (p *Pipeline) OnDegraded(fn DegradedFunc) {
+	p.onDegraded = fn
+}
+
+func validFailurePolicy(fp FailurePolicy) bool {
+	switch fp {
+	case FailOpen, FailClosed, FailMark:
+		return true
+	}
+	return false
+}
+
+// Register adds or replaces a stage under its name.
+func (p *Pipeline) Register(st Stage) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stages[st.Name()] = st
+}
+
+// Stages returns the names of registered stages.
+func (p *Pipeline) Stages() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	names := make([]string, 0, len(p.stages))
+	for name := range p.stages {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Validate checks that a config only references registered stages and a known mode.
+func (p *Pipeline) Validate(cfg policy.PipelineRuleConfig) error {
+	switch Mode(cfg.Mode) {
+	case "", ShortCircuit, CollectAll:
+	default:
+		return fmt.Errorf("unknown pipeline mode %q", cfg.Mode)
+	}
+	if cfg.OnFailure != "" && !validFailurePolicy(FailurePolicy(cfg.OnFailure)) {
+		return fmt.Errorf("unknown failure policy %q", cfg.OnFailure)
+	}
+	if cfg.InjectionThreshold < 0 || cfg.InjectionThreshold > 1 {
+		return fmt.Errorf("injection_threshold %v out of range [0,1]", cfg.InjectionThreshold)
+	}
+	if err := session.Validate(cfg.Session); err != nil {
+		return err
+	}
+	if err := grounding.Validate(cfg.Grounding); err != nil {
+		return err
+	}
+	if !rag.ValidAction(cfg.DocumentAction) {
+		return fmt.Errorf("unknown document_action %q", cfg.DocumentAction)
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, order := range [][]string{cfg.Prompt, cfg.Output, cfg.RAG} {
+		for _, name := range order {
+			if _, ok := p.stages[name]; !ok {
+				return fmt.Errorf("unknown pipeline stage %q", name)
+			}
+		}
+	}
+	for name, fp := range cfg.Failure {
+		if _, ok := p.stages[name]; !ok {
+			return fmt.Errorf("unknown pipeline stage %q", name)
+		}
+		if !validFailurePolicy(FailurePolicy(fp)) {
+			return fmt.Errorf("unknown failure policy %q for stage %q", fp, name)
+		}
+	}
+	return nil
+}
+
+// plan is the resolved configuration of one run.
+type plan struct {
+	order     []string
+	mode      Mode
+	onFailure FailurePolicy
+	failure   map[string]string
+}
+
+// failurePolicy returns the policy for a stage: per-stage, then tenant, then global.
+func (pl plan) failurePolicy(stage string) FailurePolicy {
+	if fp := FailurePolicy(pl.failure[stage]); validFailurePolicy(fp) {
+		return fp
+	}
+	return pl.onFailure
+}
+
+// plan resolves the stage order, mode and failure policies for a tenant.
+func (p *Pipeline) plan(tenantID string, kind Kind) plan {
+	pl := plan{order: DefaultOrder[kind], mode: ShortCircuit, onFailure: p.onFailure}
+	if p.configs == nil {
+		return pl
+	}
+	cfg, err := p.configs.PipelineConfig(tenantID)
+	if err != nil || cfg == nil {
+		return pl
+	}
+	if cfg.Mode != "" {
+		pl.mode = Mode(cfg.Mode)
+	}
+	if fp := FailurePolicy(cfg.OnFailure); validFailurePolicy(fp) {
+		pl.onFailure = fp
+	}
+	pl.failure = cfg.Failure
+	var custom []string
+	switch kind {
+	case KindPrompt:
+		custom = cfg.Prompt
+	case KindOutput:
+		custom = cfg.Output
+	case KindRAG:
+		custom = cfg.RAG
+	}
+	if len(custom) > 0 {
+		pl.order = custom
+	}
+	return pl
+}
+
+// Run evaluates req through the tenant's stages and records per-stage timing.
+// The most restrictive decision wins (block > confirm > deflect > redact > mark > allow;
+// the earlier stage on ties). Only block stops a short_circuit run, so a later
+// block can still override a deflect or confirm. Stages after a redact see the
+// redacted text, and their findings' offsets refer to that text.
+func (p *Pipeline) Run(ctx context.Context, req Request) types.GuardrailResult {
+	pl := p.plan(req.TenantID, req.Kind)
+	final := types.GuardrailResult{Allowed: true}
+	var top *types.GuardrailResult // result carrying the winning decision
+	var signals []string           // signals of every denying or redacting stage
+	text := req.Text
+
+	for _, name := range pl.order {
+		p.mu.RLock()
+		st, ok := p.stages[name]
+		p.mu.RUnlock()
+		if !ok {
+			continue
+		}
+		stageReq := req
+		stageReq.Text = text
+		start := time.Now()
+		res, err := st.Evaluate(ctx, stageReq)
+		trace := types.StageResult{
+			Name:       name,
+			DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if err != nil {
+			fp := pl.failurePolicy(name)
+			p.notifyDegraded(req.TenantID, name, fp, err)
+			final.Degraded = append(final.Degraded, name)
+			trace.Error = err.Error()
+			switch fp {
+			case FailClosed:
+				res = types.GuardrailResult{Allowed: false, Reason: "detector_unavailable", Signals: []string{"stage:" + name}}
+			case FailMark:
+				res = types.GuardrailResult{Allowed: true, Reason: "detector_degraded", Signals: []string{"degraded:" + name}}
+			default:
+				res = types.GuardrailResult{Allowed: true}
+			}
+		}
+		res.Decision = res.EffectiveDecision()
+		if res.Decision == types.DecisionConfirm && req.Confirmed {
+			res = types.GuardrailResult{Allowed: true, Decision: types.DecisionAllow, Signals: []string{"confirmed:" + res.Reason}}
+		}
+		res.Allowed = types.DecisionAllows(res.Decision)
+		trace.Allowed, trace.Reason, trace.Decision = res.Allowed, res.Reason, res.Decision
+		final.Stages = append(final.Stages, trace)
+		final.Rules = append(final.Rules, res.Rules...)
+		final.Findings = append(final.Findings, res.Findings...)
+		if res.Grounding != nil {
+			final.Grounding = res.Grounding
+		}
+
+		if res.Decision == types.DecisionRedact && res.TransformedText != "" {
+			text = res.TransformedText
+		}
+		if types.DecisionRank(res.Decision) >= types.DecisionRank(types.DecisionRedact) {
+			signals = append(signals, res.Signals...)
+		}
+		if top == nil || types.DecisionRank(res.Decision) > types.DecisionRank(top.Decision) {
+			r := res
+			top = &r
+		}
+		if res.Decision == types.DecisionBlock && pl.mode != CollectAll {
+			break
+		}
+	}
+	if top == nil || top.Decision == types.DecisionAllow {
+		final.Decision = types.DecisionAllow
+		return final
+	}
+	final.Decision = top.Decision
+	final.Allowed = top.Allowed
+	final.Reason = top.Reason
+	final.Response = top.Response
+	final.Signals = signals
+	if top.Decision == types.DecisionMark {
+		final.Signals = top.Signals
+	}
+	if final.Allowed && text != req.Text {
+		final.TransformedText = text
+	}
+	return final
+}
+
+func (p *Pipeline) notifyDegraded(tenantID, stage string, fp FailurePolicy, err error) {
+	if p.onDegraded == nil {
+		return
+	}
+	key := tenantID + "/" + stage
+	p.mu.Lock()
+	last, seen := p.notified[key]
+	due := !seen || time.Since(last) >= degradedNotifyInterval
+	if due {
+		p.notified[key] = time.Now()
+	}
+	p.mu.Unlock()
+	if due {
+		p.onDegraded(tenantID, stage, fp, err)
+	}
+}
@@ -0,0 +1,215 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"aiguardrails/internal/policy"
+	"aiguardrails/internal/promptfw"
+	"aiguardrails/internal/types"
+)
+
+type fakeStage struct {
+	name  string
+	res   types.GuardrailResult
+	err   error
+	calls int
+}
+
+func (f *fakeStage) Name() string { return f.name }
+
+func (f *fakeStage) Evaluate(ctx context.Context, req Request) (types.GuardrailResult, error) {
+	f.calls++
+	return f.res, f.err
+}
+
+type fixedConfig struct{ cfg *policy.PipelineRuleConfig }
+
+func (f fixedConfig) PipelineConfig(tenantID string) (*policy.PipelineRuleConfig, error) {
+	return f.cfg, nil
+}
+
+func TestPipelineShortCircuitAndCollectAll(t *testing.T) {
+	broken := &fakeStage{name: "broken", err: errors.New("timeout")}
+	first := &fakeStage{name: "first", res: types.GuardrailResult{Allowed: false, Reason: "first_block", Signals: []string{"a"}}}
+	second := &fakeStage{name: "second", res: types.GuardrailResult{Allowed: false, Reason: "second_block", Signals: []string{"b"}}}
+
+	cfg := &policy.PipelineRuleConfig{Prompt: []string{"broken", "first", "missing", "second"}}
+	p := New(fixedConfig{cfg})
+	p.Register(broken)
+	p.Register(first)
+	p.Register(second)
+
+	res := p.Run(context.Background(), Request{Kind: KindPrompt, TenantID: "t1"})
+	if res.Allowed || res.Reason != "first_block" || second.calls != 0 {
+		t.Fatalf("short circuit should stop at first block: %+v calls=%d", res, second.calls)
+	}
+	if len(res.Stages) != 2 || res.Stages[0].Error != "timeout" || !res.Stages[0].Allowed {
+		t.Fatalf("unexpected stage trace: %+v", res.Stages)
+	}
+
+	cfg.Mode = string(CollectAll)
+	res = p.Run(context.Background(), Request{Kind: KindPrompt, TenantID: "t1"})
+	if res.Allowed || res.Reason != "first_block" || len(res.Signals) != 2 || len(res.Stages) != 3 {
+		t.Fatalf("collect all should merge every stage: %+v", res)
+	}
+
+	// Kinds without a custom order use the default, which references none of these stages.
+	res = p.Run(context.Background(), Request{Kind: KindOutput, TenantID: "t1"})
+	if !res.Allowed || len(res.Stages) != 0 {
+		t.Fatalf("expected default output order: %+v", res)
+	}
+}
+
+func TestPipelineValidate(t *testing.T) {
+	p := New(nil)
+	p.Register(&fakeStage{name: StageKeyword})
+	if err := p.Validate(policy.PipelineRuleConfig{Prompt: []string{StageKeyword}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := p.Validate(policy.PipelineRuleConfig{Prompt: []string{"nope"}}); err == nil {
+		t.Fatalf("expected unknown stage error")
+	}
+	if err := p.Validate(policy.PipelineRuleConfig{Mode: "sometimes"}); err == nil {
+		t.Fatalf("expected unknown mode error")
+	}
+	if err := p.Validate(policy.PipelineRuleConfig{DocumentAction: "quarantine"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := p.Validate(policy.PipelineRuleConfig{DocumentAction: "shred"}); err == nil {
+		t.Fatalf("expected unknown document action error")
+	}
+	if err := p.Validate(policy.PipelineRuleConfig{Grounding: &policy.GroundingRuleConfig{Decision: "redact"}}); err == nil {
+		t.Fatalf("expected unknown grounding decision error")
+	}
+}
+
+func TestPipelineFailurePolicies(t *testing.T) {
+	broken := &fakeStage{name: "broken", err: errors.New("timeout")}
+	ok := &fakeStage{name: "ok", res: types.GuardrailResult{Allowed: true}}
+
+	cfg := &policy.PipelineRuleConfig{Prompt: []string{"broken", "ok"}}
+	p := New(fixedConfig{cfg})
+	p.Register(broken)
+	p.Register(ok)
+	var alerts []string
+	p.OnDegraded(func(tenantID, stage string, fp FailurePolicy, err error) {
+		alerts = append(alerts, tenantID+"/"+stage+"/"+string(fp))
+	})
+
+	res := p.Run(context.Background(), Request{Kind: KindPrompt, TenantID: "t1"})
+	if !res.Allowed || res.Reason != "" || len(res.Degraded) != 1 || res.Degraded[0] != "broken" {
+		t.Fatalf("fail_open should allow and report degraded stage: %+v", res)
+	}
+
+	cfg.OnFailure = string(FailMark)
+	res = p.Run(context.Background(), Request{Kind: KindPrompt, TenantID: "t1"})
+	if !res.Allowed || res.Reason != "detector_degraded" || len(res.Degraded) != 1 {
+		t.Fatalf("mark should allow with degraded reason: %+v", res)
+	}
+
+	cfg.Failure = map[string]string{"broken": string(FailClosed)}
+	res = p.Run(context.Background(), Request{Kind: KindPrompt, TenantID: "t1"})
+	if res.Allowed || res.Reason != "detector_unavailable" || ok.calls != 2 {
+		t.Fatalf("per-stage fail_closed should block before later stages: %+v calls=%d", res, ok.calls)
+	}
+
+	// Alerts are throttled per tenant and stage.
+	if len(alerts) != 1 || alerts[0] != "t1/broken/fail_open" {
+		t.Fatalf("unexpected alerts: %v", alerts)
+	}
+	if err := p.Validate(policy.PipelineRuleConfig{OnFailure: "explode"}); err == nil {
+		t.Fatalf("expected unknown failure policy error")
+	}
+	if err := p.Validate(policy.PipelineRuleConfig{Failure: map[string]string{"ok": "sometimes"}}); err == nil {
+		t.Fatalf("expected unknown stage failure policy error")
+	}
+}
+
+// textStage records the text it saw.
+type textStage struct {
+	fakeStage
+	seen string
+}
+
+func (f *textStage) Evaluate(ctx context.Context, req Request) (types.GuardrailResult, error) {
+	f.seen = req.Text
+	return f.fakeStage.Evaluate(ctx, req)
+}
+
+func TestPipelineDecisionPrecedence(t *testing.T) {
+	redact := &fakeStage{name: "redact", res: types.GuardrailResult{Allowed: true, Decision: types.DecisionRedact, Reason: "pii", TransformedText: "call [REDACTED]"}}
+	deflect := &fakeStage{name: "deflect", res: types.GuardrailResult{Allowed: false, Decision: types.DecisionDeflect, Reason: "off_topic", Response: "Ask me about PLCs."}}
+	confirm := &fakeStage{name: "confirm", res: types.GuardrailResult{Allowed: false, Decision: types.DecisionConfirm, Reason: "risky"}}
+	after := &textStage{fakeStage: fakeStage{name: "after", res: types.GuardrailResult{Allowed: true}}}
+
+	cfg := &policy.PipelineRuleConfig{Prompt: []string{"redact", "after"}}
+	p := New(fixedConfig{cfg})
+	for _, st := range []Stage{redact, deflect, confirm, after} {
+		p.Register(st)
+	}
+
+	res := p.Run(context.Background(), Request{Kind: KindPrompt, TenantID: "t1", Text: "call 555-0100"})
+	if !res.Allowed || res.Decision != types.DecisionRedact || res.TransformedText != "call [REDACTED]" || after.seen != "call [REDACTED]" {
+		t.Fatalf("redact should pass transformed text on: %+v seen=%q", res, after.seen)
+	}
+
+	// Deflect and confirm do not stop a short_circuit run; confirm outranks deflect.
+	cfg.Prompt = []string{"deflect", "confirm", "redact"}
+	res = p.Run(context.Background(), Request{Kind: KindPrompt, TenantID: "t1", Text: "x"})
+	if res.Allowed || res.Decision != types.DecisionConfirm || res.TransformedText != "" || len(res.Stages) != 3 {
+		t.Fatalf("expected confirm to win: %+v", res)
+	}
+
+	res = p.Run(context.Background(), Request{Kind: KindPrompt, TenantID: "t1", Text: "x", Confirmed: true})
+	if res.Allowed || res.Decision != types.DecisionDeflect || res.Response != "Ask me about PLCs." {
+		t.Fatalf("confirmed request should fall back to deflect: %+v", res)
+	}
+
+	cfg.Prompt = []string{"after"}
+	res = p.Run(context.Background(), Request{Kind: KindPrompt, TenantID: "t1", Text: "x"})
+	if !res.Allowed || res.Decision != types.DecisionAllow {
+		t.Fatalf("expected allow: %+v", res)
+	}
+}
+
+type businessRules []policy.TenantRule
+
+func (b businessRules) ListEnabled(tenantID string, ruleType policy.TenantRuleType) ([]policy.TenantRule, error) {
+	return b, nil
+}
+
+func TestDefaultOrderAppliesTenantRules(t *testing.T) {
+	domain, _ := json.Marshal(policy.DomainRuleConfig{Enabled: true, BlockedTopics: []string{"crypto trading"}})
+	rules := businessRules{{ID: "r1", Name: "domain", RuleType: policy.RuleTypeBusiness, Config: domain, Enabled: true}}
+	fw := promptfw.NewFirewall(policy.NewMemoryEngine())
+	p := New(nil)
+	p.Register(NewTenantRulesStage(rules))
+	p.Register(NewKeywordStage(fw))
+	p.Register(NewDLPStage(fw))
+
+	for _, kind := range []Kind{KindPrompt, KindOutput, KindRAG} {
+		res := p.Run(context.Background(), Request{Kind: kind, TenantID: "t1", Text: "Any tips on crypto trading?"})
+		if res.Allowed || res.Reason != "tenant_rule_block" {
+			t.Fatalf("%s: expected the blocked topic to be blocked by default: %+v", kind, res)
+		}
+	}
+	res := p.Run(context.Background(), Request{Kind: KindPrompt, TenantID: "t1", Text: "my api_key=sk-abcdef1234567890abcdef"})
+	if res.Allowed || res.Reason != "secret_detected" {
+		t.Fatalf("expected a prompt secret to be blocked: %+v", res)
+	}
+	// Output DLP dictionary words are ordinary in questions and must not block prompts.
+	for _, text := range []string{"what is a SWIFT code", "renew my passport", "is my IBAN confidential?", "how do I get a new ID card"} {
+		res := p.Run(context.Background(), Request{Kind: KindPrompt, TenantID: "t1", Text: text})
+		if res.EffectiveDecision() != types.DecisionAllow {
+			t.Fatalf("%q: expected a benign prompt to be allowed: %+v", text, res)
+		}
+		for _, st := range res.Stages {
+			if st.Name == StageDLP {
+				t.Fatalf("%q: prompt DLP ran by default: %+v", text, res)
+			}
+		}
+	}
+}
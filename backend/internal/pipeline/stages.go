@@ -0,0 +1,336 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"aiguardrails/internal/grounding"
+	"aiguardrails/internal/keyword"
+	"aiguardrails/internal/llm_guard"
+	"aiguardrails/internal/normalize"
+	"aiguardrails/internal/opa"
+	"aiguardrails/internal/policy"
+	"aiguardrails/internal/promptfw"
+	"aiguardrails/internal/rules"
+	"aiguardrails/internal/types"
+)
+
+// KeywordStage runs the prompt firewall: injection phrases and keyword rules.
+type KeywordStage struct {
+	fw *promptfw.Firewall
+}
+
+// NewKeywordStage constructs KeywordStage.
+func NewKeywordStage(fw *promptfw.Firewall) *KeywordStage { return &KeywordStage{fw: fw} }
+
+func (s *KeywordStage) Name() string { return StageKeyword }
+
+func (s *KeywordStage) Evaluate(ctx context.Context, req Request) (types.GuardrailResult, error) {
+	return s.fw.CheckPrompt(req.TenantID, req.Text, req.Keywords), nil
+}
+
+// SessionStage applies the tenant's cumulative rules to the request's
+// multi-turn session: near misses, topic drift and rolling risk.
+type SessionStage struct{}
+
+// NewSessionStage constructs SessionStage.
+func NewSessionStage() *SessionStage { return &SessionStage{} }
+
+func (s *SessionStage) Name() string { return StageSession }
+
+func (s *SessionStage) Evaluate(ctx context.Context, req Request) (types.GuardrailResult, error) {
+	if req.Session == nil {
+		return types.GuardrailResult{Allowed: true}, nil
+	}
+	return req.Session.Evaluate(), nil
+}
+
+// GroundingStage checks that an output is supported by the context documents
+// it was generated from, with the judge reviewing rejected claims when the
+// tenant asks for it.
+type GroundingStage struct {
+	judge grounding.Judge
+}
+
+// NewGroundingStage constructs GroundingStage; judge may be nil.
+func NewGroundingStage(judge grounding.Judge) *GroundingStage {
+	return &GroundingStage{judge: judge}
+}
+
+func (s *GroundingStage) Name() string { return StageGrounding }
+
+func (s *GroundingStage) Evaluate(ctx context.Context, req Request) (types.GuardrailResult, error) {
+	if req.Grounding == nil || req.Kind != KindOutput {
+		return types.GuardrailResult{Allowed: true}, nil
+	}
+	report := grounding.Evaluate(ctx, req.Text, *req.Grounding, s.judge)
+	res := req.Grounding.Rules.Verdict(report)
+	if res.Decision == "" {
+		return res, nil
+	}
+	for _, sent := range report.Sentences {
+		if sent.Claim && !sent.Supported {
+			res.Findings = append(res.Findings, types.NewFinding(StageGrounding, types.CategoryGrounding, req.Text, sent.Start, sent.End, math.Round((1-sent.Support)*100)/100, ""))
+		}
+	}
+	return res, nil
+}
+
+// DLPStage runs regex/dictionary DLP with the tenant's sensitive terms and keyword rules.
+type DLPStage struct {
+	fw *promptfw.Firewall
+}
+
+// NewDLPStage constructs DLPStage.
+func NewDLPStage(fw *promptfw.Firewall) *DLPStage { return &DLPStage{fw: fw} }
+
+func (s *DLPStage) Name() string { return StageDLP }
+
+func (s *DLPStage) Evaluate(ctx context.Context, req Request) (types.GuardrailResult, error) {
+	if req.Terms != nil {
+		return s.fw.DetectOutputDLPTerms(req.TenantID, req.Text, req.Terms), nil
+	}
+	return s.fw.DetectOutputDLP(req.TenantID, req.Text, keyword.Texts(req.Keywords.Terms())), nil
+}
+
+// LLMModerationStage runs the firewall's async LLM moderation in its block/mark mode.
+type LLMModerationStage struct {
+	fw *promptfw.Firewall
+}
+
+// NewLLMModerationStage constructs LLMModerationStage.
+func NewLLMModerationStage(fw *promptfw.Firewall) *LLMModerationStage {
+	return &LLMModerationStage{fw: fw}
+}
+
+func (s *LLMModerationStage) Name() string { return StageLLMModeration }
+
+func (s *LLMModerationStage) Evaluate(ctx context.Context, req Request) (types.GuardrailResult, error) {
+	res, err := s.fw.ModerateOutput(req.Text)
+	if !res.Allowed && res.Reason != "llm_pending" {
+		res.Findings = append(res.Findings, types.NewFinding(StageLLMModeration, types.CategoryModeration, req.Text, 0, len(req.Text), types.LLMConfidence, ""))
+	}
+	return res, err
+}
+
+// OPAStage evaluates the Rego policy in the mode matching the request kind.
+type OPAStage struct {
+	eval *opa.Evaluator
+}
+
+// NewOPAStage constructs OPAStage.
+func NewOPAStage(eval *opa.Evaluator) *OPAStage { return &OPAStage{eval: eval} }
+
+func (s *OPAStage) Name() string { return StageOPA }
+
+func (s *OPAStage) Evaluate(ctx context.Context, req Request) (types.GuardrailResult, error) {
+	in := opa.Input{TenantID: req.TenantID, AppID: req.AppID}
+	reason := "opa_block"
+	switch req.Kind {
+	case KindOutput:
+		in.Mode, in.Output = "output_filter", req.Text
+	case KindRAG:
+		in.Mode, in.Prompt = "rag_check", req.Text
+		reason = "opa_block_rag"
+	default:
+		in.Mode, in.Prompt, in.Rules = "prompt_check", req.Text, req.RuleIDs
+	}
+	for _, v := range normalize.Variants(req.Text)[1:] {
+		in.Variants = append(in.Variants, opa.Variant{Transform: v.Transform, Text: v.Text})
+	}
+	allow, data, err := s.eval.Decide(ctx, in)
+	if err != nil {
+		return types.GuardrailResult{Allowed: true}, err
+	}
+	if !allow {
+		return types.GuardrailResult{Allowed: false, Reason: reason, Signals: []string{fmt.Sprint(data)},
+			Findings: []types.Finding{types.NewFinding(StageOPA, types.CategoryPolicy, req.Text, 0, len(req.Text), 1, "")}}, nil
+	}
+	return types.GuardrailResult{Allowed: true}, nil
+}
+
+// LLMRuleStage asks the LLM guard to judge the text against each effective LLM rule.
+type LLMRuleStage struct {
+	guard *llm_guard.Client
+	rules rules.Store
+}
+
+// NewLLMRuleStage constructs LLMRuleStage.
+func NewLLMRuleStage(guard *llm_guard.Client, store rules.Store) *LLMRuleStage {
+	return &LLMRuleStage{guard: guard, rules: store}
+}
+
+func (s *LLMRuleStage) Name() string { return StageLLMRule }
+
+func (s *LLMRuleStage) Evaluate(ctx context.Context, req Request) (types.GuardrailResult, error) {
+	var firstErr error
+	for _, rid := range req.RuleIDs {
+		ruleDef, err := s.rules.Get(rid)
+		if err != nil || ruleDef.Type != rules.RuleTypeLLM {
+			continue
+		}
+		safe, reason, err := s.guard.Check(req.Text, ruleDef.Content)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("rule %s: %w", ruleDef.Name, err)
+			}
+			continue
+		}
+		if !safe {
+			return types.GuardrailResult{
+				Allowed: false,
+				Reason:  "llm_safety_block",
+				Signals: []string{fmt.Sprintf("rule:%s", ruleDef.Name), reason},
+				// The guard judges the whole text, so the finding spans all of it.
+				Findings: []types.Finding{types.NewFinding(StageLLMRule, types.CategoryModeration, req.Text, 0, len(req.Text), types.LLMConfidence, ruleDef.ID)},
+			}, nil
+		}
+	}
+	return types.GuardrailResult{Allowed: true}, firstErr
+}
+
+// PolicyRulesStage evaluates the conditions of the platform rules attached to the tenant.
+type PolicyRulesStage struct {
+	engine *policy.RuleEngine
+	notify func(tenantID string, res policy.RuleEvaluationResult)
+}
+
+// NewPolicyRulesStage constructs PolicyRulesStage; notify, if set, is called
+// for matched rules with a notify action.
+func NewPolicyRulesStage(engine *policy.RuleEngine, notify func(tenantID string, res policy.RuleEvaluationResult)) *PolicyRulesStage {
+	return &PolicyRulesStage{engine: engine, notify: notify}
+}
+
+func (s *PolicyRulesStage) Name() string { return StagePolicyRules }
+
+func (s *PolicyRulesStage) Evaluate(ctx context.Context, req Request) (types.GuardrailResult, error) {
+	in := policy.RuleInput{}
+	for _, f := range []string{policy.FieldRole, policy.FieldTool, policy.FieldVendor} {
+		if v, ok := req.Attrs[f]; ok {
+			in[f] = v
+		}
+	}
+	if req.Kind == KindOutput {
+		in[policy.FieldOutput] = req.Text
+	} else {
+		in[policy.FieldPrompt] = req.Text
+	}
+	ruleIDs := req.RuleIDs
+	if ruleIDs == nil {
+		ruleIDs = []string{}
+	}
+	matched := s.engine.Evaluate(in, ruleIDs)
+	if len(matched) == 0 {
+		return types.GuardrailResult{Allowed: true}, nil
+	}
+	res := types.GuardrailResult{Allowed: true}
+	for _, m := range matched {
+		res.Rules = append(res.Rules, types.RuleMatch{
+			RuleID:   m.RuleID,
+			RuleName: m.RuleName,
+			Decision: string(m.Decision),
+			Severity: string(m.Severity),
+			Reason:   m.Reason,
+			Signals:  m.Signals,
+			Response: m.Response,
+		})
+		if m.ShouldNotify && s.notify != nil {
+			s.notify(req.TenantID, m)
+		}
+	}
+	field := policy.FieldPrompt
+	if req.Kind == KindOutput {
+		field = policy.FieldOutput
+	}
+	top := matched[0]
+	res.Decision = string(top.Decision)
+	if top.Decision == policy.DecisionAllow {
+		return res, nil
+	}
+	for _, m := range matched {
+		if m.Decision == policy.DecisionAllow {
+			continue
+		}
+		for _, sp := range s.engine.Spans(m.RuleID, field, req.Text) {
+			res.Findings = append(res.Findings, types.NewFinding("policy_rules", types.CategoryPolicy, req.Text, sp[0], sp[1], 1, m.RuleID))
+		}
+	}
+	res.Allowed = types.DecisionAllows(res.Decision)
+	res.Reason = "policy_rule_" + string(top.Decision)
+	res.Signals = []string{"rule:" + top.RuleID, "severity:" + string(top.Severity)}
+	res.Response = top.Response
+	if top.Decision == policy.DecisionRedact {
+		res.TransformedText = s.engine.Redact(top.RuleID, field, req.Text)
+	}
+	return res, nil
+}
+
+// TenantRuleLister lists a tenant's enabled rules.
+type TenantRuleLister interface {
+	ListEnabled(tenantID string, ruleType policy.TenantRuleType) ([]policy.TenantRule, error)
+}
+
+// TenantRulesStage enforces the tenant's business rules: blocked vendors, products and topics.
+type TenantRulesStage struct {
+	store TenantRuleLister
+}
+
+// NewTenantRulesStage constructs TenantRulesStage.
+func NewTenantRulesStage(store TenantRuleLister) *TenantRulesStage {
+	return &TenantRulesStage{store: store}
+}
+
+func (s *TenantRulesStage) Name() string { return StageTenantRules }
+
+func (s *TenantRulesStage) Evaluate(ctx context.Context, req Request) (types.GuardrailResult, error) {
+	list, err := s.store.ListEnabled(req.TenantID, policy.RuleTypeBusiness)
+	if err != nil {
+		return types.GuardrailResult{Allowed: true}, err
+	}
+	lower := strings.ToLower(req.Text)
+	for i := range list {
+		rule := &list[i]
+		var blocked []string
+		if cfg, err := rule.ParseVendorConfig(); err == nil {
+			blocked = append(blocked, cfg.BlockedVendors...)
+			blocked = append(blocked, cfg.BlockedProducts...)
+		}
+		if cfg, err := rule.ParseDomainConfig(); err == nil {
+			blocked = append(blocked, cfg.BlockedTopics...)
+		}
+		for _, term := range blocked {
+			if term != "" && strings.Contains(lower, strings.ToLower(term)) {
+				res := types.GuardrailResult{
+					Allowed: false,
+					Reason:  "tenant_rule_block",
+					Signals: []string{"rule:" + rule.Name, term},
+				}
+				for _, sp := range policy.FindFold(req.Text, term) {
+					res.Findings = append(res.Findings, types.NewFinding(StageTenantRules, types.CategoryPolicy, req.Text, sp.Start, sp.End, 1, rule.ID))
+				}
+				// A configured response turns the block into a deflection.
+				if reply := ruleResponse(rule, term); reply != "" {
+					res.Decision, res.Reason, res.Response = types.DecisionDeflect, "tenant_rule_deflect", reply
+				}
+				return res, nil
+			}
+		}
+	}
+	return types.GuardrailResult{Allowed: true}, nil
+}
+
+// ruleResponse returns the rule's canned reply for term, falling back to "blocked".
+func ruleResponse(rule *policy.TenantRule, term string) string {
+	var responses map[string]string
+	if cfg, err := rule.ParseVendorConfig(); err == nil && len(cfg.Responses) > 0 {
+		responses = cfg.Responses
+	} else if cfg, err := rule.ParseDomainConfig(); err == nil {
+		responses = cfg.Responses
+	}
+	if reply := responses[term]; reply != "" {
+		return reply
+	}
+	return responses["blocked"]
+}
@@ -1,67 +1,207 @@
 package policy
 
 import (
-	"regexp"
+	"sort"
 	"strings"
+
+	"aiguardrails/internal/types"
 )
 
+// dlpTerm is a built-in dictionary term.
+type dlpTerm struct {
+	term     string
+	category string
+}
+
 var (
-	piiPatterns = []*regexp.Regexp{
-		regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),            // SSN-like
-		regexp.MustCompile(`\b4[0-9]{12}(?:[0-9]{3})?\b`),      // Visa-like
-		regexp.MustCompile(`\b[13][a-km-zA-HJ-NP-Z1-9]{25,34}\b`), // crypto-ish
+	// Built-in dictionary
+	// Credentials are left to the secret recognizers: the bare words
+	// ("password", "token") matched innocent text and missed real leaks.
+	dlpKeywords = []dlpTerm{
+		{"ssn", types.CategoryPII}, {"credit card", types.CategoryFinancial}, {"passport", types.CategoryPII},
+		{"id card", types.CategoryPII}, {"social security", types.CategoryPII}, {"iban", types.CategoryFinancial},
+		{"swift", types.CategoryFinancial}, {"confidential", types.CategoryConfidential}, {"proprietary", types.CategoryConfidential},
 	}
 )
 
+// Confidence of dictionary hits: built-in terms are weak signals, tenant terms are explicit.
+const (
+	dictionaryConfidence = 0.4
+	customTermConfidence = 1.0
+)
+
+// MaxRegexMatchLen bounds the length of a recognizer match (emails are the
+// longest); streaming filters hold back at least this many bytes so a match is
+// never emitted half-seen.
+const MaxRegexMatchLen = 128
+
 // DLPResult captures detection outcome.
 type DLPResult struct {
 	Hit     bool
 	Reason  string
 	Matches []string
+	Spans   []DLPSpan // every hit with its position, set when Hit
 }
 
-// DetectDLP combines regex, dictionary, and custom terms.
+// DLPSpan is one DLP hit with byte offsets into the scanned text.
+type DLPSpan struct {
+	Start      int
+	End        int
+	Text       string
+	Category   string
+	Rule       string // recognizer name, "dictionary" or "custom_term"
+	Confidence float64
+}
+
+// Signal is the span as reported in legacy signals; secrets are named, never echoed.
+func (sp DLPSpan) Signal() string {
+	if sp.Category == types.CategorySecret {
+		return sp.Rule
+	}
+	return sp.Text
+}
+
+// Finding converts the span into a Finding for detector over text.
+func (sp DLPSpan) Finding(detector, text string) types.Finding {
+	return types.NewFinding(detector, sp.Category, text, sp.Start, sp.End, sp.Confidence, sp.Rule)
+}
+
+// DLPFindings converts spans found in text into Findings for detector.
+func DLPFindings(detector, text string, spans []DLPSpan) []types.Finding {
+	out := make([]types.Finding, 0, len(spans))
+	for _, sp := range spans {
+		out = append(out, sp.Finding(detector, text))
+	}
+	return out
+}
+
+// DetectDLP combines the default recognizers, dictionary, and custom terms.
 func DetectDLP(text string, customTerms []string) DLPResult {
-	lower := strings.ToLower(text)
+	return DetectDLPWith(text, customTerms, DefaultRecognizers())
+}
+
+// DetectDLPWith is DetectDLP with an explicit recognizer selection.
+func DetectDLPWith(text string, customTerms []string, recs []*Recognizer) DLPResult {
+	return DetectDLPTerms(text, NewTermSet(customTerms), recs)
+}
+
+// DetectDLPTerms is DetectDLPWith with a precompiled term set.
+func DetectDLPTerms(text string, terms *TermSet, recs []*Recognizer) DLPResult {
 	matches := []string{}
+	spans := FindDLPSpansTerms(text, terms, recs)
 
-	// Regex patterns
-	for _, re := range piiPatterns {
-		if loc := re.FindString(text); loc != "" {
-			matches = append(matches, loc)
+	// Recognizers: first hit of each
+	for _, r := range recs {
+		for _, sp := range spans {
+			if sp.Rule == r.Name {
+				matches = append(matches, sp.Signal())
+				break
+			}
 		}
 	}
 
-	// Built-in dictionary
-	keywords := []string{
-		"password", "ssn", "secret", "apikey", "credit card",
-		"passport", "id card", "social security", "iban", "swift",
-		"private key", "api key", "token", "secret key", "credential",
-		"confidential", "proprietary",
+	// Dictionary and custom terms
+	matches = append(matches, terms.matches(text)...)
+
+	if len(matches) > 0 {
+		return DLPResult{Hit: true, Reason: "dlp_match", Matches: matches, Spans: spans}
 	}
-	for _, k := range keywords {
-		if strings.Contains(lower, k) {
-			matches = append(matches, k)
+
+	// Stub for LLM-based detector
+	// In production, call an LLM classifier; here we just return no-hit.
+	return DLPResult{Hit: false}
+}
+
+// FindDLPSpans returns every DLP hit in text with its position, sorted by start offset.
+// It applies the same recognizers and terms as DetectDLP.
+func FindDLPSpans(text string, customTerms []string) []DLPSpan {
+	return FindDLPSpansWith(text, customTerms, DefaultRecognizers())
+}
+
+// FindDLPSpansWith is FindDLPSpans with an explicit recognizer selection.
+func FindDLPSpansWith(text string, customTerms []string, recs []*Recognizer) []DLPSpan {
+	return FindDLPSpansTerms(text, NewTermSet(customTerms), recs)
+}
+
+// FindDLPSpansTerms is FindDLPSpansWith with a precompiled term set.
+func FindDLPSpansTerms(text string, terms *TermSet, recs []*Recognizer) []DLPSpan {
+	spans := append(recognizerSpans(text, recs), terms.Find(text)...)
+	sortSpans(spans)
+	return spans
+}
+
+// FindRecognizerSpans returns the spans of recs alone, without the dictionary or custom terms.
+func FindRecognizerSpans(text string, recs []*Recognizer) []DLPSpan {
+	spans := recognizerSpans(text, recs)
+	sortSpans(spans)
+	return spans
+}
+
+// recognizerSpans runs recs over text; fallback recognizers only fill gaps the others leave.
+func recognizerSpans(text string, recs []*Recognizer) []DLPSpan {
+	var spans []DLPSpan
+	for _, r := range recs {
+		if !r.fallback {
+			spans = append(spans, r.Find(text)...)
 		}
 	}
-
-	// Custom terms
-	for _, term := range customTerms {
-		if term == "" {
+	for _, r := range recs {
+		if !r.fallback {
 			continue
 		}
-		if strings.Contains(lower, strings.ToLower(term)) {
-			matches = append(matches, term)
+		for _, sp := range r.Find(text) {
+			if !overlapsAny(sp, spans) {
+				spans = append(spans, sp)
+			}
 		}
 	}
+	return spans
+}
 
-	if len(matches) > 0 {
-		return DLPResult{Hit: true, Reason: "dlp_match", Matches: matches}
-	}
+// sortSpans orders spans by start, the longer span first.
+func sortSpans(spans []DLPSpan) {
+	sort.Slice(spans, func(i, j int) bool {
+		if spans[i].Start != spans[j].Start {
+			return spans[i].Start < spans[j].Start
+		}
+		return spans[i].End > spans[j].End
+	})
+}
 
-	// Stub for LLM-based detector
-	// In production, call an LLM classifier; here we just return no-hit.
-	return DLPResult{Hit: false}
+func overlapsAny(sp DLPSpan, spans []DLPSpan) bool {
+	for _, o := range spans {
+		if sp.Start < o.End && o.Start < sp.End {
+			return true
+		}
+	}
+	return false
 }
 
+// MaxTermLen returns the longest built-in or custom dictionary term in bytes.
+func MaxTermLen(customTerms []string) int {
+	max := 0
+	for _, k := range dlpKeywords {
+		if len(k.term) > max {
+			max = len(k.term)
+		}
+	}
+	for _, t := range customTerms {
+		if len(t) > max {
+			max = len(t)
+		}
+	}
+	return max
+}
 
+// FindFold finds all non-overlapping case-insensitive occurrences of term in text.
+func FindFold(text, term string) []DLPSpan {
+	var out []DLPSpan
+	n := len(term)
+	for i := 0; i+n <= len(text); i++ {
+		if strings.EqualFold(text[i:i+n], term) {
+			out = append(out, DLPSpan{Start: i, End: i + n, Text: text[i : i+n]})
+			i += n - 1
+		}
+	}
+	return out
+}
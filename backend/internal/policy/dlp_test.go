@@ -3,10 +3,12 @@ package policy
 import "testing"
 
 func TestDetectDLPBuiltinAndCustom(t *testing.T) {
-	text := "user password is secret"
-	res := DetectDLP(text, []string{})
-	if !res.Hit {
-		t.Fatalf("expected hit for built-in keyword")
+	if res := DetectDLP("user password is secret", []string{}); res.Hit {
+		t.Fatalf("credential words alone should not hit: %+v", res)
+	}
+	res := DetectDLP("password: hunter2xyz", []string{})
+	if !res.Hit || len(res.Matches) != 1 || res.Matches[0] != "password_assignment" {
+		t.Fatalf("expected secret hit without echoing it: %+v", res)
 	}
 	passport := DetectDLP("passport number 123", []string{})
 	if !passport.Hit {
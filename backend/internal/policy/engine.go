@@ -23,6 +23,7 @@ type Engine interface {
 	AllowTool(tenantID, tool string) bool
 	AllowedNamespaces(tenantID string) []string
 	CustomTerms(tenantID string) []string
+	OutputFilters(tenantID string) []string
 }
 
 // MemoryEngine stores policies in memory.
@@ -173,6 +174,23 @@ func (e *MemoryEngine) CustomTerms(tenantID string) []string {
 	return out
 }
 
+// OutputFilters aggregates output filter tags.
+func (e *MemoryEngine) OutputFilters(tenantID string) []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	set := map[string]struct{}{}
+	for _, p := range e.policies[tenantID] {
+		for _, f := range p.OutputFilters {
+			set[f] = struct{}{}
+		}
+	}
+	out := make([]string, 0, len(set))
+	for f := range set {
+		out = append(out, f)
+	}
+	return out
+}
+
 // ListHistory returns empty for memory engine.
 func (e *MemoryEngine) ListHistory(tenantID string, limit int) ([]types.Policy, error) {
 	return e.ListPolicies(tenantID)
@@ -2,6 +2,8 @@ package policy
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"sync"
 	"time"
 
@@ -17,6 +19,9 @@ type job struct {
 	text string
 }
 
+// ErrDetectorDegraded means the moderation backend is failing; results are not trustworthy.
+var ErrDetectorDegraded = errors.New("llm detector degraded")
+
 // LLMDetector runs async moderation with caching.
 type LLMDetector struct {
 	client LLMClient
@@ -26,6 +31,10 @@ type LLMDetector struct {
 	tokens <-chan time.Time
 	ttl    time.Duration
 	onDone func(text string, res types.GuardrailResult)
+	// health of the moderation backend, updated by workers
+	lastErr   error
+	lastErrAt time.Time
+	lastOKAt  time.Time
 }
 
 type cacheEntry struct {
@@ -64,11 +73,15 @@ func (d *LLMDetector) worker() {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		res, err := d.client.Moderate(ctx, j.text)
 		cancel()
+		d.mu.Lock()
 		if err != nil {
+			// Errors are not cached so the text is moderated again once the backend recovers.
 			res = types.GuardrailResult{Allowed: true, Reason: "llm_error"}
+			d.lastErr, d.lastErrAt = err, time.Now()
+		} else {
+			d.lastOKAt = time.Now()
+			d.cache[j.text] = cacheEntry{res: res, expires: time.Now().Add(d.ttl)}
 		}
-		d.mu.Lock()
-		d.cache[j.text] = cacheEntry{res: res, expires: time.Now().Add(d.ttl)}
 		d.mu.Unlock()
 		if d.onDone != nil {
 			d.onDone(j.text, res)
@@ -96,6 +109,29 @@ func (d *LLMDetector) Check(text string) types.GuardrailResult {
 	return types.GuardrailResult{Allowed: true, Reason: "llm_pending"}
 }
 
+// Evaluate is Check plus health: it returns ErrDetectorDegraded (wrapping the backend
+// error) when the most recent moderation call failed, so callers can apply a failure policy.
+func (d *LLMDetector) Evaluate(text string) (types.GuardrailResult, error) {
+	res := d.Check(text)
+	if res.Reason != "llm_pending" {
+		return res, nil
+	}
+	if err := d.Health(); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+// Health returns nil while the moderation backend is healthy.
+func (d *LLMDetector) Health() error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.lastErr != nil && d.lastErrAt.After(d.lastOKAt) {
+		return fmt.Errorf("%w: %v", ErrDetectorDegraded, d.lastErr)
+	}
+	return nil
+}
+
 // WithCallback sets optional completion callback.
 func (d *LLMDetector) WithCallback(cb func(text string, res types.GuardrailResult)) {
 	d.onDone = cb
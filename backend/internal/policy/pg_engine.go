@@ -232,6 +232,25 @@ func (e *PGEngine) CustomTerms(tenantID string) []string {
 	return out
 }
 
+// OutputFilters aggregates output filter tags.
+func (e *PGEngine) OutputFilters(tenantID string) []string {
+	policies, err := e.ListPolicies(tenantID)
+	if err != nil {
+		return nil
+	}
+	set := map[string]struct{}{}
+	for _, p := range policies {
+		for _, f := range p.OutputFilters {
+			set[f] = struct{}{}
+		}
+	}
+	out := make([]string, 0, len(set))
+	for f := range set {
+		out = append(out, f)
+	}
+	return out
+}
+
 // GetHistoryVersion returns a specific version of a policy.
 func (e *PGEngine) GetHistoryVersion(tenantID, policyID string, version int) (*types.Policy, error) {
 	row := e.db.QueryRow(`SELECT policy_id, name, prompt_rules, tool_allowlist, rag_namespaces, output_filters, sensitive_terms, updated_at, version, COALESCE(change_summary, ''), COALESCE(changed_by, '') 
@@ -0,0 +1,285 @@
+package policy
+
+import (
+	"crypto/sha256"
+	"math/big"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"aiguardrails/internal/types"
+)
+
+// Recognizer finds one kind of identifier. Candidates matched by the regex are
+// kept only if validate (when set) accepts them, so checksums and format rules
+// filter out look-alikes such as order numbers.
+type Recognizer struct {
+	Name       string
+	Category   string
+	Confidence float64
+	re         *regexp.Regexp
+	group      int // submatch holding the identifier; 0 is the whole match
+	validate   func(string) bool
+	fallback   bool // only reported where no other recognizer matched
+}
+
+// Find returns the validated matches in text.
+func (r *Recognizer) Find(text string) []DLPSpan {
+	var out []DLPSpan
+	for _, loc := range r.re.FindAllStringSubmatchIndex(text, -1) {
+		start, end := loc[2*r.group], loc[2*r.group+1]
+		if start < 0 {
+			continue
+		}
+		m := text[start:end]
+		if r.validate != nil && !r.validate(m) {
+			continue
+		}
+		out = append(out, DLPSpan{Start: start, End: end, Text: m, Category: r.Category, Rule: r.Name, Confidence: r.Confidence})
+	}
+	return out
+}
+
+var piiRecognizers = []*Recognizer{
+	{Name: "credit_card", Category: types.CategoryFinancial, Confidence: 0.95,
+		re: regexp.MustCompile(`\b(?:\d{4}[ -]){3}\d{1,7}\b|\b\d{4}[ -]\d{6}[ -]\d{4,5}\b|\b\d{12,19}\b`), validate: validCard},
+	{Name: "us_ssn", Category: types.CategoryPII, Confidence: 0.8,
+		re: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`), validate: validSSN},
+	{Name: "crypto_address", Category: types.CategoryFinancial, Confidence: 0.95,
+		re: regexp.MustCompile(`\b[13][a-km-zA-HJ-NP-Z1-9]{25,34}\b`), validate: validBase58Check},
+	{Name: "cn_id", Category: types.CategoryPII, Confidence: 0.95,
+		re: regexp.MustCompile(`\b[1-9]\d{16}[\dXx]\b`), validate: validCNID},
+	{Name: "cn_mobile", Category: types.CategoryPII, Confidence: 0.85,
+		re: regexp.MustCompile(`(?:\+86[- ]?|\b)(1[3-9]\d{9})\b`), group: 1, validate: validCNMobile},
+	{Name: "iban", Category: types.CategoryFinancial, Confidence: 0.95,
+		re: regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,3})?\b`), validate: validIBAN},
+	{Name: "email", Category: types.CategoryPII, Confidence: 0.9,
+		re: regexp.MustCompile(`\b[A-Za-z0-9._%+-]{1,64}@(?:[A-Za-z0-9-]{1,30}\.){1,2}[A-Za-z]{2,24}\b`)},
+	{Name: "ipv4", Category: types.CategoryPII, Confidence: 0.7,
+		re: regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`), validate: validIP},
+	{Name: "ipv6", Category: types.CategoryPII, Confidence: 0.7,
+		re: regexp.MustCompile(`(?i)\b[0-9a-f]{1,4}(?::[0-9a-f]{0,4}){2,7}\b`), validate: validIPv6},
+	{Name: "passport", Category: types.CategoryPII, Confidence: 0.75,
+		re:       regexp.MustCompile(`(?i:passport|护照)(?:\s*(?i:no\.?|number|#|号码|号))?\s*(?:is\s+|[:：#]\s*)?([A-Z0-9]{7,9})\b`),
+		group:    1,
+		validate: validPassport},
+}
+
+// recognizers is the full registry: PII first, then secrets (see secrets.go).
+var recognizers = append(append([]*Recognizer{}, piiRecognizers...), secretRecognizers...)
+
+// defaultRecognizers keep the coverage the built-in DLP always had, plus every
+// secret recognizer; the rest are opted into through Policy.OutputFilters.
+var defaultRecognizers = map[string]bool{"credit_card": true, "us_ssn": true, "crypto_address": true}
+
+// Recognizers lists every built-in recognizer.
+func Recognizers() []*Recognizer { return recognizers }
+
+// DefaultRecognizers returns the recognizers that run when a tenant selects none.
+func DefaultRecognizers() []*Recognizer { return SelectRecognizers(nil) }
+
+// SelectRecognizers resolves a tenant's output filters: the defaults, plus every
+// recognizer named by a filter or whose category is a filter, minus those named
+// by a "-" filter (e.g. "-us_ssn" or "-pii"). Unknown filters are ignored.
+func SelectRecognizers(filters []string) []*Recognizer {
+	enable, disable := map[string]bool{}, map[string]bool{}
+	for _, f := range filters {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if strings.HasPrefix(f, "-") {
+			disable[f[1:]] = true
+		} else if f != "" {
+			enable[f] = true
+		}
+	}
+	var out []*Recognizer
+	for _, r := range recognizers {
+		on := defaultRecognizers[r.Name] || r.Category == types.CategorySecret || enable[r.Name] || enable[r.Category]
+		if on && !disable[r.Name] && !disable[r.Category] {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func digitsOnly(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// luhn reports whether the digit string passes the Luhn checksum.
+func luhn(digits string) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// cardBrands maps issuer prefix ranges to the lengths that brand issues.
+var cardBrands = []struct {
+	lo, hi  int // inclusive range over the first len(digits of lo) digits
+	lengths []int
+}{
+	{4, 4, []int{13, 16, 19}},                           // Visa
+	{51, 55, []int{16}},                                 // Mastercard
+	{2221, 2720, []int{16}},                             // Mastercard 2-series
+	{34, 34, []int{15}},                                 // Amex
+	{37, 37, []int{15}},                                 // Amex
+	{6011, 6011, []int{16, 17, 18, 19}},                 // Discover
+	{644, 649, []int{16, 17, 18, 19}},                   // Discover
+	{65, 65, []int{16, 17, 18, 19}},                     // Discover
+	{3528, 3589, []int{16, 17, 18, 19}},                 // JCB
+	{62, 62, []int{16, 17, 18, 19}},                     // UnionPay
+	{300, 305, []int{14}},                               // Diners Club
+	{36, 36, []int{14}},                                 // Diners Club
+	{38, 39, []int{14, 16}},                             // Diners Club
+	{2200, 2204, []int{16, 17, 18, 19}},                 // Mir
+	{5018, 5020, []int{12, 13, 14, 15, 16, 17, 18, 19}}, // Maestro
+}
+
+func validCard(s string) bool {
+	d := digitsOnly(s)
+	if len(d) < 12 || len(d) > 19 || !luhn(d) {
+		return false
+	}
+	for _, b := range cardBrands {
+		n := len(strconv.Itoa(b.lo))
+		p, _ := strconv.Atoi(d[:n])
+		if p < b.lo || p > b.hi {
+			continue
+		}
+		for _, l := range b.lengths {
+			if len(d) == l {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func validSSN(s string) bool {
+	area, group, serial := s[0:3], s[4:6], s[7:11]
+	if area == "000" || area == "666" || area[0] == '9' {
+		return false
+	}
+	return group != "00" && serial != "0000"
+}
+
+var cnIDWeights = [17]int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+
+const cnIDCheck = "10X98765432"
+
+// validCNID checks a PRC resident ID: plausible birth date and the ISO 7064
+// MOD 11-2 check digit.
+func validCNID(s string) bool {
+	birth, err := time.Parse("20060102", s[6:14])
+	if err != nil || birth.Year() < 1900 || birth.After(time.Now()) {
+		return false
+	}
+	sum := 0
+	for i, w := range cnIDWeights {
+		sum += int(s[i]-'0') * w
+	}
+	return cnIDCheck[sum%11] == strings.ToUpper(s[17:])[0]
+}
+
+// cnMobilePrefixes are the allocated three-digit prefixes of mainland mobile numbers.
+var cnMobilePrefixes = regexp.MustCompile(`^1(?:3\d|4[5-9]|5[0-35-9]|6[2567]|7[0-8]|8\d|9[0-35-9])`)
+
+func validCNMobile(s string) bool { return cnMobilePrefixes.MatchString(s) }
+
+// ibanLengths holds the registered IBAN length of common countries; others
+// only need to fall within the 15-34 range.
+var ibanLengths = map[string]int{
+	"AT": 20, "BE": 16, "CH": 21, "CZ": 24, "DE": 22, "DK": 18, "ES": 24, "FI": 18,
+	"FR": 27, "GB": 22, "GR": 27, "IE": 22, "IT": 27, "LU": 20, "NL": 18, "NO": 15,
+	"PL": 28, "PT": 25, "SE": 24,
+}
+
+// validIBAN checks the country length and the ISO 13616 mod-97 checksum.
+func validIBAN(s string) bool {
+	iban := strings.ReplaceAll(s, " ", "")
+	if want, ok := ibanLengths[iban[:2]]; ok && len(iban) != want {
+		return false
+	}
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+	var b strings.Builder
+	for _, r := range iban[4:] + iban[:4] {
+		if r >= 'A' && r <= 'Z' {
+			b.WriteString(strconv.Itoa(int(r-'A') + 10))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	n, ok := new(big.Int).SetString(b.String(), 10)
+	return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+func validIP(s string) bool { return net.ParseIP(s) != nil }
+
+// validIPv6 requires at least three hex groups so "a::b" style tokens in code
+// do not count.
+func validIPv6(s string) bool {
+	if net.ParseIP(s) == nil {
+		return false
+	}
+	groups := 0
+	for _, g := range strings.Split(s, ":") {
+		if g != "" {
+			groups++
+		}
+	}
+	return groups >= 3
+}
+
+// passportFormats covers CN (E/G/D + 8 digits, E + letter + 7 digits), US
+// (9 digits or a letter + 8 digits) and the common EU 1-2 letters + 7 digits.
+var passportFormats = regexp.MustCompile(`^(?:[EGD]\d{8}|E[A-HJ-NP-Z]\d{7}|[A-Z]?\d{8,9}|[A-Z]{1,2}\d{7})$`)
+
+func validPassport(s string) bool { return passportFormats.MatchString(s) }
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// validBase58Check decodes a legacy Bitcoin address and verifies its
+// double-SHA256 checksum.
+func validBase58Check(s string) bool {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	for _, r := range s {
+		i := strings.IndexRune(base58Alphabet, r)
+		if i < 0 {
+			return false
+		}
+		n.Mul(n, radix).Add(n, big.NewInt(int64(i)))
+	}
+	raw := n.Bytes()
+	for _, r := range s {
+		if r != '1' {
+			break
+		}
+		raw = append([]byte{0}, raw...)
+	}
+	if len(raw) != 25 {
+		return false
+	}
+	first := sha256.Sum256(raw[:21])
+	second := sha256.Sum256(first[:])
+	return string(second[:4]) == string(raw[21:])
+}
@@ -0,0 +1,78 @@
+package policy
+
+import (
+	"testing"
+
+	"aiguardrails/internal/types"
+)
+
+func TestRecognizersValidate(t *testing.T) {
+	all := SelectRecognizers([]string{"pii", "financial"})
+	cases := []struct {
+		text string
+		want string // recognizer name, "" for no hit
+	}{
+		{"card 4111 1111 1111 1111 on file", "credit_card"},
+		{"amex 378282246310005", "credit_card"},
+		{"order 4111111111111112 shipped", ""},
+		{"ref 1234567890123456", ""},
+		{"ssn 123-45-6789", "us_ssn"},
+		{"ssn 666-45-6789", ""},
+		{"身份证 11010519491231002X 已登记", "cn_id"},
+		{"id 110105194912310021", ""},
+		{"手机13812345678请联系", "cn_mobile"},
+		{"call +86-13812345678", "cn_mobile"},
+		{"tracking 14012345678", ""},
+		{"pay to GB82 WEST 1234 5698 7654 32", "iban"},
+		{"iban DE89370400440532013000", "iban"},
+		{"iban DE89370400440532013001", ""},
+		{"mail ops@example.com", "email"},
+		{"host 192.168.1.10", "ipv4"},
+		{"version 999.1.1.1", ""},
+		{"addr 2001:db8::8a2e:370:7334", "ipv6"},
+		{"use std::vector here", ""},
+		{"passport no. E12345678", "passport"},
+		{"护照号码：G12345678", "passport"},
+		{"passport holder services", ""},
+		{"btc 1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", "crypto_address"},
+		{"btc 1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNb", ""},
+	}
+	for _, tc := range cases {
+		var spans []DLPSpan
+		for _, r := range all {
+			if r.Category == types.CategorySecret {
+				continue
+			}
+			spans = append(spans, r.Find(tc.text)...)
+		}
+		got := ""
+		if len(spans) > 0 {
+			got = spans[0].Rule
+		}
+		if got != tc.want || len(spans) > 1 {
+			t.Errorf("%q: got %q want %q (%+v)", tc.text, got, tc.want, spans)
+		}
+	}
+}
+
+func TestSelectRecognizers(t *testing.T) {
+	names := func(recs []*Recognizer) map[string]bool {
+		out := map[string]bool{}
+		for _, r := range recs {
+			out[r.Name] = true
+		}
+		return out
+	}
+	def := names(SelectRecognizers(nil))
+	if !def["credit_card"] || !def["us_ssn"] || !def["github_token"] || def["email"] || def["cn_id"] {
+		t.Fatalf("unexpected defaults: %v", def)
+	}
+	got := names(SelectRecognizers([]string{"CN_ID", "-us_ssn", "toxicity"}))
+	if !got["cn_id"] || got["us_ssn"] || !got["credit_card"] || got["email"] {
+		t.Fatalf("unexpected selection: %v", got)
+	}
+	got = names(SelectRecognizers([]string{"pii", "-email"}))
+	if !got["cn_mobile"] || !got["passport"] || got["email"] {
+		t.Fatalf("category selection not applied: %v", got)
+	}
+}
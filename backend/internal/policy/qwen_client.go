@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -44,10 +46,13 @@ type qwenResp struct {
 	} `json:"output"`
 }
 
-// Moderate calls Qwen; if token missing, returns allow.
+// ErrQwenTokenMissing means moderation is not configured; the detector reports itself degraded.
+var ErrQwenTokenMissing = errors.New("qwen: token not configured")
+
+// Moderate calls Qwen; if token missing, returns ErrQwenTokenMissing.
 func (c *QwenClient) Moderate(ctx context.Context, text string) (types.GuardrailResult, error) {
 	if c.Token == "" {
-		return types.GuardrailResult{Allowed: true, Reason: "qwen_token_missing"}, nil
+		return types.GuardrailResult{Allowed: true, Reason: "qwen_token_missing"}, ErrQwenTokenMissing
 	}
 	body, _ := json.Marshal(qwenReq{
 		Input: map[string]string{"text": text},
@@ -69,6 +74,11 @@ func (c *QwenClient) Moderate(ctx context.Context, text string) (types.Guardrail
 			continue
 		}
 		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			lastErr = fmt.Errorf("qwen: http status %d", resp.StatusCode)
+			time.Sleep(time.Duration(i+1) * 100 * time.Millisecond)
+			continue
+		}
 		var out qwenResp
 		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
 			lastErr = err
@@ -0,0 +1,331 @@
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"aiguardrails/internal/types"
+)
+
+// Fields rule conditions can reference.
+const (
+	FieldPrompt = "prompt"
+	FieldOutput = "output"
+	FieldTool   = "tool"
+	FieldRole   = "role"
+	FieldVendor = "vendor"
+)
+
+// RuleInput holds the request fields a rule is evaluated against. A field the
+// request does not carry reads as empty, so only not_contains/not_in can match it.
+type RuleInput map[string]string
+
+var severityRank = map[RuleSeverity]int{
+	SeverityLow:      1,
+	SeverityMedium:   2,
+	SeverityHigh:     3,
+	SeverityCritical: 4,
+}
+
+// DecisionRank returns how restrictive a decision is; unknown decisions rank -1.
+func DecisionRank(d RuleDecision) int { return types.DecisionRank(string(d)) }
+
+type compiledCondition struct {
+	field  string
+	op     string
+	values []string
+	re     *regexp.Regexp
+	fold   bool
+}
+
+type compiledRule struct {
+	rule     EnhancedRule
+	decision RuleDecision
+	response string
+	notify   bool
+	redact   *regexp.Regexp // RuleAction.RedactPattern, if any
+	conds    []compiledCondition
+}
+
+// RedactMask replaces spans masked by a redact decision.
+const RedactMask = "[REDACTED]"
+
+// RuleEngine evaluates compiled EnhancedRules. Rules without conditions are
+// descriptive only and never match.
+type RuleEngine struct {
+	rules []compiledRule
+	ids   map[string]int // rule ID -> index in rules
+}
+
+// NewRuleEngine compiles rules, rejecting unknown fields, operators and bad regexes.
+func NewRuleEngine(rules []EnhancedRule) (*RuleEngine, error) {
+	e := &RuleEngine{ids: map[string]int{}}
+	for _, r := range rules {
+		if !r.Enabled || len(r.Conditions) == 0 {
+			continue
+		}
+		cr := compiledRule{rule: r, decision: r.Decision, response: r.ResponseText}
+		for _, a := range r.Actions {
+			if d := RuleDecision(a.Type); cr.decision == "" && DecisionRank(d) > 0 {
+				cr.decision = d
+			}
+			if a.Response != "" && cr.response == "" {
+				cr.response = a.Response
+			}
+			if a.Notify || a.Type == "notify" {
+				cr.notify = true
+			}
+			if a.RedactPattern != "" && cr.redact == nil {
+				re, err := regexp.Compile(a.RedactPattern)
+				if err != nil {
+					return nil, fmt.Errorf("rule %s redact_pattern: %w", r.ID, err)
+				}
+				cr.redact = re
+			}
+		}
+		if cr.decision == "" {
+			cr.decision = DecisionMark
+		}
+		if DecisionRank(cr.decision) < 0 {
+			return nil, fmt.Errorf("rule %s: unknown decision %q", r.ID, cr.decision)
+		}
+		for i, c := range r.Conditions {
+			cc, err := compileCondition(c)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s condition %d: %w", r.ID, i, err)
+			}
+			cr.conds = append(cr.conds, cc)
+		}
+		e.ids[r.ID] = len(e.rules)
+		e.rules = append(e.rules, cr)
+	}
+	return e, nil
+}
+
+func compileCondition(c RuleCondition) (compiledCondition, error) {
+	switch c.Field {
+	case FieldPrompt, FieldOutput, FieldTool, FieldRole, FieldVendor:
+	default:
+		return compiledCondition{}, fmt.Errorf("unknown field %q", c.Field)
+	}
+	cc := compiledCondition{field: c.Field, op: c.Operator, fold: !c.CaseSensitive}
+	if c.Value != "" {
+		cc.values = append(cc.values, c.Value)
+	}
+	cc.values = append(cc.values, c.Values...)
+	if len(cc.values) == 0 {
+		return cc, fmt.Errorf("operator %q needs a value", c.Operator)
+	}
+	if cc.fold && c.Operator != "regex" {
+		for i, v := range cc.values {
+			cc.values[i] = strings.ToLower(v)
+		}
+	}
+	switch c.Operator {
+	case "contains", "not_contains", "equals", "in", "not_in":
+	case "regex":
+		pattern := strings.Join(cc.values, "|")
+		if cc.fold {
+			pattern = "(?i)(?:" + pattern + ")"
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return cc, err
+		}
+		cc.re = re
+	default:
+		return cc, fmt.Errorf("unknown operator %q", c.Operator)
+	}
+	return cc, nil
+}
+
+// match reports whether the condition holds and which value triggered it.
+func (c compiledCondition) match(in RuleInput) (bool, string) {
+	v := in[c.field]
+	if c.re != nil {
+		m := c.re.FindString(v)
+		return m != "", m
+	}
+	if c.fold {
+		v = strings.ToLower(v)
+	}
+	switch c.op {
+	case "contains":
+		for _, want := range c.values {
+			if strings.Contains(v, want) {
+				return true, want
+			}
+		}
+		return false, ""
+	case "not_contains":
+		for _, want := range c.values {
+			if strings.Contains(v, want) {
+				return false, ""
+			}
+		}
+		return true, ""
+	case "equals", "in":
+		for _, want := range c.values {
+			if v == want {
+				return true, want
+			}
+		}
+		return false, ""
+	case "not_in":
+		for _, want := range c.values {
+			if v == want {
+				return false, ""
+			}
+		}
+		return true, v
+	}
+	return false, ""
+}
+
+// Has reports whether id is an enforceable rule.
+func (e *RuleEngine) Has(id string) bool {
+	_, ok := e.ids[id]
+	return ok
+}
+
+// Redact masks text for a matched rule: spans of its RedactPattern, or else the
+// spans its positive conditions on field matched.
+func (e *RuleEngine) Redact(ruleID, field, text string) string {
+	spans := e.Spans(ruleID, field, text)
+	if len(spans) == 0 {
+		return text
+	}
+	var b strings.Builder
+	pos := 0
+	for _, sp := range spans {
+		if sp[1] <= pos {
+			continue
+		}
+		if sp[0] >= pos {
+			b.WriteString(text[pos:sp[0]])
+			b.WriteString(RedactMask)
+		}
+		pos = sp[1]
+	}
+	b.WriteString(text[pos:])
+	return b.String()
+}
+
+// Spans returns the byte ranges of text a matched rule points at, sorted by
+// start: matches of its RedactPattern if it has one, otherwise the matches of
+// its regex and contains conditions on field.
+func (e *RuleEngine) Spans(ruleID, field, text string) [][2]int {
+	i, ok := e.ids[ruleID]
+	if !ok {
+		return nil
+	}
+	cr := e.rules[i]
+	var res []*regexp.Regexp
+	if cr.redact != nil {
+		res = append(res, cr.redact)
+	} else {
+		for _, c := range cr.conds {
+			if c.field != field {
+				continue
+			}
+			if re := c.spanRegexp(); re != nil {
+				res = append(res, re)
+			}
+		}
+	}
+	var out [][2]int
+	for _, re := range res {
+		for _, loc := range re.FindAllStringIndex(text, -1) {
+			if loc[1] > loc[0] {
+				out = append(out, [2]int{loc[0], loc[1]})
+			}
+		}
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a][0] < out[b][0] })
+	return out
+}
+
+// spanRegexp returns a regexp locating what a positive condition matched.
+func (c compiledCondition) spanRegexp() *regexp.Regexp {
+	if c.re != nil || c.op != "contains" {
+		return c.re
+	}
+	quoted := make([]string, len(c.values))
+	for j, v := range c.values {
+		quoted[j] = regexp.QuoteMeta(v)
+	}
+	pattern := strings.Join(quoted, "|")
+	if c.fold {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.MustCompile(pattern)
+}
+
+// Evaluate returns the rules whose conditions all match, restricted to ruleIDs
+// when it is non-nil. Results are ordered by conflict resolution: higher
+// priority first, then higher severity, then the more restrictive decision, so
+// the first result is the effective one.
+func (e *RuleEngine) Evaluate(in RuleInput, ruleIDs []string) []RuleEvaluationResult {
+	var scope map[string]bool
+	if ruleIDs != nil {
+		scope = make(map[string]bool, len(ruleIDs))
+		for _, id := range ruleIDs {
+			scope[id] = true
+		}
+	}
+	type hit struct {
+		res      RuleEvaluationResult
+		priority int
+	}
+	var hits []hit
+	for _, cr := range e.rules {
+		if scope != nil && !scope[cr.rule.ID] {
+			continue
+		}
+		signals := make([]string, 0, len(cr.conds))
+		matched := true
+		for _, c := range cr.conds {
+			ok, val := c.match(in)
+			if !ok {
+				matched = false
+				break
+			}
+			signals = append(signals, fmt.Sprintf("%s %s %s", c.field, c.op, val))
+		}
+		if !matched {
+			continue
+		}
+		reason := cr.rule.Description
+		if reason == "" {
+			reason = cr.rule.Name
+		}
+		hits = append(hits, hit{priority: cr.rule.Priority, res: RuleEvaluationResult{
+			RuleID:       cr.rule.ID,
+			RuleName:     cr.rule.Name,
+			Matched:      true,
+			Decision:     cr.decision,
+			Reason:       reason,
+			Signals:      signals,
+			Response:     cr.response,
+			Severity:     cr.rule.Severity,
+			ShouldNotify: cr.notify,
+		}})
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		a, b := hits[i], hits[j]
+		if a.priority != b.priority {
+			return a.priority > b.priority
+		}
+		if sa, sb := severityRank[a.res.Severity], severityRank[b.res.Severity]; sa != sb {
+			return sa > sb
+		}
+		return DecisionRank(a.res.Decision) > DecisionRank(b.res.Decision)
+	})
+	out := make([]RuleEvaluationResult, len(hits))
+	for i, h := range hits {
+		out[i] = h.res
+	}
+	return out
+}
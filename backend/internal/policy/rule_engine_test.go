@@ -0,0 +1,78 @@
+package policy
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRuleEngineConflictResolution(t *testing.T) {
+	rules := []EnhancedRule{
+		{ID: "mark-plc", Enabled: true, Severity: SeverityCritical, Decision: DecisionMark, Priority: 1,
+			Conditions: []RuleCondition{{Field: FieldPrompt, Operator: "contains", Value: "plc"}}},
+		{ID: "block-stop", Enabled: true, Severity: SeverityHigh, Decision: DecisionBlock, Priority: 5,
+			Conditions: []RuleCondition{
+				{Field: FieldPrompt, Operator: "regex", Value: `stop\s+the\s+plc`},
+				{Field: FieldRole, Operator: "not_in", Values: []string{"Engineer"}},
+			}},
+		{ID: "allow-vendor", Enabled: true, Severity: SeverityLow, Decision: DecisionAllow, Priority: 5,
+			Conditions: []RuleCondition{{Field: FieldVendor, Operator: "equals", Value: "Siemens", CaseSensitive: true}}},
+		{ID: "disabled", Enabled: false, Decision: DecisionBlock,
+			Conditions: []RuleCondition{{Field: FieldPrompt, Operator: "contains", Value: "plc"}}},
+		{ID: "descriptive", Enabled: true, Decision: DecisionBlock},
+	}
+	e, err := NewRuleEngine(rules)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	if e.Has("disabled") || e.Has("descriptive") || !e.Has("block-stop") {
+		t.Fatalf("unexpected enforceable set")
+	}
+
+	res := e.Evaluate(RuleInput{FieldPrompt: "Please STOP the PLC now"}, nil)
+	if len(res) != 2 || res[0].RuleID != "block-stop" || res[1].RuleID != "mark-plc" {
+		t.Fatalf("higher priority should win over severity: %+v", res)
+	}
+
+	// An engineer is exempt from the block; equal priority then falls back to severity.
+	res = e.Evaluate(RuleInput{FieldPrompt: "stop the plc", FieldRole: "engineer", FieldVendor: "Siemens"}, nil)
+	if len(res) != 2 || res[0].RuleID != "allow-vendor" || res[1].RuleID != "mark-plc" {
+		t.Fatalf("unexpected ordering: %+v", res)
+	}
+	if got := e.Evaluate(RuleInput{FieldVendor: "siemens"}, nil); len(got) != 0 {
+		t.Fatalf("case-sensitive equals should not match: %+v", got)
+	}
+
+	// Only rules in scope are evaluated.
+	if got := e.Evaluate(RuleInput{FieldPrompt: "stop the plc"}, []string{"mark-plc"}); len(got) != 1 || got[0].RuleID != "mark-plc" {
+		t.Fatalf("scope not applied: %+v", got)
+	}
+
+	bad := []EnhancedRule{{ID: "bad", Enabled: true, Conditions: []RuleCondition{{Field: FieldPrompt, Operator: "regex", Value: "("}}}}
+	if _, err := NewRuleEngine(bad); err == nil {
+		t.Fatalf("expected regex compile error")
+	}
+	bad[0].Conditions[0] = RuleCondition{Field: "headers", Operator: "contains", Value: "x"}
+	if _, err := NewRuleEngine(bad); err == nil {
+		t.Fatalf("expected unknown field error")
+	}
+}
+
+func TestRuleEngineComplianceRules(t *testing.T) {
+	repo, err := NewRulesRepository(filepath.Join("..", "..", "policies"))
+	if err != nil {
+		t.Fatalf("load rules: %v", err)
+	}
+	e := repo.Engine()
+	res := e.Evaluate(RuleInput{FieldOutput: "Card 4111 1111 1111 1111, CVV: 123"}, nil)
+	if len(res) == 0 || res[0].RuleID != "pci-dss-001" || res[0].Decision != DecisionBlock {
+		t.Fatalf("expected pci block: %+v", res)
+	}
+	res = e.Evaluate(RuleInput{FieldPrompt: "force the S7-1500 CPU into STOP"}, nil)
+	if len(res) != 1 || res[0].RuleID != "siemens-industrial-001" {
+		t.Fatalf("expected siemens rule without a role: %+v", res)
+	}
+	res = e.Evaluate(RuleInput{FieldPrompt: "force the S7-1500 CPU into STOP", FieldRole: "safety_engineer"}, nil)
+	if len(res) != 0 {
+		t.Fatalf("safety engineer should be exempt: %+v", res)
+	}
+}
@@ -3,6 +3,7 @@ package policy
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -34,7 +35,14 @@ type RuleAttachment struct {
 
 // RulesRepository loads rules from json files.
 type RulesRepository struct {
-	rules []Rule
+	rules  []Rule
+	engine *RuleEngine
+}
+
+// fileRule reads an EnhancedRule from a rules file; a missing "enabled" means enabled.
+type fileRule struct {
+	EnhancedRule
+	Enabled *bool `json:"enabled"`
 }
 
 // NewRulesRepository loads all JSON files under dir.
@@ -44,6 +52,7 @@ func NewRulesRepository(dir string) (*RulesRepository, error) {
 		return nil, err
 	}
 	var rules []Rule
+	var enhanced []EnhancedRule
 	for _, f := range files {
 		if f.IsDir() {
 			continue
@@ -60,8 +69,25 @@ func NewRulesRepository(dir string) (*RulesRepository, error) {
 			return nil, err
 		}
 		rules = append(rules, rs...)
+		var frs []fileRule
+		if err := json.Unmarshal(b, &frs); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name(), err)
+		}
+		for _, fr := range frs {
+			fr.EnhancedRule.Enabled = fr.Enabled == nil || *fr.Enabled
+			enhanced = append(enhanced, fr.EnhancedRule)
+		}
 	}
-	return &RulesRepository{rules: rules}, nil
+	engine, err := NewRuleEngine(enhanced)
+	if err != nil {
+		return nil, err
+	}
+	return &RulesRepository{rules: rules, engine: engine}, nil
+}
+
+// Engine returns the rule engine compiled from the loaded rules' conditions.
+func (r *RulesRepository) Engine() *RuleEngine {
+	return r.engine
 }
 
 // List returns rules with optional filters.
@@ -0,0 +1,108 @@
+package policy
+
+import (
+	"math"
+	"regexp"
+	"unicode"
+
+	"aiguardrails/internal/types"
+)
+
+// secretRecognizers detect credentials. Provider formats are matched exactly;
+// generic assignments and high-entropy tokens catch the rest.
+var secretRecognizers = []*Recognizer{
+	{Name: "aws_access_key", Category: types.CategorySecret, Confidence: 0.95,
+		re: regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA)[0-9A-Z]{16}\b`)},
+	{Name: "aws_secret_key", Category: types.CategorySecret, Confidence: 0.9,
+		re: regexp.MustCompile(`(?i:aws_?secret_?(?:access_?)?key)["']?\s*[:=]\s*["']?([A-Za-z0-9/+]{40})\b`), group: 1},
+	{Name: "aliyun_access_key", Category: types.CategorySecret, Confidence: 0.9,
+		re: regexp.MustCompile(`\bLTAI[0-9A-Za-z]{12,20}\b`)},
+	{Name: "github_token", Category: types.CategorySecret, Confidence: 0.95,
+		re: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36}|github_pat_[A-Za-z0-9_]{82})\b`)},
+	{Name: "gitlab_token", Category: types.CategorySecret, Confidence: 0.95,
+		re: regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20}\b`)},
+	{Name: "slack_token", Category: types.CategorySecret, Confidence: 0.95,
+		re: regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,72}\b|https://hooks\.slack\.com/services/[A-Za-z0-9/]{20,60}`)},
+	{Name: "jwt", Category: types.CategorySecret, Confidence: 0.9,
+		re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{5,}\.eyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]{10,}`)},
+	// An unterminated key still matches so a stream holds it back until END arrives.
+	{Name: "private_key", Category: types.CategorySecret, Confidence: 0.99,
+		re: regexp.MustCompile(`-----BEGIN (?:[A-Z]+ )*PRIVATE KEY-----(?:[\s\S]*?-----END (?:[A-Z]+ )*PRIVATE KEY-----|[A-Za-z0-9+/=\s:,-]*)`)},
+	{Name: "db_connection_string", Category: types.CategorySecret, Confidence: 0.9,
+		re: regexp.MustCompile(`\b(?:postgres(?:ql)?|mysql|mongodb(?:\+srv)?|redis|rediss|amqps?|mssql|sqlserver)://[^\s:@/]*:[^\s@/]+@[^\s'"<>]+`)},
+	{Name: "password_assignment", Category: types.CategorySecret, Confidence: 0.7,
+		re:       regexp.MustCompile(`(?:(?i:\b(?:password|passwd|pwd|secret|token|api[_-]?key|access[_-]?key|client[_-]?secret))|密码|口令)["']?(?:\s*[:=：]\s*|\s+is\s+)["']?([^\s"',;\[\]]{6,64})`),
+		group:    1,
+		validate: hasNonLetter},
+	{Name: "high_entropy", Category: types.CategorySecret, Confidence: 0.6,
+		re: regexp.MustCompile(`[A-Za-z0-9+/_=-]{24,128}`), validate: highEntropy, fallback: true},
+}
+
+// hasNonLetter rejects plain words ("password is secret") as assigned values.
+func hasNonLetter(s string) bool {
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Thresholds for generic high-entropy tokens. Random base62 keys of 24+ chars
+// clear both; identifiers, words and hex digests (at most 4 bits/char) do not.
+const (
+	minSecretEntropy    = 3.8 // Shannon entropy, bits per char
+	minClassSwitchRatio = 0.4 // share of adjacent chars changing class (lower/upper/digit/symbol)
+)
+
+// ShannonEntropy returns the entropy of s in bits per character.
+func ShannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := map[rune]int{}
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	h := 0.0
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+func charClass(r rune) int {
+	switch {
+	case unicode.IsDigit(r):
+		return 0
+	case unicode.IsUpper(r):
+		return 1
+	case unicode.IsLower(r):
+		return 2
+	}
+	return 3
+}
+
+// highEntropy accepts random-looking tokens: letters and digits mixed, high
+// entropy, and frequent character-class changes (camelCase words switch rarely).
+func highEntropy(s string) bool {
+	var hasDigit, hasLetter bool
+	switches := 0
+	prev := -1
+	for _, r := range s {
+		c := charClass(r)
+		hasDigit = hasDigit || c == 0
+		hasLetter = hasLetter || c == 1 || c == 2
+		if prev >= 0 && c != prev {
+			switches++
+		}
+		prev = c
+	}
+	if !hasDigit || !hasLetter {
+		return false
+	}
+	return ShannonEntropy(s) >= minSecretEntropy && float64(switches)/float64(len(s)-1) >= minClassSwitchRatio
+}
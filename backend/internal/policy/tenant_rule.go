@@ -9,8 +9,11 @@ import (
 type TenantRuleType string
 
 const (
-	RuleTypeBusiness   TenantRuleType = "business"   // 业务规则
-	RuleTypePermission TenantRuleType = "permission" // 权限规则
+	RuleTypeBusiness    TenantRuleType = "business"     // 业务规则
+	RuleTypePermission  TenantRuleType = "permission"   // 权限规则
+	RuleTypePipeline    TenantRuleType = "pipeline"     // 检测流水线编排
+	RuleTypeAgentTools  TenantRuleType = "agent_tools"  // 智能体工具参数策略
+	RuleTypeAgentEgress TenantRuleType = "agent_egress" // 智能体 HTTP 工具出站白名单
 )
 
 // TenantRule 租户规则
@@ -77,6 +80,73 @@ type ToolPermConfig struct {
 	MinLevel             int  `json:"min_level"`
 	RequiresConfirmation bool `json:"requires_confirmation,omitempty"`
 	RequiresMFA          bool `json:"requires_mfa,omitempty"`
+	// 智能体调用所需的审批人数（不同审批人），工业控制等可设为 2；未设置时需确认为 1 人、需MFA为 2 人
+	Approvers int `json:"approvers,omitempty"`
+}
+
+// PipelineRuleConfig 检测流水线配置（阶段顺序与执行模式）
+type PipelineRuleConfig struct {
+	Mode   string   `json:"mode,omitempty"` // short_circuit | collect_all
+	Prompt []string `json:"prompt,omitempty"`
+	Output []string `json:"output,omitempty"`
+	RAG    []string `json:"rag,omitempty"`
+	// 检测器故障策略：fail_open | fail_closed | mark
+	OnFailure string            `json:"on_failure,omitempty"` // 所有阶段默认策略
+	Failure   map[string]string `json:"failure,omitempty"`    // 按阶段覆盖
+	// 提示注入判定阈值（0~1），0 表示使用默认值
+	InjectionThreshold float64 `json:"injection_threshold,omitempty"`
+	// 多轮会话防护（请求携带 session_id 时生效）
+	Session *SessionRuleConfig `json:"session,omitempty"`
+	// 检索文档间接注入处置：drop（默认）| quarantine
+	DocumentAction string `json:"document_action,omitempty"`
+	// 回答与检索上下文一致性检测（输出检测携带 context 时生效）
+	Grounding *GroundingRuleConfig `json:"grounding,omitempty"`
+}
+
+// AgentToolsRuleConfig 智能体工具调用参数策略
+type AgentToolsRuleConfig struct {
+	Tools map[string]*ToolArgRuleConfig `json:"tools"` // 工具名 -> 约束，"*" 对所有工具生效
+}
+
+// AgentEgressRuleConfig 智能体 HTTP 工具的出站白名单
+type AgentEgressRuleConfig struct {
+	// 域名（含子域名）、IP 或 CIDR；内网地址须由内网 IP/CIDR 列出，或域名加 "internal:" 前缀显式放行
+	Hosts []string `json:"hosts"`
+}
+
+// ToolArgRuleConfig 智能体工具调用的参数约束
+type ToolArgRuleConfig struct {
+	Args           map[string]ArgRuleConfig `json:"args,omitempty"`            // 参数路径（如 "limit"、"filter.owner"）-> 取值约束
+	ForbiddenPaths []string                 `json:"forbidden_paths,omitempty"` // 禁止访问的文件路径：目录前缀（"/etc"、"~/.ssh"、".."）或通配（"*.pem"）
+	ForbiddenHosts []string                 `json:"forbidden_hosts,omitempty"` // 禁止访问的主机：域名（含子域名）、IP 或 CIDR
+}
+
+// ArgRuleConfig 单个参数的取值约束，数组参数逐个元素检查
+type ArgRuleConfig struct {
+	Min         *float64 `json:"min,omitempty"`          // 数值下限（含）
+	Max         *float64 `json:"max,omitempty"`          // 数值上限（含）
+	Pattern     string   `json:"pattern,omitempty"`      // 取值须匹配的正则
+	DenyPattern string   `json:"deny_pattern,omitempty"` // 取值不得匹配的正则
+	MaxLength   int      `json:"max_length,omitempty"`   // 字符串最大长度（字符数）
+}
+
+// GroundingRuleConfig 幻觉检测规则，零值字段使用默认值
+type GroundingRuleConfig struct {
+	MinSupport     float64 `json:"min_support,omitempty"`     // 句子支持度低于该值视为无依据 (0~1)
+	MaxUnsupported float64 `json:"max_unsupported,omitempty"` // 可容忍的无依据论断比例 (0~1)，默认 0
+	Decision       string  `json:"decision,omitempty"`        // 触发后的决策：mark（默认）| block
+	LLMJudge       bool    `json:"llm_judge,omitempty"`       // 由 LLM 复核启发式判定为无依据的论断
+}
+
+// SessionRuleConfig 多轮会话累计规则，零值字段使用默认值
+type SessionRuleConfig struct {
+	MaxRisk       float64             `json:"max_risk,omitempty"`        // 累计风险上限
+	Decay         float64             `json:"decay,omitempty"`           // 每轮风险衰减系数 (0~1]
+	MaxNearMisses int                 `json:"max_near_misses,omitempty"` // 会话内擦边轮数上限
+	NearMissRatio float64             `json:"near_miss_ratio,omitempty"` // 注入分数达到阈值的该比例即视为擦边 (0~1)
+	DriftTopics   map[string][]string `json:"drift_topics,omitempty"`    // 敏感领域 -> 线索词，用于识别话题逐步漂移
+	MaxDriftTurns int                 `json:"max_drift_turns,omitempty"` // 同一领域线索出现轮数上限
+	Decision      string              `json:"decision,omitempty"`        // 触发后的决策：block | confirm
 }
 
 // ParseVendorConfig 解析厂商规则配置
@@ -106,6 +176,33 @@ func (r *TenantRule) ParsePermissionConfig() (*PermissionRuleConfig, error) {
 	return &cfg, nil
 }
 
+// ParsePipelineConfig 解析检测流水线配置
+func (r *TenantRule) ParsePipelineConfig() (*PipelineRuleConfig, error) {
+	var cfg PipelineRuleConfig
+	if err := json.Unmarshal(r.Config, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// ParseAgentToolsConfig 解析智能体工具参数策略
+func (r *TenantRule) ParseAgentToolsConfig() (*AgentToolsRuleConfig, error) {
+	var cfg AgentToolsRuleConfig
+	if err := json.Unmarshal(r.Config, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// ParseAgentEgressConfig 解析智能体出站白名单
+func (r *TenantRule) ParseAgentEgressConfig() (*AgentEgressRuleConfig, error) {
+	var cfg AgentEgressRuleConfig
+	if err := json.Unmarshal(r.Config, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
 // ToOPAInput 转换为OPA输入格式
 func (r *TenantRule) ToOPAInput() map[string]interface{} {
 	var configMap map[string]interface{}
@@ -141,6 +141,95 @@ func (s *TenantRuleStore) ListEnabled(tenantID string, ruleType TenantRuleType)
 	return rules, nil
 }
 
+// PipelineConfig 获取租户生效的流水线配置（优先级最高的一条），未配置时返回nil
+func (s *TenantRuleStore) PipelineConfig(tenantID string) (*PipelineRuleConfig, error) {
+	rules, err := s.ListEnabled(tenantID, RuleTypePipeline)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	return rules[0].ParsePipelineConfig()
+}
+
+// InjectionThreshold 获取租户的提示注入阈值，未配置时返回0
+func (s *TenantRuleStore) InjectionThreshold(tenantID string) float64 {
+	cfg, err := s.PipelineConfig(tenantID)
+	if err != nil || cfg == nil {
+		return 0
+	}
+	return cfg.InjectionThreshold
+}
+
+// DocumentAction 返回租户对被投毒检索文档的处置方式（drop | quarantine），未配置时为空
+func (s *TenantRuleStore) DocumentAction(tenantID string) string {
+	cfg, err := s.PipelineConfig(tenantID)
+	if err != nil || cfg == nil {
+		return ""
+	}
+	return cfg.DocumentAction
+}
+
+// AgentToolRules 合并租户启用的智能体工具参数策略（工具名 -> 约束），同名工具以优先级高者为准
+func (s *TenantRuleStore) AgentToolRules(tenantID string) map[string]*ToolArgRuleConfig {
+	rules, err := s.ListEnabled(tenantID, RuleTypeAgentTools)
+	if err != nil || len(rules) == 0 {
+		return nil
+	}
+	out := make(map[string]*ToolArgRuleConfig)
+	for _, rule := range rules {
+		cfg, err := rule.ParseAgentToolsConfig()
+		if err != nil {
+			continue
+		}
+		for tool, c := range cfg.Tools {
+			if _, ok := out[tool]; !ok {
+				out[tool] = c
+			}
+		}
+	}
+	return out
+}
+
+// AgentEgress 合并租户启用的智能体 HTTP 工具出站白名单，未配置时为空
+func (s *TenantRuleStore) AgentEgress(tenantID string) []string {
+	rules, err := s.ListEnabled(tenantID, RuleTypeAgentEgress)
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, rule := range rules {
+		cfg, err := rule.ParseAgentEgressConfig()
+		if err != nil {
+			continue
+		}
+		out = append(out, cfg.Hosts...)
+	}
+	return out
+}
+
+// ToolPermissions 合并租户启用的权限规则中的工具权限（工具名 -> 配置），同名工具以优先级高者为准
+func (s *TenantRuleStore) ToolPermissions(tenantID string) map[string]ToolPermConfig {
+	rules, err := s.ListEnabled(tenantID, RuleTypePermission)
+	if err != nil {
+		return nil
+	}
+	out := make(map[string]ToolPermConfig)
+	for _, rule := range rules {
+		cfg, err := rule.ParsePermissionConfig()
+		if err != nil {
+			continue
+		}
+		for tool, perm := range cfg.ToolPermissions {
+			if _, ok := out[tool]; !ok {
+				out[tool] = perm
+			}
+		}
+	}
+	return out
+}
+
 // ListTemplates 列出规则模板
 func (s *TenantRuleStore) ListTemplates(ruleType TenantRuleType) ([]RuleTemplate, error) {
 	query := `SELECT id, name, rule_type, description, config_schema, default_config, tags, created_at FROM rule_templates`
@@ -0,0 +1,67 @@
+package policy
+
+import (
+	"aiguardrails/internal/ahocorasick"
+	"aiguardrails/internal/types"
+)
+
+// TermSet is the built-in dictionary plus a tenant's custom terms compiled
+// into one automaton, so a scan costs one pass however many terms there are.
+// Build it once per term list and reuse it; it is safe for concurrent use.
+type TermSet struct {
+	custom []string
+	ac     *ahocorasick.Automaton // dlpKeywords first, then custom
+	maxLen int
+}
+
+// NewTermSet compiles the dictionary with customTerms.
+func NewTermSet(customTerms []string) *TermSet {
+	patterns := make([]string, 0, len(dlpKeywords)+len(customTerms))
+	for _, k := range dlpKeywords {
+		patterns = append(patterns, k.term)
+	}
+	patterns = append(patterns, customTerms...)
+	return &TermSet{custom: customTerms, ac: ahocorasick.New(patterns), maxLen: MaxTermLen(customTerms)}
+}
+
+// Terms returns the custom terms.
+func (t *TermSet) Terms() []string { return t.custom }
+
+// MaxLen returns the longest dictionary or custom term in bytes.
+func (t *TermSet) MaxLen() int { return t.maxLen }
+
+// Find returns the dictionary and custom-term spans in text, ordered by end offset.
+func (t *TermSet) Find(text string) []DLPSpan {
+	var spans []DLPSpan
+	for _, m := range t.ac.FindAll(text) {
+		sp := DLPSpan{Start: m.Start, End: m.End, Text: text[m.Start:m.End]}
+		if m.Pattern < len(dlpKeywords) {
+			sp.Category, sp.Rule, sp.Confidence = dlpKeywords[m.Pattern].category, "dictionary", dictionaryConfidence
+		} else {
+			sp.Category, sp.Rule, sp.Confidence = types.CategoryConfidential, "custom_term", customTermConfidence
+		}
+		spans = append(spans, sp)
+	}
+	return spans
+}
+
+// matches returns the terms found in text as reported in DLPResult.Matches:
+// dictionary terms, then custom terms, each once in list order.
+func (t *TermSet) matches(text string) []string {
+	hit := map[int]bool{}
+	for _, m := range t.ac.FindAll(text) {
+		hit[m.Pattern] = true
+	}
+	var out []string
+	for i := 0; i < t.ac.Len(); i++ {
+		if !hit[i] {
+			continue
+		}
+		if i < len(dlpKeywords) {
+			out = append(out, dlpKeywords[i].term)
+		} else {
+			out = append(out, t.custom[i-len(dlpKeywords)])
+		}
+	}
+	return out
+}
@@ -0,0 +1,77 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTermSetMatchesPerTermScan(t *testing.T) {
+	custom := []string{"Project Falcon", "falcon", "机密", "SSN"}
+	text := "project falcon docs are 机密; ssn and credit card numbers, FALCON"
+	ts := NewTermSet(custom)
+
+	var want []DLPSpan
+	for _, k := range dlpKeywords {
+		want = append(want, FindFold(text, k.term)...)
+	}
+	for _, term := range custom {
+		want = append(want, FindFold(text, term)...)
+	}
+	if got := ts.Find(text); len(got) != len(want) {
+		t.Fatalf("got %d spans, want %d: %+v", len(got), len(want), got)
+	}
+	res := DetectDLPTerms(text, ts, nil)
+	if strings.Join(res.Matches, ",") != "ssn,credit card,Project Falcon,falcon,机密,SSN" {
+		t.Fatalf("unexpected matches: %v", res.Matches)
+	}
+}
+
+// benchTerms returns n distinct sensitive terms and a 4 KiB text containing a few of them.
+func benchTerms(n int) ([]string, string) {
+	terms := make([]string, n)
+	for i := range terms {
+		terms[i] = fmt.Sprintf("codename-%05d", i)
+	}
+	text := strings.Repeat("the quarterly report mentions nothing sensitive at all. ", 70) +
+		terms[n/2] + " and " + strings.ToUpper(terms[n-1])
+	return terms, text
+}
+
+// perTermScan is the previous approach: one case-insensitive scan per term.
+func perTermScan(text string, terms []string) int {
+	lower := strings.ToLower(text)
+	hits := 0
+	for _, term := range terms {
+		if strings.Contains(lower, strings.ToLower(term)) {
+			hits += len(FindFold(text, term))
+		}
+	}
+	return hits
+}
+
+func BenchmarkCustomTerms(b *testing.B) {
+	for _, n := range []int{100, 1000, 5000} {
+		terms, text := benchTerms(n)
+		b.Run(fmt.Sprintf("per_term/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if perTermScan(text, terms) != 2 {
+					b.Fatal("expected 2 hits")
+				}
+			}
+		})
+		ts := NewTermSet(terms)
+		b.Run(fmt.Sprintf("automaton/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if len(ts.Find(text)) < 2 {
+					b.Fatal("expected hits")
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("compile/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				NewTermSet(terms)
+			}
+		})
+	}
+}
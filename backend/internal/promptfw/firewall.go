@@ -1,22 +1,36 @@
 package promptfw
 
 import (
-	"strings"
-
+	"aiguardrails/internal/injection"
+	"aiguardrails/internal/keyword"
+	"aiguardrails/internal/normalize"
 	"aiguardrails/internal/policy"
 	"aiguardrails/internal/types"
 )
 
 // Firewall wraps prompt evaluation for injection prevention.
 type Firewall struct {
-	policy policy.Engine
-	llm    *policy.LLMDetector
-	mode   string // "block" or "mark"
+	policy      policy.Engine
+	llm         *policy.LLMDetector
+	mode        string // "block" or "mark"
+	injection   *injection.Detector
+	recognizers func(tenantID string) []*policy.Recognizer // nil selects from the policy on every call
 }
 
 // NewFirewall constructs a Firewall.
 func NewFirewall(p policy.Engine) *Firewall {
-	return &Firewall{policy: p}
+	return &Firewall{policy: p, injection: injection.NewDetector(nil)}
+}
+
+// WithInjection replaces the injection detector, e.g. to apply per-tenant thresholds.
+func (f *Firewall) WithInjection(det *injection.Detector) {
+	f.injection = det
+}
+
+// WithRecognizers replaces the per-call recognizer selection, e.g. with a
+// per-tenant cache that policy edits invalidate.
+func (f *Firewall) WithRecognizers(lookup func(tenantID string) []*policy.Recognizer) {
+	f.recognizers = lookup
 }
 
 // WithLLM attaches an LLM detector.
@@ -29,48 +43,192 @@ func (f *Firewall) WithLLM(det *policy.LLMDetector, mode string) {
 	}
 }
 
-// CheckPrompt runs prompt through guardrails: injection check + explicit keywords.
-func (f *Firewall) CheckPrompt(tenantID, prompt string, keywords []string) types.GuardrailResult {
-	if strings.Contains(strings.ToLower(prompt), "ignore previous instructions") {
-		return types.GuardrailResult{Allowed: false, Reason: "prompt_injection_detected", Signals: []string{"ignore previous instructions"}}
+// CheckPrompt runs prompt through guardrails: injection scoring, pasted secrets and explicit keywords.
+// keywords may be nil.
+func (f *Firewall) CheckPrompt(tenantID, prompt string, keywords *keyword.Matcher) types.GuardrailResult {
+	if res, hit := f.DetectInjection(tenantID, prompt); hit {
+		return res
 	}
 
-	lowPrompt := strings.ToLower(prompt)
-	for _, kw := range keywords {
-		if strings.Contains(lowPrompt, strings.ToLower(kw)) {
-			return types.GuardrailResult{
-				Allowed: false,
-				Reason:  "keyword_block",
-				Signals: []string{kw},
-			}
+	variants := normalize.Variants(prompt)
+	if res, hit := f.detectSecrets(tenantID, variants); hit {
+		return res
+	}
+
+	if res, hit := detectVariants(variants, func(text string) (types.GuardrailResult, bool) {
+		m, ok := keywords.Find(text)
+		if !ok {
+			return types.GuardrailResult{}, false
+		}
+		res := types.GuardrailResult{
+			Allowed:  false,
+			Reason:   "keyword_block",
+			Signals:  []string{m.Term},
+			Findings: spanFindings("keyword", types.CategoryKeyword, text, m.Spans, 1, ""),
+		}
+		if m.Via != "" {
+			res.Signals = append(res.Signals, "keyword_match:"+m.Via)
 		}
+		return res, true
+	}); hit {
+		return res
 	}
 	// Note: We no longer call policy.EvaluatePrompt here because aggregation happens upstream (server)
 	return types.GuardrailResult{Allowed: true}
 }
 
-// FilterOutput applies DLP with built-in and custom terms.
+// FilterOutput applies DLP with built-in and custom terms, then LLM moderation.
 func (f *Firewall) FilterOutput(tenantID, output string, extraTerms []string) types.GuardrailResult {
+	if res := f.DetectOutputDLP(tenantID, output, extraTerms); !res.Allowed {
+		return res
+	}
+	res, _ := f.ModerateOutput(output)
+	return res
+}
+
+// DetectOutputDLP applies regex/dictionary DLP with the tenant's custom terms plus extraTerms.
+func (f *Firewall) DetectOutputDLP(tenantID, output string, extraTerms []string) types.GuardrailResult {
+	return f.DetectOutputDLPTerms(tenantID, output, f.DLPTerms(tenantID, extraTerms))
+}
+
+// DLPTerms compiles the tenant's custom terms plus extraTerms with the built-in dictionary.
+func (f *Firewall) DLPTerms(tenantID string, extraTerms []string) *policy.TermSet {
 	custom := f.policy.CustomTerms(tenantID)
 	// Merge extra terms
 	if len(extraTerms) > 0 {
 		custom = append(custom, extraTerms...)
 	}
-	dlp := policy.DetectDLP(output, custom)
-	if dlp.Hit {
-		return types.GuardrailResult{Allowed: false, Reason: dlp.Reason, Signals: dlp.Matches}
+	return policy.NewTermSet(custom)
+}
+
+// DetectOutputDLPTerms is DetectOutputDLP with a precompiled term set, see DLPTerms.
+func (f *Firewall) DetectOutputDLPTerms(tenantID, output string, terms *policy.TermSet) types.GuardrailResult {
+	recs := f.Recognizers(tenantID)
+	res, _ := detectVariants(normalize.Variants(output), func(text string) (types.GuardrailResult, bool) {
+		dlp := policy.DetectDLPTerms(text, terms, recs)
+		return types.GuardrailResult{Allowed: false, Reason: dlp.Reason, Signals: dlp.Matches,
+			Findings: policy.DLPFindings("dlp", text, dlp.Spans)}, dlp.Hit
+	})
+	return res
+}
+
+// ScoreInjection scores text and its normalized variants without deciding,
+// returning the score with the tenant's threshold.
+func (f *Firewall) ScoreInjection(tenantID, text string) (injection.Result, float64) {
+	return injection.ScoreVariants(text), f.injection.Threshold(tenantID)
+}
+
+// DetectInjection scores text with the injection heuristics against the
+// tenant's threshold. Signals name the contributing heuristics plus the score.
+func (f *Firewall) DetectInjection(tenantID, text string) (types.GuardrailResult, bool) {
+	score, hit := f.injection.Detect(tenantID, text)
+	if !hit {
+		return types.GuardrailResult{Allowed: true}, false
+	}
+	res := types.GuardrailResult{
+		Allowed: false,
+		Reason:  "prompt_injection_detected",
+		Signals: append(score.Names(), score.ScoreSignal()),
+	}
+	if score.Transform != "" {
+		res.Signals = append(res.Signals, normalize.Signal(score.Transform))
 	}
-	if f.llm != nil {
-		res := f.llm.Check(output)
-		if !res.Allowed {
-			return res
+	for _, sig := range score.Signals {
+		res.Findings = append(res.Findings, types.NewFinding("injection", types.CategoryInjection, text, sig.Start, sig.End, sig.Weight, sig.Name))
+	}
+	return res, true
+}
+
+// DetectSecrets runs the tenant's secret recognizers over text and its
+// normalized variants. Signals name the recognizers; the secrets themselves
+// are never echoed.
+func (f *Firewall) DetectSecrets(tenantID, text string) (types.GuardrailResult, bool) {
+	return f.detectSecrets(tenantID, normalize.Variants(text))
+}
+
+func (f *Firewall) detectSecrets(tenantID string, variants []normalize.Variant) (types.GuardrailResult, bool) {
+	var recs []*policy.Recognizer
+	for _, r := range f.Recognizers(tenantID) {
+		if r.Category == types.CategorySecret {
+			recs = append(recs, r)
 		}
-		if res.Reason == "llm_pending" && f.mode == "mark" {
-			return types.GuardrailResult{Allowed: true, Reason: "llm_pending", Signals: res.Signals}
+	}
+	return detectVariants(variants, func(text string) (types.GuardrailResult, bool) {
+		return secretResult(text, recs)
+	})
+}
+
+func secretResult(text string, recs []*policy.Recognizer) (types.GuardrailResult, bool) {
+	spans := policy.FindRecognizerSpans(text, recs)
+	if len(spans) == 0 {
+		return types.GuardrailResult{Allowed: true}, false
+	}
+	res := types.GuardrailResult{Allowed: false, Reason: "secret_detected", Findings: policy.DLPFindings("secrets", text, spans)}
+	seen := map[string]bool{}
+	for _, sp := range spans {
+		if !seen[sp.Rule] {
+			seen[sp.Rule] = true
+			res.Signals = append(res.Signals, sp.Rule)
 		}
-		if f.mode == "block" && res.Reason == "llm_pending" {
-			return types.GuardrailResult{Allowed: false, Reason: "llm_pending"}
+	}
+	return res, true
+}
+
+// Recognizers returns the PII recognizers selected by the tenant's output filters.
+func (f *Firewall) Recognizers(tenantID string) []*policy.Recognizer {
+	if f.recognizers != nil {
+		return f.recognizers(tenantID)
+	}
+	return policy.SelectRecognizers(f.policy.OutputFilters(tenantID))
+}
+
+// detectVariants runs detect over each variant, the input first, and returns the
+// first hit with finding offsets mapped back to the input and, for a
+// normalized variant, a "normalized:<transform>" signal.
+func detectVariants(variants []normalize.Variant, detect func(text string) (types.GuardrailResult, bool)) (types.GuardrailResult, bool) {
+	for _, v := range variants {
+		res, hit := detect(v.Text)
+		if !hit {
+			continue
 		}
+		if v.Transform != "" {
+			for i, fd := range res.Findings {
+				res.Findings[i].Start, res.Findings[i].End = v.Span(fd.Start, fd.End)
+			}
+			res.Signals = append(res.Signals, v.Signal())
+		}
+		return res, true
 	}
-	return types.GuardrailResult{Allowed: true}
+	return types.GuardrailResult{Allowed: true}, false
+}
+
+// spanFindings reports spans of text as findings of one detector and category.
+func spanFindings(detector, category, text string, spans []policy.DLPSpan, confidence float64, ruleID string) []types.Finding {
+	out := make([]types.Finding, 0, len(spans))
+	for _, sp := range spans {
+		out = append(out, types.NewFinding(detector, category, text, sp.Start, sp.End, confidence, ruleID))
+	}
+	return out
+}
+
+// HasLLM reports whether an LLM moderation detector is attached.
+func (f *Firewall) HasLLM() bool { return f.llm != nil }
+
+// ModerateOutput runs LLM moderation in the configured block/mark mode.
+// The error is non-nil when the moderation backend is degraded.
+func (f *Firewall) ModerateOutput(output string) (types.GuardrailResult, error) {
+	if f.llm == nil {
+		return types.GuardrailResult{Allowed: true}, nil
+	}
+	res, err := f.llm.Evaluate(output)
+	if !res.Allowed {
+		return res, nil
+	}
+	if res.Reason == "llm_pending" && f.mode == "mark" {
+		return types.GuardrailResult{Allowed: true, Reason: "llm_pending", Signals: res.Signals}, err
+	}
+	if f.mode == "block" && res.Reason == "llm_pending" {
+		return types.GuardrailResult{Allowed: false, Reason: "llm_pending"}, err
+	}
+	return types.GuardrailResult{Allowed: true}, err
 }
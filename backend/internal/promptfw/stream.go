@@ -0,0 +1,227 @@
+package promptfw
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"aiguardrails/internal/policy"
+	"aiguardrails/internal/types"
+)
+
+// StreamMode selects how a StreamFilter reacts to a DLP hit.
+type StreamMode string
+
+const (
+	StreamBlock  StreamMode = "block"  // cut the stream before the first hit
+	StreamRedact StreamMode = "redact" // mask hits and keep streaming
+)
+
+// RedactedMarker replaces masked spans in redact mode.
+const RedactedMarker = policy.RedactMask
+
+// ParseStreamMode maps a config/query value to a StreamMode, defaulting to block.
+func ParseStreamMode(v string) StreamMode {
+	if strings.EqualFold(v, string(StreamRedact)) {
+		return StreamRedact
+	}
+	return StreamBlock
+}
+
+// StreamFilter applies output DLP to a token stream. It holds back the tail of the
+// text so that a match split across chunk boundaries is seen whole before any of it
+// is emitted.
+type StreamFilter struct {
+	terms    *policy.TermSet
+	recs     []*policy.Recognizer
+	mode     StreamMode
+	holdBack int
+	pending  string
+	base     int         // offset of pending[0] in the unmasked stream
+	shifts   []maskShift // masks inside pending, sorted by position
+	signals  []string
+	findings []types.Finding
+	seen     map[string]bool
+	blocked  bool
+	done     bool
+}
+
+// maskShift records a mask ending at pending offset at that is delta bytes
+// shorter than the text it replaced.
+type maskShift struct {
+	at    int
+	delta int
+}
+
+// NewStreamFilter builds a StreamFilter using the tenant's custom terms plus extraTerms.
+func (f *Firewall) NewStreamFilter(tenantID string, extraTerms []string, mode StreamMode) *StreamFilter {
+	return f.NewStreamFilterTerms(tenantID, f.DLPTerms(tenantID, extraTerms), mode)
+}
+
+// NewStreamFilterTerms is NewStreamFilter with a precompiled term set, see DLPTerms.
+func (f *Firewall) NewStreamFilterTerms(tenantID string, terms *policy.TermSet, mode StreamMode) *StreamFilter {
+	holdBack := terms.MaxLen()
+	if holdBack < policy.MaxRegexMatchLen {
+		holdBack = policy.MaxRegexMatchLen
+	}
+	return &StreamFilter{
+		terms:    terms,
+		recs:     f.Recognizers(tenantID),
+		mode:     mode,
+		holdBack: holdBack,
+		seen:     map[string]bool{},
+	}
+}
+
+// Write consumes a chunk and returns the text that is safe to emit now.
+// stop is true once the stream must be cut; later writes return nothing.
+func (s *StreamFilter) Write(chunk string) (emit string, stop bool) {
+	if s.done {
+		return "", s.blocked
+	}
+	s.pending += chunk
+	return s.flush(false)
+}
+
+// Close emits the remaining held-back text and returns the final decision.
+func (s *StreamFilter) Close() (string, types.GuardrailResult) {
+	emit := ""
+	if !s.done {
+		emit, _ = s.flush(true)
+		s.done = true
+	}
+	return emit, s.Result()
+}
+
+// Result reports the decision so far. Finding offsets refer to the stream as
+// written, before any masking.
+func (s *StreamFilter) Result() types.GuardrailResult {
+	switch {
+	case s.blocked:
+		return types.GuardrailResult{Allowed: false, Reason: "dlp_match", Signals: s.signals, Findings: s.findings}
+	case len(s.signals) > 0:
+		return types.GuardrailResult{Allowed: true, Reason: "dlp_redacted", Signals: s.signals, Findings: s.findings}
+	default:
+		return types.GuardrailResult{Allowed: true}
+	}
+}
+
+// flush scans the pending text and releases everything that can no longer be part
+// of an unseen match. When final is set, all pending text is released.
+func (s *StreamFilter) flush(final bool) (string, bool) {
+	spans := policy.FindDLPSpansTerms(s.pending, s.terms, s.recs)
+	complete := spans[:0:0]
+	for _, sp := range spans {
+		// A match touching the end may still grow (e.g. a longer card number).
+		if !final && sp.End == len(s.pending) {
+			continue
+		}
+		complete = append(complete, sp)
+	}
+
+	if len(complete) > 0 {
+		for _, sp := range complete {
+			s.record(sp.Signal())
+			f := sp.Finding("dlp", s.pending)
+			f.Start, f.End = s.streamOffset(sp.Start), s.streamOffset(sp.End)
+			s.findings = append(s.findings, f)
+		}
+		if s.mode == StreamBlock {
+			emit := s.pending[:complete[0].Start]
+			s.pending = ""
+			s.blocked = true
+			s.done = true
+			return emit, true
+		}
+		s.pending, s.shifts = redactSpans(s.pending, complete, s.shifts)
+		spans = policy.FindDLPSpansTerms(s.pending, s.terms, s.recs)
+	}
+
+	if final {
+		emit := s.pending
+		s.pending = ""
+		return emit, false
+	}
+
+	cut := len(s.pending) - (s.holdBack - 1)
+	for _, sp := range spans {
+		if sp.Start < cut {
+			cut = sp.Start
+		}
+	}
+	if cut <= 0 {
+		return "", false
+	}
+	for cut > 0 && !utf8.RuneStart(s.pending[cut]) {
+		cut--
+	}
+	emit := s.pending[:cut]
+	s.pending = s.pending[cut:]
+	s.base = s.streamOffset(cut)
+	kept := s.shifts[:0]
+	for _, m := range s.shifts {
+		if m.at > cut {
+			m.at -= cut
+			kept = append(kept, m)
+		}
+	}
+	s.shifts = kept
+	return emit, false
+}
+
+// streamOffset maps an offset in pending to the unmasked stream.
+func (s *StreamFilter) streamOffset(p int) int {
+	off := s.base + p
+	for _, m := range s.shifts {
+		if m.at > p {
+			break
+		}
+		off += m.delta
+	}
+	return off
+}
+
+func (s *StreamFilter) record(match string) {
+	key := strings.ToLower(match)
+	if s.seen[key] {
+		return
+	}
+	s.seen[key] = true
+	s.signals = append(s.signals, match)
+}
+
+// redactSpans masks spans (sorted by start) in text, merging overlaps. It
+// returns the masked text and shifts updated to its offsets.
+func redactSpans(text string, spans []policy.DLPSpan, shifts []maskShift) (string, []maskShift) {
+	var b strings.Builder
+	var out []maskShift
+	pos, next := 0, 0
+	// keep carries over earlier masks that end at or before upto.
+	keep := func(upto int) {
+		for ; next < len(shifts) && shifts[next].at <= upto; next++ {
+			m := shifts[next]
+			m.at = b.Len() + m.at - pos
+			out = append(out, m)
+		}
+	}
+	for _, sp := range spans {
+		if sp.End <= pos {
+			continue
+		}
+		if sp.Start >= pos {
+			keep(sp.Start)
+			b.WriteString(text[pos:sp.Start])
+			b.WriteString(RedactedMarker)
+			out = append(out, maskShift{at: b.Len(), delta: sp.End - sp.Start - len(RedactedMarker)})
+		} else {
+			out[len(out)-1].delta += sp.End - pos
+		}
+		// Earlier masks swallowed by this one still count toward its width.
+		for ; next < len(shifts) && shifts[next].at <= sp.End; next++ {
+			out[len(out)-1].delta += shifts[next].delta
+		}
+		pos = sp.End
+	}
+	keep(len(text))
+	b.WriteString(text[pos:])
+	return b.String(), out
+}
@@ -0,0 +1,92 @@
+package promptfw
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"aiguardrails/internal/policy"
+	"aiguardrails/internal/types"
+)
+
+func runStream(f *StreamFilter, chunks []string) (string, bool) {
+	var out strings.Builder
+	for _, c := range chunks {
+		emit, stop := f.Write(c)
+		out.WriteString(emit)
+		if stop {
+			break
+		}
+	}
+	tail, res := f.Close()
+	out.WriteString(tail)
+	return out.String(), res.Allowed
+}
+
+func TestStreamFilterRedactsSplitMatch(t *testing.T) {
+	fw := NewFirewall(policy.NewMemoryEngine())
+	f := fw.NewStreamFilter("t1", []string{"project falcon"}, StreamRedact)
+	out, allowed := runStream(f, []string{"the admin pass", "word is hunt", "er2xyz; see proj", "ect fal", "con for details"})
+	if !allowed {
+		t.Fatalf("redact mode should keep the stream allowed")
+	}
+	if strings.Contains(out, "hunter2") || strings.Contains(out, "falcon") {
+		t.Fatalf("split match leaked: %q", out)
+	}
+	if !strings.Contains(out, "the admin password is "+RedactedMarker) || !strings.HasSuffix(out, " for details") {
+		t.Fatalf("unexpected redacted output: %q", out)
+	}
+	if res := f.Result(); res.Reason != "dlp_redacted" || len(res.Signals) != 2 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+}
+
+func TestStreamFilterFindingsUseStreamOffsets(t *testing.T) {
+	fw := NewFirewall(policy.NewMemoryEngine())
+	f := fw.NewStreamFilter("t1", []string{"project falcon"}, StreamRedact)
+	chunks := []string{"the admin pass", "word is hunt", "er2xyz; see proj", "ect fal", "con, then token=s3cr3t-again"}
+	runStream(f, chunks)
+	text := strings.Join(chunks, "")
+
+	res := f.Result()
+	if len(res.Findings) != 3 {
+		t.Fatalf("expected one finding per occurrence: %+v", res.Findings)
+	}
+	categories := map[string]int{}
+	for _, fd := range res.Findings {
+		sum := sha256.Sum256([]byte(text[fd.Start:fd.End]))
+		if fd.Detector != "dlp" || fd.Hash != hex.EncodeToString(sum[:]) {
+			t.Fatalf("finding does not point at the unmasked stream: %+v (%q)", fd, text[fd.Start:fd.End])
+		}
+		categories[fd.Category]++
+	}
+	if categories[types.CategorySecret] != 2 || categories[types.CategoryConfidential] != 1 {
+		t.Fatalf("unexpected categories: %v", categories)
+	}
+}
+
+func TestStreamFilterBlocksSplitCardNumber(t *testing.T) {
+	fw := NewFirewall(policy.NewMemoryEngine())
+	f := fw.NewStreamFilter("t1", nil, StreamBlock)
+	out, allowed := runStream(f, []string{"your card is 4111 ", "and the number 41111111", "11111111 ok", " more text"})
+	if allowed {
+		t.Fatalf("expected block")
+	}
+	if strings.Contains(out, "4111111") || strings.Contains(out, "more text") {
+		t.Fatalf("blocked content leaked: %q", out)
+	}
+	if !strings.HasPrefix(out, "your card is 4111 and the number ") {
+		t.Fatalf("safe prefix should be released: %q", out)
+	}
+}
+
+func TestStreamFilterPassesCleanText(t *testing.T) {
+	fw := NewFirewall(policy.NewMemoryEngine())
+	f := fw.NewStreamFilter("t1", nil, StreamBlock)
+	chunks := []string{"Hello ", "世界, ", "this reply ", "is perfectly fine."}
+	out, allowed := runStream(f, chunks)
+	if !allowed || out != strings.Join(chunks, "") {
+		t.Fatalf("clean stream altered: %q allowed=%v", out, allowed)
+	}
+}
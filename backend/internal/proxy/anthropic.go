@@ -0,0 +1,304 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"aiguardrails/internal/types"
+)
+
+// anthropicVersion is sent upstream when the client did not pick one.
+const anthropicVersion = "2023-06-01"
+
+// Anthropic is the /v1/messages protocol.
+var Anthropic Protocol = anthropicProtocol{}
+
+type anthropicProtocol struct{}
+
+func (anthropicProtocol) Name() string         { return ProtocolAnthropic }
+func (anthropicProtocol) UpstreamPath() string { return "/v1/messages" }
+
+func (anthropicProtocol) SetHeaders(out, in http.Header, apiKey string) {
+	if apiKey != "" {
+		out.Set("X-Api-Key", apiKey)
+	}
+	version := in.Get("Anthropic-Version")
+	if version == "" {
+		version = anthropicVersion
+	}
+	out.Set("Anthropic-Version", version)
+	if beta := in.Get("Anthropic-Beta"); beta != "" {
+		out.Set("Anthropic-Beta", beta)
+	}
+}
+
+func (anthropicProtocol) DecodeRequest(body []byte) (Request, error) {
+	var req anthropicRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(body, &req.raw); err != nil {
+		return nil, err
+	}
+	if len(req.Messages) == 0 {
+		return nil, ErrNoMessages
+	}
+	return &req, nil
+}
+
+func (anthropicProtocol) DecodeResponse(body []byte) (Response, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+	return &anthropicMessage{raw: raw}, nil
+}
+
+func (anthropicProtocol) NewStream(upstream io.Reader, w http.ResponseWriter) (StreamCodec, error) {
+	sse, err := NewSSEWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	return &anthropicStream{r: NewSSEReader(upstream), w: sse}, nil
+}
+
+func (anthropicProtocol) Error(errType, message string) interface{} {
+	return anthropicError{Type: "error", Error: anthropicErrorDetail{Type: errType, Message: message}}
+}
+
+func (anthropicProtocol) GuardrailError(res types.GuardrailResult) interface{} {
+	return anthropicError{Type: "error", Error: anthropicErrorDetail{
+		Type:      "guardrail_violation",
+		Message:   guardrailMessage(res),
+		Guardrail: &res,
+	}}
+}
+
+type anthropicError struct {
+	Type  string               `json:"type"`
+	Error anthropicErrorDetail `json:"error"`
+}
+
+type anthropicErrorDetail struct {
+	Type      string                 `json:"type"`
+	Message   string                 `json:"message"`
+	Guardrail *types.GuardrailResult `json:"guardrail,omitempty"`
+}
+
+// anthropicBlock is one content block of a message.
+type anthropicBlock struct {
+	Type    string          `json:"type"`
+	Text    string          `json:"text,omitempty"`
+	Name    string          `json:"name,omitempty"`
+	Input   json.RawMessage `json:"input,omitempty"`
+	Content json.RawMessage `json:"content,omitempty"` // tool_result: string or blocks
+}
+
+func (b anthropicBlock) text() string {
+	switch b.Type {
+	case "text":
+		return b.Text
+	case "tool_use":
+		return strings.TrimSpace(b.Name + " " + string(b.Input))
+	case "tool_result":
+		return anthropicContentText(b.Content)
+	}
+	return ""
+}
+
+// anthropicContentText flattens string or block content into plain text.
+func anthropicContentText(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	var blocks []anthropicBlock
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return ""
+	}
+	texts := make([]string, 0, len(blocks))
+	for _, b := range blocks {
+		if t := b.text(); t != "" {
+			texts = append(texts, t)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+type anthropicRequest struct {
+	Model    string          `json:"model"`
+	System   json.RawMessage `json:"system,omitempty"`
+	Messages []struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	} `json:"messages"`
+	Stream bool `json:"stream,omitempty"`
+	raw    map[string]json.RawMessage
+}
+
+func (r *anthropicRequest) PromptText() string {
+	texts := make([]string, 0, len(r.Messages)+1)
+	if t := anthropicContentText(r.System); t != "" {
+		texts = append(texts, t)
+	}
+	for _, m := range r.Messages {
+		if t := anthropicContentText(m.Content); t != "" {
+			texts = append(texts, t)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+func (r *anthropicRequest) Streaming() bool { return r.Stream }
+
+func (r *anthropicRequest) RewriteText(fn func(string) string) error {
+	if err := rewriteRawContent(r.raw, "system", fn); err != nil {
+		return err
+	}
+	return rewriteRawMessages(r.raw, fn)
+}
+
+func (r *anthropicRequest) Encode(modelOverride string) ([]byte, error) {
+	return encodeRaw(r.raw, modelOverride)
+}
+
+// anthropicMessage is a non-streaming reply: a single choice made of content blocks.
+type anthropicMessage struct {
+	raw map[string]interface{}
+}
+
+func (m *anthropicMessage) Texts() []string {
+	data, _ := json.Marshal(m.raw["content"])
+	return []string{anthropicContentText(data)}
+}
+
+func (m *anthropicMessage) Refuse(i int, res types.GuardrailResult) {
+	m.raw["content"] = []interface{}{map[string]interface{}{"type": "text", "text": RefusalText(res)}}
+	m.raw["stop_reason"] = "refusal"
+}
+
+func (m *anthropicMessage) Redact(i int, text string) bool {
+	blocks, _ := m.raw["content"].([]interface{})
+	for _, b := range blocks {
+		if block, _ := b.(map[string]interface{}); block["type"] != "text" {
+			return false
+		}
+	}
+	m.raw["content"] = []interface{}{map[string]interface{}{"type": "text", "text": text}}
+	return true
+}
+
+func (m *anthropicMessage) RewriteText(fn func(string) string) {
+	if content, ok := m.raw["content"]; ok {
+		m.raw["content"] = rewriteContent(content, fn)
+	}
+}
+
+func (m *anthropicMessage) Encode() ([]byte, error) {
+	return json.Marshal(m.raw)
+}
+
+// anthropicEvent is one named SSE event of a streamed message.
+type anthropicEvent struct {
+	name    string
+	raw     map[string]interface{}
+	dropped bool
+}
+
+func (e *anthropicEvent) index() int {
+	idx, _ := e.raw["index"].(float64)
+	return int(idx)
+}
+
+// Deltas exposes text_delta content and the end of each content block.
+// Tool-use input deltas are relayed without filtering.
+func (e *anthropicEvent) Deltas() []StreamDelta {
+	switch e.name {
+	case "content_block_delta":
+		delta, _ := e.raw["delta"].(map[string]interface{})
+		if delta["type"] != "text_delta" {
+			return nil
+		}
+		text, _ := delta["text"].(string)
+		return []StreamDelta{{Channel: e.index(), Text: text, HasText: true}}
+	case "content_block_stop":
+		return []StreamDelta{{Channel: e.index(), End: true}}
+	}
+	return nil
+}
+
+func (e *anthropicEvent) SetText(pos int, text string) {
+	if delta, ok := e.raw["delta"].(map[string]interface{}); ok {
+		delta["text"] = text
+	}
+}
+
+func (e *anthropicEvent) Drop(pos int) { e.dropped = true }
+
+// anthropicStream relays message stream events.
+type anthropicStream struct {
+	r *SSEReader
+	w *SSEWriter
+}
+
+func (s *anthropicStream) Next() (StreamEvent, error) {
+	for {
+		ev, err := s.r.Next()
+		if err != nil {
+			return nil, err
+		}
+		var raw map[string]interface{}
+		if err := json.Unmarshal([]byte(ev.Data), &raw); err != nil {
+			continue
+		}
+		name := ev.Event
+		if name == "" {
+			name, _ = raw["type"].(string)
+		}
+		if name == "message_stop" {
+			return nil, io.EOF
+		}
+		return &anthropicEvent{name: name, raw: raw}, nil
+	}
+}
+
+func (s *anthropicStream) Write(ev StreamEvent) error {
+	e := ev.(*anthropicEvent)
+	if e.dropped {
+		return nil
+	}
+	return s.w.JSON(e.name, e.raw)
+}
+
+func (s *anthropicStream) Text(channel int, text string) error {
+	return s.w.JSON("content_block_delta", map[string]interface{}{
+		"type":  "content_block_delta",
+		"index": channel,
+		"delta": map[string]interface{}{"type": "text_delta", "text": text},
+	})
+}
+
+// Block closes the content block and ends the message with stop_reason "refusal".
+func (s *anthropicStream) Block(channel int, res types.GuardrailResult) (bool, error) {
+	if err := s.w.JSON("content_block_stop", map[string]interface{}{"type": "content_block_stop", "index": channel}); err != nil {
+		return true, err
+	}
+	return true, s.w.JSON("message_delta", map[string]interface{}{
+		"type":  "message_delta",
+		"delta": map[string]interface{}{"stop_reason": "refusal", "stop_sequence": nil},
+		"usage": map[string]interface{}{"output_tokens": 0},
+	})
+}
+
+// Finish sends the result as a "guardrail" event, which Anthropic SDKs ignore, then message_stop.
+func (s *anthropicStream) Finish(res types.GuardrailResult) error {
+	if err := s.w.JSON("guardrail", res); err != nil {
+		return err
+	}
+	return s.w.JSON("message_stop", map[string]string{"type": "message_stop"})
+}
@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateUpstream is returned when a tenant upstream dials a private address.
+var ErrPrivateUpstream = errors.New("upstream address is private")
+
+// Client forwards requests to upstream LLM endpoints. Redirects are not
+// followed: the request carries the upstream's API key.
+type Client struct {
+	http           *http.Client // env default upstreams, configured by the operator
+	tenant         *http.Client // tenant upstreams: private addresses refused when dialing
+	defaultTimeout time.Duration
+}
+
+// NewClient constructs a Client; defaultTimeout applies when the upstream has none,
+// headerTimeout bounds the wait for response headers (a non-streamed reply only
+// sends them once generated). allowPrivate lets tenant upstreams dial loopback
+// and private addresses.
+func NewClient(defaultTimeout, headerTimeout time.Duration, allowPrivate bool) *Client {
+	c := &Client{
+		http:           newHTTPClient(headerTimeout, nil),
+		defaultTimeout: defaultTimeout,
+	}
+	if allowPrivate {
+		c.tenant = c.http
+	} else {
+		c.tenant = newHTTPClient(headerTimeout, denyPrivate)
+	}
+	return c
+}
+
+func newHTTPClient(headerTimeout time.Duration, control func(network, address string, c syscall.RawConn) error) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second, Control: control}
+	return &http.Client{
+		Transport: &http.Transport{
+			// No proxy: the dial check must see the address actually dialed.
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: headerTimeout,
+			IdleConnTimeout:       90 * time.Second,
+			MaxIdleConnsPerHost:   16,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return fmt.Errorf("upstream redirect to %s refused", req.URL.Redacted())
+		},
+	}
+}
+
+// denyPrivate refuses connections to the addresses ValidateBaseURL rejects,
+// so a name that later resolves to one (DNS rebinding) is caught too.
+func denyPrivate(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || privateAddr(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateUpstream, host)
+	}
+	return nil
+}
+
+// Forward POSTs body to the upstream base URL + the protocol's path. inbound holds the
+// client's headers, from which the protocol may copy version headers. A stored
+// (tenant) upstream is dialed through the private-address check.
+// The returned cancel func must be called once the response body is consumed.
+func (c *Client) Forward(ctx context.Context, up Upstream, p Protocol, body []byte, inbound http.Header) (*http.Response, context.CancelFunc, error) {
+	timeout := c.defaultTimeout
+	if up.TimeoutSec > 0 {
+		timeout = time.Duration(up.TimeoutSec) * time.Second
+	}
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	url := strings.TrimRight(up.BaseURL, "/") + p.UpstreamPath()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	p.SetHeaders(req.Header, inbound, up.APIKey)
+	client := c.http
+	if up.ID != "" {
+		client = c.tenant
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return resp, cancel, nil
+}
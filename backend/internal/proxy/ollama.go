@@ -0,0 +1,268 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"aiguardrails/internal/types"
+)
+
+// Ollama is the /api/chat protocol. It streams NDJSON and streams by default.
+var Ollama Protocol = ollamaProtocol{}
+
+type ollamaProtocol struct{}
+
+func (ollamaProtocol) Name() string         { return ProtocolOllama }
+func (ollamaProtocol) UpstreamPath() string { return "/api/chat" }
+
+func (ollamaProtocol) SetHeaders(out, in http.Header, apiKey string) {
+	if apiKey != "" {
+		out.Set("Authorization", "Bearer "+apiKey)
+	}
+}
+
+func (ollamaProtocol) DecodeRequest(body []byte) (Request, error) {
+	var req ollamaRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(body, &req.raw); err != nil {
+		return nil, err
+	}
+	if len(req.Messages) == 0 {
+		return nil, ErrNoMessages
+	}
+	return &req, nil
+}
+
+func (ollamaProtocol) DecodeResponse(body []byte) (Response, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+	return &ollamaReply{raw: raw}, nil
+}
+
+func (ollamaProtocol) NewStream(upstream io.Reader, w http.ResponseWriter) (StreamCodec, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, ErrStreamingUnsupported
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	sc := bufio.NewScanner(upstream)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	return &ollamaStream{sc: sc, w: w, flusher: flusher}, nil
+}
+
+func (ollamaProtocol) Error(errType, message string) interface{} {
+	return ollamaError{Error: message}
+}
+
+func (ollamaProtocol) GuardrailError(res types.GuardrailResult) interface{} {
+	return ollamaError{Error: guardrailMessage(res), Guardrail: &res}
+}
+
+type ollamaError struct {
+	Error     string                 `json:"error"`
+	Guardrail *types.GuardrailResult `json:"guardrail,omitempty"`
+}
+
+type ollamaMessage struct {
+	Role      string `json:"role"`
+	Content   string `json:"content"`
+	ToolCalls []struct {
+		Function struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		} `json:"function"`
+	} `json:"tool_calls,omitempty"`
+}
+
+func (m ollamaMessage) text() string {
+	texts := []string{}
+	if m.Content != "" {
+		texts = append(texts, m.Content)
+	}
+	for _, c := range m.ToolCalls {
+		texts = append(texts, strings.TrimSpace(c.Function.Name+" "+string(c.Function.Arguments)))
+	}
+	return strings.Join(texts, "\n")
+}
+
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Stream   *bool           `json:"stream,omitempty"`
+	raw      map[string]json.RawMessage
+}
+
+func (r *ollamaRequest) PromptText() string {
+	texts := make([]string, 0, len(r.Messages))
+	for _, m := range r.Messages {
+		if t := m.text(); t != "" {
+			texts = append(texts, t)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// Streaming is true unless the client sent "stream": false.
+func (r *ollamaRequest) Streaming() bool { return r.Stream == nil || *r.Stream }
+
+func (r *ollamaRequest) RewriteText(fn func(string) string) error {
+	return rewriteRawMessages(r.raw, fn)
+}
+
+func (r *ollamaRequest) Encode(modelOverride string) ([]byte, error) {
+	return encodeRaw(r.raw, modelOverride)
+}
+
+// ollamaReply is a non-streaming /api/chat reply.
+type ollamaReply struct {
+	raw map[string]interface{}
+}
+
+func (m *ollamaReply) Texts() []string {
+	data, _ := json.Marshal(m.raw["message"])
+	var msg ollamaMessage
+	_ = json.Unmarshal(data, &msg)
+	return []string{msg.text()}
+}
+
+func (m *ollamaReply) Refuse(i int, res types.GuardrailResult) {
+	m.raw["message"] = map[string]interface{}{"role": "assistant", "content": RefusalText(res)}
+	m.raw["done_reason"] = "content_filter"
+}
+
+func (m *ollamaReply) Redact(i int, text string) bool {
+	msg, _ := m.raw["message"].(map[string]interface{})
+	if msg == nil {
+		return false
+	}
+	if _, ok := msg["tool_calls"]; ok {
+		return false
+	}
+	msg["content"] = text
+	return true
+}
+
+func (m *ollamaReply) RewriteText(fn func(string) string) {
+	if msg, ok := m.raw["message"].(map[string]interface{}); ok {
+		if content, ok := msg["content"].(string); ok {
+			msg["content"] = fn(content)
+		}
+	}
+}
+
+func (m *ollamaReply) Encode() ([]byte, error) {
+	return json.Marshal(m.raw)
+}
+
+// ollamaLine is one NDJSON line of a streamed reply.
+type ollamaLine struct {
+	raw     map[string]interface{}
+	dropped bool
+}
+
+func (l *ollamaLine) Deltas() []StreamDelta {
+	done, _ := l.raw["done"].(bool)
+	msg, _ := l.raw["message"].(map[string]interface{})
+	text, ok := msg["content"].(string)
+	return []StreamDelta{{Channel: 0, Text: text, HasText: ok, End: done}}
+}
+
+func (l *ollamaLine) SetText(pos int, text string) {
+	msg, _ := l.raw["message"].(map[string]interface{})
+	if msg == nil {
+		msg = map[string]interface{}{"role": "assistant"}
+		l.raw["message"] = msg
+	}
+	msg["content"] = text
+}
+
+func (l *ollamaLine) Drop(pos int) { l.dropped = true }
+
+// ollamaStream relays NDJSON lines. The final done line is held back so the
+// guardrail result can be attached to it.
+type ollamaStream struct {
+	sc      *bufio.Scanner
+	w       io.Writer
+	flusher http.Flusher
+	model   interface{}
+	done    *ollamaLine
+}
+
+func (s *ollamaStream) Next() (StreamEvent, error) {
+	if s.done != nil {
+		return nil, io.EOF
+	}
+	for s.sc.Scan() {
+		var raw map[string]interface{}
+		if err := json.Unmarshal(s.sc.Bytes(), &raw); err != nil {
+			continue
+		}
+		s.model = raw["model"]
+		return &ollamaLine{raw: raw}, nil
+	}
+	if err := s.sc.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (s *ollamaStream) Write(ev StreamEvent) error {
+	line := ev.(*ollamaLine)
+	if line.dropped {
+		return nil
+	}
+	if done, _ := line.raw["done"].(bool); done {
+		s.done = line
+		return nil
+	}
+	return s.writeLine(line.raw)
+}
+
+func (s *ollamaStream) writeLine(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := s.w.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+func (s *ollamaStream) line(text string, done bool) map[string]interface{} {
+	return map[string]interface{}{
+		"model":   s.model,
+		"message": map[string]interface{}{"role": "assistant", "content": text},
+		"done":    done,
+	}
+}
+
+func (s *ollamaStream) Text(channel int, text string) error {
+	return s.writeLine(s.line(text, false))
+}
+
+// Block ends the reply with done_reason "content_filter".
+func (s *ollamaStream) Block(channel int, res types.GuardrailResult) (bool, error) {
+	raw := s.line("", true)
+	raw["done_reason"] = "content_filter"
+	s.done = &ollamaLine{raw: raw}
+	return true, nil
+}
+
+// Finish writes the done line with a "guardrail" field.
+func (s *ollamaStream) Finish(res types.GuardrailResult) error {
+	if s.done == nil {
+		s.done = &ollamaLine{raw: s.line("", true)}
+	}
+	s.done.raw["guardrail"] = res
+	return s.writeLine(s.done.raw)
+}
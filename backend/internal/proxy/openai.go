@@ -0,0 +1,510 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"aiguardrails/internal/types"
+)
+
+var ErrNoMessages = errors.New("messages required")
+
+// OpenAI is the /v1/chat/completions protocol.
+var OpenAI Protocol = openAIProtocol{}
+
+type openAIProtocol struct{}
+
+func (openAIProtocol) Name() string         { return ProtocolOpenAI }
+func (openAIProtocol) UpstreamPath() string { return "/chat/completions" }
+
+func (openAIProtocol) SetHeaders(out, in http.Header, apiKey string) {
+	if apiKey != "" {
+		out.Set("Authorization", "Bearer "+apiKey)
+	}
+}
+
+func (openAIProtocol) DecodeRequest(body []byte) (Request, error) {
+	return DecodeChatRequest(body)
+}
+
+func (openAIProtocol) DecodeResponse(body []byte) (Response, error) {
+	return DecodeChatCompletion(body)
+}
+
+func (openAIProtocol) NewStream(upstream io.Reader, w http.ResponseWriter) (StreamCodec, error) {
+	sse, err := NewSSEWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	return &openAIStream{r: NewSSEReader(upstream), w: sse}, nil
+}
+
+func (openAIProtocol) Error(errType, message string) interface{} {
+	return NewError(errType, message)
+}
+
+func (openAIProtocol) GuardrailError(res types.GuardrailResult) interface{} {
+	return GuardrailError(res)
+}
+
+// ChatMessage is one OpenAI chat message. Content is either a string or an array of parts.
+type ChatMessage struct {
+	Role      string          `json:"role"`
+	Content   json.RawMessage `json:"content,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	ToolCalls json.RawMessage `json:"tool_calls,omitempty"`
+}
+
+// Text flattens string or multi-part content into plain text.
+func (m ChatMessage) Text() string {
+	if len(m.Content) == 0 {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(m.Content, &s); err == nil {
+		return s
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(m.Content, &parts); err != nil {
+		return ""
+	}
+	texts := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p.Type == "text" && p.Text != "" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+type openAIToolCall struct {
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// toolCallsText flattens tool calls into "name arguments" lines.
+func toolCallsText(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var calls []openAIToolCall
+	if err := json.Unmarshal(raw, &calls); err != nil {
+		return ""
+	}
+	texts := make([]string, 0, len(calls))
+	for _, c := range calls {
+		texts = append(texts, strings.TrimSpace(c.Function.Name+" "+c.Function.Arguments))
+	}
+	return strings.Join(texts, "\n")
+}
+
+// ChatCompletionRequest is an OpenAI /chat/completions request.
+// Unknown fields are kept so the upstream receives the request unchanged.
+type ChatCompletionRequest struct {
+	Model    string        `json:"model"`
+	Messages []ChatMessage `json:"messages"`
+	Stream   bool          `json:"stream,omitempty"`
+	raw      map[string]json.RawMessage
+}
+
+// DecodeChatRequest parses a chat-completions body.
+func DecodeChatRequest(body []byte) (*ChatCompletionRequest, error) {
+	var req ChatCompletionRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(body, &req.raw); err != nil {
+		return nil, err
+	}
+	if len(req.Messages) == 0 {
+		return nil, ErrNoMessages
+	}
+	return &req, nil
+}
+
+// PromptText returns everything the caller sends to the model (system, user and tool turns).
+// Assistant turns are included too because clients control the whole history.
+func (r *ChatCompletionRequest) PromptText() string {
+	texts := make([]string, 0, len(r.Messages))
+	for _, m := range r.Messages {
+		if t := m.Text(); t != "" {
+			texts = append(texts, t)
+		}
+		if t := toolCallsText(m.ToolCalls); t != "" {
+			texts = append(texts, t)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// Streaming reports whether the client asked for an SSE stream.
+func (r *ChatCompletionRequest) Streaming() bool { return r.Stream }
+
+// RewriteText applies fn to the text of every message.
+func (r *ChatCompletionRequest) RewriteText(fn func(string) string) error {
+	return rewriteRawMessages(r.raw, fn)
+}
+
+// Encode re-serializes the request, replacing the model when override is set.
+func (r *ChatCompletionRequest) Encode(modelOverride string) ([]byte, error) {
+	return encodeRaw(r.raw, modelOverride)
+}
+
+// encodeRaw re-serializes a request map, replacing the model when override is set.
+func encodeRaw(raw map[string]json.RawMessage, modelOverride string) ([]byte, error) {
+	out := make(map[string]json.RawMessage, len(raw))
+	for k, v := range raw {
+		out[k] = v
+	}
+	if modelOverride != "" {
+		m, _ := json.Marshal(modelOverride)
+		out["model"] = m
+	}
+	return json.Marshal(out)
+}
+
+// ChatCompletion wraps an upstream chat-completions response so choice contents can be filtered in place.
+type ChatCompletion struct {
+	raw map[string]interface{}
+}
+
+// DecodeChatCompletion parses an upstream chat-completions response.
+func DecodeChatCompletion(body []byte) (*ChatCompletion, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+	return &ChatCompletion{raw: raw}, nil
+}
+
+func (c *ChatCompletion) choices() []interface{} {
+	choices, _ := c.raw["choices"].([]interface{})
+	return choices
+}
+
+func (c *ChatCompletion) message(i int) map[string]interface{} {
+	choices := c.choices()
+	if i < 0 || i >= len(choices) {
+		return nil
+	}
+	choice, _ := choices[i].(map[string]interface{})
+	msg, _ := choice["message"].(map[string]interface{})
+	return msg
+}
+
+// Contents returns the assistant message content of every choice, indexed like choices.
+func (c *ChatCompletion) Contents() []string {
+	out := make([]string, len(c.choices()))
+	for i := range out {
+		out[i], _ = c.message(i)["content"].(string)
+	}
+	return out
+}
+
+// Texts returns content plus tool-call arguments of every choice.
+func (c *ChatCompletion) Texts() []string {
+	out := c.Contents()
+	for i := range out {
+		calls, ok := c.message(i)["tool_calls"]
+		if !ok {
+			continue
+		}
+		raw, _ := json.Marshal(calls)
+		if t := toolCallsText(raw); t != "" {
+			out[i] = strings.TrimSpace(out[i] + "\n" + t)
+		}
+	}
+	return out
+}
+
+// Replace overwrites the content and finish reason of choice i.
+func (c *ChatCompletion) Replace(i int, content, finishReason string) {
+	choices := c.choices()
+	if i < 0 || i >= len(choices) {
+		return
+	}
+	choice, _ := choices[i].(map[string]interface{})
+	if choice == nil {
+		return
+	}
+	msg, _ := choice["message"].(map[string]interface{})
+	if msg == nil {
+		msg = map[string]interface{}{"role": "assistant"}
+		choice["message"] = msg
+	}
+	msg["content"] = content
+	delete(msg, "tool_calls")
+	if finishReason != "" {
+		choice["finish_reason"] = finishReason
+	}
+}
+
+// Refuse withholds choice i and marks it content_filter.
+func (c *ChatCompletion) Refuse(i int, res types.GuardrailResult) {
+	c.Replace(i, RefusalText(res), "content_filter")
+}
+
+// Redact replaces choice i's content; choices with tool calls are left alone.
+func (c *ChatCompletion) Redact(i int, text string) bool {
+	msg := c.message(i)
+	if msg == nil {
+		return false
+	}
+	if _, ok := msg["tool_calls"]; ok {
+		return false
+	}
+	msg["content"] = text
+	return true
+}
+
+// RewriteText applies fn to the content of every choice.
+func (c *ChatCompletion) RewriteText(fn func(string) string) {
+	for i := range c.choices() {
+		if msg := c.message(i); msg != nil {
+			if content, ok := msg["content"].(string); ok {
+				msg["content"] = fn(content)
+			}
+		}
+	}
+}
+
+// Encode serializes the (possibly rewritten) response.
+func (c *ChatCompletion) Encode() ([]byte, error) {
+	return json.Marshal(c.raw)
+}
+
+// ChatChunk wraps one chat.completion.chunk event of a streamed response.
+type ChatChunk struct {
+	raw     map[string]interface{}
+	dropped map[int]bool
+}
+
+// DecodeChatChunk parses the data of a streamed chunk event.
+func DecodeChatChunk(data []byte) (*ChatChunk, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	return &ChatChunk{raw: raw}, nil
+}
+
+// NewChatChunk builds a chunk for choice index, copying id/model/created from prev when set.
+func NewChatChunk(prev *ChatChunk, index int, content, finishReason string) *ChatChunk {
+	raw := map[string]interface{}{"object": "chat.completion.chunk"}
+	if prev != nil {
+		for _, k := range []string{"id", "created", "model", "system_fingerprint"} {
+			if v, ok := prev.raw[k]; ok {
+				raw[k] = v
+			}
+		}
+	}
+	choice := map[string]interface{}{"index": index, "delta": map[string]interface{}{}}
+	c := &ChatChunk{raw: raw}
+	raw["choices"] = []interface{}{choice}
+	if content != "" {
+		c.SetText(0, content)
+	}
+	if finishReason != "" {
+		c.SetFinishReason(0, finishReason)
+	} else {
+		choice["finish_reason"] = nil
+	}
+	return c
+}
+
+func (c *ChatChunk) choice(pos int) map[string]interface{} {
+	choices, _ := c.raw["choices"].([]interface{})
+	if pos < 0 || pos >= len(choices) {
+		return nil
+	}
+	choice, _ := choices[pos].(map[string]interface{})
+	return choice
+}
+
+// Deltas returns the delta of every choice, in the order they appear in the chunk.
+func (c *ChatChunk) Deltas() []StreamDelta {
+	choices, _ := c.raw["choices"].([]interface{})
+	out := make([]StreamDelta, len(choices))
+	for i := range choices {
+		choice := c.choice(i)
+		if idx, ok := choice["index"].(float64); ok {
+			out[i].Channel = int(idx)
+		}
+		finish, _ := choice["finish_reason"].(string)
+		out[i].End = finish != ""
+		delta, _ := choice["delta"].(map[string]interface{})
+		out[i].Text, out[i].HasText = delta["content"].(string)
+	}
+	return out
+}
+
+// SetText overwrites the delta content of the choice at position pos.
+func (c *ChatChunk) SetText(pos int, content string) {
+	choice := c.choice(pos)
+	if choice == nil {
+		return
+	}
+	delta, _ := choice["delta"].(map[string]interface{})
+	if delta == nil {
+		delta = map[string]interface{}{}
+		choice["delta"] = delta
+	}
+	delta["content"] = content
+}
+
+// SetFinishReason sets the finish reason of the choice at position pos and drops pending tool calls.
+func (c *ChatChunk) SetFinishReason(pos int, reason string) {
+	choice := c.choice(pos)
+	if choice == nil {
+		return
+	}
+	choice["finish_reason"] = reason
+	if delta, ok := choice["delta"].(map[string]interface{}); ok {
+		delete(delta, "tool_calls")
+	}
+}
+
+// Drop removes the choice at position pos from the encoded chunk.
+func (c *ChatChunk) Drop(pos int) {
+	if c.dropped == nil {
+		c.dropped = map[int]bool{}
+	}
+	c.dropped[pos] = true
+}
+
+// empty reports whether every choice of a chunk that had choices was dropped.
+func (c *ChatChunk) empty() bool {
+	choices, _ := c.raw["choices"].([]interface{})
+	return len(choices) > 0 && len(c.dropped) == len(choices)
+}
+
+// Encode serializes the chunk without dropped choices.
+func (c *ChatChunk) Encode() ([]byte, error) {
+	if len(c.dropped) == 0 {
+		return json.Marshal(c.raw)
+	}
+	choices, _ := c.raw["choices"].([]interface{})
+	kept := make([]interface{}, 0, len(choices))
+	for i, ch := range choices {
+		if !c.dropped[i] {
+			kept = append(kept, ch)
+		}
+	}
+	out := make(map[string]interface{}, len(c.raw))
+	for k, v := range c.raw {
+		out[k] = v
+	}
+	out["choices"] = kept
+	return json.Marshal(out)
+}
+
+// GuardrailChunk is the trailing chunk carrying the stream's guardrail decision.
+// It has no choices, so OpenAI clients treat it like a usage-only chunk.
+func GuardrailChunk(prev *ChatChunk, res types.GuardrailResult) ([]byte, error) {
+	raw := map[string]interface{}{"object": "chat.completion.chunk", "choices": []interface{}{}, "guardrail": res}
+	if prev != nil {
+		for _, k := range []string{"id", "created", "model"} {
+			if v, ok := prev.raw[k]; ok {
+				raw[k] = v
+			}
+		}
+	}
+	return json.Marshal(raw)
+}
+
+// openAIStream relays chat.completion.chunk SSE events.
+type openAIStream struct {
+	r    *SSEReader
+	w    *SSEWriter
+	last *ChatChunk
+}
+
+func (s *openAIStream) Next() (StreamEvent, error) {
+	for {
+		ev, err := s.r.Next()
+		if err != nil {
+			return nil, err
+		}
+		if ev.Data == "[DONE]" {
+			return nil, io.EOF
+		}
+		chunk, err := DecodeChatChunk([]byte(ev.Data))
+		if err != nil {
+			continue // never relay what could not be inspected
+		}
+		s.last = chunk
+		return chunk, nil
+	}
+}
+
+func (s *openAIStream) Write(ev StreamEvent) error {
+	chunk := ev.(*ChatChunk)
+	if chunk.empty() {
+		return nil
+	}
+	return s.writeChunk(chunk)
+}
+
+func (s *openAIStream) writeChunk(chunk *ChatChunk) error {
+	data, err := chunk.Encode()
+	if err != nil {
+		return err
+	}
+	return s.w.Data(data)
+}
+
+func (s *openAIStream) Text(channel int, text string) error {
+	return s.writeChunk(NewChatChunk(s.last, channel, text, ""))
+}
+
+// Block finishes only the blocked choice; other choices keep streaming.
+func (s *openAIStream) Block(channel int, res types.GuardrailResult) (bool, error) {
+	return false, s.writeChunk(NewChatChunk(s.last, channel, "", "content_filter"))
+}
+
+func (s *openAIStream) Finish(res types.GuardrailResult) error {
+	data, err := GuardrailChunk(s.last, res)
+	if err != nil {
+		return err
+	}
+	if err := s.w.Data(data); err != nil {
+		return err
+	}
+	return s.w.Data([]byte("[DONE]"))
+}
+
+// ErrorBody is the OpenAI error envelope.
+type ErrorBody struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail describes an OpenAI-style error.
+type ErrorDetail struct {
+	Message   string                 `json:"message"`
+	Type      string                 `json:"type"`
+	Code      string                 `json:"code,omitempty"`
+	Guardrail *types.GuardrailResult `json:"guardrail,omitempty"`
+}
+
+// NewError builds a plain OpenAI-style error.
+func NewError(errType, message string) ErrorBody {
+	return ErrorBody{Error: ErrorDetail{Message: message, Type: errType}}
+}
+
+// GuardrailError maps a blocked GuardrailResult to an OpenAI-style error.
+func GuardrailError(res types.GuardrailResult) ErrorBody {
+	return ErrorBody{Error: ErrorDetail{
+		Message:   guardrailMessage(res),
+		Type:      "guardrail_violation",
+		Code:      res.Reason,
+		Guardrail: &res,
+	}}
+}
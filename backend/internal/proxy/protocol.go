@@ -0,0 +1,195 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"aiguardrails/internal/types"
+)
+
+// Supported client/upstream wire protocols.
+const (
+	ProtocolOpenAI    = "openai"
+	ProtocolAnthropic = "anthropic"
+	ProtocolOllama    = "ollama"
+)
+
+var ErrUnknownProtocol = errors.New("unknown proxy protocol")
+
+// Request is a decoded client request of any protocol.
+type Request interface {
+	// PromptText is everything the caller sends to the model, tool calls and results included.
+	PromptText() string
+	Streaming() bool
+	// RewriteText applies fn to the text of every message (system prompt and
+	// tool results included) so Encode sends the rewritten text. Tool-call
+	// arguments are left unchanged.
+	RewriteText(fn func(string) string) error
+	// Encode re-serializes the request, replacing the model when override is set.
+	Encode(modelOverride string) ([]byte, error)
+}
+
+// Response is a decoded non-streaming upstream reply.
+type Response interface {
+	// Texts returns the model output of every choice, tool-call arguments included.
+	Texts() []string
+	// Refuse replaces choice i with the protocol's refusal shape.
+	Refuse(i int, res types.GuardrailResult)
+	// Redact replaces choice i's text with redacted text, keeping how it ended.
+	// It reports false for choices with tool calls, which are not rewritten.
+	Redact(i int, text string) bool
+	// RewriteText applies fn to the text content of every choice in place;
+	// tool calls are left unchanged.
+	RewriteText(fn func(string) string)
+	Encode() ([]byte, error)
+}
+
+// Protocol adapts one LLM wire format to the guarded pipeline.
+type Protocol interface {
+	Name() string
+	// UpstreamPath is appended to the upstream base URL.
+	UpstreamPath() string
+	// SetHeaders sets upstream auth/version headers; in holds the client's headers.
+	SetHeaders(out, in http.Header, apiKey string)
+	DecodeRequest(body []byte) (Request, error)
+	DecodeResponse(body []byte) (Response, error)
+	// NewStream wraps a streamed upstream body and starts the client response.
+	NewStream(upstream io.Reader, w http.ResponseWriter) (StreamCodec, error)
+	// Error builds the protocol's error body.
+	Error(errType, message string) interface{}
+	// GuardrailError builds the protocol's error body for a blocked request.
+	GuardrailError(res types.GuardrailResult) interface{}
+}
+
+// StreamDelta is the text one channel (a choice or content block) carries in a stream event.
+type StreamDelta struct {
+	Channel int
+	Text    string
+	HasText bool
+	End     bool // the channel finishes with this event
+}
+
+// StreamEvent is one upstream stream event, decoded enough to filter its text.
+type StreamEvent interface {
+	Deltas() []StreamDelta
+	// SetText overwrites the text of the delta at position pos.
+	SetText(pos int, text string)
+	// Drop removes the delta at position pos from the relayed event.
+	Drop(pos int)
+}
+
+// StreamCodec reads upstream stream events and writes them to the client in the same protocol.
+type StreamCodec interface {
+	// Next returns the next upstream event, or io.EOF once the upstream stream is finished.
+	Next() (StreamEvent, error)
+	// Write relays ev unless all of its deltas were dropped.
+	Write(ev StreamEvent) error
+	// Text writes a synthetic text delta for a channel.
+	Text(channel int, text string) error
+	// Block ends a channel because of res; it reports whether the whole stream is over.
+	Block(channel int, res types.GuardrailResult) (bool, error)
+	// Finish writes the combined guardrail result and the end-of-stream marker.
+	Finish(res types.GuardrailResult) error
+}
+
+var protocols = map[string]Protocol{
+	ProtocolOpenAI:    OpenAI,
+	ProtocolAnthropic: Anthropic,
+	ProtocolOllama:    Ollama,
+}
+
+// Lookup returns the protocol registered under name.
+func Lookup(name string) (Protocol, error) {
+	p, ok := protocols[name]
+	if !ok {
+		return nil, ErrUnknownProtocol
+	}
+	return p, nil
+}
+
+// RefusalText is the assistant content substituted for a blocked reply.
+func RefusalText(res types.GuardrailResult) string {
+	if res.Response != "" {
+		return res.Response
+	}
+	return "[response withheld by guardrails: " + res.Reason + "]"
+}
+
+// guardrailMessage is the human-readable message of a guardrail error.
+func guardrailMessage(res types.GuardrailResult) string {
+	if res.Response != "" {
+		return res.Response
+	}
+	return "request blocked by guardrails: " + res.Reason
+}
+
+// rewriteContent applies fn to message content: a string, or the text parts
+// and tool_result blocks of a content array.
+func rewriteContent(v interface{}, fn func(string) string) interface{} {
+	switch c := v.(type) {
+	case string:
+		return fn(c)
+	case []interface{}:
+		for _, item := range c {
+			block, _ := item.(map[string]interface{})
+			switch block["type"] {
+			case "text":
+				if t, ok := block["text"].(string); ok {
+					block["text"] = fn(t)
+				}
+			case "tool_result":
+				if content, ok := block["content"]; ok {
+					block["content"] = rewriteContent(content, fn)
+				}
+			}
+		}
+	}
+	return v
+}
+
+// rewriteRawContent rewrites raw[field] as message content; see rewriteContent.
+func rewriteRawContent(raw map[string]json.RawMessage, field string, fn func(string) string) error {
+	data, ok := raw[field]
+	if !ok {
+		return nil
+	}
+	var v interface{}
+	if err := decodeNumbers(data, &v); err != nil {
+		return err
+	}
+	out, err := json.Marshal(rewriteContent(v, fn))
+	if err != nil {
+		return err
+	}
+	raw[field] = out
+	return nil
+}
+
+// rewriteRawMessages rewrites the content of every message in raw["messages"].
+func rewriteRawMessages(raw map[string]json.RawMessage, fn func(string) string) error {
+	var msgs []map[string]interface{}
+	if err := decodeNumbers(raw["messages"], &msgs); err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		if c, ok := m["content"]; ok {
+			m["content"] = rewriteContent(c, fn)
+		}
+	}
+	out, err := json.Marshal(msgs)
+	if err != nil {
+		return err
+	}
+	raw["messages"] = out
+	return nil
+}
+
+// decodeNumbers unmarshals keeping numbers as json.Number so they re-encode unchanged.
+func decodeNumbers(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
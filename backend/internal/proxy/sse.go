@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var ErrStreamingUnsupported = errors.New("streaming unsupported by response writer")
+
+// SSEWriter writes server-sent events and flushes after each one.
+type SSEWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+// NewSSEWriter sets event-stream headers and returns a writer.
+func NewSSEWriter(w http.ResponseWriter) (*SSEWriter, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, ErrStreamingUnsupported
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	return &SSEWriter{w: w, flusher: flusher}, nil
+}
+
+// Data writes an unnamed event with raw data.
+func (s *SSEWriter) Data(data []byte) error {
+	return s.Event("", data)
+}
+
+// Event writes a (optionally named) event with raw data.
+func (s *SSEWriter) Event(name string, data []byte) error {
+	var b strings.Builder
+	if name != "" {
+		b.WriteString("event: ")
+		b.WriteString(name)
+		b.WriteString("\n")
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		b.WriteString("data: ")
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+	if _, err := io.WriteString(s.w, b.String()); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// JSON writes a (optionally named) event with a JSON payload.
+func (s *SSEWriter) JSON(name string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return s.Event(name, data)
+}
+
+// SSEEvent is one parsed server-sent event.
+type SSEEvent struct {
+	Event string
+	Data  string
+}
+
+// SSEReader parses a server-sent event stream.
+type SSEReader struct {
+	sc *bufio.Scanner
+}
+
+// NewSSEReader wraps r.
+func NewSSEReader(r io.Reader) *SSEReader {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	return &SSEReader{sc: sc}
+}
+
+// Next returns the next event, or io.EOF at the end of the stream.
+func (r *SSEReader) Next() (SSEEvent, error) {
+	var ev SSEEvent
+	var data []string
+	for r.sc.Scan() {
+		line := r.sc.Text()
+		if line == "" {
+			if ev.Event != "" || len(data) > 0 {
+				ev.Data = strings.Join(data, "\n")
+				return ev, nil
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue // comment / keep-alive
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			ev.Event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	if err := r.sc.Err(); err != nil {
+		return ev, err
+	}
+	if ev.Event != "" || len(data) > 0 {
+		ev.Data = strings.Join(data, "\n")
+		return ev, nil
+	}
+	return ev, io.EOF
+}
@@ -0,0 +1,189 @@
+package proxy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrUpstreamNotFound = errors.New("upstream not found")
+
+// redactedKey is how Redacted shows an API key.
+const redactedKey = "****"
+
+// Upstream is the LLM endpoint a tenant (or a single app) is proxied to.
+type Upstream struct {
+	ID         string    `json:"id"`
+	TenantID   string    `json:"tenant_id"`
+	AppID      string    `json:"app_id,omitempty"` // empty = tenant-wide default
+	Protocol   string    `json:"protocol"`         // openai | anthropic | ollama
+	BaseURL    string    `json:"base_url"`
+	APIKey     string    `json:"api_key,omitempty"`
+	Model      string    `json:"model,omitempty"` // overrides the client-supplied model when set
+	TimeoutSec int       `json:"timeout_sec,omitempty"`
+	Enabled    bool      `json:"enabled"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Redacted returns a copy safe to return from admin APIs.
+func (u Upstream) Redacted() Upstream {
+	if u.APIKey != "" {
+		u.APIKey = redactedKey
+	}
+	return u
+}
+
+// Store persists upstream configuration in Postgres.
+type Store struct {
+	db *sql.DB
+}
+
+// NewStore constructs Store.
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// Resolve returns the most specific enabled upstream for a protocol: app-level first, then tenant-wide.
+func (s *Store) Resolve(tenantID, appID, protocol string) (*Upstream, error) {
+	row := s.db.QueryRow(`
+		SELECT id, tenant_id, COALESCE(app_id::text, ''), protocol, base_url, COALESCE(api_key, ''), COALESCE(model, ''),
+			COALESCE(timeout_sec, 0), enabled, created_at, updated_at
+		FROM proxy_upstreams
+		WHERE tenant_id=$1 AND enabled=true AND (app_id IS NULL OR app_id::text=$2) AND protocol=$3
+		ORDER BY app_id NULLS LAST
+		LIMIT 1`, tenantID, appID, protocol)
+	return scanUpstream(row)
+}
+
+// List returns all upstreams of a tenant.
+func (s *Store) List(tenantID string) ([]Upstream, error) {
+	rows, err := s.db.Query(`
+		SELECT id, tenant_id, COALESCE(app_id::text, ''), protocol, base_url, COALESCE(api_key, ''), COALESCE(model, ''),
+			COALESCE(timeout_sec, 0), enabled, created_at, updated_at
+		FROM proxy_upstreams WHERE tenant_id=$1 ORDER BY app_id NULLS FIRST, protocol, created_at`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Upstream
+	for rows.Next() {
+		u, err := scanUpstream(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *u)
+	}
+	return out, nil
+}
+
+// Upsert creates or replaces the upstream for the (tenant, app, protocol) scope.
+// An empty or redacted API key keeps the key already stored.
+func (s *Store) Upsert(u Upstream) (*Upstream, error) {
+	if u.Protocol == "" {
+		u.Protocol = ProtocolOpenAI
+	}
+	if u.APIKey == redactedKey {
+		u.APIKey = ""
+	}
+	now := time.Now().UTC()
+	u.ID = uuid.NewString()
+	u.CreatedAt = now
+	u.UpdatedAt = now
+	var appID interface{}
+	if u.AppID != "" {
+		appID = u.AppID
+	}
+	err := s.db.QueryRow(`
+		INSERT INTO proxy_upstreams (id, tenant_id, app_id, protocol, base_url, api_key, model, timeout_sec, enabled, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (tenant_id, COALESCE(app_id, '00000000-0000-0000-0000-000000000000'::uuid), protocol)
+		DO UPDATE SET base_url=EXCLUDED.base_url,
+			api_key=CASE WHEN EXCLUDED.api_key = '' THEN proxy_upstreams.api_key ELSE EXCLUDED.api_key END, model=EXCLUDED.model,
+			timeout_sec=EXCLUDED.timeout_sec, enabled=EXCLUDED.enabled, updated_at=EXCLUDED.updated_at
+		RETURNING id, created_at`,
+		u.ID, u.TenantID, appID, u.Protocol, u.BaseURL, u.APIKey, u.Model, u.TimeoutSec, u.Enabled, u.CreatedAt, u.UpdatedAt).
+		Scan(&u.ID, &u.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// ValidateBaseURL checks an upstream base URL: http or https with a host
+// and, unless allowPrivate, a host that neither is nor resolves to a
+// loopback, private, link-local or unspecified address.
+func ValidateBaseURL(ctx context.Context, raw string, allowPrivate bool) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("base_url %q is not an http(s) URL", raw)
+	}
+	if u.User != nil {
+		return fmt.Errorf("base_url must not carry credentials")
+	}
+	if allowPrivate {
+		return nil
+	}
+	host := u.Hostname()
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return fmt.Errorf("base_url host %s: %w", host, err)
+		}
+		ips = ips[:0]
+		for _, a := range addrs {
+			ips = append(ips, a.IP)
+		}
+	}
+	for _, ip := range ips {
+		if privateAddr(ip) {
+			return fmt.Errorf("base_url host %s is a private address (%s)", host, ip)
+		}
+	}
+	return nil
+}
+
+// cgnat is the shared address space of carrier-grade NAT.
+var cgnat = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func privateAddr(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast() || cgnat.Contains(ip)
+}
+
+// Delete removes an upstream.
+func (s *Store) Delete(tenantID, id string) error {
+	result, err := s.db.Exec(`DELETE FROM proxy_upstreams WHERE id=$1 AND tenant_id=$2`, id, tenantID)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return ErrUpstreamNotFound
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUpstream(row rowScanner) (*Upstream, error) {
+	var u Upstream
+	if err := row.Scan(&u.ID, &u.TenantID, &u.AppID, &u.Protocol, &u.BaseURL, &u.APIKey, &u.Model,
+		&u.TimeoutSec, &u.Enabled, &u.CreatedAt, &u.UpdatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUpstreamNotFound
+		}
+		return nil, err
+	}
+	return &u, nil
+}
@@ -0,0 +1,239 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"aiguardrails/internal/opa"
+)
+
+// Document metadata keys holding its ACL, mirrored from the source system.
+// List values are comma-separated.
+const (
+	MetaOwner       = "owner"
+	MetaUsers       = "acl_users"
+	MetaGroups      = "acl_groups"
+	MetaDepartments = "acl_departments"
+	MetaRoles       = "acl_roles"
+	MetaLabels      = "acl_labels" // the caller must hold every label
+)
+
+// Reasons for removing a document the caller may not open.
+const (
+	ReasonACL            = "acl_denied"
+	ReasonLabel          = "acl_label_missing"
+	ReasonACLUnavailable = "acl_unavailable" // the access policy could not decide; documents are withheld
+)
+
+// Subject is the end user a retrieval is made for.
+type Subject struct {
+	UserID      string   `json:"user_id,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	Groups      []string `json:"groups,omitempty"` // groups or teams, by name or ID
+	Departments []string `json:"departments,omitempty"`
+	Labels      []string `json:"labels,omitempty"` // clearance labels, e.g. "legal", "hr"
+}
+
+// ACL is a document's access list. A document naming no owner, users, groups,
+// departments or roles is open to every subject holding its labels.
+type ACL struct {
+	Owner       string   `json:"owner,omitempty"`
+	Users       []string `json:"users,omitempty"`
+	Groups      []string `json:"groups,omitempty"`
+	Departments []string `json:"departments,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	Labels      []string `json:"labels,omitempty"`
+}
+
+// ParseACL reads a document's ACL from its metadata.
+func ParseACL(meta map[string]string) ACL {
+	return ACL{
+		Owner:       strings.TrimSpace(meta[MetaOwner]),
+		Users:       splitList(meta[MetaUsers]),
+		Groups:      splitList(meta[MetaGroups]),
+		Departments: splitList(meta[MetaDepartments]),
+		Roles:       splitList(meta[MetaRoles]),
+		Labels:      splitList(meta[MetaLabels]),
+	}
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Restricted reports whether the ACL names who may open the document.
+func (a ACL) Restricted() bool {
+	return a.Owner != "" || len(a.Users) > 0 || len(a.Groups) > 0 || len(a.Departments) > 0 || len(a.Roles) > 0
+}
+
+// Check returns nil when s may open a document with this ACL. A nil subject
+// may only open unrestricted, unlabelled documents.
+func (a ACL) Check(s *Subject) *Denial {
+	if s == nil {
+		s = &Subject{}
+	}
+	for _, label := range a.Labels {
+		if !containsFold(s.Labels, label) {
+			return &Denial{Reason: ReasonLabel, Signals: []string{"label:" + label}}
+		}
+	}
+	if !a.Restricted() {
+		return nil
+	}
+	if s.UserID != "" && (strings.EqualFold(a.Owner, s.UserID) || containsFold(a.Users, s.UserID)) {
+		return nil
+	}
+	if overlapFold(a.Groups, s.Groups) || overlapFold(a.Departments, s.Departments) || overlapFold(a.Roles, s.Roles) {
+		return nil
+	}
+	subject := "subject:" + s.UserID
+	if s.UserID == "" {
+		subject = "subject:anonymous"
+	}
+	return &Denial{Reason: ReasonACL, Signals: []string{subject}}
+}
+
+func containsFold(list []string, v string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func overlapFold(a, b []string) bool {
+	for _, v := range a {
+		if containsFold(b, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Denial is why a subject may not open a document.
+type Denial struct {
+	Reason  string   `json:"reason"`
+	Signals []string `json:"signals,omitempty"`
+}
+
+// AccessPolicy decides which documents a subject may open. Denials are keyed
+// by the documents' input index.
+type AccessPolicy interface {
+	Denials(ctx context.Context, tenantID string, subject *Subject, docs []IndexedDocument) (map[int]Denial, error)
+}
+
+// IndexedDocument is a document with its input index and parsed ACL.
+type IndexedDocument struct {
+	Index       int               `json:"index"`
+	ID          string            `json:"id"`
+	Namespace   string            `json:"namespace,omitempty"`
+	Sensitivity string            `json:"sensitivity,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	ACL         ACL               `json:"acl"`
+}
+
+// ACLPolicy applies document ACLs in process.
+type ACLPolicy struct{}
+
+func (ACLPolicy) Denials(_ context.Context, _ string, subject *Subject, docs []IndexedDocument) (map[int]Denial, error) {
+	out := map[int]Denial{}
+	for _, doc := range docs {
+		if d := doc.ACL.Check(subject); d != nil {
+			out[doc.Index] = *d
+		}
+	}
+	return out, nil
+}
+
+// OPAPolicy evaluates document access with OPA in mode "rag_doc". The
+// decision is a set of {"index", "reason", "signals"} denials, one evaluation
+// per retrieval. Modules that do not define the decision fall back to ACLPolicy.
+type OPAPolicy struct {
+	eval     *opa.Evaluator
+	decision string
+}
+
+// NewOPAPolicy constructs OPAPolicy; decision is the query, e.g. data.guardrails.rag_doc_deny.
+func NewOPAPolicy(eval *opa.Evaluator, decision string) *OPAPolicy {
+	return &OPAPolicy{eval: eval, decision: decision}
+}
+
+func (p *OPAPolicy) Denials(ctx context.Context, tenantID string, subject *Subject, docs []IndexedDocument) (map[int]Denial, error) {
+	if subject == nil {
+		subject = &Subject{}
+	}
+	val, err := p.eval.Query(ctx, p.decision, opa.Input{TenantID: tenantID, Mode: "rag_doc", Subject: subject, Documents: docs})
+	if errors.Is(err, opa.ErrUndefined) {
+		return ACLPolicy{}.Denials(ctx, tenantID, subject, docs)
+	}
+	if err != nil {
+		return nil, err
+	}
+	items, ok := val.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("rag_doc decision: unexpected type %T", val)
+	}
+	out := map[int]Denial{}
+	for _, item := range items {
+		m, _ := item.(map[string]interface{})
+		idx, ok := opa.Int(m["index"])
+		if !ok {
+			return nil, fmt.Errorf("rag_doc decision: denial without index")
+		}
+		if _, seen := out[idx]; seen {
+			continue
+		}
+		d := Denial{Reason: ReasonACL}
+		if r, ok := m["reason"].(string); ok && r != "" {
+			d.Reason = r
+		}
+		if sigs, ok := m["signals"].([]interface{}); ok {
+			for _, s := range sigs {
+				d.Signals = append(d.Signals, fmt.Sprint(s))
+			}
+		}
+		out[idx] = d
+	}
+	return out, nil
+}
+
+// checkAccess removes the tracked documents the subject may not open and
+// records why in their verdicts. When the policy fails every document is
+// withheld.
+func (s *Security) checkAccess(ctx context.Context, tenantID string, subject *Subject, docs []Document, verdicts []Verdict) []Document {
+	indexed := make([]IndexedDocument, 0, len(docs))
+	for _, doc := range docs {
+		indexed = append(indexed, IndexedDocument{
+			Index:       doc.seq - 1,
+			ID:          doc.ID,
+			Namespace:   doc.Namespace,
+			Sensitivity: doc.Sensitivity,
+			Metadata:    doc.Metadata,
+			ACL:         ParseACL(doc.Metadata),
+		})
+	}
+	denials, err := s.access.Denials(ctx, tenantID, subject, indexed)
+	kept := make([]Document, 0, len(docs))
+	for _, doc := range docs {
+		v := &verdicts[doc.seq-1]
+		if err != nil {
+			v.Action, v.Reason, v.Signals = ActionDrop, ReasonACLUnavailable, []string{err.Error()}
+			continue
+		}
+		if d, ok := denials[doc.seq-1]; ok {
+			v.Action, v.Reason, v.Signals = ActionDrop, d.Reason, d.Signals
+			continue
+		}
+		kept = append(kept, doc)
+	}
+	return kept
+}
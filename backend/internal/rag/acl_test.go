@@ -0,0 +1,93 @@
+package rag
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"aiguardrails/internal/opa"
+	"aiguardrails/internal/policy"
+)
+
+var aclDocs = []Document{
+	{ID: "open", Content: "Holiday calendar."},
+	{ID: "owned", Content: "Alice's draft.", Metadata: map[string]string{MetaOwner: "alice"}},
+	{ID: "shared", Content: "Design doc.", Metadata: map[string]string{MetaUsers: "bob, carol"}},
+	{ID: "team", Content: "Team notes.", Metadata: map[string]string{MetaGroups: "Platform"}},
+	{ID: "dept", Content: "Budget.", Metadata: map[string]string{MetaDepartments: "finance"}},
+	{ID: "role", Content: "Runbook.", Metadata: map[string]string{MetaRoles: "tenant_admin"}},
+	{ID: "labelled", Content: "Contract.", Metadata: map[string]string{MetaLabels: "legal"}},
+	{ID: "both", Content: "Legal team memo.", Metadata: map[string]string{MetaGroups: "platform", MetaLabels: "legal,hr"}},
+}
+
+var aclCases = []struct {
+	name    string
+	subject *Subject
+	allowed []string
+}{
+	{"anonymous", nil, []string{"open"}},
+	{"owner", &Subject{UserID: "Alice"}, []string{"open", "owned"}},
+	{"user and team", &Subject{UserID: "carol", Groups: []string{"platform"}}, []string{"open", "shared", "team"}},
+	{"department and role", &Subject{UserID: "dan", Departments: []string{"Finance"}, Roles: []string{"tenant_admin"}}, []string{"open", "dept", "role"}},
+	{"labels", &Subject{UserID: "erin", Groups: []string{"platform"}, Labels: []string{"legal", "hr"}}, []string{"open", "team", "labelled", "both"}},
+}
+
+func screenIDs(t *testing.T, sec *Security, subject *Subject) ([]string, FilterResult) {
+	res := sec.ScreenRetrieval(context.Background(), "t1", Retrieval{Subject: subject, UserLevel: "secret", Documents: aclDocs})
+	ids := []string{}
+	for _, d := range res.Documents {
+		ids = append(ids, d.ID)
+	}
+	return ids, res
+}
+
+func TestACLPolicy(t *testing.T) {
+	sec := NewSecurity(policy.NewMemoryEngine())
+	for _, tc := range aclCases {
+		ids, res := screenIDs(t, sec, tc.subject)
+		if !reflect.DeepEqual(ids, tc.allowed) {
+			t.Fatalf("%s: allowed %v, want %v", tc.name, ids, tc.allowed)
+		}
+		if tc.subject == nil {
+			if v := res.Verdicts[1]; v.Reason != ReasonACL || v.Signals[0] != "subject:anonymous" {
+				t.Fatalf("unexpected owner verdict: %+v", v)
+			}
+			if v := res.Verdicts[6]; v.Reason != ReasonLabel || v.Signals[0] != "label:legal" {
+				t.Fatalf("unexpected label verdict: %+v", v)
+			}
+		}
+	}
+}
+
+func TestOPAPolicyMatchesACLPolicy(t *testing.T) {
+	eval, err := opa.NewFromDir(filepath.Join("..", "..", "opa", "policies"), "data.guardrails.allow", 5*time.Second)
+	if err != nil {
+		t.Fatalf("load rego: %v", err)
+	}
+	sec := NewSecurity(policy.NewMemoryEngine())
+	sec.WithAccessPolicy(NewOPAPolicy(eval, "data.guardrails.rag_doc_deny"))
+	for _, tc := range aclCases {
+		ids, res := screenIDs(t, sec, tc.subject)
+		if !reflect.DeepEqual(ids, tc.allowed) {
+			t.Fatalf("%s: opa allowed %v, want %v (verdicts %+v)", tc.name, ids, tc.allowed, res.Verdicts)
+		}
+	}
+
+	// Modules without the decision fall back to the in-process check.
+	sec.WithAccessPolicy(NewOPAPolicy(eval, "data.guardrails.no_such_decision"))
+	if ids, _ := screenIDs(t, sec, nil); !reflect.DeepEqual(ids, []string{"open"}) {
+		t.Fatalf("fallback allowed %v", ids)
+	}
+
+	// A failing policy withholds every document.
+	bad, _ := opa.NewFromDir(filepath.Join("..", "..", "opa", "policies"), "data.guardrails.allow", time.Second)
+	if err := bad.ReloadFromContent(map[string]string{"bad.rego": "package guardrails\nrag_doc_deny = \"broken\"\n"}); err != nil {
+		t.Fatal(err)
+	}
+	sec.WithAccessPolicy(NewOPAPolicy(bad, "data.guardrails.rag_doc_deny"))
+	if ids, res := screenIDs(t, sec, &Subject{UserID: "alice"}); len(ids) != 0 || res.Verdicts[0].Reason != ReasonACLUnavailable {
+		t.Fatalf("expected documents withheld, got %v %+v", ids, res.Verdicts)
+	}
+}
@@ -0,0 +1,222 @@
+package rag
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"aiguardrails/internal/injection"
+)
+
+// ReasonIndirectInjection marks a document carrying instructions aimed at the model.
+const ReasonIndirectInjection = "indirect_prompt_injection"
+
+// Signal names of the document scanner, in addition to the injection signals.
+const (
+	SignalEmbeddedInstruction = "embedded_instruction" // the text itself scores as an injection
+	SignalHiddenText          = "hidden_text"          // text a reader of the source would not see
+	SignalExfiltrationLink    = "exfiltration_link"    // a link built to carry conversation data out
+)
+
+// Weights of the document signals; they combine with the injection score as
+// independent evidence, like the injection heuristics themselves.
+const (
+	hiddenWeight            = 0.2 // hidden text alone
+	hiddenInstructionWeight = 0.6 // hidden text that carries injection signals
+	tagSmugglingWeight      = 0.5 // ASCII encoded in Unicode tag characters
+	exfilPlaceholderWeight  = 0.6 // link with a template placeholder, e.g. ?q={{conversation}}
+	exfilInstructionWeight  = 0.5 // "send the answer to https://..."
+	exfilImageQueryWeight   = 0.3 // auto-loading image with a query string
+	minTagRun               = 8   // shorter runs are emoji flag sequences
+	minZeroWidthRun         = 8   // zero-width characters used as a carrier
+	maxSignalsPerDocument   = 12
+)
+
+var (
+	htmlComment     = regexp.MustCompile(`(?s)<!--(.*?)-->`)
+	markdownComment = regexp.MustCompile(`(?m)^\[//\]:\s*#\s*\((.*)\)\s*$`)
+	hiddenElement   = regexp.MustCompile(`(?is)<[a-z][a-z0-9]*\b[^>]*(?:\shidden\b|aria-hidden\s*=\s*["']true["']|style\s*=\s*["'][^"']*(?:display\s*:\s*none|visibility\s*:\s*hidden|font-size\s*:\s*0(?:px|pt|em)?\s*(?:;|["'])|opacity\s*:\s*0(?:\.0+)?\s*(?:;|["'])|color\s*:\s*(?:white|#fff(?:fff)?\b|transparent)))[^>]*>(.*?)</[a-z][a-z0-9]*\s*>`)
+
+	markdownImage = regexp.MustCompile(`!\[[^\]]*\]\(\s*<?(https?://[^)\s>]+)`)
+	htmlImage     = regexp.MustCompile(`(?i)<img\b[^>]*\ssrc\s*=\s*["']?(https?://[^"'\s>]+)`)
+	anyURL        = regexp.MustCompile(`(?i)https?://[^\s)"'<>\]]+`)
+	placeholder   = regexp.MustCompile(`(?i)\{\{?[^{}]{1,40}\}?\}|\$\{?[a-z_]{3,}\}?|%7B|%3C[a-z_]`)
+	// a data-moving verb, then conversation data, then a URL
+	exfilVerb = regexp.MustCompile(`(?i)\b(?:send|post|forward|upload|submit|append|encode|transmit|exfiltrate|leak)\b[^.\n]{0,60}\b(?:conversation|chat|history|messages?|user'?s?|password|secrets?|tokens?|keys?|data|answer|response|summary|context|prompt)\b[^.\n]{0,80}https?://|(?:发送|上传|提交|转发|附加|拼接)[^。\n]{0,30}(?:对话|聊天|历史|消息|用户|密码|密钥|令牌|数据|回答|摘要|上下文|提示)[^。\n]{0,40}https?://|(?:把|将)[^。\n]{0,20}(?:对话|聊天|历史|消息|用户|密码|密钥|令牌|数据|回答|摘要|上下文|提示)[^。\n]{0,30}(?:发送|上传|提交|转发|附加|拼接)[^。\n]{0,20}https?://`)
+
+	bidiControl = regexp.MustCompile(`[\x{202A}-\x{202E}\x{2066}-\x{2069}]`)
+)
+
+// hiddenSegment is text that renders invisibly, with how it was hidden.
+type hiddenSegment struct {
+	kind string
+	text string
+}
+
+// hiddenSegments returns the document's hidden text.
+func hiddenSegments(content string) []hiddenSegment {
+	var out []hiddenSegment
+	for _, m := range htmlComment.FindAllStringSubmatch(content, -1) {
+		out = append(out, hiddenSegment{"html_comment", m[1]})
+	}
+	for _, m := range markdownComment.FindAllStringSubmatch(content, -1) {
+		out = append(out, hiddenSegment{"markdown_comment", m[1]})
+	}
+	for _, m := range hiddenElement.FindAllStringSubmatch(content, -1) {
+		out = append(out, hiddenSegment{"hidden_element", m[1]})
+	}
+	if s := decodeTagRuns(content); s != "" {
+		out = append(out, hiddenSegment{"unicode_tags", s})
+	}
+	return out
+}
+
+// decodeTagRuns decodes ASCII smuggled in Unicode tag characters (U+E0020..U+E007E).
+func decodeTagRuns(content string) string {
+	var b, run strings.Builder
+	flush := func() {
+		if utf8.RuneCountInString(run.String()) >= minTagRun {
+			b.WriteString(run.String())
+			b.WriteByte(' ')
+		}
+		run.Reset()
+	}
+	for _, r := range content {
+		if r >= 0xE0020 && r <= 0xE007E {
+			run.WriteRune(r - 0xE0000)
+			continue
+		}
+		flush()
+	}
+	flush()
+	return strings.TrimSpace(b.String())
+}
+
+// zeroWidthRun reports a run of zero-width characters long enough to carry data.
+func zeroWidthRun(content string) bool {
+	n := 0
+	for _, r := range content {
+		switch r {
+		case '\u200b', '\u200c', '\u200d', '\u2060', '\ufeff':
+			if n++; n >= minZeroWidthRun {
+				return true
+			}
+		default:
+			n = 0
+		}
+	}
+	return false
+}
+
+// ScanDocument scores content for indirect prompt injection: instructions
+// aimed at the model, hidden text and links that exfiltrate conversation data.
+// The score combines all signals; signals are unique, in the order found.
+func ScanDocument(content string) (float64, []string) {
+	var signals []string
+	seen := map[string]bool{}
+	add := func(s string) {
+		if !seen[s] && len(signals) < maxSignalsPerDocument {
+			seen[s] = true
+			signals = append(signals, s)
+		}
+	}
+	miss := 1.0
+	weigh := func(w float64) { miss *= 1 - w }
+
+	if res := injection.ScoreVariants(content); len(res.Signals) > 0 {
+		weigh(res.Score)
+		add(SignalEmbeddedInstruction)
+		for _, name := range res.Names() {
+			add(name)
+		}
+	}
+
+	hiddenW := 0.0
+	for _, seg := range hiddenSegments(content) {
+		w := hiddenWeight
+		if seg.kind == "unicode_tags" {
+			w = tagSmugglingWeight
+		}
+		if res := injection.ScoreVariants(seg.text); len(res.Signals) > 0 {
+			w = hiddenInstructionWeight
+			for _, name := range res.Names() {
+				add(name)
+			}
+		}
+		hiddenW = math.Max(hiddenW, w)
+		add(SignalHiddenText + ":" + seg.kind)
+	}
+	if bidiControl.MatchString(content) {
+		hiddenW = math.Max(hiddenW, hiddenWeight)
+		add(SignalHiddenText + ":bidi_control")
+	}
+	if zeroWidthRun(content) {
+		hiddenW = math.Max(hiddenW, hiddenWeight)
+		add(SignalHiddenText + ":zero_width")
+	}
+	weigh(hiddenW)
+
+	exfilW := 0.0
+	for _, re := range []*regexp.Regexp{markdownImage, htmlImage} {
+		for _, m := range re.FindAllStringSubmatch(content, -1) {
+			if strings.Contains(m[1], "?") {
+				exfilW = math.Max(exfilW, exfilImageQueryWeight)
+				add(SignalExfiltrationLink + ":image_query")
+			}
+		}
+	}
+	for _, u := range anyURL.FindAllString(content, -1) {
+		if placeholder.MatchString(u) {
+			exfilW = math.Max(exfilW, exfilPlaceholderWeight)
+			add(SignalExfiltrationLink + ":placeholder")
+		}
+	}
+	if exfilVerb.MatchString(content) {
+		exfilW = math.Max(exfilW, exfilInstructionWeight)
+		add(SignalExfiltrationLink + ":instruction")
+	}
+	weigh(exfilW)
+
+	return math.Round((1-miss)*100) / 100, signals
+}
+
+// DocumentActions resolves what to do with a tenant's poisoned documents;
+// an empty action means ActionDrop.
+type DocumentActions interface {
+	DocumentAction(tenantID string) string
+}
+
+// ValidAction reports whether action is a configurable poisoned-document action.
+func ValidAction(action string) bool {
+	return action == "" || action == ActionDrop || action == ActionQuarantine
+}
+
+// scan scans each tracked document against the tenant's injection threshold
+// and records the result in its verdict. Documents scoring at or above it are
+// dropped or quarantined by the tenant's action; the rest are kept in order.
+func (s *Security) scan(tenantID string, docs []Document, verdicts []Verdict) (kept, quarantined []Document) {
+	threshold := s.injection.Threshold(tenantID)
+	action := ActionDrop
+	if s.actions != nil && s.actions.DocumentAction(tenantID) == ActionQuarantine {
+		action = ActionQuarantine
+	}
+	kept = make([]Document, 0, len(docs))
+	for _, doc := range docs {
+		score, signals := ScanDocument(doc.Content)
+		v := &verdicts[doc.seq-1]
+		v.Score, v.Signals = score, signals
+		if len(signals) == 0 || score < threshold {
+			kept = append(kept, doc)
+			continue
+		}
+		v.Action = action
+		v.Reason = ReasonIndirectInjection
+		v.Signals = append(v.Signals, fmt.Sprintf("injection_score:%.2f", score))
+		if action == ActionQuarantine {
+			quarantined = append(quarantined, doc)
+		}
+	}
+	return kept, quarantined
+}
@@ -1,10 +1,11 @@
 package rag
 
 import (
+	"context"
 	"errors"
-	"regexp"
 	"strings"
 
+	"aiguardrails/internal/injection"
 	"aiguardrails/internal/policy"
 )
 
@@ -22,23 +23,58 @@ type Document struct {
 	Score       float64           `json:"score"`
 	Metadata    map[string]string `json:"metadata,omitempty"`
 	Sensitivity string            `json:"sensitivity,omitempty"` // public, internal, confidential, secret
+
+	seq int // 1-based input position while ScreenRetrieval tracks the document; 0 otherwise
+}
+
+// Actions for a retrieved document.
+const (
+	ActionKeep       = "keep"
+	ActionRedact     = "redact"     // kept with masked content
+	ActionDrop       = "drop"       // removed from the results
+	ActionQuarantine = "quarantine" // removed from the results and returned separately for review
+)
+
+// Reasons for removing or redacting a document, besides ReasonIndirectInjection.
+const (
+	ReasonNamespace     = "namespace_not_allowed"
+	ReasonClearance     = "above_clearance"
+	ReasonDLP           = "dlp"
+	ReasonSensitiveTerm = "sensitive_term"
+	ReasonFiltered      = "filtered" // a custom filter without a Reason method
+	ReasonQueryBlocked  = "query_blocked"
+)
+
+// Verdict is what happened to one retrieved document. Index is its position
+// in the input.
+type Verdict struct {
+	Index   int      `json:"index"`
+	ID      string   `json:"id"`
+	Action  string   `json:"action"`
+	Reason  string   `json:"reason,omitempty"`
+	Score   float64  `json:"score"`
+	Signals []string `json:"signals,omitempty"`
 }
 
 // Security enforces namespace isolation, query validation, and result filtering.
 type Security struct {
-	policy            policy.Engine
-	injectionPatterns []*regexp.Regexp
-	filters           []ResultFilter
+	policy    policy.Engine
+	injection *injection.Detector
+	actions   DocumentActions
+	access    AccessPolicy
+	filters   []ResultFilter
 }
 
 // NewSecurity constructs a Security layer.
 func NewSecurity(p policy.Engine) *Security {
 	return &Security{
-		policy:            p,
-		injectionPatterns: defaultInjectionPatterns(),
+		policy:    p,
+		injection: injection.NewDetector(nil),
+		access:    ACLPolicy{},
 		filters: []ResultFilter{
-			&DLPFilter{},
 			&SensitivityFilter{},
+			&DLPFilter{},
+			&TermFilter{policy: p},
 		},
 	}
 }
@@ -49,45 +85,183 @@ func (s *Security) ValidateNamespace(tenantID, namespace string) error {
 	if len(allowed) == 0 {
 		return nil // open by default if not configured
 	}
+	if namespaceAllowed(allowed, namespace) {
+		return nil
+	}
+	return ErrNamespaceNotAllowed
+}
+
+// namespaceAllowed matches namespace against allowed names, "*" and prefix
+// wildcards such as "kb/*".
+func namespaceAllowed(allowed []string, namespace string) bool {
 	for _, ns := range allowed {
 		if ns == namespace || ns == "*" {
-			return nil
+			return true
 		}
-		// Support wildcard prefix matching
 		if strings.HasSuffix(ns, "*") && strings.HasPrefix(namespace, strings.TrimSuffix(ns, "*")) {
-			return nil
+			return true
 		}
 	}
-	return ErrNamespaceNotAllowed
+	return false
+}
+
+// WithInjection replaces the injection detector, e.g. to apply per-tenant thresholds.
+func (s *Security) WithInjection(det *injection.Detector) {
+	s.injection = det
+}
+
+// WithDocumentActions sets how each tenant handles poisoned documents.
+func (s *Security) WithDocumentActions(actions DocumentActions) {
+	s.actions = actions
+}
+
+// WithAccessPolicy replaces the in-process document ACL check, e.g. with OPA.
+func (s *Security) WithAccessPolicy(p AccessPolicy) {
+	s.access = p
 }
 
-// ValidateQuery checks query for injection patterns.
+// ValidateQuery checks query for injection attempts.
 func (s *Security) ValidateQuery(tenantID, query string) error {
-	queryLower := strings.ToLower(query)
-	for _, pattern := range s.injectionPatterns {
-		if pattern.MatchString(queryLower) {
-			return ErrQueryInjection
-		}
+	if _, hit := s.ScoreQuery(tenantID, query); hit {
+		return ErrQueryInjection
 	}
 	return nil
 }
 
-// FilterResults applies all filters to results.
-func (s *Security) FilterResults(tenantID string, docs []Document, userLevel string) []Document {
-	filtered := docs
+// ScoreQuery returns the query's injection score and whether it reaches the tenant's threshold.
+func (s *Security) ScoreQuery(tenantID, query string) (injection.Result, bool) {
+	return s.injection.Detect(tenantID, query)
+}
+
+// FilterResult is the outcome of ScreenRetrieval: the documents to pass to the
+// model, redacted ones included, the quarantined ones, and the verdict of every
+// input document.
+type FilterResult struct {
+	Documents   []Document `json:"documents"`
+	Quarantined []Document `json:"quarantined,omitempty"`
+	Verdicts    []Verdict  `json:"verdicts"`
+}
+
+// Split returns the passed documents by verdict, and the verdicts of the
+// removed ones.
+func (r FilterResult) Split() (allowed, redacted []Document, removed []Verdict) {
+	allowed, redacted = []Document{}, []Document{}
+	for _, doc := range r.Documents {
+		if doc.seq > 0 && r.Verdicts[doc.seq-1].Action == ActionRedact {
+			redacted = append(redacted, doc)
+		} else {
+			allowed = append(allowed, doc)
+		}
+	}
+	removed = []Verdict{}
+	for _, v := range r.Verdicts {
+		if v.Action == ActionDrop || v.Action == ActionQuarantine {
+			removed = append(removed, v)
+		}
+	}
+	return allowed, redacted, removed
+}
+
+// Reject removes every document for reason, e.g. when the query itself is blocked.
+func Reject(docs []Document, reason string) FilterResult {
+	res := FilterResult{Documents: []Document{}, Verdicts: make([]Verdict, 0, len(docs))}
+	for i, doc := range docs {
+		res.Verdicts = append(res.Verdicts, Verdict{Index: i, ID: doc.ID, Action: ActionDrop, Reason: reason})
+	}
+	return res
+}
+
+// Retrieval is one set of candidate documents retrieved for a subject.
+type Retrieval struct {
+	Namespace string
+	UserLevel string   // caller clearance for SensitivityFilter
+	Subject   *Subject // nil: only unrestricted documents pass the ACL check
+	Documents []Document
+}
+
+// ScreenRetrieval runs the whole chain for one retrieval. Documents outside
+// the namespace (or the tenant's allowed namespaces when it is empty) are
+// removed, then those the subject may not open under the access policy. The
+// rest are scanned for indirect prompt injection before the result filters, so
+// that redaction cannot hide a poisoned chunk. Documents without a namespace
+// are taken to be in the namespace.
+func (s *Security) ScreenRetrieval(ctx context.Context, tenantID string, r Retrieval) FilterResult {
+	allowed := s.policy.AllowedNamespaces(tenantID)
+	docs := r.Documents
+	if r.Namespace != "" {
+		allowed = []string{r.Namespace}
+		docs = append([]Document(nil), docs...)
+		for i := range docs {
+			if docs[i].Namespace == "" {
+				docs[i].Namespace = r.Namespace
+			}
+		}
+	}
+	filtered, verdicts := startTracking(docs)
+	filtered = track(NewNamespaceFilter(allowed), tenantID, filtered, r.UserLevel, verdicts)
+	filtered = s.checkAccess(ctx, tenantID, r.Subject, filtered, verdicts)
+	return s.filter(tenantID, filtered, r.UserLevel, verdicts)
+}
+
+// startTracking numbers docs for track and gives each a keep verdict.
+func startTracking(docs []Document) ([]Document, []Verdict) {
+	tracked := make([]Document, len(docs))
+	verdicts := make([]Verdict, len(docs))
+	for i, doc := range docs {
+		doc.seq = i + 1
+		tracked[i] = doc
+		verdicts[i] = Verdict{Index: i, ID: doc.ID, Action: ActionKeep}
+	}
+	return tracked, verdicts
+}
+
+// filter scans the tracked documents, then applies the result filters.
+func (s *Security) filter(tenantID string, docs []Document, userLevel string, verdicts []Verdict) FilterResult {
+	filtered, quarantined := s.scan(tenantID, docs, verdicts)
 	for _, filter := range s.filters {
-		filtered = filter.Filter(tenantID, filtered, userLevel)
+		filtered = track(filter, tenantID, filtered, userLevel, verdicts)
 	}
-	return filtered
+	return FilterResult{Documents: filtered, Quarantined: quarantined, Verdicts: verdicts}
+}
+
+// track applies one filter and records in verdicts which documents it removed
+// or changed, under the filter's reason.
+func track(f ResultFilter, tenantID string, docs []Document, userLevel string, verdicts []Verdict) []Document {
+	before := make(map[int]string, len(docs))
+	for _, doc := range docs {
+		before[doc.seq] = doc.Content
+	}
+	out := f.Filter(tenantID, docs, userLevel)
+	reason := ReasonFiltered
+	if r, ok := f.(interface{ Reason() string }); ok {
+		reason = r.Reason()
+	}
+	for _, doc := range out {
+		content, ok := before[doc.seq]
+		if !ok {
+			continue
+		}
+		delete(before, doc.seq)
+		if doc.Content == content {
+			continue
+		}
+		v := &verdicts[doc.seq-1]
+		if v.Action == ActionKeep {
+			v.Action, v.Reason = ActionRedact, reason
+		}
+		v.Signals = append(v.Signals, "redacted:"+reason)
+	}
+	for seq := range before {
+		v := &verdicts[seq-1]
+		v.Action, v.Reason = ActionDrop, reason
+	}
+	return out
 }
 
 // RedactResult performs basic masking for secrets.
 func (s *Security) RedactResult(result string) string {
-	customTerms := s.policy.CustomTerms("")
-	for _, term := range customTerms {
-		if strings.Contains(strings.ToLower(result), strings.ToLower(term)) {
-			return "[REDACTED: contains sensitive term]"
-		}
+	if containsTerm(result, s.policy.CustomTerms("")) {
+		return termRedaction
 	}
 	if strings.Contains(strings.ToLower(result), "password") {
 		return "[REDACTED]"
@@ -95,29 +269,21 @@ func (s *Security) RedactResult(result string) string {
 	return result
 }
 
-// AddFilter adds a custom result filter.
-func (s *Security) AddFilter(f ResultFilter) {
-	s.filters = append(s.filters, f)
-}
+const termRedaction = "[REDACTED: contains sensitive term]"
 
-// defaultInjectionPatterns returns patterns to detect injection.
-func defaultInjectionPatterns() []*regexp.Regexp {
-	patterns := []string{
-		`(?i)ignore\s+previous\s+instructions`,
-		`(?i)forget\s+all\s+(previous|prior)`,
-		`(?i)disregard\s+(above|previous)`,
-		`(?i)system\s*:\s*you\s+are`,
-		`(?i)\[INST\]`,
-		`(?i)<\|im_start\|>`,
-		`(?i)###\s*instruction`,
-	}
-	compiled := make([]*regexp.Regexp, 0, len(patterns))
-	for _, p := range patterns {
-		if re, err := regexp.Compile(p); err == nil {
-			compiled = append(compiled, re)
+func containsTerm(content string, terms []string) bool {
+	lc := strings.ToLower(content)
+	for _, term := range terms {
+		if term != "" && strings.Contains(lc, strings.ToLower(term)) {
+			return true
 		}
 	}
-	return compiled
+	return false
+}
+
+// AddFilter adds a custom result filter.
+func (s *Security) AddFilter(f ResultFilter) {
+	s.filters = append(s.filters, f)
 }
 
 // ResultFilter interface for filtering results.
@@ -142,6 +308,32 @@ func (f *DLPFilter) Filter(tenantID string, docs []Document, userLevel string) [
 	return result
 }
 
+// Reason names why the filter redacted a document.
+func (f *DLPFilter) Reason() string { return ReasonDLP }
+
+// TermFilter masks documents containing one of the tenant's custom sensitive terms.
+type TermFilter struct {
+	policy policy.Engine
+}
+
+func (f *TermFilter) Filter(tenantID string, docs []Document, userLevel string) []Document {
+	terms := f.policy.CustomTerms(tenantID)
+	if len(terms) == 0 {
+		return docs
+	}
+	result := make([]Document, 0, len(docs))
+	for _, doc := range docs {
+		if containsTerm(doc.Content, terms) {
+			doc.Content = termRedaction
+		}
+		result = append(result, doc)
+	}
+	return result
+}
+
+// Reason names why the filter redacted a document.
+func (f *TermFilter) Reason() string { return ReasonSensitiveTerm }
+
 func containsSensitiveData(content string) bool {
 	lc := strings.ToLower(content)
 	patterns := []string{
@@ -184,6 +376,9 @@ func (f *SensitivityFilter) Filter(tenantID string, docs []Document, userLevel s
 	return result
 }
 
+// Reason names why the filter removed a document.
+func (f *SensitivityFilter) Reason() string { return ReasonClearance }
+
 // NamespaceFilter filters by allowed namespaces.
 type NamespaceFilter struct {
 	allowedNamespaces []string
@@ -199,12 +394,12 @@ func (f *NamespaceFilter) Filter(tenantID string, docs []Document, userLevel str
 	}
 	result := make([]Document, 0, len(docs))
 	for _, doc := range docs {
-		for _, ns := range f.allowedNamespaces {
-			if ns == doc.Namespace || ns == "*" {
-				result = append(result, doc)
-				break
-			}
+		if namespaceAllowed(f.allowedNamespaces, doc.Namespace) {
+			result = append(result, doc)
 		}
 	}
 	return result
 }
+
+// Reason names why the filter removed a document.
+func (f *NamespaceFilter) Reason() string { return ReasonNamespace }
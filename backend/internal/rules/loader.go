@@ -4,17 +4,20 @@ import (
 	"encoding/json"
 	"os"
 	"time"
+
+	"aiguardrails/internal/keyword"
 )
 
 type ValidationRule struct {
-	ID          string   `json:"id"`
-	Name        string   `json:"name"`
-	Description string   `json:"description"`
-	Severity    string   `json:"severity"`
-	Category    string   `json:"category"`
-	Tags        []string `json:"tags"`
-	Type        string   `json:"type,omitempty"`
-	Content     string   `json:"content,omitempty"`
+	ID          string           `json:"id"`
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Severity    string           `json:"severity"`
+	Category    string           `json:"category"`
+	Tags        []string         `json:"tags"`
+	Type        string           `json:"type,omitempty"`
+	Content     string           `json:"content,omitempty"`
+	Match       *keyword.Options `json:"match,omitempty"`
 }
 
 // Convert JSON seed format to Rule struct
@@ -44,6 +47,7 @@ func LoadFromJSON(path string, store Store) error {
 			Severity:    sr.Severity,
 			Category:    sr.Category,
 			Tags:        sr.Tags,
+			Match:       sr.Match,
 			CreatedAt:   time.Now(),
 			UpdatedAt:   time.Now(),
 			IsSystem:    true,
@@ -2,6 +2,8 @@ package rules
 
 import (
 	"time"
+
+	"aiguardrails/internal/keyword"
 )
 
 type RuleType string
@@ -14,17 +16,18 @@ const (
 
 // Rule represents a guardrail definition.
 type Rule struct {
-	ID          string    `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Type        RuleType  `json:"type"`
-	Content     string    `json:"content"`  // Rego code, Prompt Template, or Keywords
-	Severity    string    `json:"severity"` // low, medium, high
-	Category    string    `json:"category"`
-	Tags        []string  `json:"tags"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	IsSystem    bool      `json:"is_system"` // If true, cannot be deleted
+	ID          string           `json:"id"`
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Type        RuleType         `json:"type"`
+	Content     string           `json:"content"`  // Rego code, Prompt Template, or Keywords
+	Severity    string           `json:"severity"` // low, medium, high
+	Category    string           `json:"category"`
+	Tags        []string         `json:"tags"`
+	Match       *keyword.Options `json:"match,omitempty"` // keyword rules: Chinese-aware matching, common characters only (see keyword.Options)
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+	IsSystem    bool             `json:"is_system"` // If true, cannot be deleted
 }
 
 // Store defines persistence for rules.
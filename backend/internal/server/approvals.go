@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"aiguardrails/internal/approval"
+	"aiguardrails/internal/auth"
+	"aiguardrails/internal/rbac"
+)
+
+// registerApprovalRoutes 注册智能体工具调用审批路由
+func (s *Server) registerApprovalRoutes(r chi.Router) {
+	r.Get("/agent/approvals", s.listApprovals)
+	r.Get("/agent/approvals/{id}", s.getApproval)
+	r.Post("/agent/approvals/{id}/decision", s.decideApproval)
+}
+
+// adminTenantScope returns the tenant a tenant admin is limited to; empty
+// for platform admins and the admin token.
+func adminTenantScope(ctx context.Context) string {
+	if rbac.RoleFromContext(ctx) == rbac.RoleTenantAdmin {
+		return auth.TenantIDFromContext(ctx)
+	}
+	return ""
+}
+
+// adminUsername returns the username of an admin signed in with a JWT.
+func adminUsername(ctx context.Context) string {
+	if v, ok := ctx.Value(authUserCtxKey).(string); ok {
+		return v
+	}
+	return ""
+}
+
+// listApprovals lists approval requests, pending ones unless ?status= names
+// another state or "all".
+func (s *Server) listApprovals(w http.ResponseWriter, r *http.Request) {
+	tenantID := r.URL.Query().Get("tenant_id")
+	if scope := adminTenantScope(r.Context()); scope != "" {
+		tenantID = scope
+	}
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = approval.StatusPending
+	case "all":
+		status = ""
+	}
+	limit := 100
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
+			limit = parsed
+		}
+	}
+	list, err := s.approvals.List(tenantID, status, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []approval.Request{}
+	}
+	s.writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) getApproval(w http.ResponseWriter, r *http.Request) {
+	a, ok := s.loadApproval(w, r)
+	if !ok {
+		return
+	}
+	s.writeJSON(w, http.StatusOK, a)
+}
+
+type approvalDecisionRequest struct {
+	Approve bool   `json:"approve"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// adminTokenApprover is the approver of decisions made with the admin token.
+// Everyone holding the token is one approver, so the token alone never meets
+// a two-person rule.
+const adminTokenApprover = "admin-token"
+
+// decideApproval records the caller's decision on an approval request. The
+// approver is the signed-in admin, never a name from the body. A denial
+// aborts the suspended run; the last approval needed resumes it.
+func (s *Server) decideApproval(w http.ResponseWriter, r *http.Request) {
+	a, ok := s.loadApproval(w, r)
+	if !ok {
+		return
+	}
+	var req approvalDecisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	approver := adminUsername(r.Context())
+	if approver == "" {
+		approver = adminTokenApprover
+	}
+	updated, err := s.approvals.Decide(r.Context(), a.ID, approval.Decision{Approver: approver, Approved: req.Approve, Comment: req.Comment})
+	switch {
+	case err == nil:
+		s.writeJSON(w, http.StatusOK, updated)
+	case errors.Is(err, approval.ErrNoApprover):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, approval.ErrSelfApproval):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, approval.ErrNotPending), errors.Is(err, approval.ErrExpired),
+		errors.Is(err, approval.ErrDuplicateApprover), errors.Is(err, approval.ErrConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, approval.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// loadApproval loads the request named in the path; tenant admins only see their tenant's.
+func (s *Server) loadApproval(w http.ResponseWriter, r *http.Request) (*approval.Request, bool) {
+	a, err := s.approvals.Get(chi.URLParam(r, "id"))
+	if errors.Is(err, approval.ErrNotFound) {
+		http.Error(w, "approval not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if scope := adminTenantScope(r.Context()); scope != "" && a.TenantID != scope {
+		http.Error(w, "approval not found", http.StatusNotFound)
+		return nil, false
+	}
+	return a, true
+}
+
+// Agent run states reported by getAgentRun.
+const (
+	runAwaitingApproval = "awaiting_approval"
+	runResuming         = "resuming"
+	runFinished         = "finished"
+)
+
+type agentRunStatus struct {
+	RunID    string            `json:"run_id"`
+	Status   string            `json:"status"`
+	Approval *approval.Request `json:"approval"`
+	// Result is the response of the run once it was resumed or aborted.
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+// getAgentRun reports a run suspended for approval: still waiting, being
+// resumed, or finished with its result.
+func (s *Server) getAgentRun(w http.ResponseWriter, r *http.Request) {
+	runID := chi.URLParam(r, "runID")
+	a, err := s.approvals.LatestForRun(runID)
+	if errors.Is(err, approval.ErrNotFound) || (err == nil && a.TenantID != auth.TenantIDFromContext(r.Context())) {
+		http.Error(w, "run not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	st := agentRunStatus{RunID: runID, Approval: a, Result: a.Outcome}
+	switch {
+	case a.Status == approval.StatusPending:
+		st.Status = runAwaitingApproval
+	case len(a.Outcome) == 0:
+		st.Status = runResuming
+	default:
+		st.Status = runFinished
+	}
+	s.writeJSON(w, http.StatusOK, st)
+}
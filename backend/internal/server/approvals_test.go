@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"aiguardrails/internal/approval"
+	"aiguardrails/internal/auth"
+	"aiguardrails/internal/config"
+	"aiguardrails/internal/rbac"
+)
+
+func TestDecideApprovalScopesTenantAdmins(t *testing.T) {
+	cfg := config.Default()
+	cfg.AdminToken = "admin-token"
+	s := &Server{cfg: cfg, jwtSigner: &auth.JWTSigner{Secret: []byte("test-secret")}, approvals: approval.NewService(approval.NewMemoryStore(), time.Hour)}
+	router := chi.NewRouter()
+	router.Use(s.adminAuth())
+	s.registerApprovalRoutes(router)
+
+	a := &approval.Request{RunID: "run-1", TenantID: "t1", Requester: "app:app-1", Tool: "start_stop", Approvers: 2}
+	if err := s.approvals.Submit(context.Background(), a); err != nil {
+		t.Fatal(err)
+	}
+	decide := func(cred, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/agent/approvals/"+a.ID+"/decision", strings.NewReader(body))
+		if strings.HasPrefix(cred, "Bearer ") {
+			req.Header.Set("Authorization", cred)
+		} else {
+			req.Header.Set("X-Admin-Token", cred)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	token := func(user, tenantID string) string {
+		tok, err := s.jwtSigner.Sign(user, rbac.RoleTenantAdmin, tenantID, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + tok
+	}
+
+	if rec := decide(token("mallory", "t2"), `{"approve":true}`); rec.Code != http.StatusNotFound {
+		t.Fatalf("another tenant's admin must not see the approval: %d", rec.Code)
+	}
+	// The token is one approver whatever name the body gives.
+	rec := decide("admin-token", `{"approve":true,"approver":"alice"}`)
+	var got approval.Request
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || rec.Code != http.StatusOK || got.Decisions[0].Approver != adminTokenApprover {
+		t.Fatalf("unexpected decision: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := decide("admin-token", `{"approve":true,"approver":"bob"}`); rec.Code != http.StatusConflict {
+		t.Fatalf("the token must not approve twice: %d %s", rec.Code, rec.Body.String())
+	}
+	rec = decide(token("alice", "t1"), `{"approve":true}`)
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got.Status != approval.StatusApproved || got.Decisions[1].Approver != "alice" {
+		t.Fatalf("expected the second approver to approve: %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"aiguardrails/internal/auth"
+	"aiguardrails/internal/policy"
+	"aiguardrails/internal/types"
+)
+
+const decisionRules = `[
+  {"id":"confirm-restart","name":"Restart needs confirmation","severity":"high","decision":"confirm","priority":10,
+   "conditions":[{"field":"prompt","operator":"contains","value":"restart line"}]},
+  {"id":"redact-serial","name":"Serial numbers","severity":"low","priority":1,
+   "conditions":[{"field":"output","operator":"regex","value":"SN-\\d+"}],
+   "actions":[{"type":"redact","redact_pattern":"SN-\\d+"}]}
+]`
+
+func newDecisionTestServer(t *testing.T) *Server {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "rules.json"), []byte(decisionRules), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := policy.NewRulesRepository(dir)
+	if err != nil {
+		t.Fatalf("load rules: %v", err)
+	}
+	s := newProxyTestServer("http://127.0.0.1:0")
+	s.rulesRepo = repo
+	s.jwtSigner = &auth.JWTSigner{Secret: []byte("test-secret")}
+	s.pipeline = s.newPipeline()
+	if _, err := s.policy.CreatePolicy(types.Policy{TenantID: "t1", PromptRules: []string{"confirm-restart", "redact-serial"}}); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func postGuardrail(t *testing.T, handler http.HandlerFunc, body interface{}) types.GuardrailResult {
+	data, _ := json.Marshal(body)
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data)))
+	var res types.GuardrailResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+	return res
+}
+
+func TestCheckPromptConfirmRoundTrip(t *testing.T) {
+	s := newDecisionTestServer(t)
+	prompt := "please restart line 3"
+
+	res := postGuardrail(t, s.checkPrompt, map[string]string{"tenant_id": "t1", "prompt": prompt})
+	if res.Allowed || res.Decision != types.DecisionConfirm || res.ConfirmToken == "" {
+		t.Fatalf("expected confirm challenge: %+v", res)
+	}
+
+	// The token is bound to the exact prompt.
+	other := postGuardrail(t, s.checkPrompt, map[string]string{"tenant_id": "t1", "prompt": prompt + "!", "confirm_token": res.ConfirmToken})
+	if other.Allowed {
+		t.Fatalf("token must not confirm a different prompt: %+v", other)
+	}
+
+	ok := postGuardrail(t, s.checkPrompt, map[string]string{"tenant_id": "t1", "prompt": prompt, "confirm_token": res.ConfirmToken})
+	if !ok.Allowed || ok.Decision != types.DecisionAllow {
+		t.Fatalf("echoed token should confirm: %+v", ok)
+	}
+}
+
+func TestCheckOutputRedacts(t *testing.T) {
+	s := newDecisionTestServer(t)
+	res := postGuardrail(t, s.checkOutput, map[string]string{"tenant_id": "t1", "output": "unit SN-12345 is healthy"})
+	if !res.Allowed || res.Decision != types.DecisionRedact || res.TransformedText != "unit [REDACTED] is healthy" {
+		t.Fatalf("expected redacted output: %+v", res)
+	}
+	if len(res.Rules) != 1 || res.Rules[0].RuleID != "redact-serial" {
+		t.Fatalf("expected matched rule: %+v", res.Rules)
+	}
+	if len(res.Findings) != 1 || res.Findings[0].RuleID != "redact-serial" || res.Findings[0].Start != 5 || res.Findings[0].End != 13 {
+		t.Fatalf("expected a finding on the serial number: %+v", res.Findings)
+	}
+}
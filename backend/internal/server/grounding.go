@@ -0,0 +1,28 @@
+package server
+
+import (
+	"aiguardrails/internal/grounding"
+	"aiguardrails/internal/policy"
+	"aiguardrails/internal/rag"
+)
+
+// groundingInput builds the grounding check of an output from its context
+// documents and the tenant's grounding rules; nil docs skip the check.
+func (s *Server) groundingInput(tenantID string, docs []rag.Document) *grounding.Input {
+	if docs == nil {
+		return nil
+	}
+	var cfg *policy.GroundingRuleConfig
+	if pc, err := s.PipelineConfig(tenantID); err == nil && pc != nil {
+		cfg = pc.Grounding
+	}
+	in := &grounding.Input{Rules: grounding.RulesFrom(cfg)}
+	for _, d := range docs {
+		url := d.Metadata["url"]
+		if url == "" {
+			url = d.Metadata["source"]
+		}
+		in.Sources = append(in.Sources, grounding.Source{ID: d.ID, Content: d.Content, URL: url})
+	}
+	return in
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"testing"
+
+	"aiguardrails/internal/grounding"
+	"aiguardrails/internal/pipeline"
+	"aiguardrails/internal/rag"
+	"aiguardrails/internal/types"
+)
+
+func TestCheckOutputGroundsAgainstContext(t *testing.T) {
+	s := newProxyTestServer("http://127.0.0.1:0")
+	docs := []rag.Document{
+		{ID: "returns", Content: "Returns are accepted within 30 days of purchase. Refunds are issued within 5 business days."},
+	}
+	output := "You can return items within 30 days of purchase [1]. Shipping is free on all orders over $50 [3]."
+
+	res := postGuardrail(t, s.checkOutput, map[string]interface{}{"tenant_id": "t1", "output": output, "context": docs})
+	if !res.Allowed || res.Decision != types.DecisionMark || res.Reason != grounding.ReasonFabricatedCitation {
+		t.Fatalf("expected a marked answer: %+v", res)
+	}
+	g := res.Grounding
+	if g == nil || g.Claims != 2 || g.Unsupported != 1 || len(g.Sentences) != 2 || !g.Sentences[0].Supported || g.Sentences[1].Supported {
+		t.Fatalf("unexpected report: %+v", g)
+	}
+	if len(res.Findings) != 1 || res.Findings[0].Detector != pipeline.StageGrounding || res.Findings[0].Start != g.Sentences[1].Start {
+		t.Fatalf("unexpected findings: %+v", res.Findings)
+	}
+
+	// Without context the output is not grounded.
+	res = postGuardrail(t, s.checkOutput, map[string]interface{}{"tenant_id": "t1", "output": output})
+	if !res.Allowed || res.Grounding != nil {
+		t.Fatalf("grounding should be skipped: %+v", res)
+	}
+}
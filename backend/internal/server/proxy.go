@@ -0,0 +1,470 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"aiguardrails/internal/auth"
+	"aiguardrails/internal/pipeline"
+	"aiguardrails/internal/promptfw"
+	"aiguardrails/internal/proxy"
+	"aiguardrails/internal/types"
+	"aiguardrails/internal/vault"
+)
+
+const (
+	maxProxyRequestBytes  = 4 << 20
+	maxProxyResponseBytes = 16 << 20
+	// confirmHeader carries the confirm token of an earlier confirm decision.
+	confirmHeader = "X-Guardrail-Confirm"
+	// anonymizeHeader turns on prompt pseudonymization for one request.
+	anonymizeHeader = "X-Guardrail-Anonymize"
+	// sessionHeader names the conversation: the session guard tracks it and the
+	// pseudonymization vault scopes its mapping to it; it is echoed on the response.
+	sessionHeader = "X-Guardrail-Session"
+)
+
+// registerUpstreamRoutes 注册代理上游配置路由
+func (s *Server) registerUpstreamRoutes(r chi.Router) {
+	r.Get("/tenants/{tenantID}/upstreams", s.listUpstreams)
+	r.Put("/tenants/{tenantID}/upstreams", s.upsertUpstream)
+	r.Delete("/tenants/{tenantID}/upstreams/{upstreamID}", s.deleteUpstream)
+}
+
+type upstreamRequest struct {
+	AppID      string `json:"app_id,omitempty"`
+	Protocol   string `json:"protocol,omitempty"` // openai (default) | anthropic | ollama
+	BaseURL    string `json:"base_url"`
+	APIKey     string `json:"api_key,omitempty"`
+	Model      string `json:"model,omitempty"`
+	TimeoutSec int    `json:"timeout_sec,omitempty"`
+	Enabled    *bool  `json:"enabled,omitempty"`
+}
+
+func (s *Server) listUpstreams(w http.ResponseWriter, r *http.Request) {
+	tenantID := chi.URLParam(r, "tenantID")
+	if !s.allowedTenant(r.Context(), tenantID) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	list, err := s.upstreamStore.List(tenantID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	out := make([]proxy.Upstream, 0, len(list))
+	for _, u := range list {
+		out = append(out, u.Redacted())
+	}
+	s.writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) upsertUpstream(w http.ResponseWriter, r *http.Request) {
+	tenantID := chi.URLParam(r, "tenantID")
+	if !s.allowedTenant(r.Context(), tenantID) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	var req upstreamRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.BaseURL == "" {
+		http.Error(w, "base_url required", http.StatusBadRequest)
+		return
+	}
+	if err := proxy.ValidateBaseURL(r.Context(), req.BaseURL, s.cfg.ProxyAllowPrivate); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Protocol == "" {
+		req.Protocol = proxy.ProtocolOpenAI
+	}
+	if _, err := proxy.Lookup(req.Protocol); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	u, err := s.upstreamStore.Upsert(proxy.Upstream{
+		TenantID:   tenantID,
+		AppID:      req.AppID,
+		Protocol:   req.Protocol,
+		BaseURL:    req.BaseURL,
+		APIKey:     req.APIKey,
+		Model:      req.Model,
+		TimeoutSec: req.TimeoutSec,
+		Enabled:    enabled,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.audit.RecordStore(s.auditStore, "upstream_updated", map[string]string{"tenant_id": tenantID, "app_id": req.AppID, "protocol": req.Protocol, "base_url": req.BaseURL})
+	s.writeJSON(w, http.StatusOK, u.Redacted())
+}
+
+func (s *Server) deleteUpstream(w http.ResponseWriter, r *http.Request) {
+	tenantID := chi.URLParam(r, "tenantID")
+	if !s.allowedTenant(r.Context(), tenantID) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	id := chi.URLParam(r, "upstreamID")
+	if err := s.upstreamStore.Delete(tenantID, id); err != nil {
+		if errors.Is(err, proxy.ErrUpstreamNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.audit.RecordStore(s.auditStore, "upstream_deleted", map[string]string{"tenant_id": tenantID, "upstream_id": id})
+	s.writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// resolveUpstream picks the app upstream, then the tenant upstream, then the configured default for the protocol.
+func (s *Server) resolveUpstream(tenantID, appID, protocol string) (*proxy.Upstream, error) {
+	if s.upstreamStore != nil {
+		u, err := s.upstreamStore.Resolve(tenantID, appID, protocol)
+		if err == nil {
+			return u, nil
+		}
+		if !errors.Is(err, proxy.ErrUpstreamNotFound) {
+			return nil, err
+		}
+	}
+	def := proxy.Upstream{TenantID: tenantID, Protocol: protocol, Enabled: true}
+	switch protocol {
+	case proxy.ProtocolOpenAI:
+		def.BaseURL, def.APIKey, def.Model = s.cfg.ProxyUpstreamURL, s.cfg.ProxyUpstreamKey, s.cfg.ProxyUpstreamModel
+	case proxy.ProtocolAnthropic:
+		def.BaseURL, def.APIKey = s.cfg.ProxyAnthropicURL, s.cfg.ProxyAnthropicKey
+	case proxy.ProtocolOllama:
+		def.BaseURL = s.cfg.ProxyOllamaURL
+	}
+	if def.BaseURL == "" {
+		return nil, proxy.ErrUpstreamNotFound
+	}
+	return &def, nil
+}
+
+// proxyChatCompletions is an OpenAI-compatible /v1/chat/completions endpoint.
+func (s *Server) proxyChatCompletions(w http.ResponseWriter, r *http.Request) {
+	s.serveProxy(w, r, proxy.OpenAI)
+}
+
+// proxyMessages is an Anthropic-compatible /v1/messages endpoint.
+func (s *Server) proxyMessages(w http.ResponseWriter, r *http.Request) {
+	s.serveProxy(w, r, proxy.Anthropic)
+}
+
+// proxyOllamaChat is an Ollama-compatible /api/chat endpoint.
+func (s *Server) proxyOllamaChat(w http.ResponseWriter, r *http.Request) {
+	s.serveProxy(w, r, proxy.Ollama)
+}
+
+// serveProxy runs the guarded pipeline for one wire protocol:
+// prompt check -> upstream LLM -> output filter. Streamed replies are filtered incrementally.
+func (s *Server) serveProxy(w http.ResponseWriter, r *http.Request, p proxy.Protocol) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxProxyRequestBytes))
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, p.Error("invalid_request_error", err.Error()))
+		return
+	}
+	req, err := p.DecodeRequest(body)
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, p.Error("invalid_request_error", err.Error()))
+		return
+	}
+	ctx := r.Context()
+	tenantID := auth.TenantIDFromContext(ctx)
+	appID := auth.AppIDFromContext(ctx)
+	if !s.allowQuota(w, r, appID) {
+		return
+	}
+
+	check := s.runConfirmable(ctx, pipeline.KindPrompt, tenantID, appID, req.PromptText(), nil, r.Header.Get(confirmHeader), r.Header.Get(sessionHeader), nil)
+	// Client messages are not rewritten: a redact decision is returned with the
+	// transformed text so the client can resend it.
+	if !check.Allowed || check.TransformedText != "" {
+		s.audit.RecordStore(s.auditStore, "proxy_prompt_blocked", map[string]string{"tenant_id": tenantID, "app_id": appID, "protocol": p.Name(), "reason": check.Reason})
+		s.writeJSON(w, http.StatusBadRequest, p.GuardrailError(check))
+		return
+	}
+
+	up, err := s.resolveUpstream(tenantID, appID, p.Name())
+	if err != nil {
+		s.writeJSON(w, http.StatusBadGateway, p.Error("upstream_error", "no upstream configured: "+err.Error()))
+		return
+	}
+	var mapping map[string]string
+	if s.vault != nil && (s.cfg.ProxyAnonymize || r.Header.Get(anonymizeHeader) == "true") {
+		// Fail closed: PII must not reach the upstream when the vault is unavailable.
+		mapping, err = s.anonymizeRequest(w, r, req, tenantID)
+		if err != nil {
+			s.writeJSON(w, http.StatusServiceUnavailable, p.Error("server_error", "pseudonymization failed: "+err.Error()))
+			return
+		}
+	}
+	payload, err := req.Encode(up.Model)
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, p.Error("invalid_request_error", err.Error()))
+		return
+	}
+	resp, cancel, err := s.proxyClient.Forward(ctx, *up, p, payload, r.Header)
+	if err != nil {
+		s.writeJSON(w, http.StatusBadGateway, p.Error("upstream_error", err.Error()))
+		return
+	}
+	defer cancel()
+	defer resp.Body.Close()
+
+	if req.Streaming() && resp.StatusCode == http.StatusOK {
+		codec, err := p.NewStream(resp.Body, w)
+		if err != nil {
+			s.writeJSON(w, http.StatusInternalServerError, p.Error("server_error", err.Error()))
+			return
+		}
+		s.relayStream(ctx, codec, tenantID, appID, mapping)
+		return
+	}
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxProxyResponseBytes))
+	if err != nil {
+		s.writeJSON(w, http.StatusBadGateway, p.Error("upstream_error", err.Error()))
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		// Upstream error bodies are not screened and may echo the prompt or leak
+		// upstream details: only the status reaches the client.
+		s.audit.RecordStore(s.auditStore, "proxy_upstream_error", map[string]string{"tenant_id": tenantID, "app_id": appID, "protocol": p.Name(), "status": strconv.Itoa(resp.StatusCode)})
+		s.writeJSON(w, resp.StatusCode, p.Error("upstream_error", "upstream returned "+strconv.Itoa(resp.StatusCode)+" "+http.StatusText(resp.StatusCode)))
+		return
+	}
+	reply, err := p.DecodeResponse(respBody)
+	if err != nil {
+		s.writeJSON(w, http.StatusBadGateway, p.Error("upstream_error", "invalid upstream response: "+err.Error()))
+		return
+	}
+	for i, text := range reply.Texts() {
+		if text == "" {
+			continue
+		}
+		res := s.evaluateOutput(ctx, tenantID, appID, text)
+		if res.Allowed && res.TransformedText != "" && reply.Redact(i, res.TransformedText) {
+			w.Header().Set("X-Guardrail-Reason", res.Reason)
+			continue
+		}
+		if !res.Allowed || res.TransformedText != "" {
+			s.audit.RecordStore(s.auditStore, "proxy_output_blocked", map[string]string{"tenant_id": tenantID, "app_id": appID, "protocol": p.Name(), "reason": res.Reason})
+			reply.Refuse(i, res)
+			w.Header().Set("X-Guardrail-Reason", res.Reason)
+		}
+	}
+	if len(mapping) > 0 {
+		// Placeholders are restored after filtering: the client gets back its own values.
+		reply.RewriteText(func(t string) string { return vault.Restore(t, mapping) })
+	}
+	out, err := reply.Encode()
+	if err != nil {
+		s.writeJSON(w, http.StatusInternalServerError, p.Error("server_error", err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(out)
+}
+
+// anonymizeRequest replaces PII in the request messages with vault placeholders and
+// returns the session mapping used to restore the reply.
+func (s *Server) anonymizeRequest(w http.ResponseWriter, r *http.Request, req proxy.Request, tenantID string) (map[string]string, error) {
+	sessionID := r.Header.Get(sessionHeader)
+	if sessionID == "" {
+		sessionID = uuid.NewString()
+	}
+	recs, terms := s.vaultRecognizers(tenantID)
+	var anonErr error
+	err := req.RewriteText(func(text string) string {
+		if anonErr != nil {
+			return text
+		}
+		res, err := s.vault.Anonymize(r.Context(), tenantID, sessionID, text, recs, terms)
+		if err != nil {
+			anonErr = err
+			return text
+		}
+		return res.Text
+	})
+	if err == nil {
+		err = anonErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	w.Header().Set(sessionHeader, sessionID)
+	return s.vault.Mapping(r.Context(), tenantID, sessionID)
+}
+
+// relayStream relays an upstream stream through codec, running every channel (choice or
+// content block) through its own StreamFilter. When a channel ends, its whole text also
+// runs the output pipeline, so stages that cannot judge partial text (OPA, policy and
+// tenant rules, grounding, LLM moderation) still apply; a block then withholds the text
+// still held back and ends the channel as blocked. A blocked channel is ended the
+// protocol's way; the combined decision is written by codec.Finish. Vault placeholders
+// in mapping are restored in released text.
+func (s *Server) relayStream(ctx context.Context, codec proxy.StreamCodec, tenantID, appID string, mapping map[string]string) {
+	mode := s.streamMode("")
+	filters := map[int]*promptfw.StreamFilter{}
+	restorers := map[int]*vault.StreamRestorer{}
+	texts := map[int]*strings.Builder{}
+	blockedBy := map[int]types.GuardrailResult{}
+	finished := map[int]bool{}
+	var order []int
+	var results []types.GuardrailResult
+
+	// restore maps released text back to the client's values; last flushes what a
+	// channel holds back.
+	restore := func(ch int, text string, last bool) string {
+		if len(mapping) == 0 {
+			return text
+		}
+		rs, ok := restorers[ch]
+		if !ok {
+			rs = vault.NewStreamRestorer(mapping)
+			restorers[ch] = rs
+		}
+		out := rs.Write(text)
+		if last {
+			out += rs.Flush()
+		}
+		return out
+	}
+
+	// closeChannel ends a channel's filter and runs the output pipeline on its text.
+	// withheld reports that the pipeline blocked, so the tail must not be released.
+	closeChannel := func(ch int) (tail string, res types.GuardrailResult, withheld bool) {
+		tail, res = filters[ch].Close()
+		if !res.Allowed {
+			return tail, res, false
+		}
+		if full := s.evaluateOutput(ctx, tenantID, appID, texts[ch].String()); !full.Allowed {
+			return "", full, true
+		}
+		return tail, res, false
+	}
+
+	finish := func(ch int, res types.GuardrailResult) {
+		finished[ch] = true
+		results = append(results, res)
+		if !res.Allowed {
+			blockedBy[ch] = res
+			s.audit.RecordStore(s.auditStore, "proxy_output_blocked", map[string]string{"tenant_id": tenantID, "app_id": appID, "reason": res.Reason})
+		}
+	}
+	type channelText struct {
+		ch   int
+		text string
+	}
+
+	over := false
+	for !over {
+		ev, err := codec.Next()
+		if err != nil {
+			break
+		}
+		var pre []channelText
+		var blocked []int
+		for pos, d := range ev.Deltas() {
+			if finished[d.Channel] {
+				ev.Drop(pos)
+				continue
+			}
+			f, ok := filters[d.Channel]
+			if !ok {
+				f = s.newStreamFilter(tenantID, mode)
+				filters[d.Channel] = f
+				texts[d.Channel] = &strings.Builder{}
+				order = append(order, d.Channel)
+			}
+			texts[d.Channel].WriteString(d.Text)
+			emit, stop := f.Write(d.Text)
+			emit = restore(d.Channel, emit, stop)
+			if stop {
+				// Release the safe prefix on its own and end the channel in place of this delta.
+				ev.Drop(pos)
+				if emit != "" {
+					pre = append(pre, channelText{d.Channel, emit})
+				}
+				finish(d.Channel, f.Result())
+				blocked = append(blocked, d.Channel)
+				continue
+			}
+			if d.End {
+				tail, res, withheld := closeChannel(d.Channel)
+				if withheld {
+					emit = ""
+				}
+				emit += restore(d.Channel, tail, true)
+				finish(d.Channel, res)
+				if !res.Allowed {
+					// The hit only completed at the end of the channel; end it as blocked.
+					ev.Drop(pos)
+					if emit != "" {
+						pre = append(pre, channelText{d.Channel, emit})
+					}
+					blocked = append(blocked, d.Channel)
+					continue
+				}
+			}
+			if d.HasText {
+				ev.SetText(pos, emit)
+			} else if emit != "" {
+				pre = append(pre, channelText{d.Channel, emit})
+			}
+		}
+		for _, p := range pre {
+			if err := codec.Text(p.ch, p.text); err != nil {
+				return
+			}
+		}
+		if err := codec.Write(ev); err != nil {
+			return
+		}
+		for _, ch := range blocked {
+			end, err := codec.Block(ch, blockedBy[ch])
+			if err != nil {
+				return
+			}
+			over = over || end
+		}
+	}
+
+	// Upstream ended without closing some channels: release what is held back.
+	for _, ch := range order {
+		if finished[ch] {
+			continue
+		}
+		tail, res, _ := closeChannel(ch)
+		tail = restore(ch, tail, true)
+		finish(ch, res)
+		if tail != "" && !over {
+			_ = codec.Text(ch, tail)
+		}
+		if !res.Allowed && !over {
+			end, _ := codec.Block(ch, res)
+			over = over || end
+		}
+	}
+	_ = codec.Finish(mergeStreamResults(results))
+}
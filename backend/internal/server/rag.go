@@ -0,0 +1,180 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"aiguardrails/internal/auth"
+	"aiguardrails/internal/pipeline"
+	"aiguardrails/internal/rag"
+	"aiguardrails/internal/types"
+)
+
+type ragCheckRequest struct {
+	TenantID string `json:"tenant_id"`
+	Query    string `json:"query"`
+	// Prompt is the former name of Query.
+	Prompt    string `json:"prompt,omitempty"`
+	Namespace string `json:"namespace"`
+	// ClearanceLevel is the caller's highest document sensitivity: public, internal, confidential, secret.
+	ClearanceLevel string `json:"clearance_level"`
+	// Subject is the end user; roles and teams are added from the tenant's users and org.
+	Subject   *rag.Subject   `json:"subject,omitempty"`
+	Documents []rag.Document `json:"documents"`
+}
+
+// ragCheckResponse is the verdict on the query plus what to do with each
+// candidate document. Documents lists the allowed and redacted documents in
+// input order, ready to pass to the model.
+type ragCheckResponse struct {
+	types.GuardrailResult
+	Namespace       string         `json:"namespace,omitempty"`
+	Documents       []rag.Document `json:"documents"`
+	AllowedDocs     []rag.Document `json:"allowed_documents"`
+	RedactedDocs    []rag.Document `json:"redacted_documents"`
+	RemovedDocs     []rag.Verdict  `json:"removed_documents"`
+	QuarantinedDocs []rag.Document `json:"quarantined_documents,omitempty"`
+	Verdicts        []rag.Verdict  `json:"verdicts"`
+}
+
+// checkRAG screens one retrieval: the namespace must be allowed for the
+// tenant, the query runs through the rag pipeline, and the candidate documents
+// through the rag.Security chain.
+func (s *Server) checkRAG(w http.ResponseWriter, r *http.Request) {
+	var req ragCheckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tenantID := req.TenantID
+	if tenantID == "" {
+		tenantID = auth.TenantIDFromContext(r.Context())
+	}
+	if req.Query == "" {
+		req.Query = req.Prompt
+	}
+	appID := auth.AppIDFromContext(r.Context())
+
+	var verdict types.GuardrailResult
+	var docs rag.FilterResult
+	if s.rag != nil && s.rag.ValidateNamespace(tenantID, req.Namespace) != nil {
+		verdict = types.GuardrailResult{
+			Allowed:  false,
+			Decision: types.DecisionBlock,
+			Reason:   rag.ReasonNamespace,
+			Signals:  []string{"namespace:" + req.Namespace},
+		}
+		docs = rag.Reject(req.Documents, rag.ReasonNamespace)
+	} else {
+		verdict = s.runPipeline(r.Context(), pipeline.KindRAG, tenantID, appID, req.Query, nil)
+		switch {
+		case verdict.EffectiveDecision() == types.DecisionBlock:
+			docs = rag.Reject(req.Documents, rag.ReasonQueryBlocked)
+		case s.rag != nil:
+			docs = s.rag.ScreenRetrieval(r.Context(), tenantID, rag.Retrieval{
+				Namespace: req.Namespace,
+				UserLevel: req.ClearanceLevel,
+				Subject:   s.resolveSubject(tenantID, req.Subject),
+				Documents: req.Documents,
+			})
+		default:
+			docs = rag.FilterResult{Documents: req.Documents}
+		}
+	}
+	s.auditDocuments(tenantID, appID, docs.Verdicts)
+
+	res := ragCheckResponse{
+		GuardrailResult: verdict,
+		Namespace:       req.Namespace,
+		Documents:       docs.Documents,
+		QuarantinedDocs: docs.Quarantined,
+		Verdicts:        docs.Verdicts,
+	}
+	res.AllowedDocs, res.RedactedDocs, res.RemovedDocs = docs.Split()
+	if res.Documents == nil {
+		res.Documents = []rag.Document{}
+	}
+	s.writeJSON(w, http.StatusOK, res)
+}
+
+// resolveSubject adds the user's tenant role and org teams (by name and ID) to
+// the attributes the caller passed. Lookup failures leave them as passed, which
+// can only grant less.
+func (s *Server) resolveSubject(tenantID string, subject *rag.Subject) *rag.Subject {
+	if subject == nil || subject.UserID == "" {
+		return subject
+	}
+	out := *subject
+	if s.tenantUserStore != nil {
+		if tu, err := s.tenantUserStore.Get(tenantID, subject.UserID); err == nil && tu.Role != "" {
+			out.Roles = append(append([]string(nil), out.Roles...), tu.Role)
+		}
+	}
+	if s.orgStore != nil {
+		if teams, err := s.orgStore.MemberTeams(tenantID, subject.UserID); err == nil {
+			out.Groups = append([]string(nil), out.Groups...)
+			for _, t := range teams {
+				out.Groups = append(out.Groups, t.Name, t.ID)
+			}
+		}
+	}
+	return &out
+}
+
+type ragDocumentsRequest struct {
+	TenantID  string         `json:"tenant_id"`
+	Namespace string         `json:"namespace"`
+	UserLevel string         `json:"user_level"` // public, internal, confidential, secret
+	Subject   *rag.Subject   `json:"subject,omitempty"`
+	Documents []rag.Document `json:"documents"`
+}
+
+// checkRAGDocuments screens retrieved documents before they reach the model,
+// through the same namespace, ACL and injection chain as checkRAG but without
+// a query to check.
+func (s *Server) checkRAGDocuments(w http.ResponseWriter, r *http.Request) {
+	var req ragDocumentsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tenantID := req.TenantID
+	if tenantID == "" {
+		tenantID = auth.TenantIDFromContext(r.Context())
+	}
+	// Without a namespace, each document must be in one the tenant allows.
+	var res rag.FilterResult
+	if req.Namespace != "" && s.rag.ValidateNamespace(tenantID, req.Namespace) != nil {
+		res = rag.Reject(req.Documents, rag.ReasonNamespace)
+	} else {
+		res = s.rag.ScreenRetrieval(r.Context(), tenantID, rag.Retrieval{
+			Namespace: req.Namespace,
+			UserLevel: req.UserLevel,
+			Subject:   s.resolveSubject(tenantID, req.Subject),
+			Documents: req.Documents,
+		})
+	}
+	s.auditDocuments(tenantID, auth.AppIDFromContext(r.Context()), res.Verdicts)
+	s.writeJSON(w, http.StatusOK, res)
+}
+
+// auditDocuments records documents removed for carrying indirect prompt injection.
+func (s *Server) auditDocuments(tenantID, appID string, verdicts []rag.Verdict) {
+	for _, v := range verdicts {
+		if v.Reason != rag.ReasonIndirectInjection {
+			continue
+		}
+		event := "rag_document_dropped"
+		if v.Action == rag.ActionQuarantine {
+			event = "rag_document_quarantined"
+		}
+		s.audit.RecordStore(s.auditStore, event, map[string]string{
+			"tenant_id":   tenantID,
+			"app_id":      appID,
+			"document_id": v.ID,
+			"reason":      v.Reason,
+			"signals":     strings.Join(v.Signals, ","),
+		})
+	}
+}
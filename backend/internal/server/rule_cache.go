@@ -0,0 +1,144 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"aiguardrails/internal/keyword"
+	"aiguardrails/internal/policy"
+)
+
+// tenantRules is a tenant's resolved prompt rules with their keyword and DLP
+// term automata, compiled once and shared by every request until invalidated.
+type tenantRules struct {
+	ruleIDs       []string
+	keywords      *keyword.Matcher
+	terms         *policy.TermSet // custom sensitive terms plus keyword rule texts
+	outputFilters []string        // the tenant's policy output_filters
+	recognizers   []*policy.Recognizer
+	pipeline      *policy.PipelineRuleConfig // the tenant's pipeline rule; nil means defaults
+	pipelineErr   error                      // a failed load is retried, not served from the cache
+	expires       time.Time
+}
+
+// ruleCache holds compiled tenantRules. Policy and tenant rule edits invalidate
+// one tenant, rule library edits everything; the TTL bounds staleness from edits made on
+// other replicas. A nil cache compiles on every call.
+type ruleCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	gen     uint64 // bumped on invalidation so a build racing an edit is not stored
+	tenants map[string]*tenantRules
+}
+
+func newRuleCache(ttl time.Duration) *ruleCache {
+	return &ruleCache{ttl: ttl, tenants: map[string]*tenantRules{}}
+}
+
+// enabled reports whether results are kept between calls.
+func (c *ruleCache) enabled() bool {
+	return c != nil && c.ttl > 0
+}
+
+// get returns the tenant's cached rules, building them on a miss.
+func (c *ruleCache) get(tenantID string, build func() *tenantRules) *tenantRules {
+	if !c.enabled() {
+		return build()
+	}
+	now := time.Now()
+	c.mu.Lock()
+	if tr, ok := c.tenants[tenantID]; ok && now.Before(tr.expires) {
+		c.mu.Unlock()
+		return tr
+	}
+	gen := c.gen
+	c.mu.Unlock()
+
+	tr := build()
+	tr.expires = now.Add(c.ttl)
+	c.mu.Lock()
+	if c.gen == gen {
+		c.tenants[tenantID] = tr
+	}
+	c.mu.Unlock()
+	return tr
+}
+
+// invalidate drops one tenant's compiled rules.
+func (c *ruleCache) invalidate(tenantID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	delete(c.tenants, tenantID)
+	c.gen++
+	c.mu.Unlock()
+}
+
+// reset drops every tenant's compiled rules, e.g. after a rule library change.
+func (c *ruleCache) reset() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.tenants = map[string]*tenantRules{}
+	c.gen++
+	c.mu.Unlock()
+}
+
+// tenantRules returns the tenant's compiled prompt rules.
+func (s *Server) tenantRules(tenantID string) *tenantRules {
+	return s.ruleCache.get(tenantID, func() *tenantRules {
+		ruleIDs, keywords := s.resolveRules(tenantID)
+		tr := &tenantRules{ruleIDs: ruleIDs, keywords: keyword.Compile(keywords)}
+		if s.firewall != nil {
+			tr.terms = s.firewall.DLPTerms(tenantID, keyword.Texts(keywords))
+		}
+		if s.policy != nil {
+			tr.outputFilters = s.policy.OutputFilters(tenantID)
+		}
+		tr.recognizers = policy.SelectRecognizers(tr.outputFilters)
+		if s.tenantRuleStore != nil {
+			tr.pipeline, tr.pipelineErr = s.tenantRuleStore.PipelineConfig(tenantID)
+		}
+		return tr
+	})
+}
+
+// PipelineConfig returns the tenant's pipeline rule, cached with the compiled rules.
+// Without the cache, or when the cached load failed, it reads the store.
+func (s *Server) PipelineConfig(tenantID string) (*policy.PipelineRuleConfig, error) {
+	if s.tenantRuleStore == nil {
+		return nil, nil
+	}
+	if !s.ruleCache.enabled() {
+		return s.tenantRuleStore.PipelineConfig(tenantID)
+	}
+	if tr := s.tenantRules(tenantID); tr.pipelineErr == nil {
+		return tr.pipeline, nil
+	}
+	return s.tenantRuleStore.PipelineConfig(tenantID)
+}
+
+// InjectionThreshold returns the tenant's prompt injection threshold, 0 when unset.
+func (s *Server) InjectionThreshold(tenantID string) float64 {
+	cfg, err := s.PipelineConfig(tenantID)
+	if err != nil || cfg == nil {
+		return 0
+	}
+	return cfg.InjectionThreshold
+}
+
+// DocumentAction returns how the tenant handles poisoned documents, empty when unset.
+func (s *Server) DocumentAction(tenantID string) string {
+	cfg, err := s.PipelineConfig(tenantID)
+	if err != nil || cfg == nil {
+		return ""
+	}
+	return cfg.DocumentAction
+}
+
+// cachedRecognizers is the firewall's recognizer selection when the rule cache is on.
+func (s *Server) cachedRecognizers(tenantID string) []*policy.Recognizer {
+	return s.tenantRules(tenantID).recognizers
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi/v5"
+
+	"aiguardrails/internal/policy"
+	"aiguardrails/internal/rbac"
+	"aiguardrails/internal/rules"
+	"aiguardrails/internal/types"
+)
+
+func TestTenantRulesCachedUntilRuleUpdate(t *testing.T) {
+	s := newProxyTestServer("http://127.0.0.1:0")
+	s.ruleCache = newRuleCache(time.Minute)
+	rule := rules.Rule{ID: "kw-test", Name: "kw", Type: rules.RuleTypeKeyword, Content: "falcon"}
+	if err := s.ruleStore.Add(rule); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.policy.CreatePolicy(types.Policy{TenantID: "t1", PromptRules: []string{"kw-test"}}); err != nil {
+		t.Fatal(err)
+	}
+	first := s.tenantRules("t1")
+	if _, ok := first.keywords.Find("project falcon"); !ok {
+		t.Fatal("expected keyword rule to match")
+	}
+
+	// Store edits that bypass the handlers are not seen until invalidation.
+	rule.Content = "osprey"
+	_ = s.ruleStore.Update(rule)
+	if s.tenantRules("t1") != first {
+		t.Fatal("expected the compiled rules to be reused")
+	}
+
+	body, _ := json.Marshal(rule)
+	req := httptest.NewRequest(http.MethodPut, "/", bytes.NewReader(body))
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", rule.ID)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	rec := httptest.NewRecorder()
+	s.updateRule(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", rec.Code, rec.Body.String())
+	}
+	next := s.tenantRules("t1")
+	if _, ok := next.keywords.Find("project falcon"); ok {
+		t.Fatal("stale keyword still matches after update")
+	}
+	if _, ok := next.keywords.Find("an osprey"); !ok {
+		t.Fatal("updated keyword does not match")
+	}
+}
+
+func TestRuleCacheDropsBuildRacingInvalidation(t *testing.T) {
+	c := newRuleCache(time.Minute)
+	builds := 0
+	build := func() *tenantRules {
+		builds++
+		if builds == 1 {
+			c.invalidate("t1") // an edit lands while the first build runs
+		}
+		return &tenantRules{}
+	}
+	c.get("t1", build)
+	c.get("t1", build)
+	c.get("t1", build)
+	if builds != 2 {
+		t.Fatalf("expected the racing build to be discarded, got %d builds", builds)
+	}
+}
+
+type countingEngine struct {
+	policy.Engine
+	outputFilters int
+}
+
+func (e *countingEngine) OutputFilters(tenantID string) []string {
+	e.outputFilters++
+	return e.Engine.OutputFilters(tenantID)
+}
+
+func TestRecognizersCachedUntilPolicyUpdate(t *testing.T) {
+	s := newProxyTestServer("http://127.0.0.1:0")
+	eng := &countingEngine{Engine: s.policy}
+	s.policy = eng
+	s.ruleCache = newRuleCache(time.Minute)
+	s.firewall.WithRecognizers(s.cachedRecognizers)
+	p, err := s.policy.CreatePolicy(types.Policy{TenantID: "t1", Name: "p"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if res := s.evaluateOutput(context.Background(), "t1", "", "write to ops@example.com"); !res.Allowed || res.TransformedText != "" {
+			t.Fatalf("email is not filtered by default: %+v", res)
+		}
+		s.newStreamFilter("t1", "")
+	}
+	if eng.outputFilters != 1 {
+		t.Fatalf("expected one policy lookup, got %d", eng.outputFilters)
+	}
+
+	router := chi.NewRouter()
+	router.Use(rbac.WithRole(rbac.RolePlatformAdmin))
+	router.Put("/tenants/{tenantID}/policies/{policyID}", s.updatePolicy)
+	body, _ := json.Marshal(policyRequest{Name: "p", OutputFilters: []string{"email"}})
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/tenants/t1/policies/"+p.ID, bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", rec.Code, rec.Body.String())
+	}
+	if res := s.evaluateOutput(context.Background(), "t1", "", "write to ops@example.com"); res.Allowed && res.TransformedText == "" {
+		t.Fatalf("expected the new output filter after the policy update: %+v", res)
+	}
+}
+
+func TestPipelineConfigCachedUntilTenantRuleWrite(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s := newProxyTestServer("http://127.0.0.1:0")
+	s.ruleCache = newRuleCache(time.Minute)
+	s.tenantRuleStore = policy.NewTenantRuleStore(db)
+	cols := []string{"id", "tenant_id", "rule_type", "name", "description", "config", "enabled", "priority", "created_at", "updated_at", "created_by"}
+	mock.ExpectQuery("FROM tenant_rules WHERE tenant_id=\\$1 AND enabled=true AND rule_type=\\$2").
+		WithArgs("t1", policy.RuleTypePipeline).
+		WillReturnRows(sqlmock.NewRows(cols).AddRow("r1", "t1", "pipeline", "p", nil, []byte(`{"injection_threshold":0.9,"document_action":"quarantine"}`), true, 0, time.Now(), time.Now(), nil))
+
+	for i := 0; i < 3; i++ {
+		if got := s.InjectionThreshold("t1"); got != 0.9 {
+			t.Fatalf("expected the tenant threshold, got %v", got)
+		}
+		if got := s.DocumentAction("t1"); got != "quarantine" {
+			t.Fatalf("expected the tenant document action, got %q", got)
+		}
+	}
+
+	mock.ExpectExec("DELETE FROM tenant_rules").WithArgs("r1", "t1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("FROM tenant_rules WHERE tenant_id=\\$1 AND enabled=true AND rule_type=\\$2").
+		WithArgs("t1", policy.RuleTypePipeline).
+		WillReturnRows(sqlmock.NewRows(cols))
+	router := chi.NewRouter()
+	router.Use(rbac.WithRole(rbac.RolePlatformAdmin))
+	router.Delete("/tenants/{tenantID}/rules/{ruleID}", s.deleteTenantRule)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/tenants/t1/rules/r1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", rec.Code, rec.Body.String())
+	}
+	if cfg, err := s.PipelineConfig("t1"); err != nil || cfg != nil {
+		t.Fatalf("expected the deleted rule to be gone: %+v %v", cfg, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -37,6 +37,7 @@ func (s *Server) createRule(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	s.ruleCache.reset()
 
 	// If rule is OPA, we might need to trigger reload?
 	// For now just save metadata.
@@ -85,6 +86,7 @@ func (s *Server) updateRule(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	s.ruleCache.reset()
 
 	if req.Type == rules.RuleTypeOPA {
 		s.syncOPARules()
@@ -99,6 +101,7 @@ func (s *Server) deleteRule(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	s.ruleCache.reset()
 	s.syncOPARules()
 	s.writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
@@ -3,32 +3,43 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
 	"aiguardrails/internal/agent"
 	"aiguardrails/internal/alert"
+	"aiguardrails/internal/approval"
 	"aiguardrails/internal/audit"
 	"aiguardrails/internal/auth"
 	"aiguardrails/internal/config"
+	"aiguardrails/internal/grounding"
+	"aiguardrails/internal/injection"
+	"aiguardrails/internal/keyword"
 	"aiguardrails/internal/llm_guard"
 	"aiguardrails/internal/mcp"
 	"aiguardrails/internal/opa"
 	"aiguardrails/internal/org"
+	"aiguardrails/internal/pipeline"
 	"aiguardrails/internal/policy"
 	"aiguardrails/internal/promptfw"
+	"aiguardrails/internal/proxy"
 	"aiguardrails/internal/rag"
 	"aiguardrails/internal/rbac"
 	"aiguardrails/internal/rules"
+	"aiguardrails/internal/session"
 	"aiguardrails/internal/tenant"
 	"aiguardrails/internal/tracing"
 	"aiguardrails/internal/types"
 	"aiguardrails/internal/usage"
+	"aiguardrails/internal/vault"
 )
 
 // Server wires HTTP routes to services.
@@ -57,18 +68,29 @@ type Server struct {
 	opaEval         *opa.Evaluator
 	llmGuard        *llm_guard.Client
 	alertStore      *alert.RuleStore
+	alertEngine     *alert.EnhancedEngine
 	usageStore      *usage.UsageStore
 	tracingStore    *tracing.Store
 	orgStore        *org.Store
 	settings        *SettingsStore
+	upstreamStore   *proxy.Store
+	proxyClient     *proxy.Client
+	pipeline        *pipeline.Pipeline
+	vault           *vault.Vault
+	ruleCache       *ruleCache
+	sessions        *session.Store
+	approvals       *approval.Service
 }
 
 type ctxKey string
 
 const authRoleCtxKey ctxKey = "role"
 
+// authUserCtxKey carries the username of an admin signed in with a JWT.
+const authUserCtxKey ctxKey = "username"
+
 // New builds a Server with dependencies.
-func New(cfg config.Config, tenantSvc tenant.Service, policyEng policy.Engine, firewall *promptfw.Firewall, agentGw *agent.Gateway, ragSec *rag.Security, usageMeter *usage.Meter, rateLimiter *usage.RateLimiter, auditLog *audit.Logger, auditStore *audit.Store, mcpBroker *mcp.Broker, capStore *mcp.Store, rulesRepo *policy.RulesRepository, ruleStore *policy.RuleStore, tenantRuleStore *policy.TenantRuleStore, userStore *auth.UserStore, tenantUserStore *auth.TenantUserStore, jwtSigner *auth.JWTSigner, opaEval *opa.Evaluator, alertStore *alert.RuleStore, usageStore *usage.UsageStore, tracingStore *tracing.Store, orgStore *org.Store) *Server {
+func New(cfg config.Config, tenantSvc tenant.Service, policyEng policy.Engine, firewall *promptfw.Firewall, agentGw *agent.Gateway, ragSec *rag.Security, usageMeter *usage.Meter, rateLimiter *usage.RateLimiter, auditLog *audit.Logger, auditStore *audit.Store, mcpBroker *mcp.Broker, capStore *mcp.Store, rulesRepo *policy.RulesRepository, ruleStore *policy.RuleStore, tenantRuleStore *policy.TenantRuleStore, userStore *auth.UserStore, tenantUserStore *auth.TenantUserStore, jwtSigner *auth.JWTSigner, opaEval *opa.Evaluator, alertStore *alert.RuleStore, alertEngine *alert.EnhancedEngine, usageStore *usage.UsageStore, tracingStore *tracing.Store, orgStore *org.Store, upstreamStore *proxy.Store, piiVault *vault.Vault, sessionStore *session.Store, approvals *approval.Service) *Server {
 	s := &Server{
 		cfg:             cfg,
 		router:          chi.NewRouter(),
@@ -92,10 +114,17 @@ func New(cfg config.Config, tenantSvc tenant.Service, policyEng policy.Engine, f
 		opaEval:         opaEval,
 		llmGuard:        llm_guard.NewClient(llm_guard.Config{APIKey: cfg.QwenAPIToken, Endpoint: cfg.QwenAPIBase, Model: cfg.QwenModel}),
 		alertStore:      alertStore,
+		alertEngine:     alertEngine,
 		usageStore:      usageStore,
 		tracingStore:    tracingStore,
 		orgStore:        orgStore,
 		settings:        NewSettingsStore(),
+		upstreamStore:   upstreamStore,
+		proxyClient:     proxy.NewClient(time.Duration(cfg.ProxyTimeoutSec)*time.Second, time.Duration(cfg.ProxyHeaderTimeoutSec)*time.Second, cfg.ProxyAllowPrivate),
+		vault:           piiVault,
+		ruleCache:       newRuleCache(time.Duration(cfg.RuleCacheTTLSec) * time.Second),
+		sessions:        sessionStore,
+		approvals:       approvals,
 	}
 
 	// Load initial config into settings
@@ -112,6 +141,25 @@ func New(cfg config.Config, tenantSvc tenant.Service, policyEng policy.Engine, f
 	// Initial OPA Sync
 	s.syncOPARules()
 
+	// Output DLP, stream filters and secret scanning share the tenant's cached
+	// recognizer selection instead of querying policies on every call.
+	if firewall != nil && s.ruleCache.ttl > 0 {
+		firewall.WithRecognizers(s.cachedRecognizers)
+	}
+	// Injection thresholds and document actions come from the tenant's cached
+	// pipeline rule rather than a query per check.
+	if tenantRuleStore != nil && s.ruleCache.ttl > 0 {
+		det := injection.NewDetector(s)
+		if firewall != nil {
+			firewall.WithInjection(det)
+		}
+		if ragSec != nil {
+			ragSec.WithInjection(det)
+			ragSec.WithDocumentActions(s)
+		}
+	}
+	s.pipeline = s.newPipeline()
+
 	s.routes()
 	return s
 }
@@ -216,6 +264,16 @@ func (s *Server) routes() {
 				s.registerOrgRoutes(r)
 			}
 
+			// Guarded proxy upstreams
+			if s.upstreamStore != nil {
+				s.registerUpstreamRoutes(r)
+			}
+
+			// Agent tool call approvals
+			if s.approvals != nil {
+				s.registerApprovalRoutes(r)
+			}
+
 			// Rules (Old Register removed)
 			// New Rules API
 			r.Route("/rules", func(r chi.Router) {
@@ -264,44 +322,37 @@ func (s *Server) routes() {
 			r.Use(rbac.WithRole(rbac.RoleTenantUser))
 			r.Post("/guardrails/prompt-check", s.checkPrompt)
 			r.Post("/guardrails/rag-check", s.checkRAG)
+			if s.rag != nil {
+				r.Post("/guardrails/rag-documents", s.checkRAGDocuments)
+			}
 			r.Post("/guardrails/output-filter", s.checkOutput)
+			r.Post("/guardrails/output-stream", s.checkOutputStream)
+			if s.vault != nil {
+				s.registerVaultRoutes(r)
+			}
+			if s.sessions != nil {
+				s.registerSessionRoutes(r)
+			}
 			r.Post("/agent/plan", s.planAndAct)
+			if s.approvals != nil {
+				r.Get("/agent/runs/{runID}", s.getAgentRun)
+			}
 			r.Get("/mcp/capabilities", s.listCapabilities)
+			// Guarded proxy (OpenAI and Anthropic wire formats)
+			r.Post("/chat/completions", s.proxyChatCompletions)
+			r.Post("/messages", s.proxyMessages)
 		})
 	})
-}
 
-func (s *Server) checkRAG(w http.ResponseWriter, r *http.Request) {
-	var req promptCheckRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-	tenantID := req.TenantID
-	if tenantID == "" {
-		tenantID = auth.TenantIDFromContext(r.Context())
-	}
-	// OPA check for RAG
-	if s.opaEval != nil {
-		allow, data, err := s.opaEval.Decide(r.Context(), opa.Input{
-			TenantID: tenantID,
-			AppID:    auth.AppIDFromContext(r.Context()),
-			Mode:     "rag_check",
-			Prompt:   req.Prompt,
-		})
-		if err == nil && !allow {
-			s.writeJSON(w, http.StatusOK, types.GuardrailResult{Allowed: false, Reason: "opa_block_rag", Signals: []string{fmt.Sprint(data)}})
-			return
-		}
-	}
-	// Fallback to standard prompt check (keywords etc)
-	// Fallback to standard prompt check (keywords etc)
-	_, keywords := s.resolveRules(tenantID)
-	res := s.firewall.CheckPrompt(tenantID, req.Prompt, keywords)
-	s.writeJSON(w, http.StatusOK, res)
+	// Ollama-compatible guarded proxy
+	r.Group(func(r chi.Router) {
+		r.Use(auth.APIKeyMiddleware(s.tenant))
+		r.Use(rbac.WithRole(rbac.RoleTenantUser))
+		r.Post("/api/chat", s.proxyOllamaChat)
+	})
 }
 
-func (s *Server) resolveRules(tenantID string) (ruleIDs []string, keywords []string) {
+func (s *Server) resolveRules(tenantID string) (ruleIDs []string, keywords []keyword.Term) {
 	activeRules := s.getEffectiveRules(tenantID)
 	for _, item := range activeRules {
 		// Try to find rule
@@ -314,16 +365,23 @@ func (s *Server) resolveRules(tenantID string) (ruleIDs []string, keywords []str
 				for _, l := range lines {
 					k := strings.TrimSpace(l)
 					if k != "" {
-						keywords = append(keywords, k)
+						term := keyword.Term{Text: k}
+						if ruleDef.Match != nil {
+							term.Options = *ruleDef.Match
+						}
+						keywords = append(keywords, term)
 					}
 				}
 			} else {
 				// OPA or LLM rule
 				ruleIDs = append(ruleIDs, item)
 			}
+		} else if s.rulesRepo != nil && s.rulesRepo.Engine().Has(item) {
+			// Platform policy rule with conditions
+			ruleIDs = append(ruleIDs, item)
 		} else {
 			// Not a rule ID, treat as manual keyword
-			keywords = append(keywords, item)
+			keywords = append(keywords, keyword.Term{Text: item})
 		}
 	}
 	return
@@ -449,6 +507,7 @@ func (s *Server) createPolicy(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	s.ruleCache.invalidate(tenantID)
 	s.audit.RecordStore(s.auditStore, "policy_created", map[string]string{"tenant_id": tenantID, "policy_id": p.ID})
 	s.writeJSON(w, http.StatusCreated, p)
 }
@@ -480,6 +539,7 @@ func (s *Server) updatePolicy(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	s.ruleCache.invalidate(tenantID)
 	diff := summarizePolicyDiff(oldPolicy, &p)
 	s.audit.RecordStore(s.auditStore, "policy_updated", map[string]string{"tenant_id": tenantID, "policy_id": p.ID, "diff": diff})
 	s.writeJSON(w, http.StatusOK, p)
@@ -503,6 +563,7 @@ func (s *Server) deletePolicy(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	s.ruleCache.invalidate(tenantID)
 	s.audit.RecordStore(s.auditStore, "policy_deleted", map[string]string{"tenant_id": tenantID, "policy_id": policyID})
 	s.writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
@@ -559,6 +620,14 @@ func (s *Server) listAudit(w http.ResponseWriter, r *http.Request) {
 type promptCheckRequest struct {
 	TenantID string `json:"tenant_id"`
 	Prompt   string `json:"prompt"`
+	// Optional attributes for policy rule conditions
+	Role   string `json:"role,omitempty"`
+	Tool   string `json:"tool,omitempty"`
+	Vendor string `json:"vendor,omitempty"`
+	// ConfirmToken echoes the token of an earlier confirm decision for the same prompt.
+	ConfirmToken string `json:"confirm_token,omitempty"`
+	// SessionID ties the check to a multi-turn session guarded by cumulative rules.
+	SessionID string `json:"session_id,omitempty"`
 }
 
 func (s *Server) checkPrompt(w http.ResponseWriter, r *http.Request) {
@@ -571,50 +640,39 @@ func (s *Server) checkPrompt(w http.ResponseWriter, r *http.Request) {
 	if tenantID == "" {
 		tenantID = auth.TenantIDFromContext(r.Context())
 	}
-
-	ruleIDs, keywords := s.resolveRules(tenantID)
-
-	// OPA check if enabled
-	// OPA check if enabled
-	if s.opaEval != nil {
-		allow, data, err := s.opaEval.Decide(r.Context(), opa.Input{
-			TenantID: tenantID,
-			AppID:    auth.AppIDFromContext(r.Context()),
-			Mode:     "prompt_check",
-			Prompt:   req.Prompt,
-			Rules:    ruleIDs,
-		})
-
-		if err == nil && !allow {
-			s.writeJSON(w, http.StatusOK, types.GuardrailResult{Allowed: false, Reason: "opa_block", Signals: []string{fmt.Sprint(data)}})
-			return
-		}
-
-		// LLM Check if enabled (iterate valid ruleIDs)
-		if s.llmGuard != nil && len(ruleIDs) > 0 {
-			for _, rid := range ruleIDs {
-				ruleDef, err := s.ruleStore.Get(rid) // Should exist as we filtered above
-				if err == nil && ruleDef.Type == rules.RuleTypeLLM {
-					safe, reason, err := s.llmGuard.Check(req.Prompt, ruleDef.Content)
-					if err == nil && !safe {
-						s.writeJSON(w, http.StatusOK, types.GuardrailResult{
-							Allowed: false,
-							Reason:  "llm_safety_block",
-							Signals: []string{fmt.Sprintf("rule:%s", ruleDef.Name), reason},
-						})
-						return
-					}
-				}
-			}
-		}
-	}
-	result := s.firewall.CheckPrompt(tenantID, req.Prompt, keywords)
+	attrs := ruleAttrs(req.Role, req.Tool, req.Vendor)
+	result := s.runConfirmable(r.Context(), pipeline.KindPrompt, tenantID, auth.AppIDFromContext(r.Context()), req.Prompt, attrs, req.ConfirmToken, req.SessionID, nil)
 	s.writeJSON(w, http.StatusOK, result)
 }
 
+// evaluatePrompt runs the tenant's prompt pipeline (default: OPA, policy rules, LLM rules, prompt firewall).
+func (s *Server) evaluatePrompt(ctx context.Context, tenantID, appID, prompt string) types.GuardrailResult {
+	return s.runPipeline(ctx, pipeline.KindPrompt, tenantID, appID, prompt, nil)
+}
+
 type outputCheckRequest struct {
 	Output   string `json:"output"`
 	TenantID string `json:"tenant_id"`
+	Role     string `json:"role,omitempty"`
+	Tool     string `json:"tool,omitempty"`
+	Vendor   string `json:"vendor,omitempty"`
+	// ConfirmToken echoes the token of an earlier confirm decision for the same output.
+	ConfirmToken string `json:"confirm_token,omitempty"`
+	SessionID    string `json:"session_id,omitempty"`
+	// Context holds the documents the output was generated from; when present
+	// (even empty) the output is checked for claims they do not support.
+	Context []rag.Document `json:"context,omitempty"`
+}
+
+// ruleAttrs collects the non-empty caller attributes policy rules can match on.
+func ruleAttrs(role, tool, vendor string) map[string]string {
+	attrs := map[string]string{}
+	for k, v := range map[string]string{policy.FieldRole: role, policy.FieldTool: tool, policy.FieldVendor: vendor} {
+		if v != "" {
+			attrs[k] = v
+		}
+	}
+	return attrs
 }
 
 func (s *Server) checkOutput(w http.ResponseWriter, r *http.Request) {
@@ -627,29 +685,154 @@ func (s *Server) checkOutput(w http.ResponseWriter, r *http.Request) {
 	if tenantID == "" {
 		tenantID = auth.TenantIDFromContext(r.Context())
 	}
-	if s.opaEval != nil {
-		allow, data, err := s.opaEval.Decide(r.Context(), opa.Input{
-			TenantID: tenantID,
-			AppID:    auth.AppIDFromContext(r.Context()),
-			Mode:     "output_filter",
-			Output:   req.Output,
-		})
-		if err == nil && !allow {
-			s.writeJSON(w, http.StatusOK, types.GuardrailResult{Allowed: false, Reason: "opa_block", Signals: []string{fmt.Sprint(data)}})
-			return
+	attrs := ruleAttrs(req.Role, req.Tool, req.Vendor)
+	ground := s.groundingInput(tenantID, req.Context)
+	result := s.runConfirmable(r.Context(), pipeline.KindOutput, tenantID, auth.AppIDFromContext(r.Context()), req.Output, attrs, req.ConfirmToken, req.SessionID, ground)
+	s.writeJSON(w, http.StatusOK, result)
+}
+
+// evaluateOutput runs the tenant's output pipeline (default: OPA, policy rules, then DLP/LLM output filtering).
+func (s *Server) evaluateOutput(ctx context.Context, tenantID, appID, output string) types.GuardrailResult {
+	return s.runPipeline(ctx, pipeline.KindOutput, tenantID, appID, output, nil)
+}
+
+// runPipeline evaluates text through the tenant's stages for kind.
+func (s *Server) runPipeline(ctx context.Context, kind pipeline.Kind, tenantID, appID, text string, attrs map[string]string) types.GuardrailResult {
+	return s.pipeline.Run(ctx, s.pipelineRequest(kind, tenantID, appID, text, attrs))
+}
+
+func (s *Server) pipelineRequest(kind pipeline.Kind, tenantID, appID, text string, attrs map[string]string) pipeline.Request {
+	tr := s.tenantRules(tenantID)
+	return pipeline.Request{
+		Kind:     kind,
+		TenantID: tenantID,
+		AppID:    appID,
+		Text:     text,
+		RuleIDs:  tr.ruleIDs,
+		Keywords: tr.keywords,
+		Terms:    tr.terms,
+		Attrs:    attrs,
+	}
+}
+
+// confirmTTL bounds how long a confirm challenge can be answered.
+const confirmTTL = 10 * time.Minute
+
+// runConfirmable is runPipeline for callers that can answer a confirm challenge:
+// a valid confirmToken for this tenant and text lets confirm decisions pass, and
+// a confirm decision is returned with a fresh token to echo back. A sessionID
+// adds the multi-turn session guard and records the verdict in the session;
+// ground, if set, checks the text against its context documents.
+func (s *Server) runConfirmable(ctx context.Context, kind pipeline.Kind, tenantID, appID, text string, attrs map[string]string, confirmToken, sessionID string, ground *grounding.Input) types.GuardrailResult {
+	req := s.pipelineRequest(kind, tenantID, appID, text, attrs)
+	req.Grounding = ground
+	if confirmToken != "" && s.jwtSigner != nil {
+		req.Confirmed = s.jwtSigner.VerifyConfirm(confirmToken, tenantID, text) == nil
+	}
+	turn, sessionErr := s.openSession(ctx, kind, tenantID, sessionID, text)
+	req.Session = turn
+	res := s.pipeline.Run(ctx, req)
+	if res.Decision == types.DecisionConfirm && s.jwtSigner != nil {
+		if token, err := s.jwtSigner.SignConfirm(tenantID, text, res.Reason, confirmTTL); err == nil {
+			res.ConfirmToken = token
 		}
 	}
-	_, keywords := s.resolveRules(tenantID)
-	result := s.firewall.FilterOutput(tenantID, req.Output, keywords)
-	s.writeJSON(w, http.StatusOK, result)
+	if sessionErr == nil {
+		sessionErr = s.closeSession(ctx, tenantID, turn, &res)
+	}
+	if sessionErr != nil {
+		res.Degraded = append(res.Degraded, pipeline.StageSession)
+	}
+	return res
+}
+
+// newPipeline registers every stage whose dependencies are available.
+func (s *Server) newPipeline() *pipeline.Pipeline {
+	var configs pipeline.ConfigSource
+	if s.tenantRuleStore != nil {
+		configs = s
+	}
+	p := pipeline.New(configs)
+	p.SetFailurePolicy(pipeline.FailurePolicy(s.cfg.DetectorFailurePolicy))
+	p.OnDegraded(s.detectorDegraded)
+	p.Register(pipeline.NewKeywordStage(s.firewall))
+	p.Register(pipeline.NewDLPStage(s.firewall))
+	if s.firewall.HasLLM() {
+		p.Register(pipeline.NewLLMModerationStage(s.firewall))
+	}
+	if s.opaEval != nil {
+		p.Register(pipeline.NewOPAStage(s.opaEval))
+	}
+	if s.llmGuard != nil && s.ruleStore != nil {
+		p.Register(pipeline.NewLLMRuleStage(s.llmGuard, s.ruleStore))
+	}
+	if s.tenantRuleStore != nil {
+		p.Register(pipeline.NewTenantRulesStage(s.tenantRuleStore))
+	}
+	if s.rulesRepo != nil {
+		p.Register(pipeline.NewPolicyRulesStage(s.rulesRepo.Engine(), s.policyRuleMatched))
+	}
+	if s.sessions != nil {
+		p.Register(pipeline.NewSessionStage())
+	}
+	var judge grounding.Judge
+	if s.llmGuard != nil {
+		judge = grounding.NewLLMJudge(s.llmGuard)
+	}
+	p.Register(pipeline.NewGroundingStage(judge))
+	return p
+}
+
+// policyRuleMatched raises a policy_rule alert event for rules with a notify action.
+func (s *Server) policyRuleMatched(tenantID string, res policy.RuleEvaluationResult) {
+	if s.alertEngine == nil {
+		return
+	}
+	s.alertEngine.Submit(alert.Event{
+		Type:      "policy_rule",
+		TenantID:  tenantID,
+		Reason:    res.RuleID,
+		Severity:  string(res.Severity),
+		Signals:   res.Signals,
+		Metadata:  map[string]string{"rule_id": res.RuleID, "rule_name": res.RuleName, "decision": string(res.Decision)},
+		Timestamp: time.Now().UTC(),
+	})
+}
+
+// detectorDegraded logs a failing stage and raises a detector_degraded alert event.
+func (s *Server) detectorDegraded(tenantID, stage string, policy pipeline.FailurePolicy, err error) {
+	log.Printf("detector %s degraded for tenant %s (%s): %v", stage, tenantID, policy, err)
+	if s.alertEngine == nil {
+		return
+	}
+	severity := "medium"
+	if policy == pipeline.FailClosed {
+		severity = "high"
+	}
+	s.alertEngine.Submit(alert.Event{
+		Type:      "detector_degraded",
+		TenantID:  tenantID,
+		Reason:    stage,
+		Severity:  severity,
+		Signals:   []string{"stage:" + stage},
+		Metadata:  map[string]string{"stage": stage, "policy": string(policy), "error": err.Error()},
+		Timestamp: time.Now().UTC(),
+	})
 }
 
 type planRequest struct {
-	TenantID string   `json:"tenant_id"`
-	Prompt   string   `json:"prompt"`
-	Tools    []string `json:"tools"`
+	TenantID      string            `json:"tenant_id"`
+	Prompt        string            `json:"prompt"`
+	Tools         []string          `json:"tools"`
+	MaxIterations int               `json:"max_iterations,omitempty"`
+	Context       map[string]string `json:"context,omitempty"`
+	UserID        string            `json:"user_id,omitempty"` // end user the agent acts for
 }
 
+// planAndAct runs an agent behind the guardrail. A run the guardrail stops is
+// returned with status 403, one the planner fails with 502 (504 on timeout);
+// all carry the steps taken. A run suspended until a tool call is approved
+// is returned with status 202 and the pending approval.
 func (s *Server) planAndAct(w http.ResponseWriter, r *http.Request) {
 	var req planRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -661,30 +844,56 @@ func (s *Server) planAndAct(w http.ResponseWriter, r *http.Request) {
 		tenantID = auth.TenantIDFromContext(r.Context())
 	}
 	appID := auth.AppIDFromContext(r.Context())
-	if appID != "" {
-		app, err := s.tenant.GetApp(appID)
-		if err == nil && s.rate != nil {
-			ok, count, err := s.rate.Allow(r.Context(), appID, app.QuotaPerHr)
-			if err != nil {
-				http.Error(w, "rate check error", http.StatusInternalServerError)
-				return
-			}
-			if !ok {
-				http.Error(w, "quota exceeded", http.StatusTooManyRequests)
-				return
-			}
-			s.audit.RecordStore(s.auditStore, "usage_record", map[string]string{"app_id": appID, "count": fmt.Sprintf("%d", count)})
+	if !s.allowQuota(w, r, appID) {
+		return
+	}
+	resp, err := s.agent.PlanAndAct(r.Context(), agent.PlanRequest{
+		TenantID:      tenantID,
+		Prompt:        req.Prompt,
+		Tools:         req.Tools,
+		MaxIterations: req.MaxIterations,
+		Context:       req.Context,
+		AppID:         appID,
+		UserID:        req.UserID,
+	})
+	switch {
+	case errors.Is(err, agent.ErrApprovalPending):
+		s.writeJSON(w, http.StatusAccepted, resp)
+	case err == nil:
+		if appID != "" {
+			s.usage.Record(appID, 1)
 		}
+		s.writeJSON(w, http.StatusOK, resp)
+	case resp.Reason == "planner_error":
+		s.writeJSON(w, http.StatusBadGateway, resp)
+	case resp.Reason == "timeout":
+		s.writeJSON(w, http.StatusGatewayTimeout, resp)
+	default:
+		s.writeJSON(w, http.StatusForbidden, resp)
+	}
+}
+
+// allowQuota enforces the app's hourly quota. It writes the error response and returns false when the
+// request must not proceed.
+func (s *Server) allowQuota(w http.ResponseWriter, r *http.Request, appID string) bool {
+	if appID == "" {
+		return true
+	}
+	app, err := s.tenant.GetApp(appID)
+	if err != nil || s.rate == nil {
+		return true
 	}
-	result, err := s.agent.LegacyPlanAndAct(tenantID, req.Prompt, req.Tools)
+	ok, count, err := s.rate.Allow(r.Context(), appID, app.QuotaPerHr)
 	if err != nil {
-		http.Error(w, result.Reason, http.StatusForbidden)
-		return
+		http.Error(w, "rate check error", http.StatusInternalServerError)
+		return false
 	}
-	if appID != "" {
-		s.usage.Record(appID, 1)
+	if !ok {
+		http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+		return false
 	}
-	s.writeJSON(w, http.StatusOK, result)
+	s.audit.RecordStore(s.auditStore, "usage_record", map[string]string{"app_id": appID, "count": fmt.Sprintf("%d", count)})
+	return true
 }
 
 // listCapabilities returns registry entries.
@@ -766,6 +975,7 @@ func (s *Server) adminAuth() func(http.Handler) http.Handler {
 			}
 			ctx := context.WithValue(r.Context(), "role", claims.Role)
 			ctx = context.WithValue(ctx, "tenantID", claims.TenantID)
+			ctx = context.WithValue(ctx, authUserCtxKey, claims.Username)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"aiguardrails/internal/auth"
+	"aiguardrails/internal/pipeline"
+	"aiguardrails/internal/policy"
+	"aiguardrails/internal/session"
+	"aiguardrails/internal/types"
+)
+
+// registerSessionRoutes 注册多轮会话状态路由
+func (s *Server) registerSessionRoutes(r chi.Router) {
+	r.Get("/guardrails/sessions/{sessionID}", s.getSession)
+	r.Delete("/guardrails/sessions/{sessionID}", s.resetSession)
+}
+
+// openSession loads the session and observes the turn; nil without a session guard or ID.
+func (s *Server) openSession(ctx context.Context, kind pipeline.Kind, tenantID, sessionID, text string) (*session.Turn, error) {
+	if s.sessions == nil || sessionID == "" {
+		return nil, nil
+	}
+	var cfg *policy.SessionRuleConfig
+	if pc, err := s.PipelineConfig(tenantID); err == nil && pc != nil {
+		cfg = pc.Session
+	}
+	rules := session.RulesFrom(cfg)
+	var score, threshold float64
+	if kind == pipeline.KindPrompt && s.firewall != nil {
+		res, th := s.firewall.ScoreInjection(tenantID, text)
+		score, threshold = res.Score, th
+	}
+	st, err := s.sessions.Load(ctx, tenantID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return &session.Turn{ID: sessionID, State: st, Observation: rules.Observe(string(kind), text, score, threshold), Rules: rules}, nil
+}
+
+// closeSession records the turn's verdict and attaches the session state to res.
+func (s *Server) closeSession(ctx context.Context, tenantID string, turn *session.Turn, res *types.GuardrailResult) error {
+	if turn == nil {
+		return nil
+	}
+	st, err := s.sessions.Update(ctx, tenantID, turn.ID, func(st *types.SessionState) {
+		turn.Record(st, *res, time.Now().UTC())
+	})
+	if err != nil {
+		return err
+	}
+	res.Session = st
+	return nil
+}
+
+func (s *Server) getSession(w http.ResponseWriter, r *http.Request) {
+	st, err := s.sessions.Load(r.Context(), auth.TenantIDFromContext(r.Context()), chi.URLParam(r, "sessionID"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, st)
+}
+
+func (s *Server) resetSession(w http.ResponseWriter, r *http.Request) {
+	if err := s.sessions.Delete(r.Context(), auth.TenantIDFromContext(r.Context()), chi.URLParam(r, "sessionID")); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]string{"status": "reset"})
+}
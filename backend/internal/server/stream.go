@@ -0,0 +1,106 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+
+	"aiguardrails/internal/auth"
+	"aiguardrails/internal/promptfw"
+	"aiguardrails/internal/proxy"
+	"aiguardrails/internal/types"
+)
+
+type streamDelta struct {
+	Delta string `json:"delta"`
+}
+
+// streamMode resolves the stream filter mode from an optional override and the config default.
+func (s *Server) streamMode(override string) promptfw.StreamMode {
+	if override != "" {
+		return promptfw.ParseStreamMode(override)
+	}
+	return promptfw.ParseStreamMode(s.cfg.StreamFilterMode)
+}
+
+// newStreamFilter builds a stream filter with the tenant's DLP terms and keyword rules.
+// Streamed output matches keywords literally; Chinese-aware options apply to prompts.
+func (s *Server) newStreamFilter(tenantID string, mode promptfw.StreamMode) *promptfw.StreamFilter {
+	return s.firewall.NewStreamFilterTerms(tenantID, s.tenantRules(tenantID).terms, mode)
+}
+
+// mergeStreamResults folds per-choice stream results into one: any block wins, then redactions.
+func mergeStreamResults(results []types.GuardrailResult) types.GuardrailResult {
+	out := types.GuardrailResult{Allowed: true}
+	for _, res := range results {
+		if !res.Allowed && out.Allowed {
+			out.Allowed = false
+			out.Reason = res.Reason
+		} else if out.Allowed && out.Reason == "" {
+			out.Reason = res.Reason
+		}
+		out.Signals = append(out.Signals, res.Signals...)
+		out.Findings = append(out.Findings, res.Findings...)
+	}
+	return out
+}
+
+// checkOutputStream filters a streamed model reply. The request body is NDJSON
+// ({"delta":"..."} per line); the response is SSE with one data event per released
+// delta and a final "guardrail" event carrying the GuardrailResult. The tenant is the
+// authenticated one; a tenant_id query naming another tenant is refused.
+func (s *Server) checkOutputStream(w http.ResponseWriter, r *http.Request) {
+	tenantID := auth.TenantIDFromContext(r.Context())
+	if q := r.URL.Query().Get("tenant_id"); tenantID == "" || (q != "" && q != tenantID) {
+		http.Error(w, "tenant mismatch", http.StatusForbidden)
+		return
+	}
+	filter := s.newStreamFilter(tenantID, s.streamMode(r.URL.Query().Get("mode")))
+
+	// Deltas are released while the request body is still being read.
+	_ = http.NewResponseController(w).EnableFullDuplex()
+	sse, err := proxy.NewSSEWriter(w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sc := bufio.NewScanner(r.Body)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		line := sc.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var in streamDelta
+		if err := json.Unmarshal(line, &in); err != nil {
+			_ = sse.JSON("error", map[string]string{"error": err.Error()})
+			return
+		}
+		emit, stop := filter.Write(in.Delta)
+		if emit != "" {
+			if err := sse.JSON("", streamDelta{Delta: emit}); err != nil {
+				return
+			}
+		}
+		if stop {
+			break
+		}
+	}
+	if err := sc.Err(); err != nil {
+		// A line over the limit or a broken body: the held-back text is never
+		// released unchecked.
+		res := types.GuardrailResult{Allowed: false, Decision: types.DecisionBlock, Reason: "stream_read_error", Signals: []string{err.Error()}}
+		s.audit.RecordStore(s.auditStore, "output_stream_blocked", map[string]string{"tenant_id": tenantID, "reason": res.Reason})
+		_ = sse.JSON("error", map[string]string{"error": err.Error()})
+		_ = sse.JSON("guardrail", res)
+		return
+	}
+	tail, res := filter.Close()
+	if tail != "" {
+		_ = sse.JSON("", streamDelta{Delta: tail})
+	}
+	if !res.Allowed {
+		s.audit.RecordStore(s.auditStore, "output_stream_blocked", map[string]string{"tenant_id": tenantID, "reason": res.Reason})
+	}
+	_ = sse.JSON("guardrail", res)
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckOutputStreamBlocksOnReadError(t *testing.T) {
+	s := newProxyTestServer("http://127.0.0.1:0")
+	body := `{"delta":"the weather is fine"}` + "\n" + `{"delta":"` + strings.Repeat("a", 2<<20) + `"}` + "\n"
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	s.checkOutputStream(rec, req.WithContext(context.WithValue(req.Context(), "tenantID", "t1")))
+
+	out := rec.Body.String()
+	if !strings.Contains(out, "event: error") || !strings.Contains(out, `"reason":"stream_read_error"`) || strings.Contains(out, `"allowed":true`) {
+		t.Fatalf("expected a blocking guardrail event: %s", out)
+	}
+	if strings.Contains(out, "aaaa") {
+		t.Fatalf("the oversized line must not be released: %s", out)
+	}
+}
+
+func TestCheckOutputStreamRejectsOtherTenant(t *testing.T) {
+	s := newProxyTestServer("http://127.0.0.1:0")
+	for _, tc := range []struct {
+		name, ctxTenant, query string
+		want                   int
+	}{
+		{"other tenant", "t1", "?tenant_id=t2", http.StatusForbidden},
+		{"no tenant", "", "?tenant_id=t1", http.StatusForbidden},
+		{"same tenant", "t1", "?tenant_id=t1", http.StatusOK},
+		{"implicit tenant", "t1", "", http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/"+tc.query, strings.NewReader(`{"delta":"hello"}`+"\n"))
+		if tc.ctxTenant != "" {
+			req = req.WithContext(context.WithValue(req.Context(), "tenantID", tc.ctxTenant))
+		}
+		rec := httptest.NewRecorder()
+		s.checkOutputStream(rec, req)
+		if rec.Code != tc.want {
+			t.Fatalf("%s: expected %d, got %d: %s", tc.name, tc.want, rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/go-chi/chi/v5"
 
+	"aiguardrails/internal/agent"
 	"aiguardrails/internal/policy"
 	"aiguardrails/internal/rbac"
 )
@@ -75,12 +76,17 @@ func (s *Server) createTenantRule(w http.ResponseWriter, r *http.Request) {
 		Enabled:     req.Enabled,
 		Priority:    req.Priority,
 	}
+	if err := s.validateTenantRule(&rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	created, err := s.tenantRuleStore.Create(rule)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	s.ruleCache.invalidate(tenantID)
 
 	s.audit.RecordStore(s.auditStore, "tenant_rule_created", map[string]string{
 		"tenant_id": tenantID,
@@ -141,6 +147,10 @@ func (s *Server) updateTenantRule(w http.ResponseWriter, r *http.Request) {
 		Enabled:     req.Enabled,
 		Priority:    req.Priority,
 	}
+	if err := s.validateTenantRule(&rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	updated, err := s.tenantRuleStore.Update(rule)
 	if err != nil {
@@ -151,6 +161,7 @@ func (s *Server) updateTenantRule(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	s.ruleCache.invalidate(tenantID)
 
 	s.audit.RecordStore(s.auditStore, "tenant_rule_updated", map[string]string{
 		"tenant_id": tenantID,
@@ -182,6 +193,7 @@ func (s *Server) deleteTenantRule(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	s.ruleCache.invalidate(tenantID)
 
 	s.audit.RecordStore(s.auditStore, "tenant_rule_deleted", map[string]string{
 		"tenant_id": tenantID,
@@ -190,6 +202,34 @@ func (s *Server) deleteTenantRule(w http.ResponseWriter, r *http.Request) {
 	s.writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
 
+// validateTenantRule 校验需要服务端解析的规则配置
+func (s *Server) validateTenantRule(rule *policy.TenantRule) error {
+	switch rule.RuleType {
+	case policy.RuleTypePipeline:
+		cfg, err := rule.ParsePipelineConfig()
+		if err != nil {
+			return err
+		}
+		if s.pipeline == nil {
+			return nil
+		}
+		return s.pipeline.Validate(*cfg)
+	case policy.RuleTypeAgentTools:
+		cfg, err := rule.ParseAgentToolsConfig()
+		if err != nil {
+			return err
+		}
+		return agent.ValidateToolRules(cfg.Tools)
+	case policy.RuleTypeAgentEgress:
+		cfg, err := rule.ParseAgentEgressConfig()
+		if err != nil {
+			return err
+		}
+		return agent.ValidateEgress(cfg.Hosts)
+	}
+	return nil
+}
+
 func (s *Server) listRuleTemplates(w http.ResponseWriter, r *http.Request) {
 	ruleType := policy.TenantRuleType(r.URL.Query().Get("type"))
 	templates, err := s.tenantRuleStore.ListTemplates(ruleType)
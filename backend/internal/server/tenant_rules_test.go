@@ -0,0 +1,31 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"aiguardrails/internal/policy"
+)
+
+func TestValidateTenantRuleAgentTypes(t *testing.T) {
+	s := newProxyTestServer("http://127.0.0.1:0")
+	for _, tc := range []struct {
+		ruleType policy.TenantRuleType
+		config   string
+		ok       bool
+	}{
+		{policy.RuleTypeAgentTools, `{"tools":{"search":{"args":{"limit":{"min":1,"max":50}}}}}`, true},
+		{policy.RuleTypeAgentTools, `{"tools":{"search":{"args":{"q":{"pattern":"("}}}}}`, false},
+		{policy.RuleTypeAgentTools, `{"tools":{"*":{"forbidden_hosts":["10.0.0.0/33"]}}}`, false},
+		{policy.RuleTypeAgentEgress, `{"hosts":["internal:orders.internal","10.20.0.0/16"]}`, true},
+		{policy.RuleTypeAgentEgress, `{"hosts":["internal:10.0.0.0/8"]}`, false},
+		{policy.RuleTypeAgentEgress, `{"hosts":"orders.internal"}`, false},
+		// The pipeline rule no longer carries agent settings.
+		{policy.RuleTypePipeline, `{"mode":"collect_all"}`, true},
+	} {
+		rule := policy.TenantRule{TenantID: "t1", RuleType: tc.ruleType, Config: json.RawMessage(tc.config)}
+		if err := s.validateTenantRule(&rule); (err == nil) != tc.ok {
+			t.Fatalf("%s %s: ok=%v, got %v", tc.ruleType, tc.config, tc.ok, err)
+		}
+	}
+}
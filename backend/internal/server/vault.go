@@ -0,0 +1,91 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"aiguardrails/internal/auth"
+	"aiguardrails/internal/policy"
+	"aiguardrails/internal/types"
+	"aiguardrails/internal/vault"
+)
+
+// registerVaultRoutes 注册 PII 假名化路由
+func (s *Server) registerVaultRoutes(r chi.Router) {
+	r.Post("/guardrails/anonymize", s.anonymize)
+	r.Post("/guardrails/deanonymize", s.deanonymize)
+}
+
+type vaultRequest struct {
+	TenantID  string `json:"tenant_id"`
+	SessionID string `json:"session_id"`
+	Text      string `json:"text"`
+}
+
+// vaultTenant is the authenticated tenant, the only one whose mappings a
+// caller may read or write; a body tenant_id naming another is refused.
+func vaultTenant(w http.ResponseWriter, r *http.Request, req vaultRequest) (string, bool) {
+	tenantID := auth.TenantIDFromContext(r.Context())
+	if tenantID == "" || (req.TenantID != "" && req.TenantID != tenantID) {
+		http.Error(w, "tenant mismatch", http.StatusForbidden)
+		return "", false
+	}
+	return tenantID, true
+}
+
+// vaultRecognizers returns what the vault replaces for a tenant: every PII and
+// financial recognizer plus the output-DLP defaults, minus those the tenant's
+// output_filters disable, and the tenant's custom terms.
+func (s *Server) vaultRecognizers(tenantID string) ([]*policy.Recognizer, []string) {
+	filters := []string{types.CategoryPII, types.CategoryFinancial}
+	var terms []string
+	if s.policy != nil {
+		filters = append(append([]string(nil), s.tenantRules(tenantID).outputFilters...), filters...)
+		terms = s.policy.CustomTerms(tenantID)
+	}
+	return policy.SelectRecognizers(filters), terms
+}
+
+func (s *Server) anonymize(w http.ResponseWriter, r *http.Request) {
+	var req vaultRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tenantID, ok := vaultTenant(w, r, req)
+	if !ok {
+		return
+	}
+	recs, terms := s.vaultRecognizers(tenantID)
+	res, err := s.vault.Anonymize(r.Context(), tenantID, req.SessionID, req.Text, recs, terms)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) deanonymize(w http.ResponseWriter, r *http.Request) {
+	var req vaultRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tenantID, ok := vaultTenant(w, r, req)
+	if !ok {
+		return
+	}
+	text, err := s.vault.Deanonymize(r.Context(), tenantID, req.SessionID, req.Text)
+	if err != nil {
+		if errors.Is(err, vault.ErrSessionRequired) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]string{"session_id": req.SessionID, "text": text})
+}
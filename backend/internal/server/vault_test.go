@@ -0,0 +1,66 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"aiguardrails/internal/vault"
+)
+
+func postVault(handler http.HandlerFunc, tenantID string, body map[string]string) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data))
+	if tenantID != "" {
+		req = req.WithContext(context.WithValue(req.Context(), "tenantID", tenantID))
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestVaultScopedToAuthenticatedTenant(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	s := newProxyTestServer("http://127.0.0.1:0")
+	s.vault = vault.New(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "testns", time.Hour)
+
+	rec := postVault(s.anonymize, "t1", map[string]string{"session_id": "conv-1", "text": "email ops@example.com"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("anonymize: %d %s", rec.Code, rec.Body.String())
+	}
+	var res struct {
+		Text string `json:"text"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &res)
+
+	// Another tenant's key cannot name t1, in either direction.
+	for _, h := range []http.HandlerFunc{s.anonymize, s.deanonymize} {
+		rec := postVault(h, "t2", map[string]string{"tenant_id": "t1", "session_id": "conv-1", "text": res.Text})
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("expected a cross-tenant request refused: %d %s", rec.Code, rec.Body.String())
+		}
+	}
+	// Nor does its own scope reach t1's mappings.
+	rec = postVault(s.deanonymize, "t2", map[string]string{"session_id": "conv-1", "text": res.Text})
+	if bytes.Contains(rec.Body.Bytes(), []byte("ops@example.com")) {
+		t.Fatalf("t2 restored t1's PII: %s", rec.Body.String())
+	}
+	rec = postVault(s.deanonymize, "t1", map[string]string{"tenant_id": "t1", "session_id": "conv-1", "text": res.Text})
+	if !bytes.Contains(rec.Body.Bytes(), []byte("ops@example.com")) {
+		t.Fatalf("t1 should restore its own PII: %s", rec.Body.String())
+	}
+	if rec := postVault(s.anonymize, "", map[string]string{"tenant_id": "t1", "text": "x"}); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected an unauthenticated request refused: %d", rec.Code)
+	}
+}
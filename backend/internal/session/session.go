@@ -0,0 +1,231 @@
+// Package session keeps the rolling state of multi-turn conversations so that
+// attacks escalating over many individually harmless turns can be stopped.
+// Each evaluation with a session ID is observed before the pipeline runs,
+// checked against the tenant's cumulative rules, and recorded with its final
+// verdict afterwards. Only verdicts are stored, never the text of a turn.
+package session
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"aiguardrails/internal/policy"
+	"aiguardrails/internal/types"
+)
+
+// Defaults for SessionRuleConfig fields left zero.
+const (
+	DefaultMaxRisk       = 2.5
+	DefaultDecay         = 0.8
+	DefaultMaxNearMisses = 3
+	DefaultNearMissRatio = 0.5
+	DefaultMaxDriftTurns = 3
+)
+
+// maxFlagged bounds the flagged-turn summary kept per session.
+const maxFlagged = 10
+
+// maxTurnSignals bounds the signals kept per flagged turn.
+const maxTurnSignals = 5
+
+// Per-turn risk by final decision; a near miss adds nearMissRisk.
+var decisionRisk = map[string]float64{
+	types.DecisionBlock:   1,
+	types.DecisionConfirm: 0.6,
+	types.DecisionDeflect: 0.6,
+	types.DecisionRedact:  0.3,
+	types.DecisionMark:    0.3,
+}
+
+const nearMissRisk = 0.5
+
+// Rules are a tenant's cumulative session rules with defaults applied.
+type Rules struct {
+	MaxRisk       float64
+	Decay         float64
+	MaxNearMisses int
+	NearMissRatio float64
+	DriftTopics   map[string][]string
+	MaxDriftTurns int
+	Decision      string // block or confirm
+}
+
+// RulesFrom applies defaults to cfg, which may be nil.
+func RulesFrom(cfg *policy.SessionRuleConfig) Rules {
+	r := Rules{
+		MaxRisk:       DefaultMaxRisk,
+		Decay:         DefaultDecay,
+		MaxNearMisses: DefaultMaxNearMisses,
+		NearMissRatio: DefaultNearMissRatio,
+		MaxDriftTurns: DefaultMaxDriftTurns,
+		Decision:      types.DecisionBlock,
+	}
+	if cfg == nil {
+		return r
+	}
+	if cfg.MaxRisk > 0 {
+		r.MaxRisk = cfg.MaxRisk
+	}
+	if cfg.Decay > 0 {
+		r.Decay = cfg.Decay
+	}
+	if cfg.MaxNearMisses > 0 {
+		r.MaxNearMisses = cfg.MaxNearMisses
+	}
+	if cfg.NearMissRatio > 0 {
+		r.NearMissRatio = cfg.NearMissRatio
+	}
+	if cfg.MaxDriftTurns > 0 {
+		r.MaxDriftTurns = cfg.MaxDriftTurns
+	}
+	if cfg.Decision == types.DecisionConfirm {
+		r.Decision = types.DecisionConfirm
+	}
+	r.DriftTopics = cfg.DriftTopics
+	return r
+}
+
+// Validate checks a tenant's session config.
+func Validate(cfg *policy.SessionRuleConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	switch {
+	case cfg.MaxRisk < 0:
+		return fmt.Errorf("session.max_risk %v must not be negative", cfg.MaxRisk)
+	case cfg.Decay < 0 || cfg.Decay > 1:
+		return fmt.Errorf("session.decay %v out of range [0,1]", cfg.Decay)
+	case cfg.NearMissRatio < 0 || cfg.NearMissRatio > 1:
+		return fmt.Errorf("session.near_miss_ratio %v out of range [0,1]", cfg.NearMissRatio)
+	case cfg.MaxNearMisses < 0 || cfg.MaxDriftTurns < 0:
+		return fmt.Errorf("session limits must not be negative")
+	}
+	switch cfg.Decision {
+	case "", types.DecisionBlock, types.DecisionConfirm:
+	default:
+		return fmt.Errorf("unknown session decision %q", cfg.Decision)
+	}
+	return nil
+}
+
+// Observation is what the current turn contributes before its verdict is known.
+type Observation struct {
+	Kind     string   `json:"kind"`
+	Score    float64  `json:"injection_score,omitempty"`
+	NearMiss bool     `json:"near_miss,omitempty"`
+	Topics   []string `json:"topics,omitempty"` // drift topics whose cues the turn mentions
+}
+
+// Observe inspects one turn. score and threshold are the turn's injection
+// score and the tenant's threshold; a score below the threshold but at least
+// NearMissRatio of it is a near miss.
+func (r Rules) Observe(kind, text string, score, threshold float64) Observation {
+	obs := Observation{Kind: kind, Score: score}
+	obs.NearMiss = threshold > 0 && score < threshold && score >= threshold*r.NearMissRatio
+	for topic, cues := range r.DriftTopics {
+		for _, cue := range cues {
+			if cue != "" && len(policy.FindFold(text, cue)) > 0 {
+				obs.Topics = append(obs.Topics, topic)
+				break
+			}
+		}
+	}
+	sort.Strings(obs.Topics)
+	return obs
+}
+
+// Turn is one evaluation within a session: the state before it, what it adds
+// and the rules that apply.
+type Turn struct {
+	ID          string
+	State       *types.SessionState
+	Observation Observation
+	Rules       Rules
+}
+
+// Evaluate applies the cumulative rules to the session with the turn's
+// observation folded in. A session that crossed a limit stays over it until it
+// expires or is reset.
+func (t *Turn) Evaluate() types.GuardrailResult {
+	st, obs, r := t.State, t.Observation, t.Rules
+	var reason string
+	var signals []string
+	nearMisses := st.NearMisses
+	if obs.NearMiss {
+		nearMisses++
+	}
+	if nearMisses >= r.MaxNearMisses {
+		reason = "session_near_misses"
+		signals = append(signals, fmt.Sprintf("session_near_misses:%d", nearMisses))
+	}
+	for _, topic := range obs.Topics {
+		if st.Topics[topic]+1 >= r.MaxDriftTurns {
+			if reason == "" {
+				reason = "session_topic_drift"
+			}
+			signals = append(signals, "session_topic:"+topic)
+		}
+	}
+	if risk := st.Risk * r.Decay; risk >= r.MaxRisk {
+		if reason == "" {
+			reason = "session_risk"
+		}
+		signals = append(signals, fmt.Sprintf("session_risk:%.2f", risk))
+	}
+	if reason == "" {
+		return types.GuardrailResult{Allowed: true}
+	}
+	return types.GuardrailResult{
+		Allowed:  false,
+		Decision: r.Decision,
+		Reason:   reason,
+		Signals:  signals,
+	}
+}
+
+// Record folds the turn and its final verdict into st.
+func (t *Turn) Record(st *types.SessionState, res types.GuardrailResult, now time.Time) {
+	obs, r := t.Observation, t.Rules
+	decision := res.EffectiveDecision()
+	risk := decisionRisk[decision]
+	if obs.NearMiss {
+		risk = math.Min(1, risk+nearMissRisk)
+	}
+	st.ID = t.ID
+	st.Turns++
+	st.Risk = math.Round((st.Risk*r.Decay+risk)*100) / 100
+	if obs.NearMiss {
+		st.NearMisses++
+	}
+	for _, topic := range obs.Topics {
+		if st.Topics == nil {
+			st.Topics = map[string]int{}
+		}
+		st.Topics[topic]++
+	}
+	st.UpdatedAt = now
+	if risk == 0 {
+		return
+	}
+	signals := res.Signals
+	if obs.NearMiss {
+		signals = append([]string{fmt.Sprintf("near_miss:%.2f", obs.Score)}, signals...)
+	}
+	if len(signals) > maxTurnSignals {
+		signals = signals[:maxTurnSignals]
+	}
+	st.Flagged = append(st.Flagged, types.SessionTurn{
+		Turn:     st.Turns,
+		Kind:     obs.Kind,
+		Decision: decision,
+		Reason:   res.Reason,
+		Risk:     risk,
+		Signals:  signals,
+		At:       now,
+	})
+	if len(st.Flagged) > maxFlagged {
+		st.Flagged = st.Flagged[len(st.Flagged)-maxFlagged:]
+	}
+}
@@ -0,0 +1,95 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"aiguardrails/internal/types"
+)
+
+// maxRetries bounds optimistic retries when turns of one session race.
+const maxRetries = 3
+
+// Store keeps session state in Redis, one JSON value per tenant and session
+// that expires ttl after the last turn.
+type Store struct {
+	redis *redis.Client
+	ns    string
+	ttl   time.Duration
+}
+
+// NewStore constructs a Store.
+func NewStore(client *redis.Client, namespace string, ttl time.Duration) *Store {
+	return &Store{redis: client, ns: namespace, ttl: ttl}
+}
+
+func (s *Store) key(tenantID, sessionID string) string {
+	return fmt.Sprintf("%s:session:%s:%s", s.ns, tenantID, sessionID)
+}
+
+// Load returns the session's state; an unknown session starts empty.
+func (s *Store) Load(ctx context.Context, tenantID, sessionID string) (*types.SessionState, error) {
+	return s.get(ctx, s.redis, tenantID, sessionID)
+}
+
+type getter interface {
+	Get(ctx context.Context, key string) *redis.StringCmd
+}
+
+func (s *Store) get(ctx context.Context, c getter, tenantID, sessionID string) (*types.SessionState, error) {
+	st := &types.SessionState{ID: sessionID}
+	raw, err := c.Get(ctx, s.key(tenantID, sessionID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, st); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// Update applies fn to the session's current state and saves it. Concurrent
+// updates of one session are retried so no turn is lost.
+func (s *Store) Update(ctx context.Context, tenantID, sessionID string, fn func(*types.SessionState)) (*types.SessionState, error) {
+	key := s.key(tenantID, sessionID)
+	var out *types.SessionState
+	txf := func(tx *redis.Tx) error {
+		st, err := s.get(ctx, tx, tenantID, sessionID)
+		if err != nil {
+			return err
+		}
+		fn(st)
+		raw, err := json.Marshal(st)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			p.Set(ctx, key, raw, s.ttl)
+			return nil
+		})
+		if err == nil {
+			out = st
+		}
+		return err
+	}
+	for i := 0; i < maxRetries; i++ {
+		err := s.redis.Watch(ctx, txf, key)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return out, err
+		}
+	}
+	return nil, redis.TxFailedErr
+}
+
+// Delete resets a session.
+func (s *Store) Delete(ctx context.Context, tenantID, sessionID string) error {
+	return s.redis.Del(ctx, s.key(tenantID, sessionID)).Err()
+}
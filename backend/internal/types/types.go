@@ -1,6 +1,10 @@
 package types
 
-import "time"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
 
 // Tenant represents a logical organization using the SaaS.
 type Tenant struct {
@@ -29,7 +33,7 @@ type Policy struct {
 	PromptRules    []string  `json:"prompt_rules"` // e.g., regex or keywords
 	ToolAllowList  []string  `json:"tool_allowlist"`
 	RAGNamespaces  []string  `json:"rag_namespaces"`
-	OutputFilters  []string  `json:"output_filters"`  // PII, secrets, toxicity tags
+	OutputFilters  []string  `json:"output_filters"`  // PII recognizer names/categories ("-" disables), other tags
 	SensitiveTerms []string  `json:"sensitive_terms"` // custom sensitive words
 	LastModifiedAt time.Time `json:"last_modified_at"`
 	Version        int       `json:"version"`        // version number
@@ -68,9 +72,183 @@ type UsageRecord struct {
 	Count     int64     `json:"count"`
 }
 
+// Guardrail decisions, from most to least restrictive.
+const (
+	DecisionBlock   = "block"   // refuse outright
+	DecisionConfirm = "confirm" // proceed only after the client echoes ConfirmToken
+	DecisionDeflect = "deflect" // answer with the canned Response instead
+	DecisionRedact  = "redact"  // proceed with TransformedText
+	DecisionMark    = "mark"    // proceed, flagged for review
+	DecisionAllow   = "allow"
+)
+
+var decisionRank = map[string]int{
+	DecisionAllow:   0,
+	DecisionMark:    1,
+	DecisionRedact:  2,
+	DecisionDeflect: 3,
+	DecisionConfirm: 4,
+	DecisionBlock:   5,
+}
+
+// DecisionRank orders decisions by restrictiveness; higher is stricter, unknown is -1.
+func DecisionRank(d string) int {
+	if r, ok := decisionRank[d]; ok {
+		return r
+	}
+	return -1
+}
+
+// DecisionAllows reports whether the caller may proceed (possibly with transformed text).
+func DecisionAllows(d string) bool {
+	return d == DecisionAllow || d == DecisionMark || d == DecisionRedact
+}
+
 // GuardrailResult captures prompt firewall decisions.
 type GuardrailResult struct {
-	Allowed bool     `json:"allowed"`
-	Reason  string   `json:"reason"`
-	Signals []string `json:"signals"`
+	Allowed bool          `json:"allowed"`
+	Reason  string        `json:"reason"`
+	Signals []string      `json:"signals"`
+	Stages  []StageResult `json:"stages,omitempty"` // per-stage trace of the evaluation pipeline
+	// Decision refines Allowed; empty means block when !Allowed, else mark/allow by Reason.
+	Decision        string `json:"decision,omitempty"`
+	TransformedText string `json:"transformed_text,omitempty"` // redact: text with masked spans
+	Response        string `json:"response,omitempty"`         // deflect: canned reply; confirm: challenge text
+	ConfirmToken    string `json:"confirm_token,omitempty"`    // confirm: echo back to proceed
+	// Degraded lists stages that failed to decide during this evaluation.
+	Degraded []string `json:"degraded,omitempty"`
+	// Rules lists matched policy rules, effective rule first.
+	Rules []RuleMatch `json:"rules,omitempty"`
+	// Findings are the spans detectors flagged; Signals keeps the legacy strings.
+	Findings []Finding `json:"findings,omitempty"`
+	// Session is the multi-turn session state after this evaluation, when a session was given.
+	Session *SessionState `json:"session,omitempty"`
+	// Grounding is the per-sentence support of an output by its context, when context was given.
+	Grounding *GroundingReport `json:"grounding,omitempty"`
+}
+
+// Finding categories.
+const (
+	CategoryPII          = "pii"
+	CategorySecret       = "secret"
+	CategoryFinancial    = "financial"
+	CategoryConfidential = "confidential"
+	CategoryInjection    = "injection"
+	CategoryKeyword      = "keyword"
+	CategoryPolicy       = "policy"
+	CategoryModeration   = "moderation"
+	CategoryGrounding    = "grounding"
+)
+
+// LLMConfidence is reported for LLM verdicts, which carry no score of their own.
+const LLMConfidence = 0.8
+
+// Finding is one span a detector flagged. Start and End are byte offsets into the
+// text the detector evaluated; the matched text is only exposed as a hash.
+type Finding struct {
+	Detector   string  `json:"detector"`
+	Category   string  `json:"category"`
+	Start      int     `json:"start"`
+	End        int     `json:"end"`
+	Hash       string  `json:"hash"` // hex sha256 of the matched text
+	Confidence float64 `json:"confidence"`
+	RuleID     string  `json:"rule_id,omitempty"`
+}
+
+// NewFinding builds a Finding for text[start:end].
+func NewFinding(detector, category, text string, start, end int, confidence float64, ruleID string) Finding {
+	sum := sha256.Sum256([]byte(text[start:end]))
+	return Finding{
+		Detector:   detector,
+		Category:   category,
+		Start:      start,
+		End:        end,
+		Hash:       hex.EncodeToString(sum[:]),
+		Confidence: confidence,
+		RuleID:     ruleID,
+	}
+}
+
+// RuleMatch is one policy rule that matched the evaluated text.
+type RuleMatch struct {
+	RuleID   string   `json:"rule_id"`
+	RuleName string   `json:"rule_name"`
+	Decision string   `json:"decision"`
+	Severity string   `json:"severity"`
+	Reason   string   `json:"reason,omitempty"`
+	Signals  []string `json:"signals,omitempty"`
+	Response string   `json:"response,omitempty"`
+}
+
+// EffectiveDecision returns Decision, inferring it from Allowed and Reason when unset.
+func (r GuardrailResult) EffectiveDecision() string {
+	switch {
+	case r.Decision != "":
+		return r.Decision
+	case !r.Allowed:
+		return DecisionBlock
+	case r.Reason != "":
+		return DecisionMark
+	}
+	return DecisionAllow
+}
+
+// StageResult records one pipeline stage's outcome and latency.
+type StageResult struct {
+	Name       string  `json:"name"`
+	Allowed    bool    `json:"allowed"`
+	Reason     string  `json:"reason,omitempty"`
+	Decision   string  `json:"decision,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// SessionState is the rolling state of a multi-turn conversation. Only
+// verdicts are kept; the text of earlier turns is never stored.
+type SessionState struct {
+	ID         string         `json:"id"`
+	Turns      int            `json:"turns"`
+	Risk       float64        `json:"risk"`                    // decayed sum of per-turn risk
+	NearMisses int            `json:"near_misses"`             // turns that scored close to a detector threshold
+	Topics     map[string]int `json:"topics,omitempty"`        // drift topic -> turns that touched it
+	Flagged    []SessionTurn  `json:"flagged_turns,omitempty"` // most recent flagged turns, oldest first
+	UpdatedAt  time.Time      `json:"updated_at"`
+}
+
+// SessionTurn summarizes one flagged turn of a session.
+type SessionTurn struct {
+	Turn     int       `json:"turn"`
+	Kind     string    `json:"kind"`
+	Decision string    `json:"decision"`
+	Reason   string    `json:"reason,omitempty"`
+	Risk     float64   `json:"risk"`
+	Signals  []string  `json:"signals,omitempty"`
+	At       time.Time `json:"at"`
+}
+
+// GroundingReport is how well an output is supported by the context it was
+// generated from. Sentence offsets are byte offsets into the evaluated output.
+type GroundingReport struct {
+	Support             float64           `json:"support"` // mean support of the claims; 1 when there are none
+	Claims              int               `json:"claims"`
+	Unsupported         int               `json:"unsupported"`
+	FabricatedCitations []string          `json:"fabricated_citations,omitempty"`
+	JudgeDegraded       bool              `json:"judge_degraded,omitempty"` // the LLM judge failed; heuristic verdicts stand
+	Sentences           []SentenceSupport `json:"sentences"`
+}
+
+// SentenceSupport is the support of one output sentence. Sentences that make
+// no claim, such as questions, are listed without scores.
+type SentenceSupport struct {
+	Start     int      `json:"start"`
+	End       int      `json:"end"`
+	Claim     bool     `json:"claim"`
+	Lexical   float64  `json:"lexical"`
+	Semantic  float64  `json:"semantic"`
+	Support   float64  `json:"support"`
+	Supported bool     `json:"supported"`
+	Source    string   `json:"source,omitempty"` // best supporting context document
+	Judge     string   `json:"judge,omitempty"`  // supported | unsupported, when the LLM judge ruled
+	Citations []string `json:"citations,omitempty"`
+	Signals   []string `json:"signals,omitempty"`
 }
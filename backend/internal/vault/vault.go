@@ -0,0 +1,205 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"aiguardrails/internal/policy"
+)
+
+// ErrSessionRequired is returned when deanonymizing without a session.
+var ErrSessionRequired = errors.New("session_id required")
+
+// Vault replaces PII with stable placeholders such as <EMAIL_1> and restores
+// them later. Mappings are scoped per tenant and session and live in one Redis
+// hash that expires ttl after its last use.
+type Vault struct {
+	redis *redis.Client
+	ns    string
+	ttl   time.Duration
+}
+
+// New constructs a Vault.
+func New(client *redis.Client, namespace string, ttl time.Duration) *Vault {
+	return &Vault{redis: client, ns: namespace, ttl: ttl}
+}
+
+// Entity is one value replaced by a placeholder; offsets refer to the input text.
+type Entity struct {
+	Placeholder string `json:"placeholder"`
+	Category    string `json:"category"`
+	Rule        string `json:"rule"`
+	Start       int    `json:"start"`
+	End         int    `json:"end"`
+}
+
+// Result is the anonymized text and the session holding its mapping.
+type Result struct {
+	SessionID string   `json:"session_id"`
+	Text      string   `json:"text"`
+	Entities  []Entity `json:"entities"`
+}
+
+// placeholderRe matches placeholders produced by the vault.
+var placeholderRe = regexp.MustCompile(`<[A-Z][A-Z0-9_]*_\d+>`)
+
+// maxPlaceholderLen bounds a placeholder; streams hold back at most this much.
+const maxPlaceholderLen = 48
+
+// assignScript returns the placeholder of each (label, value) pair, allocating
+// the next number for the label when the value is new to the session.
+var assignScript = redis.NewScript(`
+local out = {}
+for i = 2, #ARGV, 2 do
+  local label, value = ARGV[i], ARGV[i + 1]
+  local ph = redis.call('HGET', KEYS[1], 'v:' .. value)
+  if not ph then
+    local n = redis.call('HINCRBY', KEYS[1], 'n:' .. label, 1)
+    ph = '<' .. label .. '_' .. n .. '>'
+    redis.call('HSET', KEYS[1], 'v:' .. value, ph, 'p:' .. ph, value)
+  end
+  out[#out + 1] = ph
+end
+redis.call('PEXPIRE', KEYS[1], ARGV[1])
+return out
+`)
+
+func (v *Vault) key(tenantID, sessionID string) string {
+	prefix := "vault"
+	if v.ns != "" {
+		prefix = v.ns + ":" + prefix
+	}
+	return fmt.Sprintf("%s:%s:%s", prefix, tenantID, sessionID)
+}
+
+// label names the placeholder of a recognizer rule, e.g. cn_id -> CN_ID.
+func label(rule string) string {
+	if rule == "custom_term" {
+		return "TERM"
+	}
+	return strings.ToUpper(rule)
+}
+
+// Anonymize replaces what recs and the tenant's custom terms find in text with
+// placeholders. An empty sessionID starts a new session. Dictionary words
+// ("passport", "iban") carry no value and are left in place.
+func (v *Vault) Anonymize(ctx context.Context, tenantID, sessionID, text string, recs []*policy.Recognizer, terms []string) (Result, error) {
+	if sessionID == "" {
+		sessionID = uuid.NewString()
+	}
+	res := Result{SessionID: sessionID, Text: text}
+	var spans []policy.DLPSpan
+	pos := 0
+	for _, sp := range policy.FindDLPSpansWith(text, terms, recs) {
+		if sp.Rule == "dictionary" || sp.Start < pos {
+			continue
+		}
+		spans = append(spans, sp)
+		pos = sp.End
+	}
+	if len(spans) == 0 {
+		return res, nil
+	}
+	args := []interface{}{v.ttl.Milliseconds()}
+	for _, sp := range spans {
+		args = append(args, label(sp.Rule), sp.Text)
+	}
+	out, err := assignScript.Run(ctx, v.redis, []string{v.key(tenantID, sessionID)}, args...).StringSlice()
+	if err != nil {
+		return res, err
+	}
+	var b strings.Builder
+	pos = 0
+	for i, sp := range spans {
+		b.WriteString(text[pos:sp.Start])
+		b.WriteString(out[i])
+		pos = sp.End
+		res.Entities = append(res.Entities, Entity{Placeholder: out[i], Category: sp.Category, Rule: sp.Rule, Start: sp.Start, End: sp.End})
+	}
+	b.WriteString(text[pos:])
+	res.Text = b.String()
+	return res, nil
+}
+
+// Mapping returns the session's placeholder -> value mapping and extends its TTL.
+func (v *Vault) Mapping(ctx context.Context, tenantID, sessionID string) (map[string]string, error) {
+	if sessionID == "" {
+		return nil, ErrSessionRequired
+	}
+	key := v.key(tenantID, sessionID)
+	all, err := v.redis.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]string{}
+	for field, value := range all {
+		if strings.HasPrefix(field, "p:") {
+			out[field[2:]] = value
+		}
+	}
+	if len(out) > 0 {
+		v.redis.PExpire(ctx, key, v.ttl)
+	}
+	return out, nil
+}
+
+// Deanonymize restores the session's placeholders in text. Unknown
+// placeholders, including those of other tenants or sessions, are left as is.
+func (v *Vault) Deanonymize(ctx context.Context, tenantID, sessionID, text string) (string, error) {
+	mapping, err := v.Mapping(ctx, tenantID, sessionID)
+	if err != nil {
+		return text, err
+	}
+	return Restore(text, mapping), nil
+}
+
+// Restore replaces known placeholders in text with their values.
+func Restore(text string, mapping map[string]string) string {
+	if len(mapping) == 0 {
+		return text
+	}
+	return placeholderRe.ReplaceAllStringFunc(text, func(ph string) string {
+		if v, ok := mapping[ph]; ok {
+			return v
+		}
+		return ph
+	})
+}
+
+// StreamRestorer restores placeholders in a token stream, holding back a
+// trailing "<..." until it is known whether it completes a placeholder.
+type StreamRestorer struct {
+	mapping map[string]string
+	pending string
+}
+
+// NewStreamRestorer constructs a StreamRestorer for mapping.
+func NewStreamRestorer(mapping map[string]string) *StreamRestorer {
+	return &StreamRestorer{mapping: mapping}
+}
+
+// Write consumes a chunk and returns the restored text that is safe to emit.
+func (r *StreamRestorer) Write(chunk string) string {
+	r.pending += chunk
+	cut := len(r.pending)
+	if i := strings.LastIndexByte(r.pending, '<'); i >= 0 && !strings.Contains(r.pending[i:], ">") && len(r.pending)-i < maxPlaceholderLen {
+		cut = i
+	}
+	out := Restore(r.pending[:cut], r.mapping)
+	r.pending = r.pending[cut:]
+	return out
+}
+
+// Flush returns whatever is held back.
+func (r *StreamRestorer) Flush() string {
+	out := Restore(r.pending, r.mapping)
+	r.pending = ""
+	return out
+}
@@ -0,0 +1,95 @@
+package vault
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	miniredis "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"aiguardrails/internal/policy"
+)
+
+func newTestVault(t *testing.T) (*Vault, *miniredis.Miniredis) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	return New(client, "testns", time.Hour), mr
+}
+
+func TestVaultRoundTrip(t *testing.T) {
+	v, mr := newTestVault(t)
+	ctx := context.Background()
+	recs := policy.SelectRecognizers([]string{"pii", "financial"})
+	text := "张三 身份证 11010519491231002X，邮箱 ops@example.com"
+
+	res, err := v.Anonymize(ctx, "t1", "s1", text, recs, []string{"张三"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<TERM_1> 身份证 <CN_ID_1>，邮箱 <EMAIL_1>"
+	if res.Text != want || len(res.Entities) != 3 {
+		t.Fatalf("got %q %+v", res.Text, res.Entities)
+	}
+	if e := res.Entities[1]; text[e.Start:e.End] != "11010519491231002X" || e.Category != "pii" {
+		t.Fatalf("unexpected entity: %+v", e)
+	}
+
+	// The same value keeps its placeholder within the session; new values count on.
+	again, err := v.Anonymize(ctx, "t1", "s1", "ops@example.com and dev@example.com", recs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Text != "<EMAIL_1> and <EMAIL_2>" {
+		t.Fatalf("placeholders not stable: %q", again.Text)
+	}
+
+	got, err := v.Deanonymize(ctx, "t1", "s1", "Dear <TERM_1>, we mailed <EMAIL_2>. <EMAIL_9>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "Dear 张三, we mailed dev@example.com. <EMAIL_9>" {
+		t.Fatalf("unexpected restore: %q", got)
+	}
+
+	// Other tenants and sessions cannot resolve the placeholders.
+	for _, scope := range [][2]string{{"t2", "s1"}, {"t1", "s2"}} {
+		if got, _ := v.Deanonymize(ctx, scope[0], scope[1], "<EMAIL_1>"); got != "<EMAIL_1>" {
+			t.Fatalf("%v resolved a foreign placeholder: %q", scope, got)
+		}
+	}
+	if ttl := mr.TTL("testns:vault:t1:s1"); ttl <= 0 || ttl > time.Hour {
+		t.Fatalf("expected session ttl, got %v", ttl)
+	}
+	if _, err := v.Deanonymize(ctx, "t1", "", "x"); err != ErrSessionRequired {
+		t.Fatalf("expected ErrSessionRequired, got %v", err)
+	}
+}
+
+func TestAnonymizeStartsSession(t *testing.T) {
+	v, _ := newTestVault(t)
+	res, err := v.Anonymize(context.Background(), "t1", "", "no pii here", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.SessionID == "" || res.Text != "no pii here" || len(res.Entities) != 0 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+}
+
+func TestStreamRestorerSplitPlaceholder(t *testing.T) {
+	r := NewStreamRestorer(map[string]string{"<EMAIL_1>": "ops@example.com"})
+	var b strings.Builder
+	for _, chunk := range []string{"mail <EM", "AIL_", "1> now, 1 < 2", " ok <"} {
+		b.WriteString(r.Write(chunk))
+	}
+	b.WriteString(r.Flush())
+	if got := b.String(); got != "mail ops@example.com now, 1 < 2 ok <" {
+		t.Fatalf("unexpected stream: %q", got)
+	}
+}
@@ -0,0 +1,17 @@
+-- Upstream LLM endpoints for the guarded proxy (/v1/chat/completions)
+
+CREATE TABLE IF NOT EXISTS proxy_upstreams (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL,
+    app_id UUID,                         -- NULL = tenant-wide default
+    base_url TEXT NOT NULL,              -- e.g. https://api.openai.com/v1
+    api_key TEXT,
+    model VARCHAR(100),                  -- optional model override
+    timeout_sec INT DEFAULT 0,           -- 0 = use PROXY_TIMEOUT_SEC
+    enabled BOOLEAN DEFAULT true,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_proxy_upstreams_scope
+    ON proxy_upstreams(tenant_id, COALESCE(app_id, '00000000-0000-0000-0000-000000000000'::uuid));
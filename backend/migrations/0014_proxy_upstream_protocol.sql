@@ -0,0 +1,8 @@
+-- Wire protocol of each proxy upstream (openai | anthropic | ollama)
+
+ALTER TABLE proxy_upstreams ADD COLUMN IF NOT EXISTS protocol VARCHAR(20) NOT NULL DEFAULT 'openai';
+
+-- One upstream per (tenant, app, protocol)
+DROP INDEX IF EXISTS idx_proxy_upstreams_scope;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_proxy_upstreams_scope_protocol
+    ON proxy_upstreams(tenant_id, COALESCE(app_id, '00000000-0000-0000-0000-000000000000'::uuid), protocol);
@@ -0,0 +1,8 @@
+-- Detection pipeline template: per-tenant stage order and execution mode
+
+INSERT INTO rule_templates (id, name, rule_type, description, config_schema, default_config, tags) VALUES
+(gen_random_uuid(), 'detection_pipeline', 'pipeline', '检测流水线编排 - 定义各检测阶段顺序与执行模式',
+ '{"type":"object","properties":{"mode":{"type":"string","enum":["short_circuit","collect_all"]},"prompt":{"type":"array"},"output":{"type":"array"},"rag":{"type":"array"}}}',
+ '{"mode":"short_circuit","prompt":["opa","llm_rule","keyword"],"output":["opa","dlp"],"rag":["opa","keyword"]}',
+ ARRAY['pipeline', 'stage'])
+ON CONFLICT (name) DO NOTHING;
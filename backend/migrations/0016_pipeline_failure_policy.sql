@@ -0,0 +1,9 @@
+-- Detection pipeline: separate LLM moderation stage and per-stage failure policy
+
+UPDATE rule_templates
+SET description = '检测流水线编排 - 定义各检测阶段顺序、执行模式与故障策略',
+    config_schema = jsonb_set(jsonb_set(config_schema,
+        '{properties,on_failure}', '{"type":"string","enum":["fail_open","fail_closed","mark"]}'::jsonb),
+        '{properties,failure}', '{"type":"object","additionalProperties":{"type":"string","enum":["fail_open","fail_closed","mark"]}}'::jsonb),
+    default_config = '{"mode":"short_circuit","on_failure":"fail_open","prompt":["opa","llm_rule","keyword"],"output":["opa","dlp","llm_moderation"],"rag":["opa","keyword"]}'
+WHERE name = 'detection_pipeline';
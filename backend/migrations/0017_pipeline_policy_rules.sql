@@ -0,0 +1,5 @@
+-- Detection pipeline: evaluate attached platform policy rules (conditions/actions)
+
+UPDATE rule_templates
+SET default_config = '{"mode":"short_circuit","on_failure":"fail_open","prompt":["opa","policy_rules","llm_rule","keyword"],"output":["opa","policy_rules","dlp","llm_moderation"],"rag":["opa","policy_rules","keyword"]}'
+WHERE name = 'detection_pipeline';
@@ -0,0 +1,5 @@
+-- Detection pipeline: per-tenant prompt-injection score threshold
+
+UPDATE rule_templates
+SET config_schema = jsonb_set(config_schema, '{properties,injection_threshold}', '{"type":"number","minimum":0,"maximum":1}'::jsonb)
+WHERE name = 'detection_pipeline';
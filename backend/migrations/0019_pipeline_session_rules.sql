@@ -0,0 +1,5 @@
+-- Detection pipeline: multi-turn session guard rules
+
+UPDATE rule_templates
+SET config_schema = jsonb_set(config_schema, '{properties,session}', '{"type":"object","properties":{"max_risk":{"type":"number","minimum":0},"decay":{"type":"number","minimum":0,"maximum":1},"max_near_misses":{"type":"integer","minimum":0},"near_miss_ratio":{"type":"number","minimum":0,"maximum":1},"drift_topics":{"type":"object","additionalProperties":{"type":"array","items":{"type":"string"}}},"max_drift_turns":{"type":"integer","minimum":0},"decision":{"type":"string","enum":["block","confirm"]}}}'::jsonb)
+WHERE name = 'detection_pipeline';
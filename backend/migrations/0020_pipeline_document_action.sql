@@ -0,0 +1,5 @@
+-- Detection pipeline: action for retrieved documents carrying indirect prompt injection
+
+UPDATE rule_templates
+SET config_schema = jsonb_set(config_schema, '{properties,document_action}', '{"type":"string","enum":["drop","quarantine"]}'::jsonb)
+WHERE name = 'detection_pipeline';
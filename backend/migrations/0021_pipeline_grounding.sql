@@ -0,0 +1,5 @@
+-- Detection pipeline: grounding of outputs against their context documents
+
+UPDATE rule_templates
+SET config_schema = jsonb_set(config_schema, '{properties,grounding}', '{"type":"object","properties":{"min_support":{"type":"number","minimum":0,"maximum":1},"max_unsupported":{"type":"number","minimum":0,"maximum":1},"decision":{"type":"string","enum":["mark","block"]},"llm_judge":{"type":"boolean"}}}'::jsonb)
+WHERE name = 'detection_pipeline';
@@ -0,0 +1,8 @@
+-- Agent tool argument rules: tenant rule type agent_tools and its template
+
+INSERT INTO rule_templates (id, name, rule_type, description, config_schema, default_config, tags) VALUES
+(gen_random_uuid(), 'agent_tool_args', 'agent_tools', '智能体工具参数策略 - 按工具名约束调用参数、禁止访问的路径与主机',
+ '{"type":"object","properties":{"tools":{"type":"object","additionalProperties":{"type":"object","properties":{"args":{"type":"object","additionalProperties":{"type":"object","properties":{"min":{"type":"number"},"max":{"type":"number"},"pattern":{"type":"string"},"deny_pattern":{"type":"string"},"max_length":{"type":"integer","minimum":0}}}},"forbidden_paths":{"type":"array","items":{"type":"string"}},"forbidden_hosts":{"type":"array","items":{"type":"string"}}}}}}}',
+ '{"tools":{"*":{"forbidden_paths":["/etc","~/.ssh",".."]}}}',
+ ARRAY['agent', 'tools'])
+ON CONFLICT (name) DO NOTHING;
@@ -0,0 +1,28 @@
+-- Agent tool calls awaiting human approval; the suspended run resumes or aborts once resolved
+
+CREATE TABLE IF NOT EXISTS agent_approvals (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    run_id UUID NOT NULL,
+    tenant_id UUID NOT NULL,
+    app_id UUID,                             -- NULL when not run by an app
+    requester TEXT NOT NULL DEFAULT '',      -- app that ran the agent; may not approve
+    tool TEXT NOT NULL,
+    args JSONB NOT NULL DEFAULT '{}'::jsonb,
+    reason TEXT NOT NULL DEFAULT '',
+    signals JSONB NOT NULL DEFAULT '[]'::jsonb,
+    approvers INT NOT NULL DEFAULT 1,        -- distinct approvals needed
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending | approved | denied | expired
+    decisions JSONB NOT NULL DEFAULT '[]'::jsonb,
+    run JSONB,                               -- suspended run state
+    outcome JSONB,                           -- result of the resumed or aborted run
+    version INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    resolved_at TIMESTAMPTZ,
+    resumed_at TIMESTAMPTZ                   -- when a resume of the run last started
+);
+
+CREATE INDEX IF NOT EXISTS idx_agent_approvals_tenant_status ON agent_approvals(tenant_id, status, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_agent_approvals_run ON agent_approvals(run_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_agent_approvals_due ON agent_approvals(expires_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_agent_approvals_unresumed ON agent_approvals(resolved_at) WHERE status <> 'pending' AND outcome IS NULL;
@@ -0,0 +1,8 @@
+-- Agent HTTP tool egress allowlist: tenant rule type agent_egress and its template
+
+INSERT INTO rule_templates (id, name, rule_type, description, config_schema, default_config, tags) VALUES
+(gen_random_uuid(), 'agent_egress_allowlist', 'agent_egress', '智能体出站白名单 - HTTP 工具可访问的域名、IP 或 CIDR',
+ '{"type":"object","properties":{"hosts":{"type":"array","items":{"type":"string"}}}}',
+ '{"hosts":[]}',
+ ARRAY['agent', 'egress'])
+ON CONFLICT (name) DO NOTHING;
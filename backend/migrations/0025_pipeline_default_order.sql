@@ -0,0 +1,8 @@
+-- Detection pipeline: template stage orders follow the built-in defaults, tenant rules included
+
+UPDATE rule_templates
+SET default_config = jsonb_set(jsonb_set(jsonb_set(default_config,
+        '{prompt}', '["session","opa","policy_rules","tenant_rules","llm_rule","keyword"]'::jsonb),
+        '{output}', '["session","opa","policy_rules","tenant_rules","grounding","dlp","llm_moderation"]'::jsonb),
+        '{rag}', '["opa","policy_rules","tenant_rules","keyword"]'::jsonb)
+WHERE name = 'detection_pipeline';
@@ -42,6 +42,28 @@ deny_reason[msg] {
   msg := {"allow": false, "reason": "opa_agent_cross_tenant_tool", "signals": [input.tool_tenant, input.tenantId]}
 }
 
+# Agent tool arguments: no path traversal
+deny_reason[msg] {
+  input.mode == "agent_tool"
+  walk(input.args, [path, value])
+  is_string(value)
+  regex.match(`(^|[/\\])\.\.([/\\]|$)`, value)
+  msg := {"allow": false, "reason": "opa_agent_tool_path_traversal", "signals": [agent_arg_path(path)]}
+}
+
+# Agent tool arguments: no URLs to loopback, private or link-local (cloud metadata) addresses
+deny_reason[msg] {
+  input.mode == "agent_tool"
+  walk(input.args, [path, value])
+  is_string(value)
+  regex.match(`(?i)^[a-z][a-z0-9+.-]*://(localhost([:/?#]|$)|127\.|10\.|192\.168\.|169\.254\.|172\.(1[6-9]|2[0-9]|3[01])\.|\[::1\]|0\.0\.0\.0)`, value)
+  msg := {"allow": false, "reason": "opa_agent_tool_private_url", "signals": [agent_arg_path(path)]}
+}
+
+agent_arg_path(path) = p {
+  p := concat(".", [sprintf("%v", [k]) | k := path[_]])
+}
+
 # MCP provider allowlist
 deny_reason[msg] {
   input.mode == "mcp_call"
@@ -19,9 +19,18 @@ deny_reason[msg] {
   msg := {"allow": false, "reason": "opa_block_output", "signals": [ban]}
 }
 
+# Same check on normalized variants (decoded payloads, de-obfuscated text)
+deny_reason[msg] {
+  v := input.variants[_]
+  lv := lower(v.text)
+  ban := banned[_]
+  contains(lv, ban)
+  msg := {"allow": false, "reason": "opa_block_normalized", "signals": [ban, sprintf("normalized:%s", [v.transform])]}
+}
+
 # Adapter: Support simple deny[msg] rules from dynamic store
 deny_reason[msg] {
-    reason := deny[_]
+    reason := data.guardrails.deny[_]
     msg := {"allow": false, "reason": "opa_block", "signals": [reason]}
 }
 
@@ -176,6 +176,28 @@ deny_reason[msg] {
   }
 }
 
+# ===== 智能体工具调用审批 =====
+
+# 智能体调用需确认的工具时挂起运行，等待人工审批；需MFA或控制级（min_level >= 3）以上的操作需两名审批人
+agent_approval = approval {
+  input.mode == "agent_tool"
+  tool_perm := tool_permissions[input.tool]
+  tool_perm.requires_confirmation == true
+  approval := {
+    "approvers": agent_approvers(tool_perm),
+    "reason": "approval_required",
+    "signals": [input.tool, sprintf("requires_level_%d", [tool_perm.min_level])]
+  }
+}
+
+agent_approvers(tool_perm) = 2 {
+  tool_perm.requires_mfa == true
+} else = 2 {
+  tool_perm.min_level >= 3
+} else = 1 {
+  true
+}
+
 # ===== 租户隔离 =====
 
 # 跨租户操作检查
@@ -0,0 +1,76 @@
+package guardrails
+
+# ===== RAG 文档级访问控制 =====
+# mode: rag_doc，由 rag-check 对每次检索调用一次（查询 data.guardrails.rag_doc_deny）
+# input.subject:   {"user_id", "roles", "groups", "departments", "labels"}
+# input.documents: [{"index", "id", "namespace", "sensitivity", "metadata", "acl": {"owner", "users", "groups", "departments", "roles", "labels"}}]
+# 每条拒绝输出 {"index", "reason", "signals"}；未被拒绝的文档可返回给用户
+
+rag_doc_deny[msg] {
+  input.mode == "rag_doc"
+  doc := input.documents[_]
+  label := doc.acl.labels[_]
+  not rag_doc_has_label(label)
+  msg := {"index": doc.index, "reason": "acl_label_missing", "signals": [sprintf("label:%s", [label])]}
+}
+
+rag_doc_deny[msg] {
+  input.mode == "rag_doc"
+  doc := input.documents[_]
+  rag_doc_restricted(doc.acl)
+  not rag_doc_granted(doc.acl)
+  msg := {"index": doc.index, "reason": "acl_denied", "signals": [sprintf("subject:%s", [rag_doc_subject])]}
+}
+
+rag_doc_has_label(label) {
+  lower(input.subject.labels[_]) == lower(label)
+}
+
+# 文档指定了所有者、用户、组、部门或角色之一即为受限文档
+rag_doc_restricted(acl) {
+  acl.owner != ""
+}
+
+rag_doc_restricted(acl) {
+  count(acl.users) > 0
+}
+
+rag_doc_restricted(acl) {
+  count(acl.groups) > 0
+}
+
+rag_doc_restricted(acl) {
+  count(acl.departments) > 0
+}
+
+rag_doc_restricted(acl) {
+  count(acl.roles) > 0
+}
+
+rag_doc_granted(acl) {
+  input.subject.user_id != ""
+  lower(acl.owner) == lower(input.subject.user_id)
+}
+
+rag_doc_granted(acl) {
+  input.subject.user_id != ""
+  lower(acl.users[_]) == lower(input.subject.user_id)
+}
+
+rag_doc_granted(acl) {
+  lower(acl.groups[_]) == lower(input.subject.groups[_])
+}
+
+rag_doc_granted(acl) {
+  lower(acl.departments[_]) == lower(input.subject.departments[_])
+}
+
+rag_doc_granted(acl) {
+  lower(acl.roles[_]) == lower(input.subject.roles[_])
+}
+
+default rag_doc_subject = "anonymous"
+
+rag_doc_subject = input.subject.user_id {
+  input.subject.user_id != ""
+}